@@ -1,13 +1,16 @@
 package main
 
 import (
+	"errors"
 	"flag"
 	"log"
 	"os"
 	"os/signal"
 	"syscall"
 
+	"github.com/mooncorn/nodelink/agent/pkg/credentials"
 	"github.com/mooncorn/nodelink/agent/pkg/grpc"
+	"github.com/mooncorn/nodelink/agent/pkg/labels"
 )
 
 // Set during build time
@@ -18,6 +21,14 @@ var (
 
 func main() {
 	address := flag.String("address", ServerAddress, "gRPC server address")
+	credentialsPath := flag.String("credentials", credentials.DefaultPath, "File holding credentials obtained by enrolling or rotation")
+	insecure := flag.Bool("insecure", false, "Connect without TLS, the default for localhost addresses without TLS options")
+	tlsCA := flag.String("tls-ca", os.Getenv("TLS_CA_FILE"), "CA for verifying the server, defaults to the system roots")
+	tlsCert := flag.String("tls-cert", os.Getenv("TLS_CERT_FILE"), "Client certificate for mutual TLS")
+	tlsKey := flag.String("tls-key", os.Getenv("TLS_KEY_FILE"), "Client private key for mutual TLS")
+	tlsServerName := flag.String("tls-server-name", "", "Override the server name checked against its certificate")
+	labelList := flag.String("labels", os.Getenv("AGENT_LABELS"), "Labels to declare to the server, e.g. env=prod,role=db")
+	labelsFile := flag.String("labels-file", os.Getenv("AGENT_LABELS_FILE"), "File with one key=value label per line; -labels take precedence")
 	version := flag.Bool("version", false, "Print version and exit")
 	flag.Parse()
 
@@ -26,27 +37,44 @@ func main() {
 		os.Exit(0)
 	}
 
-	// Get agentID from environment variable
-	agentID := os.Getenv("AGENT_ID")
-	if agentID == "" {
-		log.Fatal("AGENT_ID environment variable is required")
-	}
+	log.Printf("Starting Agent (version %s)...", Version)
 
-	// Get agentToken from environment variable
-	agentToken := os.Getenv("AGENT_TOKEN")
-	if agentToken == "" {
-		log.Fatal("AGENT_TOKEN environment variable is required")
+	tlsOptions := grpc.TLSOptions{
+		Insecure:   *insecure,
+		CAFile:     *tlsCA,
+		CertFile:   *tlsCert,
+		KeyFile:    *tlsKey,
+		ServerName: *tlsServerName,
 	}
 
-	log.Printf("Starting Agent (version %s)...", Version)
+	transport, err := grpc.TransportCredentials(*address, tlsOptions)
+	if err != nil {
+		log.Fatalf("Failed to configure transport security: %v", err)
+	}
 
 	// Create grpc client
-	client, err := grpc.NewStreamClient(*address)
+	client, err := grpc.NewStreamClient(*address, transport)
 	if err != nil {
 		log.Fatalf("Failed to create grpc client: %v", err)
 	}
 	defer client.Close()
 
+	agentLabels, err := loadLabels(*labelsFile, *labelList)
+	if err != nil {
+		log.Fatalf("Invalid labels: %v", err)
+	}
+	if len(agentLabels) > 0 {
+		client.SetLabels(labels.Format(agentLabels))
+		log.Printf("Declaring labels %s", labels.Format(agentLabels))
+	}
+
+	agentID, agentToken := resolveCredentials(client, *credentialsPath, tlsOptions.HasClientCert())
+
+	// Rotated tokens are written to the credentials file so they survive restarts
+	client.SetCredentialsSaver(func(agentID, agentToken string) error {
+		return credentials.Save(*credentialsPath, &credentials.Credentials{AgentID: agentID, AgentToken: agentToken})
+	})
+
 	// Connect to the server
 	if err := client.Connect(agentID, agentToken); err != nil {
 		log.Fatalf("Failed to connect to grpc server: %v", err)
@@ -61,3 +89,73 @@ func main() {
 
 	log.Println("Agent shutting down...")
 }
+
+// resolveCredentials returns the agent's credentials, taken from the credentials
+// file, from the environment, or by enrolling with ENROLLMENT_TOKEN. With a client
+// certificate the server derives the agent ID from it, so none are needed.
+func resolveCredentials(client *grpc.StreamClient, path string, hasClientCert bool) (string, string) {
+	agentID := os.Getenv("AGENT_ID")
+	agentToken := os.Getenv("AGENT_TOKEN")
+
+	// The file holds the latest token, which may have been rotated since AGENT_TOKEN was set
+	creds, err := credentials.Load(path)
+	if err == nil && (agentID == "" || creds.AgentID == agentID) {
+		log.Printf("Loaded credentials for agent %s from %s", creds.AgentID, path)
+		return creds.AgentID, creds.AgentToken
+	}
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		log.Fatalf("Failed to load credentials: %v", err)
+	}
+
+	if agentID != "" && agentToken != "" {
+		return agentID, agentToken
+	}
+
+	enrollmentToken := os.Getenv("ENROLLMENT_TOKEN")
+	if enrollmentToken == "" {
+		if hasClientCert {
+			log.Println("Authenticating with client certificate")
+			return agentID, ""
+		}
+		log.Fatal("AGENT_ID and AGENT_TOKEN or ENROLLMENT_TOKEN environment variables are required")
+	}
+
+	hostname, _ := os.Hostname()
+
+	log.Println("Enrolling with server...")
+	agentID, agentToken, err = client.Enroll(enrollmentToken, agentID, hostname)
+	if err != nil {
+		log.Fatalf("Failed to enroll: %v", err)
+	}
+
+	// The enrollment token is spent, so losing these credentials means re-enrolling
+	if err := credentials.Save(path, &credentials.Credentials{AgentID: agentID, AgentToken: agentToken}); err != nil {
+		log.Fatalf("Failed to save credentials: %v", err)
+	}
+
+	log.Printf("Enrolled as agent %s, credentials saved to %s", agentID, path)
+	return agentID, agentToken
+}
+
+// loadLabels merges the labels from the labels file with those from the flag
+func loadLabels(path, list string) (map[string]string, error) {
+	agentLabels := make(map[string]string)
+
+	if path != "" {
+		fileLabels, err := labels.LoadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		agentLabels = fileLabels
+	}
+
+	flagLabels, err := labels.Parse(list)
+	if err != nil {
+		return nil, err
+	}
+	for key, value := range flagLabels {
+		agentLabels[key] = value
+	}
+
+	return agentLabels, nil
+}
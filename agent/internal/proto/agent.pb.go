@@ -21,6 +21,127 @@ const (
 	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
 )
 
+// Enrollment exchanges a one-time enrollment token for a long-lived agent credential
+type EnrollRequest struct {
+	state           protoimpl.MessageState `protogen:"open.v1"`
+	EnrollmentToken string                 `protobuf:"bytes,1,opt,name=enrollment_token,json=enrollmentToken,proto3" json:"enrollment_token,omitempty"`
+	AgentId         string                 `protobuf:"bytes,2,opt,name=agent_id,json=agentId,proto3" json:"agent_id,omitempty"` // requested agent ID, ignored if the token is bound to one
+	Hostname        string                 `protobuf:"bytes,3,opt,name=hostname,proto3" json:"hostname,omitempty"`
+	Nonce           string                 `protobuf:"bytes,4,opt,name=nonce,proto3" json:"nonce,omitempty"` // random per enrollment, retries repeat it to prove they come from the same agent
+	unknownFields   protoimpl.UnknownFields
+	sizeCache       protoimpl.SizeCache
+}
+
+func (x *EnrollRequest) Reset() {
+	*x = EnrollRequest{}
+	mi := &file_agent_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *EnrollRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*EnrollRequest) ProtoMessage() {}
+
+func (x *EnrollRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_agent_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use EnrollRequest.ProtoReflect.Descriptor instead.
+func (*EnrollRequest) Descriptor() ([]byte, []int) {
+	return file_agent_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *EnrollRequest) GetEnrollmentToken() string {
+	if x != nil {
+		return x.EnrollmentToken
+	}
+	return ""
+}
+
+func (x *EnrollRequest) GetAgentId() string {
+	if x != nil {
+		return x.AgentId
+	}
+	return ""
+}
+
+func (x *EnrollRequest) GetHostname() string {
+	if x != nil {
+		return x.Hostname
+	}
+	return ""
+}
+
+func (x *EnrollRequest) GetNonce() string {
+	if x != nil {
+		return x.Nonce
+	}
+	return ""
+}
+
+type EnrollResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	AgentId       string                 `protobuf:"bytes,1,opt,name=agent_id,json=agentId,proto3" json:"agent_id,omitempty"`
+	AgentToken    string                 `protobuf:"bytes,2,opt,name=agent_token,json=agentToken,proto3" json:"agent_token,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *EnrollResponse) Reset() {
+	*x = EnrollResponse{}
+	mi := &file_agent_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *EnrollResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*EnrollResponse) ProtoMessage() {}
+
+func (x *EnrollResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_agent_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use EnrollResponse.ProtoReflect.Descriptor instead.
+func (*EnrollResponse) Descriptor() ([]byte, []int) {
+	return file_agent_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *EnrollResponse) GetAgentId() string {
+	if x != nil {
+		return x.AgentId
+	}
+	return ""
+}
+
+func (x *EnrollResponse) GetAgentToken() string {
+	if x != nil {
+		return x.AgentToken
+	}
+	return ""
+}
+
 // Server to Agent messages
 type ServerMessage struct {
 	state protoimpl.MessageState `protogen:"open.v1"`
@@ -33,6 +154,13 @@ type ServerMessage struct {
 	//	*ServerMessage_TerminalCloseRequest
 	//	*ServerMessage_MetricsRequest
 	//	*ServerMessage_SystemInfoRequest
+	//	*ServerMessage_CredentialRotationRequest
+	//	*ServerMessage_CommandCancelRequest
+	//	*ServerMessage_TerminalResizeRequest
+	//	*ServerMessage_TerminalInput
+	//	*ServerMessage_TerminalSignalRequest
+	//	*ServerMessage_MetricsSubscribeRequest
+	//	*ServerMessage_MetricsUnsubscribeRequest
 	Message       isServerMessage_Message `protobuf_oneof:"message"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
@@ -40,7 +168,7 @@ type ServerMessage struct {
 
 func (x *ServerMessage) Reset() {
 	*x = ServerMessage{}
-	mi := &file_agent_proto_msgTypes[0]
+	mi := &file_agent_proto_msgTypes[2]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -52,7 +180,7 @@ func (x *ServerMessage) String() string {
 func (*ServerMessage) ProtoMessage() {}
 
 func (x *ServerMessage) ProtoReflect() protoreflect.Message {
-	mi := &file_agent_proto_msgTypes[0]
+	mi := &file_agent_proto_msgTypes[2]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -65,7 +193,7 @@ func (x *ServerMessage) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use ServerMessage.ProtoReflect.Descriptor instead.
 func (*ServerMessage) Descriptor() ([]byte, []int) {
-	return file_agent_proto_rawDescGZIP(), []int{0}
+	return file_agent_proto_rawDescGZIP(), []int{2}
 }
 
 func (x *ServerMessage) GetMessage() isServerMessage_Message {
@@ -138,6 +266,69 @@ func (x *ServerMessage) GetSystemInfoRequest() *SystemInfoRequest {
 	return nil
 }
 
+func (x *ServerMessage) GetCredentialRotationRequest() *CredentialRotationRequest {
+	if x != nil {
+		if x, ok := x.Message.(*ServerMessage_CredentialRotationRequest); ok {
+			return x.CredentialRotationRequest
+		}
+	}
+	return nil
+}
+
+func (x *ServerMessage) GetCommandCancelRequest() *CommandCancelRequest {
+	if x != nil {
+		if x, ok := x.Message.(*ServerMessage_CommandCancelRequest); ok {
+			return x.CommandCancelRequest
+		}
+	}
+	return nil
+}
+
+func (x *ServerMessage) GetTerminalResizeRequest() *TerminalResizeRequest {
+	if x != nil {
+		if x, ok := x.Message.(*ServerMessage_TerminalResizeRequest); ok {
+			return x.TerminalResizeRequest
+		}
+	}
+	return nil
+}
+
+func (x *ServerMessage) GetTerminalInput() *TerminalInput {
+	if x != nil {
+		if x, ok := x.Message.(*ServerMessage_TerminalInput); ok {
+			return x.TerminalInput
+		}
+	}
+	return nil
+}
+
+func (x *ServerMessage) GetTerminalSignalRequest() *TerminalSignalRequest {
+	if x != nil {
+		if x, ok := x.Message.(*ServerMessage_TerminalSignalRequest); ok {
+			return x.TerminalSignalRequest
+		}
+	}
+	return nil
+}
+
+func (x *ServerMessage) GetMetricsSubscribeRequest() *MetricsSubscribeRequest {
+	if x != nil {
+		if x, ok := x.Message.(*ServerMessage_MetricsSubscribeRequest); ok {
+			return x.MetricsSubscribeRequest
+		}
+	}
+	return nil
+}
+
+func (x *ServerMessage) GetMetricsUnsubscribeRequest() *MetricsUnsubscribeRequest {
+	if x != nil {
+		if x, ok := x.Message.(*ServerMessage_MetricsUnsubscribeRequest); ok {
+			return x.MetricsUnsubscribeRequest
+		}
+	}
+	return nil
+}
+
 type isServerMessage_Message interface {
 	isServerMessage_Message()
 }
@@ -170,6 +361,34 @@ type ServerMessage_SystemInfoRequest struct {
 	SystemInfoRequest *SystemInfoRequest `protobuf:"bytes,7,opt,name=system_info_request,json=systemInfoRequest,proto3,oneof"`
 }
 
+type ServerMessage_CredentialRotationRequest struct {
+	CredentialRotationRequest *CredentialRotationRequest `protobuf:"bytes,8,opt,name=credential_rotation_request,json=credentialRotationRequest,proto3,oneof"`
+}
+
+type ServerMessage_CommandCancelRequest struct {
+	CommandCancelRequest *CommandCancelRequest `protobuf:"bytes,9,opt,name=command_cancel_request,json=commandCancelRequest,proto3,oneof"`
+}
+
+type ServerMessage_TerminalResizeRequest struct {
+	TerminalResizeRequest *TerminalResizeRequest `protobuf:"bytes,10,opt,name=terminal_resize_request,json=terminalResizeRequest,proto3,oneof"`
+}
+
+type ServerMessage_TerminalInput struct {
+	TerminalInput *TerminalInput `protobuf:"bytes,11,opt,name=terminal_input,json=terminalInput,proto3,oneof"`
+}
+
+type ServerMessage_TerminalSignalRequest struct {
+	TerminalSignalRequest *TerminalSignalRequest `protobuf:"bytes,12,opt,name=terminal_signal_request,json=terminalSignalRequest,proto3,oneof"`
+}
+
+type ServerMessage_MetricsSubscribeRequest struct {
+	MetricsSubscribeRequest *MetricsSubscribeRequest `protobuf:"bytes,13,opt,name=metrics_subscribe_request,json=metricsSubscribeRequest,proto3,oneof"`
+}
+
+type ServerMessage_MetricsUnsubscribeRequest struct {
+	MetricsUnsubscribeRequest *MetricsUnsubscribeRequest `protobuf:"bytes,14,opt,name=metrics_unsubscribe_request,json=metricsUnsubscribeRequest,proto3,oneof"`
+}
+
 func (*ServerMessage_Ping) isServerMessage_Message() {}
 
 func (*ServerMessage_CommandRequest) isServerMessage_Message() {}
@@ -184,6 +403,20 @@ func (*ServerMessage_MetricsRequest) isServerMessage_Message() {}
 
 func (*ServerMessage_SystemInfoRequest) isServerMessage_Message() {}
 
+func (*ServerMessage_CredentialRotationRequest) isServerMessage_Message() {}
+
+func (*ServerMessage_CommandCancelRequest) isServerMessage_Message() {}
+
+func (*ServerMessage_TerminalResizeRequest) isServerMessage_Message() {}
+
+func (*ServerMessage_TerminalInput) isServerMessage_Message() {}
+
+func (*ServerMessage_TerminalSignalRequest) isServerMessage_Message() {}
+
+func (*ServerMessage_MetricsSubscribeRequest) isServerMessage_Message() {}
+
+func (*ServerMessage_MetricsUnsubscribeRequest) isServerMessage_Message() {}
+
 // Agent to Server messages
 type AgentMessage struct {
 	state protoimpl.MessageState `protogen:"open.v1"`
@@ -196,6 +429,14 @@ type AgentMessage struct {
 	//	*AgentMessage_TerminalCloseResponse
 	//	*AgentMessage_MetricsResponse
 	//	*AgentMessage_SystemInfoResponse
+	//	*AgentMessage_TerminalSessionsAnnouncement
+	//	*AgentMessage_CredentialRotationResponse
+	//	*AgentMessage_CommandOutput
+	//	*AgentMessage_CommandExit
+	//	*AgentMessage_CommandCancelResponse
+	//	*AgentMessage_TerminalOutput
+	//	*AgentMessage_MetricsSubscribeResponse
+	//	*AgentMessage_MetricsPush
 	Message       isAgentMessage_Message `protobuf_oneof:"message"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
@@ -203,7 +444,7 @@ type AgentMessage struct {
 
 func (x *AgentMessage) Reset() {
 	*x = AgentMessage{}
-	mi := &file_agent_proto_msgTypes[1]
+	mi := &file_agent_proto_msgTypes[3]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -215,7 +456,7 @@ func (x *AgentMessage) String() string {
 func (*AgentMessage) ProtoMessage() {}
 
 func (x *AgentMessage) ProtoReflect() protoreflect.Message {
-	mi := &file_agent_proto_msgTypes[1]
+	mi := &file_agent_proto_msgTypes[3]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -228,7 +469,7 @@ func (x *AgentMessage) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use AgentMessage.ProtoReflect.Descriptor instead.
 func (*AgentMessage) Descriptor() ([]byte, []int) {
-	return file_agent_proto_rawDescGZIP(), []int{1}
+	return file_agent_proto_rawDescGZIP(), []int{3}
 }
 
 func (x *AgentMessage) GetMessage() isAgentMessage_Message {
@@ -301,6 +542,78 @@ func (x *AgentMessage) GetSystemInfoResponse() *SystemInfoResponse {
 	return nil
 }
 
+func (x *AgentMessage) GetTerminalSessionsAnnouncement() *TerminalSessionsAnnouncement {
+	if x != nil {
+		if x, ok := x.Message.(*AgentMessage_TerminalSessionsAnnouncement); ok {
+			return x.TerminalSessionsAnnouncement
+		}
+	}
+	return nil
+}
+
+func (x *AgentMessage) GetCredentialRotationResponse() *CredentialRotationResponse {
+	if x != nil {
+		if x, ok := x.Message.(*AgentMessage_CredentialRotationResponse); ok {
+			return x.CredentialRotationResponse
+		}
+	}
+	return nil
+}
+
+func (x *AgentMessage) GetCommandOutput() *CommandOutput {
+	if x != nil {
+		if x, ok := x.Message.(*AgentMessage_CommandOutput); ok {
+			return x.CommandOutput
+		}
+	}
+	return nil
+}
+
+func (x *AgentMessage) GetCommandExit() *CommandExit {
+	if x != nil {
+		if x, ok := x.Message.(*AgentMessage_CommandExit); ok {
+			return x.CommandExit
+		}
+	}
+	return nil
+}
+
+func (x *AgentMessage) GetCommandCancelResponse() *CommandCancelResponse {
+	if x != nil {
+		if x, ok := x.Message.(*AgentMessage_CommandCancelResponse); ok {
+			return x.CommandCancelResponse
+		}
+	}
+	return nil
+}
+
+func (x *AgentMessage) GetTerminalOutput() *TerminalOutput {
+	if x != nil {
+		if x, ok := x.Message.(*AgentMessage_TerminalOutput); ok {
+			return x.TerminalOutput
+		}
+	}
+	return nil
+}
+
+func (x *AgentMessage) GetMetricsSubscribeResponse() *MetricsSubscribeResponse {
+	if x != nil {
+		if x, ok := x.Message.(*AgentMessage_MetricsSubscribeResponse); ok {
+			return x.MetricsSubscribeResponse
+		}
+	}
+	return nil
+}
+
+func (x *AgentMessage) GetMetricsPush() *MetricsPush {
+	if x != nil {
+		if x, ok := x.Message.(*AgentMessage_MetricsPush); ok {
+			return x.MetricsPush
+		}
+	}
+	return nil
+}
+
 type isAgentMessage_Message interface {
 	isAgentMessage_Message()
 }
@@ -333,6 +646,38 @@ type AgentMessage_SystemInfoResponse struct {
 	SystemInfoResponse *SystemInfoResponse `protobuf:"bytes,7,opt,name=system_info_response,json=systemInfoResponse,proto3,oneof"`
 }
 
+type AgentMessage_TerminalSessionsAnnouncement struct {
+	TerminalSessionsAnnouncement *TerminalSessionsAnnouncement `protobuf:"bytes,8,opt,name=terminal_sessions_announcement,json=terminalSessionsAnnouncement,proto3,oneof"`
+}
+
+type AgentMessage_CredentialRotationResponse struct {
+	CredentialRotationResponse *CredentialRotationResponse `protobuf:"bytes,9,opt,name=credential_rotation_response,json=credentialRotationResponse,proto3,oneof"`
+}
+
+type AgentMessage_CommandOutput struct {
+	CommandOutput *CommandOutput `protobuf:"bytes,10,opt,name=command_output,json=commandOutput,proto3,oneof"`
+}
+
+type AgentMessage_CommandExit struct {
+	CommandExit *CommandExit `protobuf:"bytes,11,opt,name=command_exit,json=commandExit,proto3,oneof"`
+}
+
+type AgentMessage_CommandCancelResponse struct {
+	CommandCancelResponse *CommandCancelResponse `protobuf:"bytes,12,opt,name=command_cancel_response,json=commandCancelResponse,proto3,oneof"`
+}
+
+type AgentMessage_TerminalOutput struct {
+	TerminalOutput *TerminalOutput `protobuf:"bytes,13,opt,name=terminal_output,json=terminalOutput,proto3,oneof"`
+}
+
+type AgentMessage_MetricsSubscribeResponse struct {
+	MetricsSubscribeResponse *MetricsSubscribeResponse `protobuf:"bytes,14,opt,name=metrics_subscribe_response,json=metricsSubscribeResponse,proto3,oneof"`
+}
+
+type AgentMessage_MetricsPush struct {
+	MetricsPush *MetricsPush `protobuf:"bytes,15,opt,name=metrics_push,json=metricsPush,proto3,oneof"`
+}
+
 func (*AgentMessage_Pong) isAgentMessage_Message() {}
 
 func (*AgentMessage_CommandResponse) isAgentMessage_Message() {}
@@ -347,7 +692,23 @@ func (*AgentMessage_MetricsResponse) isAgentMessage_Message() {}
 
 func (*AgentMessage_SystemInfoResponse) isAgentMessage_Message() {}
 
-// Ping/Pong messages for heartbeat
+func (*AgentMessage_TerminalSessionsAnnouncement) isAgentMessage_Message() {}
+
+func (*AgentMessage_CredentialRotationResponse) isAgentMessage_Message() {}
+
+func (*AgentMessage_CommandOutput) isAgentMessage_Message() {}
+
+func (*AgentMessage_CommandExit) isAgentMessage_Message() {}
+
+func (*AgentMessage_CommandCancelResponse) isAgentMessage_Message() {}
+
+func (*AgentMessage_TerminalOutput) isAgentMessage_Message() {}
+
+func (*AgentMessage_MetricsSubscribeResponse) isAgentMessage_Message() {}
+
+func (*AgentMessage_MetricsPush) isAgentMessage_Message() {}
+
+// Ping/Pong messages for heartbeat. Timestamps are Unix times in nanoseconds.
 type Ping struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
 	Timestamp     int64                  `protobuf:"varint,1,opt,name=timestamp,proto3" json:"timestamp,omitempty"`
@@ -357,7 +718,7 @@ type Ping struct {
 
 func (x *Ping) Reset() {
 	*x = Ping{}
-	mi := &file_agent_proto_msgTypes[2]
+	mi := &file_agent_proto_msgTypes[4]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -369,7 +730,7 @@ func (x *Ping) String() string {
 func (*Ping) ProtoMessage() {}
 
 func (x *Ping) ProtoReflect() protoreflect.Message {
-	mi := &file_agent_proto_msgTypes[2]
+	mi := &file_agent_proto_msgTypes[4]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -382,7 +743,7 @@ func (x *Ping) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use Ping.ProtoReflect.Descriptor instead.
 func (*Ping) Descriptor() ([]byte, []int) {
-	return file_agent_proto_rawDescGZIP(), []int{2}
+	return file_agent_proto_rawDescGZIP(), []int{4}
 }
 
 func (x *Ping) GetTimestamp() int64 {
@@ -395,14 +756,14 @@ func (x *Ping) GetTimestamp() int64 {
 type Pong struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
 	Timestamp     int64                  `protobuf:"varint,1,opt,name=timestamp,proto3" json:"timestamp,omitempty"`
-	PingTimestamp int64                  `protobuf:"varint,2,opt,name=ping_timestamp,json=pingTimestamp,proto3" json:"ping_timestamp,omitempty"`
+	PingTimestamp int64                  `protobuf:"varint,2,opt,name=ping_timestamp,json=pingTimestamp,proto3" json:"ping_timestamp,omitempty"` // the ping's timestamp echoed back, used for round-trip time
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
 
 func (x *Pong) Reset() {
 	*x = Pong{}
-	mi := &file_agent_proto_msgTypes[3]
+	mi := &file_agent_proto_msgTypes[5]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -414,7 +775,7 @@ func (x *Pong) String() string {
 func (*Pong) ProtoMessage() {}
 
 func (x *Pong) ProtoReflect() protoreflect.Message {
-	mi := &file_agent_proto_msgTypes[3]
+	mi := &file_agent_proto_msgTypes[5]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -427,7 +788,7 @@ func (x *Pong) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use Pong.ProtoReflect.Descriptor instead.
 func (*Pong) Descriptor() ([]byte, []int) {
-	return file_agent_proto_rawDescGZIP(), []int{3}
+	return file_agent_proto_rawDescGZIP(), []int{5}
 }
 
 func (x *Pong) GetTimestamp() int64 {
@@ -453,13 +814,14 @@ type CommandRequest struct {
 	Env            map[string]string      `protobuf:"bytes,4,rep,name=env,proto3" json:"env,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
 	WorkingDir     string                 `protobuf:"bytes,5,opt,name=working_dir,json=workingDir,proto3" json:"working_dir,omitempty"`
 	TimeoutSeconds int32                  `protobuf:"varint,6,opt,name=timeout_seconds,json=timeoutSeconds,proto3" json:"timeout_seconds,omitempty"`
+	Stream         bool                   `protobuf:"varint,7,opt,name=stream,proto3" json:"stream,omitempty"` // send output as CommandOutput chunks and a final CommandExit instead of a CommandResponse
 	unknownFields  protoimpl.UnknownFields
 	sizeCache      protoimpl.SizeCache
 }
 
 func (x *CommandRequest) Reset() {
 	*x = CommandRequest{}
-	mi := &file_agent_proto_msgTypes[4]
+	mi := &file_agent_proto_msgTypes[6]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -471,7 +833,7 @@ func (x *CommandRequest) String() string {
 func (*CommandRequest) ProtoMessage() {}
 
 func (x *CommandRequest) ProtoReflect() protoreflect.Message {
-	mi := &file_agent_proto_msgTypes[4]
+	mi := &file_agent_proto_msgTypes[6]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -484,7 +846,7 @@ func (x *CommandRequest) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use CommandRequest.ProtoReflect.Descriptor instead.
 func (*CommandRequest) Descriptor() ([]byte, []int) {
-	return file_agent_proto_rawDescGZIP(), []int{4}
+	return file_agent_proto_rawDescGZIP(), []int{6}
 }
 
 func (x *CommandRequest) GetRequestId() string {
@@ -529,6 +891,13 @@ func (x *CommandRequest) GetTimeoutSeconds() int32 {
 	return 0
 }
 
+func (x *CommandRequest) GetStream() bool {
+	if x != nil {
+		return x.Stream
+	}
+	return false
+}
+
 type CommandResponse struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
 	RequestId     string                 `protobuf:"bytes,1,opt,name=request_id,json=requestId,proto3" json:"request_id,omitempty"`
@@ -537,13 +906,14 @@ type CommandResponse struct {
 	Stderr        string                 `protobuf:"bytes,4,opt,name=stderr,proto3" json:"stderr,omitempty"`
 	Error         string                 `protobuf:"bytes,5,opt,name=error,proto3" json:"error,omitempty"`
 	Timeout       bool                   `protobuf:"varint,6,opt,name=timeout,proto3" json:"timeout,omitempty"`
+	Canceled      bool                   `protobuf:"varint,7,opt,name=canceled,proto3" json:"canceled,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
 
 func (x *CommandResponse) Reset() {
 	*x = CommandResponse{}
-	mi := &file_agent_proto_msgTypes[5]
+	mi := &file_agent_proto_msgTypes[7]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -555,7 +925,7 @@ func (x *CommandResponse) String() string {
 func (*CommandResponse) ProtoMessage() {}
 
 func (x *CommandResponse) ProtoReflect() protoreflect.Message {
-	mi := &file_agent_proto_msgTypes[5]
+	mi := &file_agent_proto_msgTypes[7]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -568,7 +938,7 @@ func (x *CommandResponse) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use CommandResponse.ProtoReflect.Descriptor instead.
 func (*CommandResponse) Descriptor() ([]byte, []int) {
-	return file_agent_proto_rawDescGZIP(), []int{5}
+	return file_agent_proto_rawDescGZIP(), []int{7}
 }
 
 func (x *CommandResponse) GetRequestId() string {
@@ -613,6 +983,296 @@ func (x *CommandResponse) GetTimeout() bool {
 	return false
 }
 
+func (x *CommandResponse) GetCanceled() bool {
+	if x != nil {
+		return x.Canceled
+	}
+	return false
+}
+
+// Incremental output of a streaming command
+type CommandOutput struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	RequestId     string                 `protobuf:"bytes,1,opt,name=request_id,json=requestId,proto3" json:"request_id,omitempty"`
+	Sequence      int64                  `protobuf:"varint,2,opt,name=sequence,proto3" json:"sequence,omitempty"` // starts at 1, shared by stdout and stderr
+	Stream        string                 `protobuf:"bytes,3,opt,name=stream,proto3" json:"stream,omitempty"`      // stdout or stderr
+	Data          []byte                 `protobuf:"bytes,4,opt,name=data,proto3" json:"data,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CommandOutput) Reset() {
+	*x = CommandOutput{}
+	mi := &file_agent_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CommandOutput) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CommandOutput) ProtoMessage() {}
+
+func (x *CommandOutput) ProtoReflect() protoreflect.Message {
+	mi := &file_agent_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CommandOutput.ProtoReflect.Descriptor instead.
+func (*CommandOutput) Descriptor() ([]byte, []int) {
+	return file_agent_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *CommandOutput) GetRequestId() string {
+	if x != nil {
+		return x.RequestId
+	}
+	return ""
+}
+
+func (x *CommandOutput) GetSequence() int64 {
+	if x != nil {
+		return x.Sequence
+	}
+	return 0
+}
+
+func (x *CommandOutput) GetStream() string {
+	if x != nil {
+		return x.Stream
+	}
+	return ""
+}
+
+func (x *CommandOutput) GetData() []byte {
+	if x != nil {
+		return x.Data
+	}
+	return nil
+}
+
+// Final message of a streaming command
+type CommandExit struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	RequestId     string                 `protobuf:"bytes,1,opt,name=request_id,json=requestId,proto3" json:"request_id,omitempty"`
+	Sequence      int64                  `protobuf:"varint,2,opt,name=sequence,proto3" json:"sequence,omitempty"` // one past the last CommandOutput
+	ExitCode      int32                  `protobuf:"varint,3,opt,name=exit_code,json=exitCode,proto3" json:"exit_code,omitempty"`
+	Error         string                 `protobuf:"bytes,4,opt,name=error,proto3" json:"error,omitempty"`
+	Timeout       bool                   `protobuf:"varint,5,opt,name=timeout,proto3" json:"timeout,omitempty"`
+	DurationMs    int64                  `protobuf:"varint,6,opt,name=duration_ms,json=durationMs,proto3" json:"duration_ms,omitempty"`
+	Canceled      bool                   `protobuf:"varint,7,opt,name=canceled,proto3" json:"canceled,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CommandExit) Reset() {
+	*x = CommandExit{}
+	mi := &file_agent_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CommandExit) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CommandExit) ProtoMessage() {}
+
+func (x *CommandExit) ProtoReflect() protoreflect.Message {
+	mi := &file_agent_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CommandExit.ProtoReflect.Descriptor instead.
+func (*CommandExit) Descriptor() ([]byte, []int) {
+	return file_agent_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *CommandExit) GetRequestId() string {
+	if x != nil {
+		return x.RequestId
+	}
+	return ""
+}
+
+func (x *CommandExit) GetSequence() int64 {
+	if x != nil {
+		return x.Sequence
+	}
+	return 0
+}
+
+func (x *CommandExit) GetExitCode() int32 {
+	if x != nil {
+		return x.ExitCode
+	}
+	return 0
+}
+
+func (x *CommandExit) GetError() string {
+	if x != nil {
+		return x.Error
+	}
+	return ""
+}
+
+func (x *CommandExit) GetTimeout() bool {
+	if x != nil {
+		return x.Timeout
+	}
+	return false
+}
+
+func (x *CommandExit) GetDurationMs() int64 {
+	if x != nil {
+		return x.DurationMs
+	}
+	return 0
+}
+
+func (x *CommandExit) GetCanceled() bool {
+	if x != nil {
+		return x.Canceled
+	}
+	return false
+}
+
+// Signals the process group of a running command
+type CommandCancelRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	RequestId     string                 `protobuf:"bytes,1,opt,name=request_id,json=requestId,proto3" json:"request_id,omitempty"`
+	Signal        string                 `protobuf:"bytes,2,opt,name=signal,proto3" json:"signal,omitempty"`                                  // SIGTERM (default), SIGINT or SIGKILL
+	GraceSeconds  int32                  `protobuf:"varint,3,opt,name=grace_seconds,json=graceSeconds,proto3" json:"grace_seconds,omitempty"` // SIGKILL follows if the command is still running after this
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CommandCancelRequest) Reset() {
+	*x = CommandCancelRequest{}
+	mi := &file_agent_proto_msgTypes[10]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CommandCancelRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CommandCancelRequest) ProtoMessage() {}
+
+func (x *CommandCancelRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_agent_proto_msgTypes[10]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CommandCancelRequest.ProtoReflect.Descriptor instead.
+func (*CommandCancelRequest) Descriptor() ([]byte, []int) {
+	return file_agent_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *CommandCancelRequest) GetRequestId() string {
+	if x != nil {
+		return x.RequestId
+	}
+	return ""
+}
+
+func (x *CommandCancelRequest) GetSignal() string {
+	if x != nil {
+		return x.Signal
+	}
+	return ""
+}
+
+func (x *CommandCancelRequest) GetGraceSeconds() int32 {
+	if x != nil {
+		return x.GraceSeconds
+	}
+	return 0
+}
+
+type CommandCancelResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	RequestId     string                 `protobuf:"bytes,1,opt,name=request_id,json=requestId,proto3" json:"request_id,omitempty"`
+	Success       bool                   `protobuf:"varint,2,opt,name=success,proto3" json:"success,omitempty"`
+	Error         string                 `protobuf:"bytes,3,opt,name=error,proto3" json:"error,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CommandCancelResponse) Reset() {
+	*x = CommandCancelResponse{}
+	mi := &file_agent_proto_msgTypes[11]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CommandCancelResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CommandCancelResponse) ProtoMessage() {}
+
+func (x *CommandCancelResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_agent_proto_msgTypes[11]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CommandCancelResponse.ProtoReflect.Descriptor instead.
+func (*CommandCancelResponse) Descriptor() ([]byte, []int) {
+	return file_agent_proto_rawDescGZIP(), []int{11}
+}
+
+func (x *CommandCancelResponse) GetRequestId() string {
+	if x != nil {
+		return x.RequestId
+	}
+	return ""
+}
+
+func (x *CommandCancelResponse) GetSuccess() bool {
+	if x != nil {
+		return x.Success
+	}
+	return false
+}
+
+func (x *CommandCancelResponse) GetError() string {
+	if x != nil {
+		return x.Error
+	}
+	return ""
+}
+
 // Terminal session messages
 type TerminalCreateRequest struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
@@ -620,13 +1280,15 @@ type TerminalCreateRequest struct {
 	Shell         string                 `protobuf:"bytes,2,opt,name=shell,proto3" json:"shell,omitempty"` // bash, zsh, sh, etc. Default: bash
 	WorkingDir    string                 `protobuf:"bytes,3,opt,name=working_dir,json=workingDir,proto3" json:"working_dir,omitempty"`
 	Env           map[string]string      `protobuf:"bytes,4,rep,name=env,proto3" json:"env,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	Rows          uint32                 `protobuf:"varint,5,opt,name=rows,proto3" json:"rows,omitempty"` // initial size of the pseudo-terminal
+	Cols          uint32                 `protobuf:"varint,6,opt,name=cols,proto3" json:"cols,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
 
 func (x *TerminalCreateRequest) Reset() {
 	*x = TerminalCreateRequest{}
-	mi := &file_agent_proto_msgTypes[6]
+	mi := &file_agent_proto_msgTypes[12]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -638,7 +1300,7 @@ func (x *TerminalCreateRequest) String() string {
 func (*TerminalCreateRequest) ProtoMessage() {}
 
 func (x *TerminalCreateRequest) ProtoReflect() protoreflect.Message {
-	mi := &file_agent_proto_msgTypes[6]
+	mi := &file_agent_proto_msgTypes[12]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -651,7 +1313,7 @@ func (x *TerminalCreateRequest) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use TerminalCreateRequest.ProtoReflect.Descriptor instead.
 func (*TerminalCreateRequest) Descriptor() ([]byte, []int) {
-	return file_agent_proto_rawDescGZIP(), []int{6}
+	return file_agent_proto_rawDescGZIP(), []int{12}
 }
 
 func (x *TerminalCreateRequest) GetSessionId() string {
@@ -682,6 +1344,20 @@ func (x *TerminalCreateRequest) GetEnv() map[string]string {
 	return nil
 }
 
+func (x *TerminalCreateRequest) GetRows() uint32 {
+	if x != nil {
+		return x.Rows
+	}
+	return 0
+}
+
+func (x *TerminalCreateRequest) GetCols() uint32 {
+	if x != nil {
+		return x.Cols
+	}
+	return 0
+}
+
 type TerminalCreateResponse struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
 	SessionId     string                 `protobuf:"bytes,1,opt,name=session_id,json=sessionId,proto3" json:"session_id,omitempty"`
@@ -695,7 +1371,7 @@ type TerminalCreateResponse struct {
 
 func (x *TerminalCreateResponse) Reset() {
 	*x = TerminalCreateResponse{}
-	mi := &file_agent_proto_msgTypes[7]
+	mi := &file_agent_proto_msgTypes[13]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -707,7 +1383,7 @@ func (x *TerminalCreateResponse) String() string {
 func (*TerminalCreateResponse) ProtoMessage() {}
 
 func (x *TerminalCreateResponse) ProtoReflect() protoreflect.Message {
-	mi := &file_agent_proto_msgTypes[7]
+	mi := &file_agent_proto_msgTypes[13]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -720,7 +1396,7 @@ func (x *TerminalCreateResponse) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use TerminalCreateResponse.ProtoReflect.Descriptor instead.
 func (*TerminalCreateResponse) Descriptor() ([]byte, []int) {
-	return file_agent_proto_rawDescGZIP(), []int{7}
+	return file_agent_proto_rawDescGZIP(), []int{13}
 }
 
 func (x *TerminalCreateResponse) GetSessionId() string {
@@ -769,7 +1445,7 @@ type TerminalCommandRequest struct {
 
 func (x *TerminalCommandRequest) Reset() {
 	*x = TerminalCommandRequest{}
-	mi := &file_agent_proto_msgTypes[8]
+	mi := &file_agent_proto_msgTypes[14]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -781,7 +1457,7 @@ func (x *TerminalCommandRequest) String() string {
 func (*TerminalCommandRequest) ProtoMessage() {}
 
 func (x *TerminalCommandRequest) ProtoReflect() protoreflect.Message {
-	mi := &file_agent_proto_msgTypes[8]
+	mi := &file_agent_proto_msgTypes[14]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -794,7 +1470,7 @@ func (x *TerminalCommandRequest) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use TerminalCommandRequest.ProtoReflect.Descriptor instead.
 func (*TerminalCommandRequest) Descriptor() ([]byte, []int) {
-	return file_agent_proto_rawDescGZIP(), []int{8}
+	return file_agent_proto_rawDescGZIP(), []int{14}
 }
 
 func (x *TerminalCommandRequest) GetSessionId() string {
@@ -824,15 +1500,16 @@ type TerminalCommandResponse struct {
 	CommandId     string                 `protobuf:"bytes,2,opt,name=command_id,json=commandId,proto3" json:"command_id,omitempty"`
 	Output        string                 `protobuf:"bytes,3,opt,name=output,proto3" json:"output,omitempty"`
 	Error         string                 `protobuf:"bytes,4,opt,name=error,proto3" json:"error,omitempty"`
-	IsFinal       bool                   `protobuf:"varint,5,opt,name=is_final,json=isFinal,proto3" json:"is_final,omitempty"`    // true if command completed
-	ExitCode      int32                  `protobuf:"varint,6,opt,name=exit_code,json=exitCode,proto3" json:"exit_code,omitempty"` // only set when is_final is true
+	IsFinal       bool                   `protobuf:"varint,5,opt,name=is_final,json=isFinal,proto3" json:"is_final,omitempty"`          // true if command completed
+	ExitCode      int32                  `protobuf:"varint,6,opt,name=exit_code,json=exitCode,proto3" json:"exit_code,omitempty"`       // only set when is_final is true
+	DurationMs    int64                  `protobuf:"varint,7,opt,name=duration_ms,json=durationMs,proto3" json:"duration_ms,omitempty"` // time from typing the command to its completion, set with is_final
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
 
 func (x *TerminalCommandResponse) Reset() {
 	*x = TerminalCommandResponse{}
-	mi := &file_agent_proto_msgTypes[9]
+	mi := &file_agent_proto_msgTypes[15]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -844,7 +1521,7 @@ func (x *TerminalCommandResponse) String() string {
 func (*TerminalCommandResponse) ProtoMessage() {}
 
 func (x *TerminalCommandResponse) ProtoReflect() protoreflect.Message {
-	mi := &file_agent_proto_msgTypes[9]
+	mi := &file_agent_proto_msgTypes[15]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -857,7 +1534,7 @@ func (x *TerminalCommandResponse) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use TerminalCommandResponse.ProtoReflect.Descriptor instead.
 func (*TerminalCommandResponse) Descriptor() ([]byte, []int) {
-	return file_agent_proto_rawDescGZIP(), []int{9}
+	return file_agent_proto_rawDescGZIP(), []int{15}
 }
 
 func (x *TerminalCommandResponse) GetSessionId() string {
@@ -902,28 +1579,39 @@ func (x *TerminalCommandResponse) GetExitCode() int32 {
 	return 0
 }
 
-type TerminalCloseRequest struct {
-	state         protoimpl.MessageState `protogen:"open.v1"`
+func (x *TerminalCommandResponse) GetDurationMs() int64 {
+	if x != nil {
+		return x.DurationMs
+	}
+	return 0
+}
+
+// Raw bytes read from a session's pseudo-terminal. Chunks end on UTF-8
+// character boundaries where possible so they can be decoded independently.
+type TerminalOutput struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
 	SessionId     string                 `protobuf:"bytes,1,opt,name=session_id,json=sessionId,proto3" json:"session_id,omitempty"`
+	Data          []byte                 `protobuf:"bytes,2,opt,name=data,proto3" json:"data,omitempty"`
+	CommandId     string                 `protobuf:"bytes,3,opt,name=command_id,json=commandId,proto3" json:"command_id,omitempty"` // command that produced the output, empty outside tracked commands
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
 
-func (x *TerminalCloseRequest) Reset() {
-	*x = TerminalCloseRequest{}
-	mi := &file_agent_proto_msgTypes[10]
+func (x *TerminalOutput) Reset() {
+	*x = TerminalOutput{}
+	mi := &file_agent_proto_msgTypes[16]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
 
-func (x *TerminalCloseRequest) String() string {
+func (x *TerminalOutput) String() string {
 	return protoimpl.X.MessageStringOf(x)
 }
 
-func (*TerminalCloseRequest) ProtoMessage() {}
+func (*TerminalOutput) ProtoMessage() {}
 
-func (x *TerminalCloseRequest) ProtoReflect() protoreflect.Message {
-	mi := &file_agent_proto_msgTypes[10]
+func (x *TerminalOutput) ProtoReflect() protoreflect.Message {
+	mi := &file_agent_proto_msgTypes[16]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -934,42 +1622,56 @@ func (x *TerminalCloseRequest) ProtoReflect() protoreflect.Message {
 	return mi.MessageOf(x)
 }
 
-// Deprecated: Use TerminalCloseRequest.ProtoReflect.Descriptor instead.
-func (*TerminalCloseRequest) Descriptor() ([]byte, []int) {
-	return file_agent_proto_rawDescGZIP(), []int{10}
+// Deprecated: Use TerminalOutput.ProtoReflect.Descriptor instead.
+func (*TerminalOutput) Descriptor() ([]byte, []int) {
+	return file_agent_proto_rawDescGZIP(), []int{16}
 }
 
-func (x *TerminalCloseRequest) GetSessionId() string {
+func (x *TerminalOutput) GetSessionId() string {
 	if x != nil {
 		return x.SessionId
 	}
 	return ""
 }
 
-type TerminalCloseResponse struct {
+func (x *TerminalOutput) GetData() []byte {
+	if x != nil {
+		return x.Data
+	}
+	return nil
+}
+
+func (x *TerminalOutput) GetCommandId() string {
+	if x != nil {
+		return x.CommandId
+	}
+	return ""
+}
+
+// Raw bytes typed into a session's pseudo-terminal, e.g. keystrokes
+type TerminalInput struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
 	SessionId     string                 `protobuf:"bytes,1,opt,name=session_id,json=sessionId,proto3" json:"session_id,omitempty"`
-	Success       bool                   `protobuf:"varint,2,opt,name=success,proto3" json:"success,omitempty"`
-	Error         string                 `protobuf:"bytes,3,opt,name=error,proto3" json:"error,omitempty"`
+	Data          []byte                 `protobuf:"bytes,2,opt,name=data,proto3" json:"data,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
 
-func (x *TerminalCloseResponse) Reset() {
-	*x = TerminalCloseResponse{}
-	mi := &file_agent_proto_msgTypes[11]
+func (x *TerminalInput) Reset() {
+	*x = TerminalInput{}
+	mi := &file_agent_proto_msgTypes[17]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
 
-func (x *TerminalCloseResponse) String() string {
+func (x *TerminalInput) String() string {
 	return protoimpl.X.MessageStringOf(x)
 }
 
-func (*TerminalCloseResponse) ProtoMessage() {}
+func (*TerminalInput) ProtoMessage() {}
 
-func (x *TerminalCloseResponse) ProtoReflect() protoreflect.Message {
-	mi := &file_agent_proto_msgTypes[11]
+func (x *TerminalInput) ProtoReflect() protoreflect.Message {
+	mi := &file_agent_proto_msgTypes[17]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -980,55 +1682,49 @@ func (x *TerminalCloseResponse) ProtoReflect() protoreflect.Message {
 	return mi.MessageOf(x)
 }
 
-// Deprecated: Use TerminalCloseResponse.ProtoReflect.Descriptor instead.
-func (*TerminalCloseResponse) Descriptor() ([]byte, []int) {
-	return file_agent_proto_rawDescGZIP(), []int{11}
+// Deprecated: Use TerminalInput.ProtoReflect.Descriptor instead.
+func (*TerminalInput) Descriptor() ([]byte, []int) {
+	return file_agent_proto_rawDescGZIP(), []int{17}
 }
 
-func (x *TerminalCloseResponse) GetSessionId() string {
+func (x *TerminalInput) GetSessionId() string {
 	if x != nil {
 		return x.SessionId
 	}
 	return ""
 }
 
-func (x *TerminalCloseResponse) GetSuccess() bool {
-	if x != nil {
-		return x.Success
-	}
-	return false
-}
-
-func (x *TerminalCloseResponse) GetError() string {
+func (x *TerminalInput) GetData() []byte {
 	if x != nil {
-		return x.Error
+		return x.Data
 	}
-	return ""
+	return nil
 }
 
-// Metrics messages
-type MetricsRequest struct {
+// Signals the foreground process group of a session's terminal
+type TerminalSignalRequest struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
-	RequestId     string                 `protobuf:"bytes,1,opt,name=request_id,json=requestId,proto3" json:"request_id,omitempty"`
+	SessionId     string                 `protobuf:"bytes,1,opt,name=session_id,json=sessionId,proto3" json:"session_id,omitempty"`
+	Signal        string                 `protobuf:"bytes,2,opt,name=signal,proto3" json:"signal,omitempty"` // SIGINT, SIGQUIT, SIGTSTP, SIGTERM, SIGKILL or SIGHUP
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
 
-func (x *MetricsRequest) Reset() {
-	*x = MetricsRequest{}
-	mi := &file_agent_proto_msgTypes[12]
+func (x *TerminalSignalRequest) Reset() {
+	*x = TerminalSignalRequest{}
+	mi := &file_agent_proto_msgTypes[18]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
 
-func (x *MetricsRequest) String() string {
+func (x *TerminalSignalRequest) String() string {
 	return protoimpl.X.MessageStringOf(x)
 }
 
-func (*MetricsRequest) ProtoMessage() {}
+func (*TerminalSignalRequest) ProtoMessage() {}
 
-func (x *MetricsRequest) ProtoReflect() protoreflect.Message {
-	mi := &file_agent_proto_msgTypes[12]
+func (x *TerminalSignalRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_agent_proto_msgTypes[18]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -1039,42 +1735,49 @@ func (x *MetricsRequest) ProtoReflect() protoreflect.Message {
 	return mi.MessageOf(x)
 }
 
-// Deprecated: Use MetricsRequest.ProtoReflect.Descriptor instead.
-func (*MetricsRequest) Descriptor() ([]byte, []int) {
-	return file_agent_proto_rawDescGZIP(), []int{12}
+// Deprecated: Use TerminalSignalRequest.ProtoReflect.Descriptor instead.
+func (*TerminalSignalRequest) Descriptor() ([]byte, []int) {
+	return file_agent_proto_rawDescGZIP(), []int{18}
 }
 
-func (x *MetricsRequest) GetRequestId() string {
+func (x *TerminalSignalRequest) GetSessionId() string {
 	if x != nil {
-		return x.RequestId
+		return x.SessionId
 	}
 	return ""
 }
 
-type MetricsResponse struct {
+func (x *TerminalSignalRequest) GetSignal() string {
+	if x != nil {
+		return x.Signal
+	}
+	return ""
+}
+
+type TerminalResizeRequest struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
-	RequestId     string                 `protobuf:"bytes,1,opt,name=request_id,json=requestId,proto3" json:"request_id,omitempty"`
-	Metrics       *SystemMetrics         `protobuf:"bytes,2,opt,name=metrics,proto3" json:"metrics,omitempty"`
-	Error         string                 `protobuf:"bytes,3,opt,name=error,proto3" json:"error,omitempty"`
+	SessionId     string                 `protobuf:"bytes,1,opt,name=session_id,json=sessionId,proto3" json:"session_id,omitempty"`
+	Rows          uint32                 `protobuf:"varint,2,opt,name=rows,proto3" json:"rows,omitempty"`
+	Cols          uint32                 `protobuf:"varint,3,opt,name=cols,proto3" json:"cols,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
 
-func (x *MetricsResponse) Reset() {
-	*x = MetricsResponse{}
-	mi := &file_agent_proto_msgTypes[13]
+func (x *TerminalResizeRequest) Reset() {
+	*x = TerminalResizeRequest{}
+	mi := &file_agent_proto_msgTypes[19]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
 
-func (x *MetricsResponse) String() string {
+func (x *TerminalResizeRequest) String() string {
 	return protoimpl.X.MessageStringOf(x)
 }
 
-func (*MetricsResponse) ProtoMessage() {}
+func (*TerminalResizeRequest) ProtoMessage() {}
 
-func (x *MetricsResponse) ProtoReflect() protoreflect.Message {
-	mi := &file_agent_proto_msgTypes[13]
+func (x *TerminalResizeRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_agent_proto_msgTypes[19]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -1085,54 +1788,54 @@ func (x *MetricsResponse) ProtoReflect() protoreflect.Message {
 	return mi.MessageOf(x)
 }
 
-// Deprecated: Use MetricsResponse.ProtoReflect.Descriptor instead.
-func (*MetricsResponse) Descriptor() ([]byte, []int) {
-	return file_agent_proto_rawDescGZIP(), []int{13}
+// Deprecated: Use TerminalResizeRequest.ProtoReflect.Descriptor instead.
+func (*TerminalResizeRequest) Descriptor() ([]byte, []int) {
+	return file_agent_proto_rawDescGZIP(), []int{19}
 }
 
-func (x *MetricsResponse) GetRequestId() string {
+func (x *TerminalResizeRequest) GetSessionId() string {
 	if x != nil {
-		return x.RequestId
+		return x.SessionId
 	}
 	return ""
 }
 
-func (x *MetricsResponse) GetMetrics() *SystemMetrics {
+func (x *TerminalResizeRequest) GetRows() uint32 {
 	if x != nil {
-		return x.Metrics
+		return x.Rows
 	}
-	return nil
+	return 0
 }
 
-func (x *MetricsResponse) GetError() string {
+func (x *TerminalResizeRequest) GetCols() uint32 {
 	if x != nil {
-		return x.Error
+		return x.Cols
 	}
-	return ""
+	return 0
 }
 
-type SystemInfoRequest struct {
+type TerminalCloseRequest struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
-	RequestId     string                 `protobuf:"bytes,1,opt,name=request_id,json=requestId,proto3" json:"request_id,omitempty"`
+	SessionId     string                 `protobuf:"bytes,1,opt,name=session_id,json=sessionId,proto3" json:"session_id,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
 
-func (x *SystemInfoRequest) Reset() {
-	*x = SystemInfoRequest{}
-	mi := &file_agent_proto_msgTypes[14]
+func (x *TerminalCloseRequest) Reset() {
+	*x = TerminalCloseRequest{}
+	mi := &file_agent_proto_msgTypes[20]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
 
-func (x *SystemInfoRequest) String() string {
+func (x *TerminalCloseRequest) String() string {
 	return protoimpl.X.MessageStringOf(x)
 }
 
-func (*SystemInfoRequest) ProtoMessage() {}
+func (*TerminalCloseRequest) ProtoMessage() {}
 
-func (x *SystemInfoRequest) ProtoReflect() protoreflect.Message {
-	mi := &file_agent_proto_msgTypes[14]
+func (x *TerminalCloseRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_agent_proto_msgTypes[20]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -1143,42 +1846,42 @@ func (x *SystemInfoRequest) ProtoReflect() protoreflect.Message {
 	return mi.MessageOf(x)
 }
 
-// Deprecated: Use SystemInfoRequest.ProtoReflect.Descriptor instead.
-func (*SystemInfoRequest) Descriptor() ([]byte, []int) {
-	return file_agent_proto_rawDescGZIP(), []int{14}
+// Deprecated: Use TerminalCloseRequest.ProtoReflect.Descriptor instead.
+func (*TerminalCloseRequest) Descriptor() ([]byte, []int) {
+	return file_agent_proto_rawDescGZIP(), []int{20}
 }
 
-func (x *SystemInfoRequest) GetRequestId() string {
+func (x *TerminalCloseRequest) GetSessionId() string {
 	if x != nil {
-		return x.RequestId
+		return x.SessionId
 	}
 	return ""
 }
 
-type SystemInfoResponse struct {
+type TerminalCloseResponse struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
-	RequestId     string                 `protobuf:"bytes,1,opt,name=request_id,json=requestId,proto3" json:"request_id,omitempty"`
-	SystemInfo    *SystemInfo            `protobuf:"bytes,2,opt,name=system_info,json=systemInfo,proto3" json:"system_info,omitempty"`
+	SessionId     string                 `protobuf:"bytes,1,opt,name=session_id,json=sessionId,proto3" json:"session_id,omitempty"`
+	Success       bool                   `protobuf:"varint,2,opt,name=success,proto3" json:"success,omitempty"`
 	Error         string                 `protobuf:"bytes,3,opt,name=error,proto3" json:"error,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
 
-func (x *SystemInfoResponse) Reset() {
-	*x = SystemInfoResponse{}
-	mi := &file_agent_proto_msgTypes[15]
+func (x *TerminalCloseResponse) Reset() {
+	*x = TerminalCloseResponse{}
+	mi := &file_agent_proto_msgTypes[21]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
 
-func (x *SystemInfoResponse) String() string {
+func (x *TerminalCloseResponse) String() string {
 	return protoimpl.X.MessageStringOf(x)
 }
 
-func (*SystemInfoResponse) ProtoMessage() {}
+func (*TerminalCloseResponse) ProtoMessage() {}
 
-func (x *SystemInfoResponse) ProtoReflect() protoreflect.Message {
-	mi := &file_agent_proto_msgTypes[15]
+func (x *TerminalCloseResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_agent_proto_msgTypes[21]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -1189,63 +1892,56 @@ func (x *SystemInfoResponse) ProtoReflect() protoreflect.Message {
 	return mi.MessageOf(x)
 }
 
-// Deprecated: Use SystemInfoResponse.ProtoReflect.Descriptor instead.
-func (*SystemInfoResponse) Descriptor() ([]byte, []int) {
-	return file_agent_proto_rawDescGZIP(), []int{15}
+// Deprecated: Use TerminalCloseResponse.ProtoReflect.Descriptor instead.
+func (*TerminalCloseResponse) Descriptor() ([]byte, []int) {
+	return file_agent_proto_rawDescGZIP(), []int{21}
 }
 
-func (x *SystemInfoResponse) GetRequestId() string {
+func (x *TerminalCloseResponse) GetSessionId() string {
 	if x != nil {
-		return x.RequestId
+		return x.SessionId
 	}
 	return ""
 }
 
-func (x *SystemInfoResponse) GetSystemInfo() *SystemInfo {
+func (x *TerminalCloseResponse) GetSuccess() bool {
 	if x != nil {
-		return x.SystemInfo
+		return x.Success
 	}
-	return nil
+	return false
 }
 
-func (x *SystemInfoResponse) GetError() string {
+func (x *TerminalCloseResponse) GetError() string {
 	if x != nil {
 		return x.Error
 	}
 	return ""
 }
 
-// System information structures
-type SystemInfo struct {
-	state             protoimpl.MessageState `protogen:"open.v1"`
-	Hostname          string                 `protobuf:"bytes,1,opt,name=hostname,proto3" json:"hostname,omitempty"`
-	Platform          string                 `protobuf:"bytes,2,opt,name=platform,proto3" json:"platform,omitempty"`
-	Arch              string                 `protobuf:"bytes,3,opt,name=arch,proto3" json:"arch,omitempty"`
-	OsVersion         string                 `protobuf:"bytes,4,opt,name=os_version,json=osVersion,proto3" json:"os_version,omitempty"`
-	CpuCount          int32                  `protobuf:"varint,5,opt,name=cpu_count,json=cpuCount,proto3" json:"cpu_count,omitempty"`
-	TotalMemory       int64                  `protobuf:"varint,6,opt,name=total_memory,json=totalMemory,proto3" json:"total_memory,omitempty"`
-	NetworkInterfaces []string               `protobuf:"bytes,7,rep,name=network_interfaces,json=networkInterfaces,proto3" json:"network_interfaces,omitempty"`
-	KernelVersion     string                 `protobuf:"bytes,8,opt,name=kernel_version,json=kernelVersion,proto3" json:"kernel_version,omitempty"`
-	UptimeSeconds     int64                  `protobuf:"varint,9,opt,name=uptime_seconds,json=uptimeSeconds,proto3" json:"uptime_seconds,omitempty"`
-	unknownFields     protoimpl.UnknownFields
-	sizeCache         protoimpl.SizeCache
+// Sent by the agent right after (re)connecting so the server can re-attach
+// terminal sessions that survived a dropped stream
+type TerminalSessionsAnnouncement struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Sessions      []*TerminalSessionInfo `protobuf:"bytes,1,rep,name=sessions,proto3" json:"sessions,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
 }
 
-func (x *SystemInfo) Reset() {
-	*x = SystemInfo{}
-	mi := &file_agent_proto_msgTypes[16]
+func (x *TerminalSessionsAnnouncement) Reset() {
+	*x = TerminalSessionsAnnouncement{}
+	mi := &file_agent_proto_msgTypes[22]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
 
-func (x *SystemInfo) String() string {
+func (x *TerminalSessionsAnnouncement) String() string {
 	return protoimpl.X.MessageStringOf(x)
 }
 
-func (*SystemInfo) ProtoMessage() {}
+func (*TerminalSessionsAnnouncement) ProtoMessage() {}
 
-func (x *SystemInfo) ProtoReflect() protoreflect.Message {
-	mi := &file_agent_proto_msgTypes[16]
+func (x *TerminalSessionsAnnouncement) ProtoReflect() protoreflect.Message {
+	mi := &file_agent_proto_msgTypes[22]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -1256,58 +1952,641 @@ func (x *SystemInfo) ProtoReflect() protoreflect.Message {
 	return mi.MessageOf(x)
 }
 
-// Deprecated: Use SystemInfo.ProtoReflect.Descriptor instead.
-func (*SystemInfo) Descriptor() ([]byte, []int) {
-	return file_agent_proto_rawDescGZIP(), []int{16}
+// Deprecated: Use TerminalSessionsAnnouncement.ProtoReflect.Descriptor instead.
+func (*TerminalSessionsAnnouncement) Descriptor() ([]byte, []int) {
+	return file_agent_proto_rawDescGZIP(), []int{22}
 }
 
-func (x *SystemInfo) GetHostname() string {
+func (x *TerminalSessionsAnnouncement) GetSessions() []*TerminalSessionInfo {
 	if x != nil {
-		return x.Hostname
+		return x.Sessions
 	}
-	return ""
+	return nil
 }
 
-func (x *SystemInfo) GetPlatform() string {
-	if x != nil {
-		return x.Platform
-	}
-	return ""
+type TerminalSessionInfo struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	SessionId     string                 `protobuf:"bytes,1,opt,name=session_id,json=sessionId,proto3" json:"session_id,omitempty"`
+	Shell         string                 `protobuf:"bytes,2,opt,name=shell,proto3" json:"shell,omitempty"`
+	WorkingDir    string                 `protobuf:"bytes,3,opt,name=working_dir,json=workingDir,proto3" json:"working_dir,omitempty"`
+	CreatedAt     int64                  `protobuf:"varint,4,opt,name=created_at,json=createdAt,proto3" json:"created_at,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
 }
 
-func (x *SystemInfo) GetArch() string {
+func (x *TerminalSessionInfo) Reset() {
+	*x = TerminalSessionInfo{}
+	mi := &file_agent_proto_msgTypes[23]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *TerminalSessionInfo) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*TerminalSessionInfo) ProtoMessage() {}
+
+func (x *TerminalSessionInfo) ProtoReflect() protoreflect.Message {
+	mi := &file_agent_proto_msgTypes[23]
 	if x != nil {
-		return x.Arch
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
 	}
-	return ""
+	return mi.MessageOf(x)
 }
 
-func (x *SystemInfo) GetOsVersion() string {
+// Deprecated: Use TerminalSessionInfo.ProtoReflect.Descriptor instead.
+func (*TerminalSessionInfo) Descriptor() ([]byte, []int) {
+	return file_agent_proto_rawDescGZIP(), []int{23}
+}
+
+func (x *TerminalSessionInfo) GetSessionId() string {
 	if x != nil {
-		return x.OsVersion
+		return x.SessionId
 	}
 	return ""
 }
 
-func (x *SystemInfo) GetCpuCount() int32 {
+func (x *TerminalSessionInfo) GetShell() string {
 	if x != nil {
-		return x.CpuCount
+		return x.Shell
 	}
-	return 0
+	return ""
 }
 
-func (x *SystemInfo) GetTotalMemory() int64 {
+func (x *TerminalSessionInfo) GetWorkingDir() string {
 	if x != nil {
-		return x.TotalMemory
+		return x.WorkingDir
 	}
-	return 0
+	return ""
 }
 
-func (x *SystemInfo) GetNetworkInterfaces() []string {
+func (x *TerminalSessionInfo) GetCreatedAt() int64 {
 	if x != nil {
-		return x.NetworkInterfaces
+		return x.CreatedAt
 	}
-	return nil
+	return 0
+}
+
+// Metrics messages
+type MetricsRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	RequestId     string                 `protobuf:"bytes,1,opt,name=request_id,json=requestId,proto3" json:"request_id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *MetricsRequest) Reset() {
+	*x = MetricsRequest{}
+	mi := &file_agent_proto_msgTypes[24]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *MetricsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*MetricsRequest) ProtoMessage() {}
+
+func (x *MetricsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_agent_proto_msgTypes[24]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use MetricsRequest.ProtoReflect.Descriptor instead.
+func (*MetricsRequest) Descriptor() ([]byte, []int) {
+	return file_agent_proto_rawDescGZIP(), []int{24}
+}
+
+func (x *MetricsRequest) GetRequestId() string {
+	if x != nil {
+		return x.RequestId
+	}
+	return ""
+}
+
+type MetricsResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	RequestId     string                 `protobuf:"bytes,1,opt,name=request_id,json=requestId,proto3" json:"request_id,omitempty"`
+	Metrics       *SystemMetrics         `protobuf:"bytes,2,opt,name=metrics,proto3" json:"metrics,omitempty"`
+	Error         string                 `protobuf:"bytes,3,opt,name=error,proto3" json:"error,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *MetricsResponse) Reset() {
+	*x = MetricsResponse{}
+	mi := &file_agent_proto_msgTypes[25]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *MetricsResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*MetricsResponse) ProtoMessage() {}
+
+func (x *MetricsResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_agent_proto_msgTypes[25]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use MetricsResponse.ProtoReflect.Descriptor instead.
+func (*MetricsResponse) Descriptor() ([]byte, []int) {
+	return file_agent_proto_rawDescGZIP(), []int{25}
+}
+
+func (x *MetricsResponse) GetRequestId() string {
+	if x != nil {
+		return x.RequestId
+	}
+	return ""
+}
+
+func (x *MetricsResponse) GetMetrics() *SystemMetrics {
+	if x != nil {
+		return x.Metrics
+	}
+	return nil
+}
+
+func (x *MetricsResponse) GetError() string {
+	if x != nil {
+		return x.Error
+	}
+	return ""
+}
+
+// Asks the agent to push metrics on its own schedule instead of being polled.
+// Agents that don't answer it are polled with MetricsRequest.
+type MetricsSubscribeRequest struct {
+	state          protoimpl.MessageState `protogen:"open.v1"`
+	SubscriptionId string                 `protobuf:"bytes,1,opt,name=subscription_id,json=subscriptionId,proto3" json:"subscription_id,omitempty"`
+	IntervalMs     int64                  `protobuf:"varint,2,opt,name=interval_ms,json=intervalMs,proto3" json:"interval_ms,omitempty"`
+	Fields         []string               `protobuf:"bytes,3,rep,name=fields,proto3" json:"fields,omitempty"` // SystemMetrics fields to collect, all if empty; timestamp is always sent
+	Delta          bool                   `protobuf:"varint,4,opt,name=delta,proto3" json:"delta,omitempty"`  // leave out fields that kept their value since the previous push
+	unknownFields  protoimpl.UnknownFields
+	sizeCache      protoimpl.SizeCache
+}
+
+func (x *MetricsSubscribeRequest) Reset() {
+	*x = MetricsSubscribeRequest{}
+	mi := &file_agent_proto_msgTypes[26]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *MetricsSubscribeRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*MetricsSubscribeRequest) ProtoMessage() {}
+
+func (x *MetricsSubscribeRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_agent_proto_msgTypes[26]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use MetricsSubscribeRequest.ProtoReflect.Descriptor instead.
+func (*MetricsSubscribeRequest) Descriptor() ([]byte, []int) {
+	return file_agent_proto_rawDescGZIP(), []int{26}
+}
+
+func (x *MetricsSubscribeRequest) GetSubscriptionId() string {
+	if x != nil {
+		return x.SubscriptionId
+	}
+	return ""
+}
+
+func (x *MetricsSubscribeRequest) GetIntervalMs() int64 {
+	if x != nil {
+		return x.IntervalMs
+	}
+	return 0
+}
+
+func (x *MetricsSubscribeRequest) GetFields() []string {
+	if x != nil {
+		return x.Fields
+	}
+	return nil
+}
+
+func (x *MetricsSubscribeRequest) GetDelta() bool {
+	if x != nil {
+		return x.Delta
+	}
+	return false
+}
+
+type MetricsSubscribeResponse struct {
+	state          protoimpl.MessageState `protogen:"open.v1"`
+	SubscriptionId string                 `protobuf:"bytes,1,opt,name=subscription_id,json=subscriptionId,proto3" json:"subscription_id,omitempty"`
+	Error          string                 `protobuf:"bytes,2,opt,name=error,proto3" json:"error,omitempty"`
+	unknownFields  protoimpl.UnknownFields
+	sizeCache      protoimpl.SizeCache
+}
+
+func (x *MetricsSubscribeResponse) Reset() {
+	*x = MetricsSubscribeResponse{}
+	mi := &file_agent_proto_msgTypes[27]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *MetricsSubscribeResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*MetricsSubscribeResponse) ProtoMessage() {}
+
+func (x *MetricsSubscribeResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_agent_proto_msgTypes[27]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use MetricsSubscribeResponse.ProtoReflect.Descriptor instead.
+func (*MetricsSubscribeResponse) Descriptor() ([]byte, []int) {
+	return file_agent_proto_rawDescGZIP(), []int{27}
+}
+
+func (x *MetricsSubscribeResponse) GetSubscriptionId() string {
+	if x != nil {
+		return x.SubscriptionId
+	}
+	return ""
+}
+
+func (x *MetricsSubscribeResponse) GetError() string {
+	if x != nil {
+		return x.Error
+	}
+	return ""
+}
+
+type MetricsUnsubscribeRequest struct {
+	state          protoimpl.MessageState `protogen:"open.v1"`
+	SubscriptionId string                 `protobuf:"bytes,1,opt,name=subscription_id,json=subscriptionId,proto3" json:"subscription_id,omitempty"`
+	unknownFields  protoimpl.UnknownFields
+	sizeCache      protoimpl.SizeCache
+}
+
+func (x *MetricsUnsubscribeRequest) Reset() {
+	*x = MetricsUnsubscribeRequest{}
+	mi := &file_agent_proto_msgTypes[28]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *MetricsUnsubscribeRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*MetricsUnsubscribeRequest) ProtoMessage() {}
+
+func (x *MetricsUnsubscribeRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_agent_proto_msgTypes[28]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use MetricsUnsubscribeRequest.ProtoReflect.Descriptor instead.
+func (*MetricsUnsubscribeRequest) Descriptor() ([]byte, []int) {
+	return file_agent_proto_rawDescGZIP(), []int{28}
+}
+
+func (x *MetricsUnsubscribeRequest) GetSubscriptionId() string {
+	if x != nil {
+		return x.SubscriptionId
+	}
+	return ""
+}
+
+// A sample pushed by a subscribed agent. A delta push lists the fields that
+// kept the value of the previous push instead of repeating them; pushes are
+// full from time to time and after a push could not be sent.
+type MetricsPush struct {
+	state          protoimpl.MessageState `protogen:"open.v1"`
+	SubscriptionId string                 `protobuf:"bytes,1,opt,name=subscription_id,json=subscriptionId,proto3" json:"subscription_id,omitempty"`
+	Sequence       uint64                 `protobuf:"varint,2,opt,name=sequence,proto3" json:"sequence,omitempty"`
+	Metrics        *SystemMetrics         `protobuf:"bytes,3,opt,name=metrics,proto3" json:"metrics,omitempty"`
+	Full           bool                   `protobuf:"varint,4,opt,name=full,proto3" json:"full,omitempty"`
+	Unchanged      []string               `protobuf:"bytes,5,rep,name=unchanged,proto3" json:"unchanged,omitempty"`
+	Error          string                 `protobuf:"bytes,6,opt,name=error,proto3" json:"error,omitempty"` // collecting the sample failed
+	unknownFields  protoimpl.UnknownFields
+	sizeCache      protoimpl.SizeCache
+}
+
+func (x *MetricsPush) Reset() {
+	*x = MetricsPush{}
+	mi := &file_agent_proto_msgTypes[29]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *MetricsPush) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*MetricsPush) ProtoMessage() {}
+
+func (x *MetricsPush) ProtoReflect() protoreflect.Message {
+	mi := &file_agent_proto_msgTypes[29]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use MetricsPush.ProtoReflect.Descriptor instead.
+func (*MetricsPush) Descriptor() ([]byte, []int) {
+	return file_agent_proto_rawDescGZIP(), []int{29}
+}
+
+func (x *MetricsPush) GetSubscriptionId() string {
+	if x != nil {
+		return x.SubscriptionId
+	}
+	return ""
+}
+
+func (x *MetricsPush) GetSequence() uint64 {
+	if x != nil {
+		return x.Sequence
+	}
+	return 0
+}
+
+func (x *MetricsPush) GetMetrics() *SystemMetrics {
+	if x != nil {
+		return x.Metrics
+	}
+	return nil
+}
+
+func (x *MetricsPush) GetFull() bool {
+	if x != nil {
+		return x.Full
+	}
+	return false
+}
+
+func (x *MetricsPush) GetUnchanged() []string {
+	if x != nil {
+		return x.Unchanged
+	}
+	return nil
+}
+
+func (x *MetricsPush) GetError() string {
+	if x != nil {
+		return x.Error
+	}
+	return ""
+}
+
+type SystemInfoRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	RequestId     string                 `protobuf:"bytes,1,opt,name=request_id,json=requestId,proto3" json:"request_id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SystemInfoRequest) Reset() {
+	*x = SystemInfoRequest{}
+	mi := &file_agent_proto_msgTypes[30]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SystemInfoRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SystemInfoRequest) ProtoMessage() {}
+
+func (x *SystemInfoRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_agent_proto_msgTypes[30]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SystemInfoRequest.ProtoReflect.Descriptor instead.
+func (*SystemInfoRequest) Descriptor() ([]byte, []int) {
+	return file_agent_proto_rawDescGZIP(), []int{30}
+}
+
+func (x *SystemInfoRequest) GetRequestId() string {
+	if x != nil {
+		return x.RequestId
+	}
+	return ""
+}
+
+type SystemInfoResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	RequestId     string                 `protobuf:"bytes,1,opt,name=request_id,json=requestId,proto3" json:"request_id,omitempty"`
+	SystemInfo    *SystemInfo            `protobuf:"bytes,2,opt,name=system_info,json=systemInfo,proto3" json:"system_info,omitempty"`
+	Error         string                 `protobuf:"bytes,3,opt,name=error,proto3" json:"error,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SystemInfoResponse) Reset() {
+	*x = SystemInfoResponse{}
+	mi := &file_agent_proto_msgTypes[31]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SystemInfoResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SystemInfoResponse) ProtoMessage() {}
+
+func (x *SystemInfoResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_agent_proto_msgTypes[31]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SystemInfoResponse.ProtoReflect.Descriptor instead.
+func (*SystemInfoResponse) Descriptor() ([]byte, []int) {
+	return file_agent_proto_rawDescGZIP(), []int{31}
+}
+
+func (x *SystemInfoResponse) GetRequestId() string {
+	if x != nil {
+		return x.RequestId
+	}
+	return ""
+}
+
+func (x *SystemInfoResponse) GetSystemInfo() *SystemInfo {
+	if x != nil {
+		return x.SystemInfo
+	}
+	return nil
+}
+
+func (x *SystemInfoResponse) GetError() string {
+	if x != nil {
+		return x.Error
+	}
+	return ""
+}
+
+// System information structures
+type SystemInfo struct {
+	state             protoimpl.MessageState `protogen:"open.v1"`
+	Hostname          string                 `protobuf:"bytes,1,opt,name=hostname,proto3" json:"hostname,omitempty"`
+	Platform          string                 `protobuf:"bytes,2,opt,name=platform,proto3" json:"platform,omitempty"`
+	Arch              string                 `protobuf:"bytes,3,opt,name=arch,proto3" json:"arch,omitempty"`
+	OsVersion         string                 `protobuf:"bytes,4,opt,name=os_version,json=osVersion,proto3" json:"os_version,omitempty"`
+	CpuCount          int32                  `protobuf:"varint,5,opt,name=cpu_count,json=cpuCount,proto3" json:"cpu_count,omitempty"`
+	TotalMemory       int64                  `protobuf:"varint,6,opt,name=total_memory,json=totalMemory,proto3" json:"total_memory,omitempty"`
+	NetworkInterfaces []string               `protobuf:"bytes,7,rep,name=network_interfaces,json=networkInterfaces,proto3" json:"network_interfaces,omitempty"`
+	KernelVersion     string                 `protobuf:"bytes,8,opt,name=kernel_version,json=kernelVersion,proto3" json:"kernel_version,omitempty"`
+	UptimeSeconds     int64                  `protobuf:"varint,9,opt,name=uptime_seconds,json=uptimeSeconds,proto3" json:"uptime_seconds,omitempty"`
+	unknownFields     protoimpl.UnknownFields
+	sizeCache         protoimpl.SizeCache
+}
+
+func (x *SystemInfo) Reset() {
+	*x = SystemInfo{}
+	mi := &file_agent_proto_msgTypes[32]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SystemInfo) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SystemInfo) ProtoMessage() {}
+
+func (x *SystemInfo) ProtoReflect() protoreflect.Message {
+	mi := &file_agent_proto_msgTypes[32]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SystemInfo.ProtoReflect.Descriptor instead.
+func (*SystemInfo) Descriptor() ([]byte, []int) {
+	return file_agent_proto_rawDescGZIP(), []int{32}
+}
+
+func (x *SystemInfo) GetHostname() string {
+	if x != nil {
+		return x.Hostname
+	}
+	return ""
+}
+
+func (x *SystemInfo) GetPlatform() string {
+	if x != nil {
+		return x.Platform
+	}
+	return ""
+}
+
+func (x *SystemInfo) GetArch() string {
+	if x != nil {
+		return x.Arch
+	}
+	return ""
+}
+
+func (x *SystemInfo) GetOsVersion() string {
+	if x != nil {
+		return x.OsVersion
+	}
+	return ""
+}
+
+func (x *SystemInfo) GetCpuCount() int32 {
+	if x != nil {
+		return x.CpuCount
+	}
+	return 0
+}
+
+func (x *SystemInfo) GetTotalMemory() int64 {
+	if x != nil {
+		return x.TotalMemory
+	}
+	return 0
+}
+
+func (x *SystemInfo) GetNetworkInterfaces() []string {
+	if x != nil {
+		return x.NetworkInterfaces
+	}
+	return nil
 }
 
 func (x *SystemInfo) GetKernelVersion() string {
@@ -1324,36 +2603,333 @@ func (x *SystemInfo) GetUptimeSeconds() int64 {
 	return 0
 }
 
-type SystemMetrics struct {
-	state             protoimpl.MessageState `protogen:"open.v1"`
-	CpuUsagePercent   float64                `protobuf:"fixed64,1,opt,name=cpu_usage_percent,json=cpuUsagePercent,proto3" json:"cpu_usage_percent,omitempty"`
-	Memory            *MemoryMetrics         `protobuf:"bytes,2,opt,name=memory,proto3" json:"memory,omitempty"`
-	Disks             []*DiskMetrics         `protobuf:"bytes,3,rep,name=disks,proto3" json:"disks,omitempty"`
-	NetworkInterfaces []*NetworkMetrics      `protobuf:"bytes,4,rep,name=network_interfaces,json=networkInterfaces,proto3" json:"network_interfaces,omitempty"`
-	Processes         []*ProcessMetrics      `protobuf:"bytes,5,rep,name=processes,proto3" json:"processes,omitempty"`
-	Timestamp         int64                  `protobuf:"varint,6,opt,name=timestamp,proto3" json:"timestamp,omitempty"`
-	LoadAverage_1M    float64                `protobuf:"fixed64,7,opt,name=load_average_1m,json=loadAverage1m,proto3" json:"load_average_1m,omitempty"`
-	LoadAverage_5M    float64                `protobuf:"fixed64,8,opt,name=load_average_5m,json=loadAverage5m,proto3" json:"load_average_5m,omitempty"`
-	LoadAverage_15M   float64                `protobuf:"fixed64,9,opt,name=load_average_15m,json=loadAverage15m,proto3" json:"load_average_15m,omitempty"`
-	unknownFields     protoimpl.UnknownFields
-	sizeCache         protoimpl.SizeCache
+type SystemMetrics struct {
+	state               protoimpl.MessageState `protogen:"open.v1"`
+	CpuUsagePercent     float64                `protobuf:"fixed64,1,opt,name=cpu_usage_percent,json=cpuUsagePercent,proto3" json:"cpu_usage_percent,omitempty"`
+	Memory              *MemoryMetrics         `protobuf:"bytes,2,opt,name=memory,proto3" json:"memory,omitempty"`
+	Disks               []*DiskMetrics         `protobuf:"bytes,3,rep,name=disks,proto3" json:"disks,omitempty"`
+	NetworkInterfaces   []*NetworkMetrics      `protobuf:"bytes,4,rep,name=network_interfaces,json=networkInterfaces,proto3" json:"network_interfaces,omitempty"`
+	Processes           []*ProcessMetrics      `protobuf:"bytes,5,rep,name=processes,proto3" json:"processes,omitempty"`
+	Timestamp           int64                  `protobuf:"varint,6,opt,name=timestamp,proto3" json:"timestamp,omitempty"`
+	LoadAverage_1M      float64                `protobuf:"fixed64,7,opt,name=load_average_1m,json=loadAverage1m,proto3" json:"load_average_1m,omitempty"`
+	LoadAverage_5M      float64                `protobuf:"fixed64,8,opt,name=load_average_5m,json=loadAverage5m,proto3" json:"load_average_5m,omitempty"`
+	LoadAverage_15M     float64                `protobuf:"fixed64,9,opt,name=load_average_15m,json=loadAverage15m,proto3" json:"load_average_15m,omitempty"`
+	DiskIo              []*DiskIOMetrics       `protobuf:"bytes,10,rep,name=disk_io,json=diskIo,proto3" json:"disk_io,omitempty"`
+	CpuCoreUsagePercent []float64              `protobuf:"fixed64,11,rep,packed,name=cpu_core_usage_percent,json=cpuCoreUsagePercent,proto3" json:"cpu_core_usage_percent,omitempty"` // usage of each logical CPU
+	CpuTimes            *CPUTimesMetrics       `protobuf:"bytes,12,opt,name=cpu_times,json=cpuTimes,proto3" json:"cpu_times,omitempty"`
+	Pressure            *PressureMetrics       `protobuf:"bytes,13,opt,name=pressure,proto3" json:"pressure,omitempty"` // only on Linux kernels with PSI
+	unknownFields       protoimpl.UnknownFields
+	sizeCache           protoimpl.SizeCache
+}
+
+func (x *SystemMetrics) Reset() {
+	*x = SystemMetrics{}
+	mi := &file_agent_proto_msgTypes[33]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SystemMetrics) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SystemMetrics) ProtoMessage() {}
+
+func (x *SystemMetrics) ProtoReflect() protoreflect.Message {
+	mi := &file_agent_proto_msgTypes[33]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SystemMetrics.ProtoReflect.Descriptor instead.
+func (*SystemMetrics) Descriptor() ([]byte, []int) {
+	return file_agent_proto_rawDescGZIP(), []int{33}
+}
+
+func (x *SystemMetrics) GetCpuUsagePercent() float64 {
+	if x != nil {
+		return x.CpuUsagePercent
+	}
+	return 0
+}
+
+func (x *SystemMetrics) GetMemory() *MemoryMetrics {
+	if x != nil {
+		return x.Memory
+	}
+	return nil
+}
+
+func (x *SystemMetrics) GetDisks() []*DiskMetrics {
+	if x != nil {
+		return x.Disks
+	}
+	return nil
+}
+
+func (x *SystemMetrics) GetNetworkInterfaces() []*NetworkMetrics {
+	if x != nil {
+		return x.NetworkInterfaces
+	}
+	return nil
+}
+
+func (x *SystemMetrics) GetProcesses() []*ProcessMetrics {
+	if x != nil {
+		return x.Processes
+	}
+	return nil
+}
+
+func (x *SystemMetrics) GetTimestamp() int64 {
+	if x != nil {
+		return x.Timestamp
+	}
+	return 0
+}
+
+func (x *SystemMetrics) GetLoadAverage_1M() float64 {
+	if x != nil {
+		return x.LoadAverage_1M
+	}
+	return 0
+}
+
+func (x *SystemMetrics) GetLoadAverage_5M() float64 {
+	if x != nil {
+		return x.LoadAverage_5M
+	}
+	return 0
+}
+
+func (x *SystemMetrics) GetLoadAverage_15M() float64 {
+	if x != nil {
+		return x.LoadAverage_15M
+	}
+	return 0
+}
+
+func (x *SystemMetrics) GetDiskIo() []*DiskIOMetrics {
+	if x != nil {
+		return x.DiskIo
+	}
+	return nil
+}
+
+func (x *SystemMetrics) GetCpuCoreUsagePercent() []float64 {
+	if x != nil {
+		return x.CpuCoreUsagePercent
+	}
+	return nil
+}
+
+func (x *SystemMetrics) GetCpuTimes() *CPUTimesMetrics {
+	if x != nil {
+		return x.CpuTimes
+	}
+	return nil
+}
+
+func (x *SystemMetrics) GetPressure() *PressureMetrics {
+	if x != nil {
+		return x.Pressure
+	}
+	return nil
+}
+
+// Share of CPU time spent in each state since the previous sample, in percent
+type CPUTimesMetrics struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	User          float64                `protobuf:"fixed64,1,opt,name=user,proto3" json:"user,omitempty"`
+	System        float64                `protobuf:"fixed64,2,opt,name=system,proto3" json:"system,omitempty"`
+	Idle          float64                `protobuf:"fixed64,3,opt,name=idle,proto3" json:"idle,omitempty"`
+	Nice          float64                `protobuf:"fixed64,4,opt,name=nice,proto3" json:"nice,omitempty"`
+	Iowait        float64                `protobuf:"fixed64,5,opt,name=iowait,proto3" json:"iowait,omitempty"`
+	Irq           float64                `protobuf:"fixed64,6,opt,name=irq,proto3" json:"irq,omitempty"`
+	Softirq       float64                `protobuf:"fixed64,7,opt,name=softirq,proto3" json:"softirq,omitempty"`
+	Steal         float64                `protobuf:"fixed64,8,opt,name=steal,proto3" json:"steal,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CPUTimesMetrics) Reset() {
+	*x = CPUTimesMetrics{}
+	mi := &file_agent_proto_msgTypes[34]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CPUTimesMetrics) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CPUTimesMetrics) ProtoMessage() {}
+
+func (x *CPUTimesMetrics) ProtoReflect() protoreflect.Message {
+	mi := &file_agent_proto_msgTypes[34]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CPUTimesMetrics.ProtoReflect.Descriptor instead.
+func (*CPUTimesMetrics) Descriptor() ([]byte, []int) {
+	return file_agent_proto_rawDescGZIP(), []int{34}
+}
+
+func (x *CPUTimesMetrics) GetUser() float64 {
+	if x != nil {
+		return x.User
+	}
+	return 0
+}
+
+func (x *CPUTimesMetrics) GetSystem() float64 {
+	if x != nil {
+		return x.System
+	}
+	return 0
+}
+
+func (x *CPUTimesMetrics) GetIdle() float64 {
+	if x != nil {
+		return x.Idle
+	}
+	return 0
+}
+
+func (x *CPUTimesMetrics) GetNice() float64 {
+	if x != nil {
+		return x.Nice
+	}
+	return 0
+}
+
+func (x *CPUTimesMetrics) GetIowait() float64 {
+	if x != nil {
+		return x.Iowait
+	}
+	return 0
+}
+
+func (x *CPUTimesMetrics) GetIrq() float64 {
+	if x != nil {
+		return x.Irq
+	}
+	return 0
+}
+
+func (x *CPUTimesMetrics) GetSoftirq() float64 {
+	if x != nil {
+		return x.Softirq
+	}
+	return 0
+}
+
+func (x *CPUTimesMetrics) GetSteal() float64 {
+	if x != nil {
+		return x.Steal
+	}
+	return 0
+}
+
+// Pressure stall information from /proc/pressure
+type PressureMetrics struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Cpu           *PressureStall         `protobuf:"bytes,1,opt,name=cpu,proto3" json:"cpu,omitempty"`
+	Memory        *PressureStall         `protobuf:"bytes,2,opt,name=memory,proto3" json:"memory,omitempty"`
+	Io            *PressureStall         `protobuf:"bytes,3,opt,name=io,proto3" json:"io,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *PressureMetrics) Reset() {
+	*x = PressureMetrics{}
+	mi := &file_agent_proto_msgTypes[35]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PressureMetrics) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PressureMetrics) ProtoMessage() {}
+
+func (x *PressureMetrics) ProtoReflect() protoreflect.Message {
+	mi := &file_agent_proto_msgTypes[35]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PressureMetrics.ProtoReflect.Descriptor instead.
+func (*PressureMetrics) Descriptor() ([]byte, []int) {
+	return file_agent_proto_rawDescGZIP(), []int{35}
+}
+
+func (x *PressureMetrics) GetCpu() *PressureStall {
+	if x != nil {
+		return x.Cpu
+	}
+	return nil
+}
+
+func (x *PressureMetrics) GetMemory() *PressureStall {
+	if x != nil {
+		return x.Memory
+	}
+	return nil
+}
+
+func (x *PressureMetrics) GetIo() *PressureStall {
+	if x != nil {
+		return x.Io
+	}
+	return nil
+}
+
+// Time some or all non-idle tasks were stalled on a resource. Full is
+// missing for CPU on kernels before 5.13.
+type PressureStall struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Some          *PressureAverages      `protobuf:"bytes,1,opt,name=some,proto3" json:"some,omitempty"`
+	Full          *PressureAverages      `protobuf:"bytes,2,opt,name=full,proto3" json:"full,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
 }
 
-func (x *SystemMetrics) Reset() {
-	*x = SystemMetrics{}
-	mi := &file_agent_proto_msgTypes[17]
+func (x *PressureStall) Reset() {
+	*x = PressureStall{}
+	mi := &file_agent_proto_msgTypes[36]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
 
-func (x *SystemMetrics) String() string {
+func (x *PressureStall) String() string {
 	return protoimpl.X.MessageStringOf(x)
 }
 
-func (*SystemMetrics) ProtoMessage() {}
+func (*PressureStall) ProtoMessage() {}
 
-func (x *SystemMetrics) ProtoReflect() protoreflect.Message {
-	mi := &file_agent_proto_msgTypes[17]
+func (x *PressureStall) ProtoReflect() protoreflect.Message {
+	mi := &file_agent_proto_msgTypes[36]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -1364,70 +2940,91 @@ func (x *SystemMetrics) ProtoReflect() protoreflect.Message {
 	return mi.MessageOf(x)
 }
 
-// Deprecated: Use SystemMetrics.ProtoReflect.Descriptor instead.
-func (*SystemMetrics) Descriptor() ([]byte, []int) {
-	return file_agent_proto_rawDescGZIP(), []int{17}
+// Deprecated: Use PressureStall.ProtoReflect.Descriptor instead.
+func (*PressureStall) Descriptor() ([]byte, []int) {
+	return file_agent_proto_rawDescGZIP(), []int{36}
 }
 
-func (x *SystemMetrics) GetCpuUsagePercent() float64 {
+func (x *PressureStall) GetSome() *PressureAverages {
 	if x != nil {
-		return x.CpuUsagePercent
+		return x.Some
 	}
-	return 0
+	return nil
 }
 
-func (x *SystemMetrics) GetMemory() *MemoryMetrics {
+func (x *PressureStall) GetFull() *PressureAverages {
 	if x != nil {
-		return x.Memory
+		return x.Full
 	}
 	return nil
 }
 
-func (x *SystemMetrics) GetDisks() []*DiskMetrics {
-	if x != nil {
-		return x.Disks
-	}
-	return nil
+// Percent of time stalled over the last 10, 60 and 300 seconds, and the
+// total stall time in microseconds
+type PressureAverages struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Avg10         float64                `protobuf:"fixed64,1,opt,name=avg10,proto3" json:"avg10,omitempty"`
+	Avg60         float64                `protobuf:"fixed64,2,opt,name=avg60,proto3" json:"avg60,omitempty"`
+	Avg300        float64                `protobuf:"fixed64,3,opt,name=avg300,proto3" json:"avg300,omitempty"`
+	TotalUs       int64                  `protobuf:"varint,4,opt,name=total_us,json=totalUs,proto3" json:"total_us,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
 }
 
-func (x *SystemMetrics) GetNetworkInterfaces() []*NetworkMetrics {
-	if x != nil {
-		return x.NetworkInterfaces
-	}
-	return nil
+func (x *PressureAverages) Reset() {
+	*x = PressureAverages{}
+	mi := &file_agent_proto_msgTypes[37]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
 }
 
-func (x *SystemMetrics) GetProcesses() []*ProcessMetrics {
+func (x *PressureAverages) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PressureAverages) ProtoMessage() {}
+
+func (x *PressureAverages) ProtoReflect() protoreflect.Message {
+	mi := &file_agent_proto_msgTypes[37]
 	if x != nil {
-		return x.Processes
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
 	}
-	return nil
+	return mi.MessageOf(x)
 }
 
-func (x *SystemMetrics) GetTimestamp() int64 {
+// Deprecated: Use PressureAverages.ProtoReflect.Descriptor instead.
+func (*PressureAverages) Descriptor() ([]byte, []int) {
+	return file_agent_proto_rawDescGZIP(), []int{37}
+}
+
+func (x *PressureAverages) GetAvg10() float64 {
 	if x != nil {
-		return x.Timestamp
+		return x.Avg10
 	}
 	return 0
 }
 
-func (x *SystemMetrics) GetLoadAverage_1M() float64 {
+func (x *PressureAverages) GetAvg60() float64 {
 	if x != nil {
-		return x.LoadAverage_1M
+		return x.Avg60
 	}
 	return 0
 }
 
-func (x *SystemMetrics) GetLoadAverage_5M() float64 {
+func (x *PressureAverages) GetAvg300() float64 {
 	if x != nil {
-		return x.LoadAverage_5M
+		return x.Avg300
 	}
 	return 0
 }
 
-func (x *SystemMetrics) GetLoadAverage_15M() float64 {
+func (x *PressureAverages) GetTotalUs() int64 {
 	if x != nil {
-		return x.LoadAverage_15M
+		return x.TotalUs
 	}
 	return 0
 }
@@ -1447,7 +3044,7 @@ type MemoryMetrics struct {
 
 func (x *MemoryMetrics) Reset() {
 	*x = MemoryMetrics{}
-	mi := &file_agent_proto_msgTypes[18]
+	mi := &file_agent_proto_msgTypes[38]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -1459,7 +3056,7 @@ func (x *MemoryMetrics) String() string {
 func (*MemoryMetrics) ProtoMessage() {}
 
 func (x *MemoryMetrics) ProtoReflect() protoreflect.Message {
-	mi := &file_agent_proto_msgTypes[18]
+	mi := &file_agent_proto_msgTypes[38]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -1472,7 +3069,7 @@ func (x *MemoryMetrics) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use MemoryMetrics.ProtoReflect.Descriptor instead.
 func (*MemoryMetrics) Descriptor() ([]byte, []int) {
-	return file_agent_proto_rawDescGZIP(), []int{18}
+	return file_agent_proto_rawDescGZIP(), []int{38}
 }
 
 func (x *MemoryMetrics) GetTotal() int64 {
@@ -1539,7 +3136,7 @@ type DiskMetrics struct {
 
 func (x *DiskMetrics) Reset() {
 	*x = DiskMetrics{}
-	mi := &file_agent_proto_msgTypes[19]
+	mi := &file_agent_proto_msgTypes[39]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -1551,7 +3148,7 @@ func (x *DiskMetrics) String() string {
 func (*DiskMetrics) ProtoMessage() {}
 
 func (x *DiskMetrics) ProtoReflect() protoreflect.Message {
-	mi := &file_agent_proto_msgTypes[19]
+	mi := &file_agent_proto_msgTypes[39]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -1564,7 +3161,7 @@ func (x *DiskMetrics) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use DiskMetrics.ProtoReflect.Descriptor instead.
 func (*DiskMetrics) Descriptor() ([]byte, []int) {
-	return file_agent_proto_rawDescGZIP(), []int{19}
+	return file_agent_proto_rawDescGZIP(), []int{39}
 }
 
 func (x *DiskMetrics) GetDevice() string {
@@ -1617,23 +3214,28 @@ func (x *DiskMetrics) GetUsedPercent() float64 {
 }
 
 type NetworkMetrics struct {
-	state         protoimpl.MessageState `protogen:"open.v1"`
-	Interface     string                 `protobuf:"bytes,1,opt,name=interface,proto3" json:"interface,omitempty"`
-	BytesSent     int64                  `protobuf:"varint,2,opt,name=bytes_sent,json=bytesSent,proto3" json:"bytes_sent,omitempty"`
-	BytesRecv     int64                  `protobuf:"varint,3,opt,name=bytes_recv,json=bytesRecv,proto3" json:"bytes_recv,omitempty"`
-	PacketsSent   int64                  `protobuf:"varint,4,opt,name=packets_sent,json=packetsSent,proto3" json:"packets_sent,omitempty"`
-	PacketsRecv   int64                  `protobuf:"varint,5,opt,name=packets_recv,json=packetsRecv,proto3" json:"packets_recv,omitempty"`
-	ErrorsIn      int64                  `protobuf:"varint,6,opt,name=errors_in,json=errorsIn,proto3" json:"errors_in,omitempty"`
-	ErrorsOut     int64                  `protobuf:"varint,7,opt,name=errors_out,json=errorsOut,proto3" json:"errors_out,omitempty"`
-	DropsIn       int64                  `protobuf:"varint,8,opt,name=drops_in,json=dropsIn,proto3" json:"drops_in,omitempty"`
-	DropsOut      int64                  `protobuf:"varint,9,opt,name=drops_out,json=dropsOut,proto3" json:"drops_out,omitempty"`
-	unknownFields protoimpl.UnknownFields
-	sizeCache     protoimpl.SizeCache
+	state       protoimpl.MessageState `protogen:"open.v1"`
+	Interface   string                 `protobuf:"bytes,1,opt,name=interface,proto3" json:"interface,omitempty"`
+	BytesSent   int64                  `protobuf:"varint,2,opt,name=bytes_sent,json=bytesSent,proto3" json:"bytes_sent,omitempty"`
+	BytesRecv   int64                  `protobuf:"varint,3,opt,name=bytes_recv,json=bytesRecv,proto3" json:"bytes_recv,omitempty"`
+	PacketsSent int64                  `protobuf:"varint,4,opt,name=packets_sent,json=packetsSent,proto3" json:"packets_sent,omitempty"`
+	PacketsRecv int64                  `protobuf:"varint,5,opt,name=packets_recv,json=packetsRecv,proto3" json:"packets_recv,omitempty"`
+	ErrorsIn    int64                  `protobuf:"varint,6,opt,name=errors_in,json=errorsIn,proto3" json:"errors_in,omitempty"`
+	ErrorsOut   int64                  `protobuf:"varint,7,opt,name=errors_out,json=errorsOut,proto3" json:"errors_out,omitempty"`
+	DropsIn     int64                  `protobuf:"varint,8,opt,name=drops_in,json=dropsIn,proto3" json:"drops_in,omitempty"`
+	DropsOut    int64                  `protobuf:"varint,9,opt,name=drops_out,json=dropsOut,proto3" json:"drops_out,omitempty"`
+	// Rates since the previous sample, zero in the first one
+	BytesSentPerSec   float64 `protobuf:"fixed64,10,opt,name=bytes_sent_per_sec,json=bytesSentPerSec,proto3" json:"bytes_sent_per_sec,omitempty"`
+	BytesRecvPerSec   float64 `protobuf:"fixed64,11,opt,name=bytes_recv_per_sec,json=bytesRecvPerSec,proto3" json:"bytes_recv_per_sec,omitempty"`
+	PacketsSentPerSec float64 `protobuf:"fixed64,12,opt,name=packets_sent_per_sec,json=packetsSentPerSec,proto3" json:"packets_sent_per_sec,omitempty"`
+	PacketsRecvPerSec float64 `protobuf:"fixed64,13,opt,name=packets_recv_per_sec,json=packetsRecvPerSec,proto3" json:"packets_recv_per_sec,omitempty"`
+	unknownFields     protoimpl.UnknownFields
+	sizeCache         protoimpl.SizeCache
 }
 
 func (x *NetworkMetrics) Reset() {
 	*x = NetworkMetrics{}
-	mi := &file_agent_proto_msgTypes[20]
+	mi := &file_agent_proto_msgTypes[40]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -1645,7 +3247,7 @@ func (x *NetworkMetrics) String() string {
 func (*NetworkMetrics) ProtoMessage() {}
 
 func (x *NetworkMetrics) ProtoReflect() protoreflect.Message {
-	mi := &file_agent_proto_msgTypes[20]
+	mi := &file_agent_proto_msgTypes[40]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -1658,7 +3260,7 @@ func (x *NetworkMetrics) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use NetworkMetrics.ProtoReflect.Descriptor instead.
 func (*NetworkMetrics) Descriptor() ([]byte, []int) {
-	return file_agent_proto_rawDescGZIP(), []int{20}
+	return file_agent_proto_rawDescGZIP(), []int{40}
 }
 
 func (x *NetworkMetrics) GetInterface() string {
@@ -1724,6 +3326,135 @@ func (x *NetworkMetrics) GetDropsOut() int64 {
 	return 0
 }
 
+func (x *NetworkMetrics) GetBytesSentPerSec() float64 {
+	if x != nil {
+		return x.BytesSentPerSec
+	}
+	return 0
+}
+
+func (x *NetworkMetrics) GetBytesRecvPerSec() float64 {
+	if x != nil {
+		return x.BytesRecvPerSec
+	}
+	return 0
+}
+
+func (x *NetworkMetrics) GetPacketsSentPerSec() float64 {
+	if x != nil {
+		return x.PacketsSentPerSec
+	}
+	return 0
+}
+
+func (x *NetworkMetrics) GetPacketsRecvPerSec() float64 {
+	if x != nil {
+		return x.PacketsRecvPerSec
+	}
+	return 0
+}
+
+// Activity of a block device since the previous sample
+type DiskIOMetrics struct {
+	state            protoimpl.MessageState `protogen:"open.v1"`
+	Device           string                 `protobuf:"bytes,1,opt,name=device,proto3" json:"device,omitempty"`
+	ReadsPerSec      float64                `protobuf:"fixed64,2,opt,name=reads_per_sec,json=readsPerSec,proto3" json:"reads_per_sec,omitempty"`
+	WritesPerSec     float64                `protobuf:"fixed64,3,opt,name=writes_per_sec,json=writesPerSec,proto3" json:"writes_per_sec,omitempty"`
+	ReadBytesPerSec  float64                `protobuf:"fixed64,4,opt,name=read_bytes_per_sec,json=readBytesPerSec,proto3" json:"read_bytes_per_sec,omitempty"`
+	WriteBytesPerSec float64                `protobuf:"fixed64,5,opt,name=write_bytes_per_sec,json=writeBytesPerSec,proto3" json:"write_bytes_per_sec,omitempty"`
+	UtilPercent      float64                `protobuf:"fixed64,6,opt,name=util_percent,json=utilPercent,proto3" json:"util_percent,omitempty"`      // time the device was busy, where the platform reports it
+	ReadAwaitMs      float64                `protobuf:"fixed64,7,opt,name=read_await_ms,json=readAwaitMs,proto3" json:"read_await_ms,omitempty"`    // average time a read took
+	WriteAwaitMs     float64                `protobuf:"fixed64,8,opt,name=write_await_ms,json=writeAwaitMs,proto3" json:"write_await_ms,omitempty"` // average time a write took
+	unknownFields    protoimpl.UnknownFields
+	sizeCache        protoimpl.SizeCache
+}
+
+func (x *DiskIOMetrics) Reset() {
+	*x = DiskIOMetrics{}
+	mi := &file_agent_proto_msgTypes[41]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DiskIOMetrics) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DiskIOMetrics) ProtoMessage() {}
+
+func (x *DiskIOMetrics) ProtoReflect() protoreflect.Message {
+	mi := &file_agent_proto_msgTypes[41]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DiskIOMetrics.ProtoReflect.Descriptor instead.
+func (*DiskIOMetrics) Descriptor() ([]byte, []int) {
+	return file_agent_proto_rawDescGZIP(), []int{41}
+}
+
+func (x *DiskIOMetrics) GetDevice() string {
+	if x != nil {
+		return x.Device
+	}
+	return ""
+}
+
+func (x *DiskIOMetrics) GetReadsPerSec() float64 {
+	if x != nil {
+		return x.ReadsPerSec
+	}
+	return 0
+}
+
+func (x *DiskIOMetrics) GetWritesPerSec() float64 {
+	if x != nil {
+		return x.WritesPerSec
+	}
+	return 0
+}
+
+func (x *DiskIOMetrics) GetReadBytesPerSec() float64 {
+	if x != nil {
+		return x.ReadBytesPerSec
+	}
+	return 0
+}
+
+func (x *DiskIOMetrics) GetWriteBytesPerSec() float64 {
+	if x != nil {
+		return x.WriteBytesPerSec
+	}
+	return 0
+}
+
+func (x *DiskIOMetrics) GetUtilPercent() float64 {
+	if x != nil {
+		return x.UtilPercent
+	}
+	return 0
+}
+
+func (x *DiskIOMetrics) GetReadAwaitMs() float64 {
+	if x != nil {
+		return x.ReadAwaitMs
+	}
+	return 0
+}
+
+func (x *DiskIOMetrics) GetWriteAwaitMs() float64 {
+	if x != nil {
+		return x.WriteAwaitMs
+	}
+	return 0
+}
+
 type ProcessMetrics struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
 	Pid           int32                  `protobuf:"varint,1,opt,name=pid,proto3" json:"pid,omitempty"`
@@ -1740,7 +3471,7 @@ type ProcessMetrics struct {
 
 func (x *ProcessMetrics) Reset() {
 	*x = ProcessMetrics{}
-	mi := &file_agent_proto_msgTypes[21]
+	mi := &file_agent_proto_msgTypes[42]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -1752,7 +3483,7 @@ func (x *ProcessMetrics) String() string {
 func (*ProcessMetrics) ProtoMessage() {}
 
 func (x *ProcessMetrics) ProtoReflect() protoreflect.Message {
-	mi := &file_agent_proto_msgTypes[21]
+	mi := &file_agent_proto_msgTypes[42]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -1765,7 +3496,7 @@ func (x *ProcessMetrics) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use ProcessMetrics.ProtoReflect.Descriptor instead.
 func (*ProcessMetrics) Descriptor() ([]byte, []int) {
-	return file_agent_proto_rawDescGZIP(), []int{21}
+	return file_agent_proto_rawDescGZIP(), []int{42}
 }
 
 func (x *ProcessMetrics) GetPid() int32 {
@@ -1824,11 +3555,133 @@ func (x *ProcessMetrics) GetNumThreads() int32 {
 	return 0
 }
 
+// Credential rotation messages
+type CredentialRotationRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	RotationId    string                 `protobuf:"bytes,1,opt,name=rotation_id,json=rotationId,proto3" json:"rotation_id,omitempty"`
+	AgentToken    string                 `protobuf:"bytes,2,opt,name=agent_token,json=agentToken,proto3" json:"agent_token,omitempty"` // new token to use from the next connection on
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CredentialRotationRequest) Reset() {
+	*x = CredentialRotationRequest{}
+	mi := &file_agent_proto_msgTypes[43]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CredentialRotationRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CredentialRotationRequest) ProtoMessage() {}
+
+func (x *CredentialRotationRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_agent_proto_msgTypes[43]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CredentialRotationRequest.ProtoReflect.Descriptor instead.
+func (*CredentialRotationRequest) Descriptor() ([]byte, []int) {
+	return file_agent_proto_rawDescGZIP(), []int{43}
+}
+
+func (x *CredentialRotationRequest) GetRotationId() string {
+	if x != nil {
+		return x.RotationId
+	}
+	return ""
+}
+
+func (x *CredentialRotationRequest) GetAgentToken() string {
+	if x != nil {
+		return x.AgentToken
+	}
+	return ""
+}
+
+type CredentialRotationResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	RotationId    string                 `protobuf:"bytes,1,opt,name=rotation_id,json=rotationId,proto3" json:"rotation_id,omitempty"`
+	Success       bool                   `protobuf:"varint,2,opt,name=success,proto3" json:"success,omitempty"` // true once the new token is persisted
+	Error         string                 `protobuf:"bytes,3,opt,name=error,proto3" json:"error,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CredentialRotationResponse) Reset() {
+	*x = CredentialRotationResponse{}
+	mi := &file_agent_proto_msgTypes[44]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CredentialRotationResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CredentialRotationResponse) ProtoMessage() {}
+
+func (x *CredentialRotationResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_agent_proto_msgTypes[44]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CredentialRotationResponse.ProtoReflect.Descriptor instead.
+func (*CredentialRotationResponse) Descriptor() ([]byte, []int) {
+	return file_agent_proto_rawDescGZIP(), []int{44}
+}
+
+func (x *CredentialRotationResponse) GetRotationId() string {
+	if x != nil {
+		return x.RotationId
+	}
+	return ""
+}
+
+func (x *CredentialRotationResponse) GetSuccess() bool {
+	if x != nil {
+		return x.Success
+	}
+	return false
+}
+
+func (x *CredentialRotationResponse) GetError() string {
+	if x != nil {
+		return x.Error
+	}
+	return ""
+}
+
 var File_agent_proto protoreflect.FileDescriptor
 
 const file_agent_proto_rawDesc = "" +
 	"\n" +
-	"\vagent.proto\x12\x02pb\"\x80\x04\n" +
+	"\vagent.proto\x12\x02pb\"\x87\x01\n" +
+	"\rEnrollRequest\x12)\n" +
+	"\x10enrollment_token\x18\x01 \x01(\tR\x0fenrollmentToken\x12\x19\n" +
+	"\bagent_id\x18\x02 \x01(\tR\aagentId\x12\x1a\n" +
+	"\bhostname\x18\x03 \x01(\tR\bhostname\x12\x14\n" +
+	"\x05nonce\x18\x04 \x01(\tR\x05nonce\"L\n" +
+	"\x0eEnrollResponse\x12\x19\n" +
+	"\bagent_id\x18\x01 \x01(\tR\aagentId\x12\x1f\n" +
+	"\vagent_token\x18\x02 \x01(\tR\n" +
+	"agentToken\"\xd5\b\n" +
 	"\rServerMessage\x12\x1e\n" +
 	"\x04ping\x18\x01 \x01(\v2\b.pb.PingH\x00R\x04ping\x12=\n" +
 	"\x0fcommand_request\x18\x02 \x01(\v2\x12.pb.CommandRequestH\x00R\x0ecommandRequest\x12S\n" +
@@ -1836,8 +3689,16 @@ const file_agent_proto_rawDesc = "" +
 	"\x18terminal_command_request\x18\x04 \x01(\v2\x1a.pb.TerminalCommandRequestH\x00R\x16terminalCommandRequest\x12P\n" +
 	"\x16terminal_close_request\x18\x05 \x01(\v2\x18.pb.TerminalCloseRequestH\x00R\x14terminalCloseRequest\x12=\n" +
 	"\x0fmetrics_request\x18\x06 \x01(\v2\x12.pb.MetricsRequestH\x00R\x0emetricsRequest\x12G\n" +
-	"\x13system_info_request\x18\a \x01(\v2\x15.pb.SystemInfoRequestH\x00R\x11systemInfoRequestB\t\n" +
-	"\amessage\"\x91\x04\n" +
+	"\x13system_info_request\x18\a \x01(\v2\x15.pb.SystemInfoRequestH\x00R\x11systemInfoRequest\x12_\n" +
+	"\x1bcredential_rotation_request\x18\b \x01(\v2\x1d.pb.CredentialRotationRequestH\x00R\x19credentialRotationRequest\x12P\n" +
+	"\x16command_cancel_request\x18\t \x01(\v2\x18.pb.CommandCancelRequestH\x00R\x14commandCancelRequest\x12S\n" +
+	"\x17terminal_resize_request\x18\n" +
+	" \x01(\v2\x19.pb.TerminalResizeRequestH\x00R\x15terminalResizeRequest\x12:\n" +
+	"\x0eterminal_input\x18\v \x01(\v2\x11.pb.TerminalInputH\x00R\rterminalInput\x12S\n" +
+	"\x17terminal_signal_request\x18\f \x01(\v2\x19.pb.TerminalSignalRequestH\x00R\x15terminalSignalRequest\x12Y\n" +
+	"\x19metrics_subscribe_request\x18\r \x01(\v2\x1b.pb.MetricsSubscribeRequestH\x00R\x17metricsSubscribeRequest\x12_\n" +
+	"\x1bmetrics_unsubscribe_request\x18\x0e \x01(\v2\x1d.pb.MetricsUnsubscribeRequestH\x00R\x19metricsUnsubscribeRequestB\t\n" +
+	"\amessage\"\xf9\b\n" +
 	"\fAgentMessage\x12\x1e\n" +
 	"\x04pong\x18\x01 \x01(\v2\b.pb.PongH\x00R\x04pong\x12@\n" +
 	"\x10command_response\x18\x02 \x01(\v2\x13.pb.CommandResponseH\x00R\x0fcommandResponse\x12V\n" +
@@ -1845,13 +3706,22 @@ const file_agent_proto_rawDesc = "" +
 	"\x19terminal_command_response\x18\x04 \x01(\v2\x1b.pb.TerminalCommandResponseH\x00R\x17terminalCommandResponse\x12S\n" +
 	"\x17terminal_close_response\x18\x05 \x01(\v2\x19.pb.TerminalCloseResponseH\x00R\x15terminalCloseResponse\x12@\n" +
 	"\x10metrics_response\x18\x06 \x01(\v2\x13.pb.MetricsResponseH\x00R\x0fmetricsResponse\x12J\n" +
-	"\x14system_info_response\x18\a \x01(\v2\x16.pb.SystemInfoResponseH\x00R\x12systemInfoResponseB\t\n" +
+	"\x14system_info_response\x18\a \x01(\v2\x16.pb.SystemInfoResponseH\x00R\x12systemInfoResponse\x12h\n" +
+	"\x1eterminal_sessions_announcement\x18\b \x01(\v2 .pb.TerminalSessionsAnnouncementH\x00R\x1cterminalSessionsAnnouncement\x12b\n" +
+	"\x1ccredential_rotation_response\x18\t \x01(\v2\x1e.pb.CredentialRotationResponseH\x00R\x1acredentialRotationResponse\x12:\n" +
+	"\x0ecommand_output\x18\n" +
+	" \x01(\v2\x11.pb.CommandOutputH\x00R\rcommandOutput\x124\n" +
+	"\fcommand_exit\x18\v \x01(\v2\x0f.pb.CommandExitH\x00R\vcommandExit\x12S\n" +
+	"\x17command_cancel_response\x18\f \x01(\v2\x19.pb.CommandCancelResponseH\x00R\x15commandCancelResponse\x12=\n" +
+	"\x0fterminal_output\x18\r \x01(\v2\x12.pb.TerminalOutputH\x00R\x0eterminalOutput\x12\\\n" +
+	"\x1ametrics_subscribe_response\x18\x0e \x01(\v2\x1c.pb.MetricsSubscribeResponseH\x00R\x18metricsSubscribeResponse\x124\n" +
+	"\fmetrics_push\x18\x0f \x01(\v2\x0f.pb.MetricsPushH\x00R\vmetricsPushB\t\n" +
 	"\amessage\"$\n" +
 	"\x04Ping\x12\x1c\n" +
 	"\ttimestamp\x18\x01 \x01(\x03R\ttimestamp\"K\n" +
 	"\x04Pong\x12\x1c\n" +
 	"\ttimestamp\x18\x01 \x01(\x03R\ttimestamp\x12%\n" +
-	"\x0eping_timestamp\x18\x02 \x01(\x03R\rpingTimestamp\"\x8e\x02\n" +
+	"\x0eping_timestamp\x18\x02 \x01(\x03R\rpingTimestamp\"\xa6\x02\n" +
 	"\x0eCommandRequest\x12\x1d\n" +
 	"\n" +
 	"request_id\x18\x01 \x01(\tR\trequestId\x12\x18\n" +
@@ -1860,10 +3730,11 @@ const file_agent_proto_rawDesc = "" +
 	"\x03env\x18\x04 \x03(\v2\x1b.pb.CommandRequest.EnvEntryR\x03env\x12\x1f\n" +
 	"\vworking_dir\x18\x05 \x01(\tR\n" +
 	"workingDir\x12'\n" +
-	"\x0ftimeout_seconds\x18\x06 \x01(\x05R\x0etimeoutSeconds\x1a6\n" +
+	"\x0ftimeout_seconds\x18\x06 \x01(\x05R\x0etimeoutSeconds\x12\x16\n" +
+	"\x06stream\x18\a \x01(\bR\x06stream\x1a6\n" +
 	"\bEnvEntry\x12\x10\n" +
 	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
-	"\x05value\x18\x02 \x01(\tR\x05value:\x028\x01\"\xad\x01\n" +
+	"\x05value\x18\x02 \x01(\tR\x05value:\x028\x01\"\xc9\x01\n" +
 	"\x0fCommandResponse\x12\x1d\n" +
 	"\n" +
 	"request_id\x18\x01 \x01(\tR\trequestId\x12\x1b\n" +
@@ -1871,14 +3742,43 @@ const file_agent_proto_rawDesc = "" +
 	"\x06stdout\x18\x03 \x01(\tR\x06stdout\x12\x16\n" +
 	"\x06stderr\x18\x04 \x01(\tR\x06stderr\x12\x14\n" +
 	"\x05error\x18\x05 \x01(\tR\x05error\x12\x18\n" +
-	"\atimeout\x18\x06 \x01(\bR\atimeout\"\xdb\x01\n" +
+	"\atimeout\x18\x06 \x01(\bR\atimeout\x12\x1a\n" +
+	"\bcanceled\x18\a \x01(\bR\bcanceled\"v\n" +
+	"\rCommandOutput\x12\x1d\n" +
+	"\n" +
+	"request_id\x18\x01 \x01(\tR\trequestId\x12\x1a\n" +
+	"\bsequence\x18\x02 \x01(\x03R\bsequence\x12\x16\n" +
+	"\x06stream\x18\x03 \x01(\tR\x06stream\x12\x12\n" +
+	"\x04data\x18\x04 \x01(\fR\x04data\"\xd2\x01\n" +
+	"\vCommandExit\x12\x1d\n" +
+	"\n" +
+	"request_id\x18\x01 \x01(\tR\trequestId\x12\x1a\n" +
+	"\bsequence\x18\x02 \x01(\x03R\bsequence\x12\x1b\n" +
+	"\texit_code\x18\x03 \x01(\x05R\bexitCode\x12\x14\n" +
+	"\x05error\x18\x04 \x01(\tR\x05error\x12\x18\n" +
+	"\atimeout\x18\x05 \x01(\bR\atimeout\x12\x1f\n" +
+	"\vduration_ms\x18\x06 \x01(\x03R\n" +
+	"durationMs\x12\x1a\n" +
+	"\bcanceled\x18\a \x01(\bR\bcanceled\"r\n" +
+	"\x14CommandCancelRequest\x12\x1d\n" +
+	"\n" +
+	"request_id\x18\x01 \x01(\tR\trequestId\x12\x16\n" +
+	"\x06signal\x18\x02 \x01(\tR\x06signal\x12#\n" +
+	"\rgrace_seconds\x18\x03 \x01(\x05R\fgraceSeconds\"f\n" +
+	"\x15CommandCancelResponse\x12\x1d\n" +
+	"\n" +
+	"request_id\x18\x01 \x01(\tR\trequestId\x12\x18\n" +
+	"\asuccess\x18\x02 \x01(\bR\asuccess\x12\x14\n" +
+	"\x05error\x18\x03 \x01(\tR\x05error\"\x83\x02\n" +
 	"\x15TerminalCreateRequest\x12\x1d\n" +
 	"\n" +
 	"session_id\x18\x01 \x01(\tR\tsessionId\x12\x14\n" +
 	"\x05shell\x18\x02 \x01(\tR\x05shell\x12\x1f\n" +
 	"\vworking_dir\x18\x03 \x01(\tR\n" +
 	"workingDir\x124\n" +
-	"\x03env\x18\x04 \x03(\v2\".pb.TerminalCreateRequest.EnvEntryR\x03env\x1a6\n" +
+	"\x03env\x18\x04 \x03(\v2\".pb.TerminalCreateRequest.EnvEntryR\x03env\x12\x12\n" +
+	"\x04rows\x18\x05 \x01(\rR\x04rows\x12\x12\n" +
+	"\x04cols\x18\x06 \x01(\rR\x04cols\x1a6\n" +
 	"\bEnvEntry\x12\x10\n" +
 	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
 	"\x05value\x18\x02 \x01(\tR\x05value:\x028\x01\"\x9e\x01\n" +
@@ -1895,7 +3795,7 @@ const file_agent_proto_rawDesc = "" +
 	"session_id\x18\x01 \x01(\tR\tsessionId\x12\x1d\n" +
 	"\n" +
 	"command_id\x18\x02 \x01(\tR\tcommandId\x12\x18\n" +
-	"\acommand\x18\x03 \x01(\tR\acommand\"\xbd\x01\n" +
+	"\acommand\x18\x03 \x01(\tR\acommand\"\xde\x01\n" +
 	"\x17TerminalCommandResponse\x12\x1d\n" +
 	"\n" +
 	"session_id\x18\x01 \x01(\tR\tsessionId\x12\x1d\n" +
@@ -1904,7 +3804,28 @@ const file_agent_proto_rawDesc = "" +
 	"\x06output\x18\x03 \x01(\tR\x06output\x12\x14\n" +
 	"\x05error\x18\x04 \x01(\tR\x05error\x12\x19\n" +
 	"\bis_final\x18\x05 \x01(\bR\aisFinal\x12\x1b\n" +
-	"\texit_code\x18\x06 \x01(\x05R\bexitCode\"5\n" +
+	"\texit_code\x18\x06 \x01(\x05R\bexitCode\x12\x1f\n" +
+	"\vduration_ms\x18\a \x01(\x03R\n" +
+	"durationMs\"b\n" +
+	"\x0eTerminalOutput\x12\x1d\n" +
+	"\n" +
+	"session_id\x18\x01 \x01(\tR\tsessionId\x12\x12\n" +
+	"\x04data\x18\x02 \x01(\fR\x04data\x12\x1d\n" +
+	"\n" +
+	"command_id\x18\x03 \x01(\tR\tcommandId\"B\n" +
+	"\rTerminalInput\x12\x1d\n" +
+	"\n" +
+	"session_id\x18\x01 \x01(\tR\tsessionId\x12\x12\n" +
+	"\x04data\x18\x02 \x01(\fR\x04data\"N\n" +
+	"\x15TerminalSignalRequest\x12\x1d\n" +
+	"\n" +
+	"session_id\x18\x01 \x01(\tR\tsessionId\x12\x16\n" +
+	"\x06signal\x18\x02 \x01(\tR\x06signal\"^\n" +
+	"\x15TerminalResizeRequest\x12\x1d\n" +
+	"\n" +
+	"session_id\x18\x01 \x01(\tR\tsessionId\x12\x12\n" +
+	"\x04rows\x18\x02 \x01(\rR\x04rows\x12\x12\n" +
+	"\x04cols\x18\x03 \x01(\rR\x04cols\"5\n" +
 	"\x14TerminalCloseRequest\x12\x1d\n" +
 	"\n" +
 	"session_id\x18\x01 \x01(\tR\tsessionId\"f\n" +
@@ -1912,7 +3833,17 @@ const file_agent_proto_rawDesc = "" +
 	"\n" +
 	"session_id\x18\x01 \x01(\tR\tsessionId\x12\x18\n" +
 	"\asuccess\x18\x02 \x01(\bR\asuccess\x12\x14\n" +
-	"\x05error\x18\x03 \x01(\tR\x05error\"/\n" +
+	"\x05error\x18\x03 \x01(\tR\x05error\"S\n" +
+	"\x1cTerminalSessionsAnnouncement\x123\n" +
+	"\bsessions\x18\x01 \x03(\v2\x17.pb.TerminalSessionInfoR\bsessions\"\x8a\x01\n" +
+	"\x13TerminalSessionInfo\x12\x1d\n" +
+	"\n" +
+	"session_id\x18\x01 \x01(\tR\tsessionId\x12\x14\n" +
+	"\x05shell\x18\x02 \x01(\tR\x05shell\x12\x1f\n" +
+	"\vworking_dir\x18\x03 \x01(\tR\n" +
+	"workingDir\x12\x1d\n" +
+	"\n" +
+	"created_at\x18\x04 \x01(\x03R\tcreatedAt\"/\n" +
 	"\x0eMetricsRequest\x12\x1d\n" +
 	"\n" +
 	"request_id\x18\x01 \x01(\tR\trequestId\"s\n" +
@@ -1920,7 +3851,25 @@ const file_agent_proto_rawDesc = "" +
 	"\n" +
 	"request_id\x18\x01 \x01(\tR\trequestId\x12+\n" +
 	"\ametrics\x18\x02 \x01(\v2\x11.pb.SystemMetricsR\ametrics\x12\x14\n" +
-	"\x05error\x18\x03 \x01(\tR\x05error\"2\n" +
+	"\x05error\x18\x03 \x01(\tR\x05error\"\x91\x01\n" +
+	"\x17MetricsSubscribeRequest\x12'\n" +
+	"\x0fsubscription_id\x18\x01 \x01(\tR\x0esubscriptionId\x12\x1f\n" +
+	"\vinterval_ms\x18\x02 \x01(\x03R\n" +
+	"intervalMs\x12\x16\n" +
+	"\x06fields\x18\x03 \x03(\tR\x06fields\x12\x14\n" +
+	"\x05delta\x18\x04 \x01(\bR\x05delta\"Y\n" +
+	"\x18MetricsSubscribeResponse\x12'\n" +
+	"\x0fsubscription_id\x18\x01 \x01(\tR\x0esubscriptionId\x12\x14\n" +
+	"\x05error\x18\x02 \x01(\tR\x05error\"D\n" +
+	"\x19MetricsUnsubscribeRequest\x12'\n" +
+	"\x0fsubscription_id\x18\x01 \x01(\tR\x0esubscriptionId\"\xc7\x01\n" +
+	"\vMetricsPush\x12'\n" +
+	"\x0fsubscription_id\x18\x01 \x01(\tR\x0esubscriptionId\x12\x1a\n" +
+	"\bsequence\x18\x02 \x01(\x04R\bsequence\x12+\n" +
+	"\ametrics\x18\x03 \x01(\v2\x11.pb.SystemMetricsR\ametrics\x12\x12\n" +
+	"\x04full\x18\x04 \x01(\bR\x04full\x12\x1c\n" +
+	"\tunchanged\x18\x05 \x03(\tR\tunchanged\x12\x14\n" +
+	"\x05error\x18\x06 \x01(\tR\x05error\"2\n" +
 	"\x11SystemInfoRequest\x12\x1d\n" +
 	"\n" +
 	"request_id\x18\x01 \x01(\tR\trequestId\"z\n" +
@@ -1941,7 +3890,7 @@ const file_agent_proto_rawDesc = "" +
 	"\ftotal_memory\x18\x06 \x01(\x03R\vtotalMemory\x12-\n" +
 	"\x12network_interfaces\x18\a \x03(\tR\x11networkInterfaces\x12%\n" +
 	"\x0ekernel_version\x18\b \x01(\tR\rkernelVersion\x12%\n" +
-	"\x0euptime_seconds\x18\t \x01(\x03R\ruptimeSeconds\"\x9a\x03\n" +
+	"\x0euptime_seconds\x18\t \x01(\x03R\ruptimeSeconds\"\xde\x04\n" +
 	"\rSystemMetrics\x12*\n" +
 	"\x11cpu_usage_percent\x18\x01 \x01(\x01R\x0fcpuUsagePercent\x12)\n" +
 	"\x06memory\x18\x02 \x01(\v2\x11.pb.MemoryMetricsR\x06memory\x12%\n" +
@@ -1951,7 +3900,33 @@ const file_agent_proto_rawDesc = "" +
 	"\ttimestamp\x18\x06 \x01(\x03R\ttimestamp\x12&\n" +
 	"\x0fload_average_1m\x18\a \x01(\x01R\rloadAverage1m\x12&\n" +
 	"\x0fload_average_5m\x18\b \x01(\x01R\rloadAverage5m\x12(\n" +
-	"\x10load_average_15m\x18\t \x01(\x01R\x0eloadAverage15m\"\xc0\x01\n" +
+	"\x10load_average_15m\x18\t \x01(\x01R\x0eloadAverage15m\x12*\n" +
+	"\adisk_io\x18\n" +
+	" \x03(\v2\x11.pb.DiskIOMetricsR\x06diskIo\x123\n" +
+	"\x16cpu_core_usage_percent\x18\v \x03(\x01R\x13cpuCoreUsagePercent\x120\n" +
+	"\tcpu_times\x18\f \x01(\v2\x13.pb.CPUTimesMetricsR\bcpuTimes\x12/\n" +
+	"\bpressure\x18\r \x01(\v2\x13.pb.PressureMetricsR\bpressure\"\xbf\x01\n" +
+	"\x0fCPUTimesMetrics\x12\x12\n" +
+	"\x04user\x18\x01 \x01(\x01R\x04user\x12\x16\n" +
+	"\x06system\x18\x02 \x01(\x01R\x06system\x12\x12\n" +
+	"\x04idle\x18\x03 \x01(\x01R\x04idle\x12\x12\n" +
+	"\x04nice\x18\x04 \x01(\x01R\x04nice\x12\x16\n" +
+	"\x06iowait\x18\x05 \x01(\x01R\x06iowait\x12\x10\n" +
+	"\x03irq\x18\x06 \x01(\x01R\x03irq\x12\x18\n" +
+	"\asoftirq\x18\a \x01(\x01R\asoftirq\x12\x14\n" +
+	"\x05steal\x18\b \x01(\x01R\x05steal\"\x84\x01\n" +
+	"\x0fPressureMetrics\x12#\n" +
+	"\x03cpu\x18\x01 \x01(\v2\x11.pb.PressureStallR\x03cpu\x12)\n" +
+	"\x06memory\x18\x02 \x01(\v2\x11.pb.PressureStallR\x06memory\x12!\n" +
+	"\x02io\x18\x03 \x01(\v2\x11.pb.PressureStallR\x02io\"c\n" +
+	"\rPressureStall\x12(\n" +
+	"\x04some\x18\x01 \x01(\v2\x14.pb.PressureAveragesR\x04some\x12(\n" +
+	"\x04full\x18\x02 \x01(\v2\x14.pb.PressureAveragesR\x04full\"q\n" +
+	"\x10PressureAverages\x12\x14\n" +
+	"\x05avg10\x18\x01 \x01(\x01R\x05avg10\x12\x14\n" +
+	"\x05avg60\x18\x02 \x01(\x01R\x05avg60\x12\x16\n" +
+	"\x06avg300\x18\x03 \x01(\x01R\x06avg300\x12\x19\n" +
+	"\btotal_us\x18\x04 \x01(\x03R\atotalUs\"\xc0\x01\n" +
 	"\rMemoryMetrics\x12\x14\n" +
 	"\x05total\x18\x01 \x01(\x03R\x05total\x12\x1c\n" +
 	"\tavailable\x18\x02 \x01(\x03R\tavailable\x12\x12\n" +
@@ -1971,7 +3946,7 @@ const file_agent_proto_rawDesc = "" +
 	"\x05total\x18\x04 \x01(\x03R\x05total\x12\x12\n" +
 	"\x04used\x18\x05 \x01(\x03R\x04used\x12\x12\n" +
 	"\x04free\x18\x06 \x01(\x03R\x04free\x12!\n" +
-	"\fused_percent\x18\a \x01(\x01R\vusedPercent\"\xa6\x02\n" +
+	"\fused_percent\x18\a \x01(\x01R\vusedPercent\"\xe2\x03\n" +
 	"\x0eNetworkMetrics\x12\x1c\n" +
 	"\tinterface\x18\x01 \x01(\tR\tinterface\x12\x1d\n" +
 	"\n" +
@@ -1984,7 +3959,21 @@ const file_agent_proto_rawDesc = "" +
 	"\n" +
 	"errors_out\x18\a \x01(\x03R\terrorsOut\x12\x19\n" +
 	"\bdrops_in\x18\b \x01(\x03R\adropsIn\x12\x1b\n" +
-	"\tdrops_out\x18\t \x01(\x03R\bdropsOut\"\xef\x01\n" +
+	"\tdrops_out\x18\t \x01(\x03R\bdropsOut\x12+\n" +
+	"\x12bytes_sent_per_sec\x18\n" +
+	" \x01(\x01R\x0fbytesSentPerSec\x12+\n" +
+	"\x12bytes_recv_per_sec\x18\v \x01(\x01R\x0fbytesRecvPerSec\x12/\n" +
+	"\x14packets_sent_per_sec\x18\f \x01(\x01R\x11packetsSentPerSec\x12/\n" +
+	"\x14packets_recv_per_sec\x18\r \x01(\x01R\x11packetsRecvPerSec\"\xba\x02\n" +
+	"\rDiskIOMetrics\x12\x16\n" +
+	"\x06device\x18\x01 \x01(\tR\x06device\x12\"\n" +
+	"\rreads_per_sec\x18\x02 \x01(\x01R\vreadsPerSec\x12$\n" +
+	"\x0ewrites_per_sec\x18\x03 \x01(\x01R\fwritesPerSec\x12+\n" +
+	"\x12read_bytes_per_sec\x18\x04 \x01(\x01R\x0freadBytesPerSec\x12-\n" +
+	"\x13write_bytes_per_sec\x18\x05 \x01(\x01R\x10writeBytesPerSec\x12!\n" +
+	"\futil_percent\x18\x06 \x01(\x01R\vutilPercent\x12\"\n" +
+	"\rread_await_ms\x18\a \x01(\x01R\vreadAwaitMs\x12$\n" +
+	"\x0ewrite_await_ms\x18\b \x01(\x01R\fwriteAwaitMs\"\xef\x01\n" +
 	"\x0eProcessMetrics\x12\x10\n" +
 	"\x03pid\x18\x01 \x01(\x05R\x03pid\x12\x12\n" +
 	"\x04name\x18\x02 \x01(\tR\x04name\x12\x1f\n" +
@@ -1998,9 +3987,20 @@ const file_agent_proto_rawDesc = "" +
 	"\vcreate_time\x18\a \x01(\x03R\n" +
 	"createTime\x12\x1f\n" +
 	"\vnum_threads\x18\b \x01(\x05R\n" +
-	"numThreads2N\n" +
+	"numThreads\"]\n" +
+	"\x19CredentialRotationRequest\x12\x1f\n" +
+	"\vrotation_id\x18\x01 \x01(\tR\n" +
+	"rotationId\x12\x1f\n" +
+	"\vagent_token\x18\x02 \x01(\tR\n" +
+	"agentToken\"m\n" +
+	"\x1aCredentialRotationResponse\x12\x1f\n" +
+	"\vrotation_id\x18\x01 \x01(\tR\n" +
+	"rotationId\x12\x18\n" +
+	"\asuccess\x18\x02 \x01(\bR\asuccess\x12\x14\n" +
+	"\x05error\x18\x03 \x01(\tR\x05error2\x7f\n" +
 	"\fAgentService\x12>\n" +
-	"\x13StreamCommunication\x12\x10.pb.AgentMessage\x1a\x11.pb.ServerMessage(\x010\x01B'Z%github.com/mooncorn/nodelink/proto/pbb\x06proto3"
+	"\x13StreamCommunication\x12\x10.pb.AgentMessage\x1a\x11.pb.ServerMessage(\x010\x01\x12/\n" +
+	"\x06Enroll\x12\x11.pb.EnrollRequest\x1a\x12.pb.EnrollResponseB'Z%github.com/mooncorn/nodelink/proto/pbb\x06proto3"
 
 var (
 	file_agent_proto_rawDescOnce sync.Once
@@ -2014,63 +4014,113 @@ func file_agent_proto_rawDescGZIP() []byte {
 	return file_agent_proto_rawDescData
 }
 
-var file_agent_proto_msgTypes = make([]protoimpl.MessageInfo, 24)
+var file_agent_proto_msgTypes = make([]protoimpl.MessageInfo, 47)
 var file_agent_proto_goTypes = []any{
-	(*ServerMessage)(nil),           // 0: pb.ServerMessage
-	(*AgentMessage)(nil),            // 1: pb.AgentMessage
-	(*Ping)(nil),                    // 2: pb.Ping
-	(*Pong)(nil),                    // 3: pb.Pong
-	(*CommandRequest)(nil),          // 4: pb.CommandRequest
-	(*CommandResponse)(nil),         // 5: pb.CommandResponse
-	(*TerminalCreateRequest)(nil),   // 6: pb.TerminalCreateRequest
-	(*TerminalCreateResponse)(nil),  // 7: pb.TerminalCreateResponse
-	(*TerminalCommandRequest)(nil),  // 8: pb.TerminalCommandRequest
-	(*TerminalCommandResponse)(nil), // 9: pb.TerminalCommandResponse
-	(*TerminalCloseRequest)(nil),    // 10: pb.TerminalCloseRequest
-	(*TerminalCloseResponse)(nil),   // 11: pb.TerminalCloseResponse
-	(*MetricsRequest)(nil),          // 12: pb.MetricsRequest
-	(*MetricsResponse)(nil),         // 13: pb.MetricsResponse
-	(*SystemInfoRequest)(nil),       // 14: pb.SystemInfoRequest
-	(*SystemInfoResponse)(nil),      // 15: pb.SystemInfoResponse
-	(*SystemInfo)(nil),              // 16: pb.SystemInfo
-	(*SystemMetrics)(nil),           // 17: pb.SystemMetrics
-	(*MemoryMetrics)(nil),           // 18: pb.MemoryMetrics
-	(*DiskMetrics)(nil),             // 19: pb.DiskMetrics
-	(*NetworkMetrics)(nil),          // 20: pb.NetworkMetrics
-	(*ProcessMetrics)(nil),          // 21: pb.ProcessMetrics
-	nil,                             // 22: pb.CommandRequest.EnvEntry
-	nil,                             // 23: pb.TerminalCreateRequest.EnvEntry
+	(*EnrollRequest)(nil),                // 0: pb.EnrollRequest
+	(*EnrollResponse)(nil),               // 1: pb.EnrollResponse
+	(*ServerMessage)(nil),                // 2: pb.ServerMessage
+	(*AgentMessage)(nil),                 // 3: pb.AgentMessage
+	(*Ping)(nil),                         // 4: pb.Ping
+	(*Pong)(nil),                         // 5: pb.Pong
+	(*CommandRequest)(nil),               // 6: pb.CommandRequest
+	(*CommandResponse)(nil),              // 7: pb.CommandResponse
+	(*CommandOutput)(nil),                // 8: pb.CommandOutput
+	(*CommandExit)(nil),                  // 9: pb.CommandExit
+	(*CommandCancelRequest)(nil),         // 10: pb.CommandCancelRequest
+	(*CommandCancelResponse)(nil),        // 11: pb.CommandCancelResponse
+	(*TerminalCreateRequest)(nil),        // 12: pb.TerminalCreateRequest
+	(*TerminalCreateResponse)(nil),       // 13: pb.TerminalCreateResponse
+	(*TerminalCommandRequest)(nil),       // 14: pb.TerminalCommandRequest
+	(*TerminalCommandResponse)(nil),      // 15: pb.TerminalCommandResponse
+	(*TerminalOutput)(nil),               // 16: pb.TerminalOutput
+	(*TerminalInput)(nil),                // 17: pb.TerminalInput
+	(*TerminalSignalRequest)(nil),        // 18: pb.TerminalSignalRequest
+	(*TerminalResizeRequest)(nil),        // 19: pb.TerminalResizeRequest
+	(*TerminalCloseRequest)(nil),         // 20: pb.TerminalCloseRequest
+	(*TerminalCloseResponse)(nil),        // 21: pb.TerminalCloseResponse
+	(*TerminalSessionsAnnouncement)(nil), // 22: pb.TerminalSessionsAnnouncement
+	(*TerminalSessionInfo)(nil),          // 23: pb.TerminalSessionInfo
+	(*MetricsRequest)(nil),               // 24: pb.MetricsRequest
+	(*MetricsResponse)(nil),              // 25: pb.MetricsResponse
+	(*MetricsSubscribeRequest)(nil),      // 26: pb.MetricsSubscribeRequest
+	(*MetricsSubscribeResponse)(nil),     // 27: pb.MetricsSubscribeResponse
+	(*MetricsUnsubscribeRequest)(nil),    // 28: pb.MetricsUnsubscribeRequest
+	(*MetricsPush)(nil),                  // 29: pb.MetricsPush
+	(*SystemInfoRequest)(nil),            // 30: pb.SystemInfoRequest
+	(*SystemInfoResponse)(nil),           // 31: pb.SystemInfoResponse
+	(*SystemInfo)(nil),                   // 32: pb.SystemInfo
+	(*SystemMetrics)(nil),                // 33: pb.SystemMetrics
+	(*CPUTimesMetrics)(nil),              // 34: pb.CPUTimesMetrics
+	(*PressureMetrics)(nil),              // 35: pb.PressureMetrics
+	(*PressureStall)(nil),                // 36: pb.PressureStall
+	(*PressureAverages)(nil),             // 37: pb.PressureAverages
+	(*MemoryMetrics)(nil),                // 38: pb.MemoryMetrics
+	(*DiskMetrics)(nil),                  // 39: pb.DiskMetrics
+	(*NetworkMetrics)(nil),               // 40: pb.NetworkMetrics
+	(*DiskIOMetrics)(nil),                // 41: pb.DiskIOMetrics
+	(*ProcessMetrics)(nil),               // 42: pb.ProcessMetrics
+	(*CredentialRotationRequest)(nil),    // 43: pb.CredentialRotationRequest
+	(*CredentialRotationResponse)(nil),   // 44: pb.CredentialRotationResponse
+	nil,                                  // 45: pb.CommandRequest.EnvEntry
+	nil,                                  // 46: pb.TerminalCreateRequest.EnvEntry
 }
 var file_agent_proto_depIdxs = []int32{
-	2,  // 0: pb.ServerMessage.ping:type_name -> pb.Ping
-	4,  // 1: pb.ServerMessage.command_request:type_name -> pb.CommandRequest
-	6,  // 2: pb.ServerMessage.terminal_create_request:type_name -> pb.TerminalCreateRequest
-	8,  // 3: pb.ServerMessage.terminal_command_request:type_name -> pb.TerminalCommandRequest
-	10, // 4: pb.ServerMessage.terminal_close_request:type_name -> pb.TerminalCloseRequest
-	12, // 5: pb.ServerMessage.metrics_request:type_name -> pb.MetricsRequest
-	14, // 6: pb.ServerMessage.system_info_request:type_name -> pb.SystemInfoRequest
-	3,  // 7: pb.AgentMessage.pong:type_name -> pb.Pong
-	5,  // 8: pb.AgentMessage.command_response:type_name -> pb.CommandResponse
-	7,  // 9: pb.AgentMessage.terminal_create_response:type_name -> pb.TerminalCreateResponse
-	9,  // 10: pb.AgentMessage.terminal_command_response:type_name -> pb.TerminalCommandResponse
-	11, // 11: pb.AgentMessage.terminal_close_response:type_name -> pb.TerminalCloseResponse
-	13, // 12: pb.AgentMessage.metrics_response:type_name -> pb.MetricsResponse
-	15, // 13: pb.AgentMessage.system_info_response:type_name -> pb.SystemInfoResponse
-	22, // 14: pb.CommandRequest.env:type_name -> pb.CommandRequest.EnvEntry
-	23, // 15: pb.TerminalCreateRequest.env:type_name -> pb.TerminalCreateRequest.EnvEntry
-	17, // 16: pb.MetricsResponse.metrics:type_name -> pb.SystemMetrics
-	16, // 17: pb.SystemInfoResponse.system_info:type_name -> pb.SystemInfo
-	18, // 18: pb.SystemMetrics.memory:type_name -> pb.MemoryMetrics
-	19, // 19: pb.SystemMetrics.disks:type_name -> pb.DiskMetrics
-	20, // 20: pb.SystemMetrics.network_interfaces:type_name -> pb.NetworkMetrics
-	21, // 21: pb.SystemMetrics.processes:type_name -> pb.ProcessMetrics
-	1,  // 22: pb.AgentService.StreamCommunication:input_type -> pb.AgentMessage
-	0,  // 23: pb.AgentService.StreamCommunication:output_type -> pb.ServerMessage
-	23, // [23:24] is the sub-list for method output_type
-	22, // [22:23] is the sub-list for method input_type
-	22, // [22:22] is the sub-list for extension type_name
-	22, // [22:22] is the sub-list for extension extendee
-	0,  // [0:22] is the sub-list for field type_name
+	4,  // 0: pb.ServerMessage.ping:type_name -> pb.Ping
+	6,  // 1: pb.ServerMessage.command_request:type_name -> pb.CommandRequest
+	12, // 2: pb.ServerMessage.terminal_create_request:type_name -> pb.TerminalCreateRequest
+	14, // 3: pb.ServerMessage.terminal_command_request:type_name -> pb.TerminalCommandRequest
+	20, // 4: pb.ServerMessage.terminal_close_request:type_name -> pb.TerminalCloseRequest
+	24, // 5: pb.ServerMessage.metrics_request:type_name -> pb.MetricsRequest
+	30, // 6: pb.ServerMessage.system_info_request:type_name -> pb.SystemInfoRequest
+	43, // 7: pb.ServerMessage.credential_rotation_request:type_name -> pb.CredentialRotationRequest
+	10, // 8: pb.ServerMessage.command_cancel_request:type_name -> pb.CommandCancelRequest
+	19, // 9: pb.ServerMessage.terminal_resize_request:type_name -> pb.TerminalResizeRequest
+	17, // 10: pb.ServerMessage.terminal_input:type_name -> pb.TerminalInput
+	18, // 11: pb.ServerMessage.terminal_signal_request:type_name -> pb.TerminalSignalRequest
+	26, // 12: pb.ServerMessage.metrics_subscribe_request:type_name -> pb.MetricsSubscribeRequest
+	28, // 13: pb.ServerMessage.metrics_unsubscribe_request:type_name -> pb.MetricsUnsubscribeRequest
+	5,  // 14: pb.AgentMessage.pong:type_name -> pb.Pong
+	7,  // 15: pb.AgentMessage.command_response:type_name -> pb.CommandResponse
+	13, // 16: pb.AgentMessage.terminal_create_response:type_name -> pb.TerminalCreateResponse
+	15, // 17: pb.AgentMessage.terminal_command_response:type_name -> pb.TerminalCommandResponse
+	21, // 18: pb.AgentMessage.terminal_close_response:type_name -> pb.TerminalCloseResponse
+	25, // 19: pb.AgentMessage.metrics_response:type_name -> pb.MetricsResponse
+	31, // 20: pb.AgentMessage.system_info_response:type_name -> pb.SystemInfoResponse
+	22, // 21: pb.AgentMessage.terminal_sessions_announcement:type_name -> pb.TerminalSessionsAnnouncement
+	44, // 22: pb.AgentMessage.credential_rotation_response:type_name -> pb.CredentialRotationResponse
+	8,  // 23: pb.AgentMessage.command_output:type_name -> pb.CommandOutput
+	9,  // 24: pb.AgentMessage.command_exit:type_name -> pb.CommandExit
+	11, // 25: pb.AgentMessage.command_cancel_response:type_name -> pb.CommandCancelResponse
+	16, // 26: pb.AgentMessage.terminal_output:type_name -> pb.TerminalOutput
+	27, // 27: pb.AgentMessage.metrics_subscribe_response:type_name -> pb.MetricsSubscribeResponse
+	29, // 28: pb.AgentMessage.metrics_push:type_name -> pb.MetricsPush
+	45, // 29: pb.CommandRequest.env:type_name -> pb.CommandRequest.EnvEntry
+	46, // 30: pb.TerminalCreateRequest.env:type_name -> pb.TerminalCreateRequest.EnvEntry
+	23, // 31: pb.TerminalSessionsAnnouncement.sessions:type_name -> pb.TerminalSessionInfo
+	33, // 32: pb.MetricsResponse.metrics:type_name -> pb.SystemMetrics
+	33, // 33: pb.MetricsPush.metrics:type_name -> pb.SystemMetrics
+	32, // 34: pb.SystemInfoResponse.system_info:type_name -> pb.SystemInfo
+	38, // 35: pb.SystemMetrics.memory:type_name -> pb.MemoryMetrics
+	39, // 36: pb.SystemMetrics.disks:type_name -> pb.DiskMetrics
+	40, // 37: pb.SystemMetrics.network_interfaces:type_name -> pb.NetworkMetrics
+	42, // 38: pb.SystemMetrics.processes:type_name -> pb.ProcessMetrics
+	41, // 39: pb.SystemMetrics.disk_io:type_name -> pb.DiskIOMetrics
+	34, // 40: pb.SystemMetrics.cpu_times:type_name -> pb.CPUTimesMetrics
+	35, // 41: pb.SystemMetrics.pressure:type_name -> pb.PressureMetrics
+	36, // 42: pb.PressureMetrics.cpu:type_name -> pb.PressureStall
+	36, // 43: pb.PressureMetrics.memory:type_name -> pb.PressureStall
+	36, // 44: pb.PressureMetrics.io:type_name -> pb.PressureStall
+	37, // 45: pb.PressureStall.some:type_name -> pb.PressureAverages
+	37, // 46: pb.PressureStall.full:type_name -> pb.PressureAverages
+	3,  // 47: pb.AgentService.StreamCommunication:input_type -> pb.AgentMessage
+	0,  // 48: pb.AgentService.Enroll:input_type -> pb.EnrollRequest
+	2,  // 49: pb.AgentService.StreamCommunication:output_type -> pb.ServerMessage
+	1,  // 50: pb.AgentService.Enroll:output_type -> pb.EnrollResponse
+	49, // [49:51] is the sub-list for method output_type
+	47, // [47:49] is the sub-list for method input_type
+	47, // [47:47] is the sub-list for extension type_name
+	47, // [47:47] is the sub-list for extension extendee
+	0,  // [0:47] is the sub-list for field type_name
 }
 
 func init() { file_agent_proto_init() }
@@ -2078,7 +4128,7 @@ func file_agent_proto_init() {
 	if File_agent_proto != nil {
 		return
 	}
-	file_agent_proto_msgTypes[0].OneofWrappers = []any{
+	file_agent_proto_msgTypes[2].OneofWrappers = []any{
 		(*ServerMessage_Ping)(nil),
 		(*ServerMessage_CommandRequest)(nil),
 		(*ServerMessage_TerminalCreateRequest)(nil),
@@ -2086,8 +4136,15 @@ func file_agent_proto_init() {
 		(*ServerMessage_TerminalCloseRequest)(nil),
 		(*ServerMessage_MetricsRequest)(nil),
 		(*ServerMessage_SystemInfoRequest)(nil),
-	}
-	file_agent_proto_msgTypes[1].OneofWrappers = []any{
+		(*ServerMessage_CredentialRotationRequest)(nil),
+		(*ServerMessage_CommandCancelRequest)(nil),
+		(*ServerMessage_TerminalResizeRequest)(nil),
+		(*ServerMessage_TerminalInput)(nil),
+		(*ServerMessage_TerminalSignalRequest)(nil),
+		(*ServerMessage_MetricsSubscribeRequest)(nil),
+		(*ServerMessage_MetricsUnsubscribeRequest)(nil),
+	}
+	file_agent_proto_msgTypes[3].OneofWrappers = []any{
 		(*AgentMessage_Pong)(nil),
 		(*AgentMessage_CommandResponse)(nil),
 		(*AgentMessage_TerminalCreateResponse)(nil),
@@ -2095,6 +4152,14 @@ func file_agent_proto_init() {
 		(*AgentMessage_TerminalCloseResponse)(nil),
 		(*AgentMessage_MetricsResponse)(nil),
 		(*AgentMessage_SystemInfoResponse)(nil),
+		(*AgentMessage_TerminalSessionsAnnouncement)(nil),
+		(*AgentMessage_CredentialRotationResponse)(nil),
+		(*AgentMessage_CommandOutput)(nil),
+		(*AgentMessage_CommandExit)(nil),
+		(*AgentMessage_CommandCancelResponse)(nil),
+		(*AgentMessage_TerminalOutput)(nil),
+		(*AgentMessage_MetricsSubscribeResponse)(nil),
+		(*AgentMessage_MetricsPush)(nil),
 	}
 	type x struct{}
 	out := protoimpl.TypeBuilder{
@@ -2102,7 +4167,7 @@ func file_agent_proto_init() {
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: unsafe.Slice(unsafe.StringData(file_agent_proto_rawDesc), len(file_agent_proto_rawDesc)),
 			NumEnums:      0,
-			NumMessages:   24,
+			NumMessages:   47,
 			NumExtensions: 0,
 			NumServices:   1,
 		},
@@ -1,18 +1,38 @@
 package command
 
 import (
+	"bytes"
 	"context"
 	"fmt"
+	"log"
 	"os/exec"
 	"strings"
+	"sync"
+	"syscall"
 	"time"
 
 	pb "github.com/mooncorn/nodelink/agent/internal/proto"
 )
 
+const (
+	// defaultCancelGrace is how long a canceled command gets before it is killed
+	defaultCancelGrace = 5 * time.Second
+	maxCancelGrace     = 5 * time.Minute
+)
+
+// runningCommand is a started command that can be canceled
+type runningCommand struct {
+	cmd      *exec.Cmd
+	done     chan struct{}
+	canceled bool
+}
+
 // Executor handles command execution on the agent side
 type Executor struct {
 	maxTimeout time.Duration
+
+	mu      sync.Mutex
+	running map[string]*runningCommand
 }
 
 // NewExecutor creates a new command executor
@@ -22,6 +42,7 @@ func NewExecutor(maxTimeout time.Duration) *Executor {
 	}
 	return &Executor{
 		maxTimeout: maxTimeout,
+		running:    make(map[string]*runningCommand),
 	}
 }
 
@@ -31,17 +52,210 @@ func (e *Executor) Execute(req *pb.CommandRequest) *pb.CommandResponse {
 		RequestId: req.RequestId,
 	}
 
-	// Validate timeout
+	ctx, cancel := context.WithTimeout(context.Background(), e.timeout(req))
+	defer cancel()
+
+	cmd := e.buildCommand(ctx, req)
+
+	// Execute command and capture output
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	canceled, err := e.run(req.RequestId, cmd)
+	if err != nil {
+		if canceled {
+			response.Canceled = true
+			response.Error = "command canceled"
+		} else if ctx.Err() == context.DeadlineExceeded {
+			response.Timeout = true
+			response.Error = "command timed out"
+		} else if exitError, ok := err.(*exec.ExitError); ok {
+			response.ExitCode = int32(exitError.ExitCode())
+			response.Stderr = stderr.String()
+		} else {
+			response.Error = err.Error()
+		}
+	}
+
+	response.Stdout = strings.TrimSpace(stdout.String())
+
+	return response
+}
+
+// ExecuteStream runs a command and emits its output in chunks as it is produced,
+// followed by a final exit message
+func (e *Executor) ExecuteStream(req *pb.CommandRequest, emit func(*pb.AgentMessage)) {
+	start := time.Now()
+
+	ctx, cancel := context.WithTimeout(context.Background(), e.timeout(req))
+	defer cancel()
+
+	cmd := e.buildCommand(ctx, req)
+
+	// Both streams share one sequence so the server can order chunks across them
+	var mu sync.Mutex
+	var sequence int64
+	newWriter := func(stream string) *chunkWriter {
+		return &chunkWriter{
+			write: func(data []byte) {
+				mu.Lock()
+				defer mu.Unlock()
+				sequence++
+				emit(&pb.AgentMessage{
+					Message: &pb.AgentMessage_CommandOutput{
+						CommandOutput: &pb.CommandOutput{
+							RequestId: req.RequestId,
+							Sequence:  sequence,
+							Stream:    stream,
+							Data:      data,
+						},
+					},
+				})
+			},
+		}
+	}
+	cmd.Stdout = newWriter("stdout")
+	cmd.Stderr = newWriter("stderr")
+
+	exit := &pb.CommandExit{
+		RequestId: req.RequestId,
+	}
+
+	if canceled, err := e.run(req.RequestId, cmd); err != nil {
+		if canceled {
+			exit.Canceled = true
+			exit.Error = "command canceled"
+		} else if ctx.Err() == context.DeadlineExceeded {
+			exit.Timeout = true
+			exit.Error = "command timed out"
+		} else if exitError, ok := err.(*exec.ExitError); ok {
+			exit.ExitCode = int32(exitError.ExitCode())
+		} else {
+			exit.Error = err.Error()
+		}
+	}
+
+	mu.Lock()
+	exit.Sequence = sequence + 1
+	mu.Unlock()
+	exit.DurationMs = time.Since(start).Milliseconds()
+
+	emit(&pb.AgentMessage{
+		Message: &pb.AgentMessage_CommandExit{
+			CommandExit: exit,
+		},
+	})
+}
+
+// Cancel signals the process group of a running command. Unless the signal is
+// SIGKILL, the group is killed if it is still running after the grace period.
+func (e *Executor) Cancel(req *pb.CommandCancelRequest) error {
+	sig, err := parseSignal(req.Signal)
+	if err != nil {
+		return err
+	}
+
+	grace := time.Duration(req.GraceSeconds) * time.Second
+	if grace <= 0 {
+		grace = defaultCancelGrace
+	}
+	if grace > maxCancelGrace {
+		grace = maxCancelGrace
+	}
+
+	e.mu.Lock()
+	running, exists := e.running[req.RequestId]
+	if exists {
+		running.canceled = true
+	}
+	e.mu.Unlock()
+
+	if !exists {
+		return fmt.Errorf("command %s is not running", req.RequestId)
+	}
+
+	log.Printf("Canceling command %s with %s", req.RequestId, req.Signal)
+	if err := signalProcessGroup(running.cmd, sig); err != nil {
+		return fmt.Errorf("failed to signal command: %w", err)
+	}
+
+	if sig != syscall.SIGKILL {
+		go func() {
+			select {
+			case <-running.done:
+			case <-time.After(grace):
+				log.Printf("Command %s still running after %s, killing it", req.RequestId, grace)
+				signalProcessGroup(running.cmd, syscall.SIGKILL)
+			}
+		}()
+	}
+
+	return nil
+}
+
+// run starts a command in its own process group, tracks it for cancellation and
+// waits for it. It reports whether the command was canceled.
+func (e *Executor) run(requestID string, cmd *exec.Cmd) (bool, error) {
+	setProcessGroup(cmd)
+
+	// On timeout take down the whole group, not just the direct child
+	cmd.Cancel = func() error {
+		return signalProcessGroup(cmd, syscall.SIGKILL)
+	}
+
+	// Don't let background children holding the pipes open keep us waiting forever
+	cmd.WaitDelay = 5 * time.Second
+
+	if err := cmd.Start(); err != nil {
+		return false, err
+	}
+
+	running := &runningCommand{
+		cmd:  cmd,
+		done: make(chan struct{}),
+	}
+
+	e.mu.Lock()
+	e.running[requestID] = running
+	e.mu.Unlock()
+
+	err := cmd.Wait()
+	close(running.done)
+
+	e.mu.Lock()
+	delete(e.running, requestID)
+	canceled := running.canceled
+	e.mu.Unlock()
+
+	return canceled, err
+}
+
+// parseSignal maps a signal name to the signal to send
+func parseSignal(name string) (syscall.Signal, error) {
+	switch name {
+	case "", "SIGTERM":
+		return syscall.SIGTERM, nil
+	case "SIGINT":
+		return syscall.SIGINT, nil
+	case "SIGKILL":
+		return syscall.SIGKILL, nil
+	default:
+		return 0, fmt.Errorf("unsupported signal: %s", name)
+	}
+}
+
+// timeout returns the effective timeout for a request
+func (e *Executor) timeout(req *pb.CommandRequest) time.Duration {
 	timeout := time.Duration(req.TimeoutSeconds) * time.Second
 	if timeout <= 0 || timeout > e.maxTimeout {
 		timeout = e.maxTimeout
 	}
+	return timeout
+}
 
-	// Create context with timeout
-	ctx, cancel := context.WithTimeout(context.Background(), timeout)
-	defer cancel()
-
-	// Prepare command
+// buildCommand prepares the process for a request
+func (e *Executor) buildCommand(ctx context.Context, req *pb.CommandRequest) *exec.Cmd {
 	var cmd *exec.Cmd
 	if len(req.Args) > 0 {
 		cmd = exec.CommandContext(ctx, req.Command, req.Args...)
@@ -64,21 +278,19 @@ func (e *Executor) Execute(req *pb.CommandRequest) *pb.CommandResponse {
 		cmd.Env = env
 	}
 
-	// Execute command and capture output
-	stdout, err := cmd.Output()
-	if err != nil {
-		if ctx.Err() == context.DeadlineExceeded {
-			response.Timeout = true
-			response.Error = "command timed out"
-		} else if exitError, ok := err.(*exec.ExitError); ok {
-			response.ExitCode = int32(exitError.ExitCode())
-			response.Stderr = string(exitError.Stderr)
-		} else {
-			response.Error = err.Error()
-		}
-	}
+	return cmd
+}
 
-	response.Stdout = strings.TrimSpace(string(stdout))
+// chunkWriter forwards every write of a process stream as one output chunk
+type chunkWriter struct {
+	write func(data []byte)
+}
 
-	return response
+// Write implements io.Writer
+func (w *chunkWriter) Write(p []byte) (int, error) {
+	// The caller reuses its buffer, so the chunk needs its own copy
+	data := make([]byte, len(p))
+	copy(data, p)
+	w.write(data)
+	return len(p), nil
 }
@@ -0,0 +1,16 @@
+//go:build !unix
+
+package command
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// setProcessGroup is a no-op where process groups aren't available
+func setProcessGroup(cmd *exec.Cmd) {}
+
+// signalProcessGroup falls back to killing the direct child
+func signalProcessGroup(cmd *exec.Cmd, sig syscall.Signal) error {
+	return cmd.Process.Kill()
+}
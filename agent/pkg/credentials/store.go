@@ -0,0 +1,76 @@
+package credentials
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// DefaultPath is where the agent keeps the credentials it obtained by enrolling
+const DefaultPath = "/var/lib/nodelink/credentials.json"
+
+// Credentials identify the agent to the server
+type Credentials struct {
+	AgentID    string `json:"agent_id"`
+	AgentToken string `json:"agent_token"`
+}
+
+// Load reads credentials from the given file. A missing file is reported with
+// an error satisfying errors.Is(err, os.ErrNotExist).
+func Load(path string) (*Credentials, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var creds Credentials
+	if err := json.Unmarshal(data, &creds); err != nil {
+		return nil, fmt.Errorf("failed to parse credentials file %s: %w", path, err)
+	}
+	if creds.AgentID == "" || creds.AgentToken == "" {
+		return nil, fmt.Errorf("credentials file %s is missing agent_id or agent_token", path)
+	}
+
+	return &creds, nil
+}
+
+// Save atomically writes credentials to the given file, readable only by the owner
+func Save(path string, creds *Credentials) error {
+	data, err := json.MarshalIndent(creds, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode credentials: %w", err)
+	}
+
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return fmt.Errorf("failed to create credentials directory: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(dir, ".credentials-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary credentials file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write credentials: %w", err)
+	}
+	if err := tmp.Chmod(0600); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to set credentials file permissions: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write credentials: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write credentials: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to replace credentials file: %w", err)
+	}
+
+	return nil
+}
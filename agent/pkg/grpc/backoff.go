@@ -0,0 +1,49 @@
+package grpc
+
+import (
+	"math"
+	"math/rand"
+	"time"
+)
+
+// Backoff computes jittered exponential delays between reconnection attempts
+type Backoff struct {
+	Initial    time.Duration
+	Max        time.Duration
+	Multiplier float64
+	Jitter     float64 // fraction of the delay to randomize, 0.0 - 1.0
+
+	attempt int
+}
+
+// DefaultBackoff returns the backoff used for reconnecting to the server
+func DefaultBackoff() *Backoff {
+	return &Backoff{
+		Initial:    1 * time.Second,
+		Max:        60 * time.Second,
+		Multiplier: 2,
+		Jitter:     0.2,
+	}
+}
+
+// Next returns the delay before the next attempt and advances the backoff
+func (b *Backoff) Next() time.Duration {
+	delay := float64(b.Initial) * math.Pow(b.Multiplier, float64(b.attempt))
+	if delay > float64(b.Max) {
+		delay = float64(b.Max)
+	} else {
+		b.attempt++
+	}
+
+	// Spread reconnecting agents out so they don't hit the server in lockstep
+	if b.Jitter > 0 {
+		delay += delay * b.Jitter * (rand.Float64()*2 - 1)
+	}
+
+	return time.Duration(delay)
+}
+
+// Reset starts the backoff over from the initial delay
+func (b *Backoff) Reset() {
+	b.attempt = 0
+}
@@ -2,11 +2,12 @@ package grpc
 
 import (
 	"context"
-	"crypto/tls"
+	"crypto/rand"
+	"encoding/hex"
 	"fmt"
 	"io"
 	"log"
-	"strings"
+	"sync"
 	"time"
 
 	pb "github.com/mooncorn/nodelink/agent/internal/proto"
@@ -14,18 +15,24 @@ import (
 	"github.com/mooncorn/nodelink/agent/pkg/metrics"
 	"github.com/mooncorn/nodelink/agent/pkg/terminal"
 	"google.golang.org/grpc"
-	"google.golang.org/grpc/credentials"
-	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/keepalive"
 	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
 )
 
 type StreamClient struct {
 	conn              *grpc.ClientConn
 	client            pb.AgentServiceClient
+	mu                sync.Mutex // guards stream and serializes sends
 	stream            pb.AgentService_StreamCommunicationClient
 	ctx               context.Context
 	cancel            context.CancelFunc
 	agentID           string
+	agentToken        string
+	saveCredentials   func(agentID, agentToken string) error
+	labels            string // comma-separated key=value pairs sent on every connect
+	backoff           *Backoff
 	heartbeatTicker   *time.Ticker
 	heartbeatInterval time.Duration
 	commandExecutor   *command.Executor
@@ -35,20 +42,22 @@ type StreamClient struct {
 
 // NewStreamClient creates a new stream client
 func NewStreamClient(serverAddr string, opts ...grpc.DialOption) (*StreamClient, error) {
-	// If no dial options provided, determine TLS configuration based on address
+	// Without explicit dial options, pick the transport from the address
 	if len(opts) == 0 {
-		if isProdAddress(serverAddr) {
-			// Use TLS for production
-			creds := credentials.NewTLS(&tls.Config{})
-			opts = append(opts, grpc.WithTransportCredentials(creds))
-			log.Println("Using TLS connection for production address")
-		} else {
-			// Use insecure connection for localhost/dev
-			opts = append(opts, grpc.WithTransportCredentials(insecure.NewCredentials()))
-			log.Println("Using insecure connection for development address")
+		transport, err := TransportCredentials(serverAddr, TLSOptions{})
+		if err != nil {
+			return nil, err
 		}
+		opts = append(opts, transport)
 	}
 
+	// Keepalive pings detect dead links (e.g. dropped NAT mappings) so the stream fails fast
+	opts = append(opts, grpc.WithKeepaliveParams(keepalive.ClientParameters{
+		Time:                20 * time.Second,
+		Timeout:             10 * time.Second,
+		PermitWithoutStream: true,
+	}))
+
 	conn, err := grpc.Dial(serverAddr, opts...)
 	if err != nil {
 		return nil, err
@@ -62,6 +71,7 @@ func NewStreamClient(serverAddr string, opts ...grpc.DialOption) (*StreamClient,
 		client:            client,
 		ctx:               ctx,
 		cancel:            cancel,
+		backoff:           DefaultBackoff(),
 		heartbeatInterval: 3 * time.Second, // Default 3 seconds
 		commandExecutor:   command.NewExecutor(5 * time.Minute),
 		metricsHandler:    metrics.NewHandler(),
@@ -81,67 +91,219 @@ func (c *StreamClient) SetHeartbeatInterval(interval time.Duration) {
 	c.heartbeatInterval = interval
 }
 
-// Connect establishes the streaming connection
+// SetCredentialsSaver sets the function used to persist rotated credentials.
+// Without it the agent rejects credential rotations.
+func (c *StreamClient) SetCredentialsSaver(save func(agentID, agentToken string) error) {
+	c.saveCredentials = save
+}
+
+// SetLabels sets the labels declared to the server on every (re)connect. They
+// replace the labels of the previous connection; labels set by operators stay.
+func (c *StreamClient) SetLabels(labels string) {
+	c.labels = labels
+}
+
+// Enroll exchanges a one-time enrollment token for agent credentials. It keeps
+// retrying while the server is unreachable or doesn't answer in time and fails
+// on any other error. The server accepts the token again from the same agent
+// for a few minutes, so a retry succeeds even if the first request got through.
+// Every attempt carries the same random nonce, which proves to the server
+// that a retry comes from the agent that made the first request.
+func (c *StreamClient) Enroll(enrollmentToken, agentID, hostname string) (string, string, error) {
+	if enrollmentToken == "" {
+		return "", "", fmt.Errorf("enrollment token is required")
+	}
+
+	nonce := make([]byte, 32)
+	if _, err := rand.Read(nonce); err != nil {
+		return "", "", fmt.Errorf("failed to generate enrollment nonce: %w", err)
+	}
+
+	backoff := DefaultBackoff()
+	for {
+		ctx, cancel := context.WithTimeout(c.ctx, 30*time.Second)
+		resp, err := c.client.Enroll(ctx, &pb.EnrollRequest{
+			EnrollmentToken: enrollmentToken,
+			AgentId:         agentID,
+			Hostname:        hostname,
+			Nonce:           hex.EncodeToString(nonce),
+		})
+		cancel()
+
+		if err == nil {
+			return resp.AgentId, resp.AgentToken, nil
+		}
+		if code := status.Code(err); code != codes.Unavailable && code != codes.DeadlineExceeded {
+			return "", "", fmt.Errorf("enrollment rejected: %w", err)
+		}
+
+		delay := backoff.Next()
+		log.Printf("Enrollment failed: %v. Retrying in %s", err, delay.Round(time.Millisecond))
+
+		select {
+		case <-c.ctx.Done():
+			return "", "", c.ctx.Err()
+		case <-time.After(delay):
+		}
+	}
+}
+
+// Connect starts a supervised connection to the server. The stream is
+// re-established with jittered exponential backoff whenever it drops. The ID
+// and token may be empty when a client certificate identifies the agent.
 func (c *StreamClient) Connect(agentID, agentToken string) error {
-	md := metadata.New(map[string]string{
-		"agent_id":    agentID,
-		"agent_token": agentToken,
-	})
-	ctx := metadata.NewOutgoingContext(c.ctx, md)
+
+	c.agentID = agentID
+	c.agentToken = agentToken
+
+	go c.run()
+
+	return nil
+}
+
+// run keeps the communication stream alive until the client is closed
+func (c *StreamClient) run() {
+	for {
+		established, err := c.connectOnce()
+		if c.ctx.Err() != nil {
+			return
+		}
+
+		// Only back off further while the server keeps rejecting us
+		if established {
+			c.backoff.Reset()
+		}
+
+		delay := c.backoff.Next()
+		log.Printf("Communication stream lost: %v. Reconnecting in %s", err, delay.Round(time.Millisecond))
+
+		select {
+		case <-c.ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+	}
+}
+
+// connectOnce authenticates a new stream, announces surviving terminal sessions
+// and processes messages until the stream fails. It reports whether the server
+// accepted the stream.
+func (c *StreamClient) connectOnce() (bool, error) {
+	md := metadata.MD{}
+	if c.agentID != "" {
+		md.Set("agent_id", c.agentID)
+	}
+	if c.agentToken != "" {
+		md.Set("agent_token", c.agentToken)
+	}
+	if c.labels != "" {
+		md.Set("agent_labels", c.labels)
+	}
+	ctx, cancel := context.WithCancel(metadata.NewOutgoingContext(c.ctx, md))
 
 	stream, err := c.client.StreamCommunication(ctx)
 	if err != nil {
-		return err
+		cancel()
+		return false, err
 	}
 
+	c.mu.Lock()
 	c.stream = stream
-	c.agentID = agentID
+	c.mu.Unlock()
 
-	go c.listen()
+	// Authentication errors only surface on Recv, so a failed announcement is left to listen
+	if err := c.announceSessions(); err != nil {
+		log.Printf("Error announcing terminal sessions: %v", err)
+	}
 
 	log.Println("Agent connected to communication stream")
-	return nil
+	established, err := c.listen(stream)
+
+	// Cancel first so a send blocked on the dead stream releases the lock
+	cancel()
+
+	// The server subscribes again once reconnected
+	c.metricsHandler.StopPushing()
+
+	c.mu.Lock()
+	c.stream = nil
+	c.mu.Unlock()
+
+	return established, err
 }
 
-// listen continuously listens for incoming messages from server
-func (c *StreamClient) listen() {
+// announceSessions tells the server which terminal sessions are still running
+func (c *StreamClient) announceSessions() error {
+	return c.Send(&pb.AgentMessage{
+		Message: &pb.AgentMessage_TerminalSessionsAnnouncement{
+			TerminalSessionsAnnouncement: &pb.TerminalSessionsAnnouncement{
+				Sessions: c.terminalManager.ListSessions(),
+			},
+		},
+	})
+}
+
+// listen continuously listens for incoming messages from server until the
+// stream fails. It reports whether any message was received.
+func (c *StreamClient) listen(stream pb.AgentService_StreamCommunicationClient) (bool, error) {
+	received := false
 	for {
-		serverMsg, err := c.stream.Recv()
+		serverMsg, err := stream.Recv()
 		if err == io.EOF {
-			log.Println("communication stream ended")
-			break
+			return received, fmt.Errorf("communication stream closed by server")
 		}
 		if err != nil {
-			log.Printf("Error receiving message: %v", err)
-			break
+			return received, err
 		}
+		received = true
 
 		// Handle different message types
 		switch msg := serverMsg.Message.(type) {
 		case *pb.ServerMessage_Ping:
 			// Handle ping message
 			c.sendPong(&pb.Pong{
-				Timestamp:     time.Now().UTC().Unix(),
+				Timestamp:     time.Now().UnixNano(),
 				PingTimestamp: msg.Ping.Timestamp,
 			})
 		case *pb.ServerMessage_CommandRequest:
-			// Handle command request
-			c.handleCommandRequest(msg.CommandRequest)
+			// Run commands off the receive loop so long ones don't hold up pings
+			go c.handleCommandRequest(msg.CommandRequest)
+		case *pb.ServerMessage_CommandCancelRequest:
+			// Handle command cancel request
+			c.handleCommandCancel(msg.CommandCancelRequest)
 		case *pb.ServerMessage_TerminalCreateRequest:
 			// Handle terminal create request
 			c.terminalManager.CreateSession(msg.TerminalCreateRequest)
 		case *pb.ServerMessage_TerminalCommandRequest:
 			// Handle terminal command request
 			c.terminalManager.ExecuteCommand(msg.TerminalCommandRequest)
+		case *pb.ServerMessage_TerminalInput:
+			// Handle terminal input
+			c.terminalManager.WriteInput(msg.TerminalInput)
+		case *pb.ServerMessage_TerminalSignalRequest:
+			// Handle terminal signal request
+			c.terminalManager.SignalSession(msg.TerminalSignalRequest)
+		case *pb.ServerMessage_TerminalResizeRequest:
+			// Handle terminal resize request
+			c.terminalManager.ResizeSession(msg.TerminalResizeRequest)
 		case *pb.ServerMessage_TerminalCloseRequest:
 			// Handle terminal close request
 			c.terminalManager.CloseSession(msg.TerminalCloseRequest)
 		case *pb.ServerMessage_MetricsRequest:
 			// Handle metrics request
 			c.metricsHandler.HandleMetricsRequest(msg.MetricsRequest)
+		case *pb.ServerMessage_MetricsSubscribeRequest:
+			// Start pushing metrics on the server's schedule
+			c.metricsHandler.HandleMetricsSubscribe(msg.MetricsSubscribeRequest)
+		case *pb.ServerMessage_MetricsUnsubscribeRequest:
+			// Stop pushing metrics
+			c.metricsHandler.HandleMetricsUnsubscribe(msg.MetricsUnsubscribeRequest)
 		case *pb.ServerMessage_SystemInfoRequest:
 			// Handle system info request
 			c.metricsHandler.HandleSystemInfoRequest(msg.SystemInfoRequest)
+		case *pb.ServerMessage_CredentialRotationRequest:
+			// Handle credential rotation request
+			c.handleCredentialRotation(msg.CredentialRotationRequest)
 		default:
 			log.Printf("Unknown message type received: %T", msg)
 		}
@@ -152,6 +314,15 @@ func (c *StreamClient) listen() {
 func (c *StreamClient) handleCommandRequest(req *pb.CommandRequest) {
 	log.Printf("Executing command: %s", req.Command)
 
+	if req.Stream {
+		c.commandExecutor.ExecuteStream(req, func(msg *pb.AgentMessage) {
+			if err := c.Send(msg); err != nil {
+				log.Printf("Error sending command output: %v", err)
+			}
+		})
+		return
+	}
+
 	// Execute command
 	response := c.commandExecutor.Execute(req)
 
@@ -162,11 +333,74 @@ func (c *StreamClient) handleCommandRequest(req *pb.CommandRequest) {
 		},
 	}
 
-	if err := c.stream.Send(agentMsg); err != nil {
+	if err := c.Send(agentMsg); err != nil {
 		log.Printf("Error sending command response: %v", err)
 	}
 }
 
+// handleCommandCancel signals a running command and reports whether it was found
+func (c *StreamClient) handleCommandCancel(req *pb.CommandCancelRequest) {
+	response := &pb.CommandCancelResponse{
+		RequestId: req.RequestId,
+		Success:   true,
+	}
+
+	if err := c.commandExecutor.Cancel(req); err != nil {
+		response.Success = false
+		response.Error = err.Error()
+	}
+
+	agentMsg := &pb.AgentMessage{
+		Message: &pb.AgentMessage_CommandCancelResponse{
+			CommandCancelResponse: response,
+		},
+	}
+
+	if err := c.Send(agentMsg); err != nil {
+		log.Printf("Error sending command cancel response: %v", err)
+	}
+}
+
+// handleCredentialRotation persists a rotated token and acknowledges it. The new
+// token is used from the next connection on; the current stream stays open.
+func (c *StreamClient) handleCredentialRotation(req *pb.CredentialRotationRequest) {
+	response := &pb.CredentialRotationResponse{
+		RotationId: req.RotationId,
+	}
+
+	switch {
+	case c.agentID == "" || c.agentToken == "":
+		response.Error = "agent does not authenticate with a token"
+	case c.saveCredentials == nil:
+		response.Error = "agent cannot persist credentials"
+	case req.AgentToken == "":
+		response.Error = "rotation did not include a token"
+	default:
+		if err := c.saveCredentials(c.agentID, req.AgentToken); err != nil {
+			response.Error = err.Error()
+		} else {
+			c.agentToken = req.AgentToken
+			response.Success = true
+		}
+	}
+
+	if response.Success {
+		log.Printf("Credentials rotated (rotation %s)", req.RotationId)
+	} else {
+		log.Printf("Credential rotation %s failed: %s", req.RotationId, response.Error)
+	}
+
+	agentMsg := &pb.AgentMessage{
+		Message: &pb.AgentMessage_CredentialRotationResponse{
+			CredentialRotationResponse: response,
+		},
+	}
+
+	if err := c.Send(agentMsg); err != nil {
+		log.Printf("Error sending credential rotation response: %v", err)
+	}
+}
+
 // sendPong sends a pong response to the server
 func (c *StreamClient) sendPong(pong *pb.Pong) {
 	agentMsg := &pb.AgentMessage{
@@ -175,13 +409,16 @@ func (c *StreamClient) sendPong(pong *pb.Pong) {
 		},
 	}
 
-	if err := c.stream.Send(agentMsg); err != nil {
+	if err := c.Send(agentMsg); err != nil {
 		log.Printf("Error sending pong: %v", err)
 	}
 }
 
 // Send sends an agent message to the server
 func (c *StreamClient) Send(msg *pb.AgentMessage) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
 	if c.stream == nil {
 		return fmt.Errorf("not connected")
 	}
@@ -207,16 +444,3 @@ func (c *StreamClient) Close() error {
 	}
 	return nil
 }
-
-// isProdAddress determines if the given address is a production address that requires TLS
-func isProdAddress(address string) bool {
-	// Check for localhost or local development addresses
-	if strings.HasPrefix(address, "localhost:") ||
-		strings.HasPrefix(address, "127.0.0.1:") ||
-		strings.HasPrefix(address, "0.0.0.0:") {
-		return false
-	}
-
-	// Default to TLS for any other external address
-	return true
-}
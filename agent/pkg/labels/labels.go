@@ -0,0 +1,123 @@
+package labels
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Parse parses a comma-separated list of key=value pairs, e.g. "env=prod,role=db"
+func Parse(list string) (map[string]string, error) {
+	labels := make(map[string]string)
+
+	for _, pair := range strings.Split(list, ",") {
+		if err := add(labels, pair); err != nil {
+			return nil, err
+		}
+	}
+
+	return labels, nil
+}
+
+// LoadFile reads labels from a file with one key=value pair per line. Blank
+// lines and lines starting with # are ignored.
+func LoadFile(path string) (map[string]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open labels file: %w", err)
+	}
+	defer file.Close()
+
+	labels := make(map[string]string)
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+		if err := add(labels, line); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read labels file: %w", err)
+	}
+
+	return labels, nil
+}
+
+// Format returns labels as a sorted comma-separated list of key=value pairs
+func Format(labels map[string]string) string {
+	pairs := make([]string, 0, len(labels))
+	for key, value := range labels {
+		pairs = append(pairs, key+"="+value)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+// add parses one key=value pair into labels. Empty pairs are skipped.
+func add(labels map[string]string, pair string) error {
+	pair = strings.TrimSpace(pair)
+	if pair == "" {
+		return nil
+	}
+
+	key, value, found := strings.Cut(pair, "=")
+	if !found {
+		return fmt.Errorf("invalid label %q: expected key=value", pair)
+	}
+
+	key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+	if err := validateKey(key); err != nil {
+		return err
+	}
+	if err := validateValue(value); err != nil {
+		return err
+	}
+
+	labels[key] = value
+	return nil
+}
+
+// validateKey applies the server's rules for label keys, which ignores all
+// labels of an agent if any of them breaks them
+func validateKey(key string) error {
+	if key == "" {
+		return fmt.Errorf("label key must not be empty")
+	}
+	if len(key) > 253 {
+		return fmt.Errorf("label key %q is longer than 253 characters", key)
+	}
+	if !validChars(key, "._-/") {
+		return fmt.Errorf("label key %q may only contain letters, digits, '.', '_', '-' and '/'", key)
+	}
+	return nil
+}
+
+// validateValue applies the server's rules for label values
+func validateValue(value string) error {
+	if len(value) > 63 {
+		return fmt.Errorf("label value %q is longer than 63 characters", value)
+	}
+	if !validChars(value, "._-") {
+		return fmt.Errorf("label value %q may only contain letters, digits, '.', '_' and '-'", value)
+	}
+	return nil
+}
+
+// validChars reports whether s consists of ASCII letters, digits and the given extra characters
+func validChars(s, extra string) bool {
+	for _, char := range s {
+		switch {
+		case char >= 'a' && char <= 'z', char >= 'A' && char <= 'Z', char >= '0' && char <= '9':
+		case strings.ContainsRune(extra, char):
+		default:
+			return false
+		}
+	}
+	return true
+}
@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"log"
 	"runtime"
+	"sort"
+	"sync"
 	"time"
 
 	pb "github.com/mooncorn/nodelink/agent/internal/proto"
@@ -16,8 +18,16 @@ import (
 	"github.com/shirou/gopsutil/v3/process"
 )
 
-// Collector collects system metrics and information
-type Collector struct{}
+// Collector collects system metrics and information. It keeps the CPU and
+// I/O counters of the previous sample to turn them into usage and rates.
+type Collector struct {
+	mu            sync.Mutex
+	lastCPU       *cpuTimes
+	lastNetwork   map[string]net.IOCountersStat
+	lastNetworkAt time.Time
+	lastDiskIO    map[string]disk.IOCountersStat
+	lastDiskIOAt  time.Time
+}
 
 // NewCollector creates a new metrics collector
 func NewCollector() *Collector {
@@ -65,74 +75,250 @@ func (c *Collector) GetSystemInfo() (*pb.SystemInfo, error) {
 	}, nil
 }
 
-// GetSystemMetrics collects current system metrics
+// GetSystemMetrics collects current system metrics, measuring CPU usage over a second
 func (c *Collector) GetSystemMetrics() (*pb.SystemMetrics, error) {
-	// CPU usage
-	cpuPercents, err := cpu.Percent(time.Second, false)
-	if err != nil {
-		return nil, fmt.Errorf("failed to get CPU usage: %w", err)
+	return c.collect(nil, time.Second)
+}
+
+// SampleSystemMetrics collects the given SystemMetrics fields, all of them if
+// fields is empty. CPU usage is measured since the previous sample instead of
+// blocking, so the first sample only primes it.
+func (c *Collector) SampleSystemMetrics(fields map[string]bool) (*pb.SystemMetrics, error) {
+	return c.collect(fields, 0)
+}
+
+// collect gathers the requested fields, skipping the work for the others
+func (c *Collector) collect(fields map[string]bool, cpuInterval time.Duration) (*pb.SystemMetrics, error) {
+	wanted := func(field string) bool {
+		return len(fields) == 0 || fields[field]
 	}
 
-	var cpuUsage float64
-	if len(cpuPercents) > 0 {
-		cpuUsage = cpuPercents[0]
+	metrics := &pb.SystemMetrics{
+		Timestamp: time.Now().Unix(),
 	}
 
-	// Memory metrics
-	memInfo, err := mem.VirtualMemory()
-	if err != nil {
-		return nil, fmt.Errorf("failed to get memory info: %w", err)
+	// CPU usage
+	if wanted("cpu_usage_percent") || wanted("cpu_core_usage_percent") || wanted("cpu_times") {
+		usage, err := c.getCPUUsage(cpuInterval)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get CPU usage: %w", err)
+		}
+		if usage != nil {
+			if wanted("cpu_usage_percent") {
+				metrics.CpuUsagePercent = usage.total
+			}
+			if wanted("cpu_core_usage_percent") {
+				metrics.CpuCoreUsagePercent = usage.cores
+			}
+			if wanted("cpu_times") {
+				metrics.CpuTimes = usage.times
+			}
+		}
 	}
 
-	memoryMetrics := &pb.MemoryMetrics{
-		Total:       int64(memInfo.Total),
-		Available:   int64(memInfo.Available),
-		Used:        int64(memInfo.Used),
-		UsedPercent: memInfo.UsedPercent,
-		Free:        int64(memInfo.Free),
-		Cached:      int64(memInfo.Cached),
-		Buffers:     int64(memInfo.Buffers),
+	// Memory metrics
+	if wanted("memory") {
+		memInfo, err := mem.VirtualMemory()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get memory info: %w", err)
+		}
+
+		metrics.Memory = &pb.MemoryMetrics{
+			Total:       int64(memInfo.Total),
+			Available:   int64(memInfo.Available),
+			Used:        int64(memInfo.Used),
+			UsedPercent: memInfo.UsedPercent,
+			Free:        int64(memInfo.Free),
+			Cached:      int64(memInfo.Cached),
+			Buffers:     int64(memInfo.Buffers),
+		}
 	}
 
 	// Disk metrics
-	diskMetrics, err := c.getDiskMetrics()
-	if err != nil {
-		log.Printf("Warning: failed to get disk metrics: %v", err)
-		diskMetrics = []*pb.DiskMetrics{} // Use empty slice if error
+	if wanted("disks") {
+		diskMetrics, err := c.getDiskMetrics()
+		if err != nil {
+			log.Printf("Warning: failed to get disk metrics: %v", err)
+			diskMetrics = []*pb.DiskMetrics{} // Use empty slice if error
+		}
+		metrics.Disks = diskMetrics
 	}
 
 	// Network metrics
-	networkMetrics, err := c.getNetworkMetrics()
-	if err != nil {
-		log.Printf("Warning: failed to get network metrics: %v", err)
-		networkMetrics = []*pb.NetworkMetrics{} // Use empty slice if error
+	if wanted("network_interfaces") {
+		networkMetrics, err := c.getNetworkMetrics()
+		if err != nil {
+			log.Printf("Warning: failed to get network metrics: %v", err)
+			networkMetrics = []*pb.NetworkMetrics{} // Use empty slice if error
+		}
+		metrics.NetworkInterfaces = networkMetrics
+	}
+
+	// Disk I/O metrics
+	if wanted("disk_io") {
+		diskIOMetrics, err := c.getDiskIOMetrics()
+		if err != nil {
+			log.Printf("Warning: failed to get disk I/O metrics: %v", err)
+			diskIOMetrics = []*pb.DiskIOMetrics{} // Use empty slice if error
+		}
+		metrics.DiskIo = diskIOMetrics
 	}
 
 	// Process metrics (top 10 by CPU usage)
-	processMetrics, err := c.getTopProcesses(10)
-	if err != nil {
-		log.Printf("Warning: failed to get process metrics: %v", err)
-		processMetrics = []*pb.ProcessMetrics{} // Use empty slice if error
+	if wanted("processes") {
+		processMetrics, err := c.getTopProcesses(10)
+		if err != nil {
+			log.Printf("Warning: failed to get process metrics: %v", err)
+			processMetrics = []*pb.ProcessMetrics{} // Use empty slice if error
+		}
+		metrics.Processes = processMetrics
+	}
+
+	// Pressure stall information
+	if wanted("pressure") {
+		pressure, err := getPressureMetrics()
+		if err != nil {
+			log.Printf("Warning: failed to get pressure stall information: %v", err)
+		}
+		metrics.Pressure = pressure
 	}
 
 	// Load average
-	loadInfo, err := load.Avg()
+	if wanted("load_average_1m") || wanted("load_average_5m") || wanted("load_average_15m") {
+		loadInfo, err := load.Avg()
+		if err != nil {
+			log.Printf("Warning: failed to get load average: %v", err)
+			loadInfo = &load.AvgStat{Load1: 0, Load5: 0, Load15: 0}
+		}
+		if wanted("load_average_1m") {
+			metrics.LoadAverage_1M = loadInfo.Load1
+		}
+		if wanted("load_average_5m") {
+			metrics.LoadAverage_5M = loadInfo.Load5
+		}
+		if wanted("load_average_15m") {
+			metrics.LoadAverage_15M = loadInfo.Load15
+		}
+	}
+
+	return metrics, nil
+}
+
+// cpuTimes are the CPU time counters of the whole system and of each logical CPU
+type cpuTimes struct {
+	total cpu.TimesStat
+	cores []cpu.TimesStat
+}
+
+// cpuUsage is how the CPUs were used between two readings of their counters
+type cpuUsage struct {
+	total float64
+	cores []float64
+	times *pb.CPUTimesMetrics
+}
+
+// getCPUUsage measures CPU usage over interval, or since the previous sample
+// if interval is zero. It returns nil for the first such sample, which only
+// reads the counters.
+func (c *Collector) getCPUUsage(interval time.Duration) (*cpuUsage, error) {
+	current, err := readCPUTimes()
 	if err != nil {
-		log.Printf("Warning: failed to get load average: %v", err)
-		loadInfo = &load.AvgStat{Load1: 0, Load5: 0, Load15: 0}
-	}
-
-	return &pb.SystemMetrics{
-		CpuUsagePercent:   cpuUsage,
-		Memory:            memoryMetrics,
-		Disks:             diskMetrics,
-		NetworkInterfaces: networkMetrics,
-		Processes:         processMetrics,
-		Timestamp:         time.Now().Unix(),
-		LoadAverage_1M:    loadInfo.Load1,
-		LoadAverage_5M:    loadInfo.Load5,
-		LoadAverage_15M:   loadInfo.Load15,
-	}, nil
+		return nil, err
+	}
+
+	var previous *cpuTimes
+	if interval > 0 {
+		previous = current
+		time.Sleep(interval)
+		if current, err = readCPUTimes(); err != nil {
+			return nil, err
+		}
+	}
+
+	c.mu.Lock()
+	if previous == nil {
+		previous = c.lastCPU
+	}
+	c.lastCPU = current
+	c.mu.Unlock()
+
+	if previous == nil {
+		return nil, nil
+	}
+
+	usage := &cpuUsage{
+		total: busyPercent(previous.total, current.total),
+		times: timesPercent(previous.total, current.total),
+	}
+	// Per-core counters are left out if the set of CPUs changed, e.g. one went offline
+	if len(previous.cores) == len(current.cores) {
+		usage.cores = make([]float64, len(current.cores))
+		for i := range current.cores {
+			usage.cores[i] = busyPercent(previous.cores[i], current.cores[i])
+		}
+	}
+
+	return usage, nil
+}
+
+// readCPUTimes reads the CPU time counters. Per-core counters are left out
+// where the platform doesn't report them.
+func readCPUTimes() (*cpuTimes, error) {
+	total, err := cpu.Times(false)
+	if err != nil {
+		return nil, err
+	}
+	if len(total) == 0 {
+		return nil, fmt.Errorf("no CPU times reported")
+	}
+
+	times := &cpuTimes{total: total[0]}
+	cores, err := cpu.Times(true)
+	if err != nil {
+		log.Printf("Warning: failed to get per-core CPU times: %v", err)
+	} else {
+		times.cores = cores
+	}
+
+	return times, nil
+}
+
+// cpuTotal returns the time a CPU spent in any state. Guest time is already
+// part of user time.
+func cpuTotal(t cpu.TimesStat) float64 {
+	return t.User + t.System + t.Idle + t.Nice + t.Iowait + t.Irq + t.Softirq + t.Steal
+}
+
+// busyPercent returns the share of time a CPU wasn't idle or waiting for I/O between two readings
+func busyPercent(previous, current cpu.TimesStat) float64 {
+	elapsed := cpuTotal(current) - cpuTotal(previous)
+	if elapsed <= 0 {
+		return 0
+	}
+	idle := current.Idle + current.Iowait - previous.Idle - previous.Iowait
+	return min(max((elapsed-idle)/elapsed*100, 0), 100)
+}
+
+// timesPercent returns the share of time a CPU spent in each state between two readings
+func timesPercent(previous, current cpu.TimesStat) *pb.CPUTimesMetrics {
+	elapsed := cpuTotal(current) - cpuTotal(previous)
+	if elapsed <= 0 {
+		return &pb.CPUTimesMetrics{}
+	}
+	percent := func(before, after float64) float64 {
+		return max(after-before, 0) / elapsed * 100
+	}
+
+	return &pb.CPUTimesMetrics{
+		User:    percent(previous.User, current.User),
+		System:  percent(previous.System, current.System),
+		Idle:    percent(previous.Idle, current.Idle),
+		Nice:    percent(previous.Nice, current.Nice),
+		Iowait:  percent(previous.Iowait, current.Iowait),
+		Irq:     percent(previous.Irq, current.Irq),
+		Softirq: percent(previous.Softirq, current.Softirq),
+		Steal:   percent(previous.Steal, current.Steal),
+	}
 }
 
 // getDiskMetrics collects disk usage metrics for all mounted filesystems
@@ -165,18 +351,28 @@ func (c *Collector) getDiskMetrics() ([]*pb.DiskMetrics, error) {
 	return diskMetrics, nil
 }
 
-// getNetworkMetrics collects network interface statistics
+// getNetworkMetrics collects network interface statistics and their rates
+// since the previous sample
 func (c *Collector) getNetworkMetrics() ([]*pb.NetworkMetrics, error) {
 	stats, err := net.IOCounters(true)
 	if err != nil {
 		return nil, err
 	}
+	now := time.Now()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	last, elapsed := c.lastNetwork, now.Sub(c.lastNetworkAt).Seconds()
+	c.lastNetwork = make(map[string]net.IOCountersStat, len(stats))
+	c.lastNetworkAt = now
 
 	var networkMetrics []*pb.NetworkMetrics
 	for _, stat := range stats {
 		if stat.Name == "lo" { // Skip loopback interface
 			continue
 		}
+		c.lastNetwork[stat.Name] = stat
 
 		networkMetric := &pb.NetworkMetrics{
 			Interface:   stat.Name,
@@ -189,12 +385,88 @@ func (c *Collector) getNetworkMetrics() ([]*pb.NetworkMetrics, error) {
 			DropsIn:     int64(stat.Dropin),
 			DropsOut:    int64(stat.Dropout),
 		}
+		if previous, exists := last[stat.Name]; exists {
+			networkMetric.BytesSentPerSec = rate(previous.BytesSent, stat.BytesSent, elapsed)
+			networkMetric.BytesRecvPerSec = rate(previous.BytesRecv, stat.BytesRecv, elapsed)
+			networkMetric.PacketsSentPerSec = rate(previous.PacketsSent, stat.PacketsSent, elapsed)
+			networkMetric.PacketsRecvPerSec = rate(previous.PacketsRecv, stat.PacketsRecv, elapsed)
+		}
 		networkMetrics = append(networkMetrics, networkMetric)
 	}
 
 	return networkMetrics, nil
 }
 
+// getDiskIOMetrics collects the activity of each block device since the
+// previous sample. The first sample only records the counters.
+func (c *Collector) getDiskIOMetrics() ([]*pb.DiskIOMetrics, error) {
+	stats, err := disk.IOCounters()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	last, elapsed := c.lastDiskIO, now.Sub(c.lastDiskIOAt).Seconds()
+	c.lastDiskIO = stats
+	c.lastDiskIOAt = now
+
+	names := make([]string, 0, len(stats))
+	for name := range stats {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	diskIOMetrics := make([]*pb.DiskIOMetrics, 0, len(names))
+	for _, name := range names {
+		stat := stats[name]
+		previous, exists := last[name]
+		if !exists || stat.ReadCount+stat.WriteCount == 0 { // Skip devices that were never used, e.g. loop devices
+			continue
+		}
+
+		reads := delta(previous.ReadCount, stat.ReadCount)
+		writes := delta(previous.WriteCount, stat.WriteCount)
+
+		diskIOMetric := &pb.DiskIOMetrics{
+			Device:           name,
+			ReadsPerSec:      rate(previous.ReadCount, stat.ReadCount, elapsed),
+			WritesPerSec:     rate(previous.WriteCount, stat.WriteCount, elapsed),
+			ReadBytesPerSec:  rate(previous.ReadBytes, stat.ReadBytes, elapsed),
+			WriteBytesPerSec: rate(previous.WriteBytes, stat.WriteBytes, elapsed),
+			// IoTime is in milliseconds
+			UtilPercent: min(rate(previous.IoTime, stat.IoTime, elapsed)/10, 100),
+		}
+		if reads > 0 {
+			diskIOMetric.ReadAwaitMs = float64(delta(previous.ReadTime, stat.ReadTime)) / float64(reads)
+		}
+		if writes > 0 {
+			diskIOMetric.WriteAwaitMs = float64(delta(previous.WriteTime, stat.WriteTime)) / float64(writes)
+		}
+		diskIOMetrics = append(diskIOMetrics, diskIOMetric)
+	}
+
+	return diskIOMetrics, nil
+}
+
+// delta returns how much a counter grew, or zero if it was reset
+func delta(previous, current uint64) uint64 {
+	if current < previous {
+		return 0
+	}
+	return current - previous
+}
+
+// rate returns how much a counter grew per second over elapsed seconds
+func rate(previous, current uint64, elapsed float64) float64 {
+	if elapsed <= 0 {
+		return 0
+	}
+	return float64(delta(previous, current)) / elapsed
+}
+
 // getTopProcesses gets the top N processes by CPU usage
 func (c *Collector) getTopProcesses(limit int) ([]*pb.ProcessMetrics, error) {
 	pids, err := process.Pids()
@@ -2,6 +2,7 @@ package metrics
 
 import (
 	"log"
+	"sync"
 
 	pb "github.com/mooncorn/nodelink/agent/internal/proto"
 )
@@ -11,10 +12,13 @@ type MessageSender interface {
 	Send(msg *pb.AgentMessage) error
 }
 
-// Handler handles metrics requests from the server
+// Handler handles metrics requests and subscriptions from the server
 type Handler struct {
 	collector     *Collector
 	messageSender MessageSender
+
+	mu           sync.Mutex
+	subscription *subscription // pushing metrics, if the server subscribed
 }
 
 // NewHandler creates a new metrics handler
@@ -0,0 +1,101 @@
+//go:build linux
+
+package metrics
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+
+	pb "github.com/mooncorn/nodelink/agent/internal/proto"
+)
+
+// pressureDir is where the kernel reports pressure stall information
+const pressureDir = "/proc/pressure"
+
+// getPressureMetrics reads the pressure stall information of the CPU, memory
+// and I/O. It returns nil without an error on kernels built without PSI or
+// booted with psi=0.
+func getPressureMetrics() (*pb.PressureMetrics, error) {
+	resources := []string{"cpu", "memory", "io"}
+	stalls := make([]*pb.PressureStall, len(resources))
+	for i, resource := range resources {
+		stall, err := readPressure(filepath.Join(pressureDir, resource))
+		if errors.Is(err, fs.ErrNotExist) || errors.Is(err, syscall.EOPNOTSUPP) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		stalls[i] = stall
+	}
+
+	return &pb.PressureMetrics{
+		Cpu:    stalls[0],
+		Memory: stalls[1],
+		Io:     stalls[2],
+	}, nil
+}
+
+// readPressure parses a pressure file, which has a line such as
+// "some avg10=0.12 avg60=0.05 avg300=0.01 total=123456" for some and full
+func readPressure(path string) (*pb.PressureStall, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	stall := &pb.PressureStall{}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		kind, values, _ := strings.Cut(scanner.Text(), " ")
+
+		averages, err := parsePressureAverages(values)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+		}
+
+		switch kind {
+		case "some":
+			stall.Some = averages
+		case "full":
+			stall.Full = averages
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return stall, nil
+}
+
+// parsePressureAverages parses the key=value pairs of a pressure line
+func parsePressureAverages(values string) (*pb.PressureAverages, error) {
+	averages := &pb.PressureAverages{}
+	for _, field := range strings.Fields(values) {
+		key, value, _ := strings.Cut(field, "=")
+
+		var err error
+		switch key {
+		case "avg10":
+			averages.Avg10, err = strconv.ParseFloat(value, 64)
+		case "avg60":
+			averages.Avg60, err = strconv.ParseFloat(value, 64)
+		case "avg300":
+			averages.Avg300, err = strconv.ParseFloat(value, 64)
+		case "total":
+			averages.TotalUs, err = strconv.ParseInt(value, 10, 64)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %w", key, err)
+		}
+	}
+	return averages, nil
+}
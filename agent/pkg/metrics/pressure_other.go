@@ -0,0 +1,10 @@
+//go:build !linux
+
+package metrics
+
+import pb "github.com/mooncorn/nodelink/agent/internal/proto"
+
+// getPressureMetrics reports nothing, as pressure stall information is specific to Linux
+func getPressureMetrics() (*pb.PressureMetrics, error) {
+	return nil, nil
+}
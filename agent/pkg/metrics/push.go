@@ -0,0 +1,233 @@
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	pb "github.com/mooncorn/nodelink/agent/internal/proto"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+const (
+	// minPushInterval keeps a server from having metrics collected back to back
+	minPushInterval = time.Second
+
+	// fullPushEvery is how often a delta subscription sends a full sample
+	fullPushEvery = 12
+)
+
+// subscription pushes metrics to the server until it is stopped
+type subscription struct {
+	id     string
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// HandleMetricsSubscribe starts pushing metrics as the server asked,
+// replacing any earlier subscription
+func (h *Handler) HandleMetricsSubscribe(request *pb.MetricsSubscribeRequest) {
+	log.Printf("Handling metrics subscription: %s", request.SubscriptionId)
+
+	fields, err := subscribedFields(request.Fields)
+	if err != nil {
+		h.sendSubscribeResponse(request.SubscriptionId, err.Error())
+		return
+	}
+
+	interval := time.Duration(request.IntervalMs) * time.Millisecond
+	if interval < minPushInterval {
+		interval = minPushInterval
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	sub := &subscription{id: request.SubscriptionId, cancel: cancel, done: make(chan struct{})}
+
+	h.mu.Lock()
+	previous := h.subscription
+	h.subscription = sub
+	h.mu.Unlock()
+
+	if previous != nil {
+		previous.stop()
+	}
+
+	// Acknowledge before the first push so the server knows it is subscribed
+	h.sendSubscribeResponse(request.SubscriptionId, "")
+	go h.push(ctx, sub, interval, fields, request.Delta)
+}
+
+// HandleMetricsUnsubscribe stops pushing metrics for a subscription
+func (h *Handler) HandleMetricsUnsubscribe(request *pb.MetricsUnsubscribeRequest) {
+	h.mu.Lock()
+	sub := h.subscription
+	if sub == nil || sub.id != request.SubscriptionId {
+		h.mu.Unlock()
+		return
+	}
+	h.subscription = nil
+	h.mu.Unlock()
+
+	log.Printf("Metrics subscription %s ended", sub.id)
+	sub.stop()
+}
+
+// StopPushing ends the current subscription, e.g. once the stream is gone.
+// The server subscribes again after the agent reconnects.
+func (h *Handler) StopPushing() {
+	h.mu.Lock()
+	sub := h.subscription
+	h.subscription = nil
+	h.mu.Unlock()
+
+	if sub != nil {
+		sub.stop()
+	}
+}
+
+// stop ends the subscription and waits for its last push
+func (s *subscription) stop() {
+	s.cancel()
+	<-s.done
+}
+
+// push collects and sends metrics every interval until the subscription is stopped
+func (h *Handler) push(ctx context.Context, sub *subscription, interval time.Duration, fields map[string]bool, delta bool) {
+	defer close(sub.done)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	// CPU usage is measured between samples, so the first one starts the measurement
+	h.collector.SampleSystemMetrics(map[string]bool{"cpu_usage_percent": true})
+
+	var previous *pb.SystemMetrics
+	var sequence uint64
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		sequence++
+		push := &pb.MetricsPush{
+			SubscriptionId: sub.id,
+			Sequence:       sequence,
+		}
+
+		metrics, err := h.collector.SampleSystemMetrics(fields)
+		switch {
+		case err != nil:
+			log.Printf("Error collecting system metrics: %v", err)
+			push.Error = err.Error()
+		case !delta || previous == nil || sequence%fullPushEvery == 0:
+			push.Metrics = metrics
+			push.Full = true
+			previous = metrics
+		default:
+			sample := proto.Clone(metrics).(*pb.SystemMetrics)
+			push.Unchanged = leaveOutUnchanged(previous, sample)
+			push.Metrics = sample
+			previous = metrics
+		}
+
+		agentMsg := &pb.AgentMessage{
+			Message: &pb.AgentMessage_MetricsPush{
+				MetricsPush: push,
+			},
+		}
+
+		if h.messageSender == nil {
+			log.Printf("Warning: no message sender set for metrics handler")
+			continue
+		}
+		if err := h.messageSender.Send(agentMsg); err != nil {
+			log.Printf("Error pushing metrics: %v", err)
+			// The server may have missed what the next delta builds on
+			previous = nil
+		}
+	}
+}
+
+// sendSubscribeResponse acknowledges a subscription, or rejects it with an error
+func (h *Handler) sendSubscribeResponse(subscriptionID, errorMsg string) {
+	agentMsg := &pb.AgentMessage{
+		Message: &pb.AgentMessage_MetricsSubscribeResponse{
+			MetricsSubscribeResponse: &pb.MetricsSubscribeResponse{
+				SubscriptionId: subscriptionID,
+				Error:          errorMsg,
+			},
+		},
+	}
+
+	if h.messageSender != nil {
+		if err := h.messageSender.Send(agentMsg); err != nil {
+			log.Printf("Error sending metrics subscription response: %v", err)
+		}
+	} else {
+		log.Printf("Warning: no message sender set for metrics handler")
+	}
+}
+
+// subscribedFields checks that the requested fields exist in SystemMetrics
+func subscribedFields(names []string) (map[string]bool, error) {
+	descriptor := (&pb.SystemMetrics{}).ProtoReflect().Descriptor().Fields()
+
+	fields := make(map[string]bool, len(names))
+	for _, name := range names {
+		if descriptor.ByName(protoreflect.Name(name)) == nil {
+			return nil, fmt.Errorf("unknown metrics field %q", name)
+		}
+		fields[name] = true
+	}
+	return fields, nil
+}
+
+// leaveOutUnchanged clears the fields of a sample that are equal to the
+// previous one and returns their names. The timestamp is always kept.
+func leaveOutUnchanged(previous, sample *pb.SystemMetrics) []string {
+	before := previous.ProtoReflect()
+	after := sample.ProtoReflect()
+
+	var unchanged []string
+	fields := after.Descriptor().Fields()
+	for i := 0; i < fields.Len(); i++ {
+		field := fields.Get(i)
+		if field.Name() == "timestamp" || !after.Has(field) {
+			continue
+		}
+		if before.Has(field) && fieldEqual(field, before.Get(field), after.Get(field)) {
+			unchanged = append(unchanged, string(field.Name()))
+			after.Clear(field)
+		}
+	}
+	return unchanged
+}
+
+// fieldEqual compares two values of a field
+func fieldEqual(field protoreflect.FieldDescriptor, a, b protoreflect.Value) bool {
+	switch {
+	case field.IsList():
+		x, y := a.List(), b.List()
+		if x.Len() != y.Len() {
+			return false
+		}
+		for i := 0; i < x.Len(); i++ {
+			if field.Message() != nil {
+				if !proto.Equal(x.Get(i).Message().Interface(), y.Get(i).Message().Interface()) {
+					return false
+				}
+			} else if x.Get(i).Interface() != y.Get(i).Interface() {
+				return false
+			}
+		}
+		return true
+	case field.Message() != nil:
+		return proto.Equal(a.Message().Interface(), b.Message().Interface())
+	default:
+		return a.Interface() == b.Interface()
+	}
+}
@@ -0,0 +1,326 @@
+package terminal
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// bashIntegration is loaded instead of ~/.bashrc. It loads the user's bashrc
+// and then marks each prompt with OSC 133 sequences: D;<exit status> once the
+// previous command finished, A where the prompt starts and B at its end, once
+// readline is reading input. Terminal emulators that don't know them ignore them.
+const bashIntegration = `# Loaded by the nodelink agent to report when commands finish
+if [ -f ~/.bashrc ]; then
+	. ~/.bashrc
+fi
+
+__nodelink_status() {
+	local status=$?
+	printf '\033]133;D;%s\007\033]133;A\007' "$status"
+	return $status
+}
+
+# Runs last, since other prompt commands may set PS1
+__nodelink_prompt() {
+	local status=$?
+	case "$PS1" in
+	*'\[\e]133;B\a\]') ;;
+	*) PS1="$PS1"'\[\e]133;B\a\]' ;;
+	esac
+	return $status
+}
+
+# Newlines, since existing prompt commands may end with a semicolon
+PROMPT_COMMAND="__nodelink_status
+${PROMPT_COMMAND}
+__nodelink_prompt"
+`
+
+const (
+	// maxMarkerSize bounds how much of an OSC sequence is collected; longer ones,
+	// such as window titles, can't be completion markers
+	maxMarkerSize = 64
+
+	// integrationTimeout is how long a new shell gets to show its first marker.
+	// Without one, e.g. if the startup file broke, commands aren't tracked.
+	integrationTimeout = 10 * time.Second
+)
+
+// shellIntegration provides the startup file that makes shells emit completion markers
+type shellIntegration struct {
+	bashRC string
+	mu     sync.Mutex
+}
+
+// args returns the arguments that load the integration into the shell, or
+// nil if the shell isn't supported and commands can't be tracked
+func (i *shellIntegration) args(shell string) []string {
+	if filepath.Base(shell) != "bash" {
+		return nil
+	}
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	// Temporary files may be cleaned up while the agent runs, so the file is
+	// checked for every session and written again if it is gone
+	if i.bashRC != "" {
+		if _, err := os.Stat(i.bashRC); err != nil {
+			i.bashRC = ""
+		}
+	}
+
+	if i.bashRC == "" {
+		file, err := os.CreateTemp("", "nodelink-bash-*.sh")
+		if err != nil {
+			log.Printf("Failed to create shell integration, commands won't be tracked: %v", err)
+			return nil
+		}
+		defer file.Close()
+
+		if _, err := file.WriteString(bashIntegration); err != nil {
+			log.Printf("Failed to write shell integration, commands won't be tracked: %v", err)
+			os.Remove(file.Name())
+			return nil
+		}
+		i.bashRC = file.Name()
+	}
+
+	return []string{"--rcfile", i.bashRC}
+}
+
+// remove deletes the startup file; running shells have already read it
+func (i *shellIntegration) remove() {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	if i.bashRC != "" {
+		os.Remove(i.bashRC)
+	}
+}
+
+// trackedCommand is a command sent through the API to a shell with integration
+type trackedCommand struct {
+	id      string
+	line    string
+	started time.Time
+}
+
+// newTrackedCommand prepares a command for typing. A command of several lines
+// is grouped in braces, so the shell reads all of it before running any and
+// reports one exit status, that of its last line.
+func newTrackedCommand(id, command string) *trackedCommand {
+	command = strings.TrimRight(command, "\r\n")
+	if strings.ContainsAny(command, "\r\n") {
+		command = "{ " + command + "\n}"
+	}
+	return &trackedCommand{id: id, line: command + "\n"}
+}
+
+// commandTracker runs a session's commands one at a time at the prompt and
+// matches each completion marker to the command it belongs to
+type commandTracker struct {
+	atPrompt bool // the shell is waiting at an empty prompt
+	queued   []*trackedCommand
+	running  *trackedCommand
+	seen     bool // the shell showed a marker, so the integration is loaded
+	disabled bool // no marker showed up in time, commands are typed untracked
+	mu       sync.Mutex
+}
+
+// markerScanner finds OSC 133 sequences in terminal output, including
+// sequences split across reads
+type markerScanner struct {
+	state   int
+	payload []byte
+}
+
+const (
+	scanText = iota
+	scanEscape
+	scanOSC
+	scanOSCEscape
+)
+
+// scan consumes data up to and including the end of the next OSC 133
+// sequence and returns how much it consumed along with the sequence's
+// parameters, such as "D;0". Without a complete sequence it consumes
+// everything and reports false.
+func (s *markerScanner) scan(data []byte) (int, string, bool) {
+	for i, b := range data {
+		switch s.state {
+		case scanText:
+			if b == 0x1b {
+				s.state = scanEscape
+			}
+		case scanEscape:
+			switch b {
+			case ']':
+				s.state, s.payload = scanOSC, s.payload[:0]
+			case 0x1b:
+			default:
+				s.state = scanText
+			}
+		case scanOSC:
+			switch {
+			case b == 0x07:
+				if marker, ok := s.end(); ok {
+					return i + 1, marker, true
+				}
+			case b == 0x1b:
+				s.state = scanOSCEscape
+			case len(s.payload) >= maxMarkerSize:
+				s.state = scanText
+			default:
+				s.payload = append(s.payload, b)
+			}
+		case scanOSCEscape:
+			if b == '\\' {
+				if marker, ok := s.end(); ok {
+					return i + 1, marker, true
+				}
+			} else {
+				s.state = scanText
+			}
+		}
+	}
+	return len(data), "", false
+}
+
+// end finishes an OSC sequence, reporting its parameters if it is an OSC 133 marker
+func (s *markerScanner) end() (string, bool) {
+	s.state = scanText
+	marker, ok := bytes.CutPrefix(s.payload, []byte("133;"))
+	return string(marker), ok
+}
+
+// emitOutput sends terminal output, splitting it at completion markers so
+// each piece is attributed to the command that was running when it was written
+func (m *Manager) emitOutput(session *Session, data []byte) {
+	if !session.tracked {
+		m.sendOutput(session.ID, data, "")
+		return
+	}
+
+	for len(data) > 0 {
+		n, marker, found := session.scanner.scan(data)
+
+		session.commands.mu.Lock()
+		commandID := ""
+		if session.commands.running != nil {
+			commandID = session.commands.running.id
+		}
+		session.commands.mu.Unlock()
+
+		m.sendOutput(session.ID, data[:n], commandID)
+		if found {
+			m.handleMarker(session, marker)
+		}
+		data = data[n:]
+	}
+}
+
+// handleMarker finishes the running command when the shell reports its exit
+// status, and types the next queued command once the prompt is back. Typing
+// before the end of the prompt would have the terminal echo it twice.
+func (m *Manager) handleMarker(session *Session, marker string) {
+	session.commands.mu.Lock()
+	defer session.commands.mu.Unlock()
+
+	// A shell that was slow to start is tracked from its first marker on
+	session.commands.seen = true
+	session.commands.disabled = false
+
+	switch {
+	case marker == "D" || strings.HasPrefix(marker, "D;"):
+		command := session.commands.running
+		if command == nil {
+			// A command typed by a user
+			return
+		}
+		session.commands.running = nil
+
+		exitCode := 0
+		if len(marker) > 2 {
+			if code, err := strconv.Atoi(marker[2:]); err == nil {
+				exitCode = code
+			}
+		}
+		m.sendCommandFinished(session.ID, command, int32(exitCode), "")
+
+	case marker == "B":
+		session.commands.atPrompt = true
+		m.dispatchCommand(session)
+	}
+}
+
+// dispatchCommand types the next queued command if the shell is idle at its
+// prompt; the caller must hold the tracker's lock
+func (m *Manager) dispatchCommand(session *Session) {
+	tracker := &session.commands
+	if !tracker.atPrompt || tracker.running != nil || len(tracker.queued) == 0 {
+		return
+	}
+
+	command := tracker.queued[0]
+	tracker.queued = tracker.queued[1:]
+
+	command.started = time.Now()
+	if _, err := session.pty.Write([]byte(command.line)); err != nil {
+		m.sendCommandFinished(session.ID, command, 1, fmt.Sprintf("failed to write command: %v", err))
+		return
+	}
+	tracker.running = command
+	tracker.atPrompt = false
+}
+
+// checkIntegration stops tracking a session's commands if its shell hasn't
+// shown a marker yet, typing the commands waiting for a prompt right away
+func (m *Manager) checkIntegration(session *Session) {
+	session.commands.mu.Lock()
+	defer session.commands.mu.Unlock()
+
+	tracker := &session.commands
+	if tracker.seen {
+		return
+	}
+	select {
+	case <-session.done:
+		return
+	default:
+	}
+
+	log.Printf("Terminal session %s showed no prompt marker within %s, commands won't be tracked", session.ID, integrationTimeout)
+	tracker.disabled = true
+
+	for _, command := range tracker.queued {
+		if _, err := session.pty.Write([]byte(command.line)); err != nil {
+			log.Printf("Failed to write command to terminal session %s: %v", session.ID, err)
+		}
+	}
+	tracker.queued = nil
+}
+
+// abandonCommands finishes the commands of a session whose shell exited. The
+// running command, e.g. exit itself, gets the shell's exit code.
+func (m *Manager) abandonCommands(session *Session, exitCode int32) {
+	session.commands.mu.Lock()
+	defer session.commands.mu.Unlock()
+
+	if command := session.commands.running; command != nil {
+		m.sendCommandFinished(session.ID, command, exitCode, "terminal session ended")
+		session.commands.running = nil
+	}
+	for _, command := range session.commands.queued {
+		command.started = time.Now()
+		m.sendCommandFinished(session.ID, command, 1, "terminal session ended before the command ran")
+	}
+	session.commands.queued = nil
+}
@@ -1,39 +1,56 @@
 package terminal
 
 import (
-	"bufio"
-	"context"
+	"bytes"
 	"fmt"
-	"io"
 	"log"
+	"math"
 	"os"
 	"os/exec"
 	"sync"
 	"time"
+	"unicode/utf8"
 
 	pb "github.com/mooncorn/nodelink/agent/internal/proto"
 )
 
-// Session represents a terminal session
+// Session represents a terminal session running on a pseudo-terminal
 type Session struct {
 	ID         string
 	Shell      string
 	WorkingDir string
 	Env        map[string]string
 	cmd        *exec.Cmd
-	stdin      io.WriteCloser
-	stdout     io.ReadCloser
-	stderr     io.ReadCloser
-	ctx        context.Context
-	cancel     context.CancelFunc
+	pty        *os.File      // master side of the pseudo-terminal
+	outputDone chan struct{} // closed once all output has been read
+	done       chan struct{} // closed once the shell has exited
 	createdAt  time.Time
+
+	// With shell integration, API commands are tracked until they finish
+	tracked  bool
+	commands commandTracker
+	scanner  markerScanner
 }
 
+const (
+	// Size of a pseudo-terminal when the server doesn't specify one
+	defaultRows = 24
+	defaultCols = 80
+
+	// outputDrainTimeout bounds how long output is still read after the shell
+	// exits, since background processes may keep the terminal open
+	outputDrainTimeout = time.Second
+
+	// hangupTimeout is how long a closed session gets to exit after SIGHUP before it is killed
+	hangupTimeout = 5 * time.Second
+)
+
 // Manager manages terminal sessions on the agent
 type Manager struct {
 	sessions    map[string]*Session
 	mu          sync.RWMutex
 	messageSend func(*pb.AgentMessage) error
+	integration shellIntegration
 }
 
 // NewManager creates a new terminal manager
@@ -76,50 +93,25 @@ func (m *Manager) CreateSession(req *pb.TerminalCreateRequest) {
 		}
 	}
 
-	// Create context for the session
-	ctx, cancel := context.WithCancel(context.Background())
-
-	// Create command - start interactive shell
-	cmd := exec.CommandContext(ctx, shell)
+	// Create command - start interactive shell, reporting command completion if it supports that
+	integrationArgs := m.integration.args(shell)
+	cmd := exec.Command(shell, integrationArgs...)
 	cmd.Dir = workingDir
 
-	// Set environment variables
+	// Set environment variables; full-screen programs need to know the terminal type
 	cmd.Env = os.Environ()
+	if os.Getenv("TERM") == "" {
+		cmd.Env = append(cmd.Env, "TERM=xterm-256color")
+	}
 	for key, value := range req.Env {
 		cmd.Env = append(cmd.Env, fmt.Sprintf("%s=%s", key, value))
 	}
 
-	// Get pipes
-	stdin, err := cmd.StdinPipe()
-	if err != nil {
-		cancel()
-		m.sendCreateResponse(req.SessionId, false, fmt.Sprintf("failed to create stdin pipe: %v", err), "")
-		return
-	}
-
-	stdout, err := cmd.StdoutPipe()
-	if err != nil {
-		stdin.Close()
-		cancel()
-		m.sendCreateResponse(req.SessionId, false, fmt.Sprintf("failed to create stdout pipe: %v", err), "")
-		return
-	}
+	rows, cols := terminalSize(req.Rows, req.Cols)
 
-	stderr, err := cmd.StderrPipe()
+	// Start the shell on a pseudo-terminal
+	pty, err := startPTY(cmd, rows, cols)
 	if err != nil {
-		stdin.Close()
-		stdout.Close()
-		cancel()
-		m.sendCreateResponse(req.SessionId, false, fmt.Sprintf("failed to create stderr pipe: %v", err), "")
-		return
-	}
-
-	// Start the command
-	if err := cmd.Start(); err != nil {
-		stdin.Close()
-		stdout.Close()
-		stderr.Close()
-		cancel()
 		m.sendCreateResponse(req.SessionId, false, fmt.Sprintf("failed to start shell: %v", err), "")
 		return
 	}
@@ -131,30 +123,34 @@ func (m *Manager) CreateSession(req *pb.TerminalCreateRequest) {
 		WorkingDir: workingDir,
 		Env:        req.Env,
 		cmd:        cmd,
-		stdin:      stdin,
-		stdout:     stdout,
-		stderr:     stderr,
-		ctx:        ctx,
-		cancel:     cancel,
+		pty:        pty,
+		outputDone: make(chan struct{}),
+		done:       make(chan struct{}),
 		createdAt:  time.Now(),
+		tracked:    integrationArgs != nil,
 	}
 
 	m.sessions[req.SessionId] = session
 
-	// Start output streaming goroutines
-	go m.streamOutput(session, stdout, false)
-	go m.streamOutput(session, stderr, true)
+	// Start output streaming goroutine
+	go m.streamOutput(session)
 
 	// Monitor process termination
 	go m.monitorSession(session)
 
+	if session.tracked {
+		time.AfterFunc(integrationTimeout, func() { m.checkIntegration(session) })
+	}
+
 	// Send success response
 	m.sendCreateResponse(req.SessionId, true, "", shell)
 
-	log.Printf("Terminal session %s created with shell %s", req.SessionId, shell)
+	log.Printf("Terminal session %s created with shell %s (%dx%d)", req.SessionId, shell, cols, rows)
 }
 
-// ExecuteCommand executes a command in a terminal session
+// ExecuteCommand executes a command in a terminal session. With shell
+// integration the command is typed once the shell is back at its prompt, and
+// gets a final response with its exit code when it finishes.
 func (m *Manager) ExecuteCommand(req *pb.TerminalCommandRequest) {
 	m.mu.RLock()
 	session, exists := m.sessions[req.SessionId]
@@ -165,18 +161,87 @@ func (m *Manager) ExecuteCommand(req *pb.TerminalCommandRequest) {
 		return
 	}
 
-	// Write command to stdin
+	if session.tracked {
+		session.commands.mu.Lock()
+		if !session.commands.disabled {
+			session.commands.queued = append(session.commands.queued, newTrackedCommand(req.CommandId, req.Command))
+			m.dispatchCommand(session)
+			session.commands.mu.Unlock()
+
+			m.sendCommandResponse(req.SessionId, req.CommandId, "", "", false, 0)
+			return
+		}
+		session.commands.mu.Unlock()
+	}
+
+	// Type the command into the terminal
 	command := req.Command + "\n"
-	if _, err := session.stdin.Write([]byte(command)); err != nil {
+	if _, err := session.pty.Write([]byte(command)); err != nil {
 		m.sendCommandResponse(req.SessionId, req.CommandId, "", fmt.Sprintf("failed to write command: %v", err), true, 1)
 		return
 	}
 
-	// Commands in interactive shells don't have a direct way to track completion
+	// Without shell integration there is no way to tell when the command finishes
 	// We send a non-final response to indicate the command was sent
 	m.sendCommandResponse(req.SessionId, req.CommandId, "", "", false, 0)
 }
 
+// WriteInput types raw input into a session's terminal
+func (m *Manager) WriteInput(req *pb.TerminalInput) {
+	m.mu.RLock()
+	session, exists := m.sessions[req.SessionId]
+	m.mu.RUnlock()
+
+	if !exists {
+		log.Printf("Cannot write input to unknown terminal session %s", req.SessionId)
+		return
+	}
+
+	if session.tracked && bytes.ContainsAny(req.Data, "\r\n") {
+		// The user may have submitted a line at the prompt, so wait for the next one
+		session.commands.mu.Lock()
+		session.commands.atPrompt = false
+		session.commands.mu.Unlock()
+	}
+
+	if _, err := session.pty.Write(req.Data); err != nil {
+		log.Printf("Failed to write input to terminal session %s: %v", req.SessionId, err)
+	}
+}
+
+// SignalSession signals the foreground process group of a session's terminal
+func (m *Manager) SignalSession(req *pb.TerminalSignalRequest) {
+	m.mu.RLock()
+	session, exists := m.sessions[req.SessionId]
+	m.mu.RUnlock()
+
+	if !exists {
+		log.Printf("Cannot signal unknown terminal session %s", req.SessionId)
+		return
+	}
+
+	if err := signalForeground(session.pty, req.Signal); err != nil {
+		log.Printf("Failed to send %s to terminal session %s: %v", req.Signal, req.SessionId, err)
+	}
+}
+
+// ResizeSession changes the size of a session's terminal
+func (m *Manager) ResizeSession(req *pb.TerminalResizeRequest) {
+	m.mu.RLock()
+	session, exists := m.sessions[req.SessionId]
+	m.mu.RUnlock()
+
+	if !exists {
+		log.Printf("Cannot resize unknown terminal session %s", req.SessionId)
+		return
+	}
+
+	rows, cols := terminalSize(req.Rows, req.Cols)
+	if err := resizePTY(session.pty, rows, cols); err != nil {
+		log.Printf("Failed to resize terminal session %s: %v", req.SessionId, err)
+	}
+}
+
 // CloseSession closes a terminal session
 func (m *Manager) CloseSession(req *pb.TerminalCloseRequest) {
 	m.mu.Lock()
@@ -188,16 +253,7 @@ func (m *Manager) CloseSession(req *pb.TerminalCloseRequest) {
 		return
 	}
 
-	// Cancel context and close pipes
-	session.cancel()
-	session.stdin.Close()
-	session.stdout.Close()
-	session.stderr.Close()
-
-	// Kill the process if still running
-	if session.cmd.Process != nil {
-		session.cmd.Process.Kill()
-	}
+	session.terminate()
 
 	// Remove from sessions
 	delete(m.sessions, req.SessionId)
@@ -208,30 +264,73 @@ func (m *Manager) CloseSession(req *pb.TerminalCloseRequest) {
 	log.Printf("Terminal session %s closed", req.SessionId)
 }
 
-// streamOutput streams output from stdout or stderr
-func (m *Manager) streamOutput(session *Session, reader io.ReadCloser, isStderr bool) {
-	defer reader.Close()
+// terminate hangs up the session and kills it if it hasn't exited in time
+func (s *Session) terminate() {
+	if err := hangup(s.cmd); err != nil {
+		log.Printf("Failed to hang up terminal session %s: %v", s.ID, err)
+	}
+
+	go func() {
+		select {
+		case <-s.done:
+		case <-time.After(hangupTimeout):
+			log.Printf("Terminal session %s ignored hangup, killing it", s.ID)
+			kill(s.cmd)
+		}
+	}()
+}
 
-	scanner := bufio.NewScanner(reader)
-	for scanner.Scan() {
-		output := scanner.Text()
+// streamOutput sends everything written to the terminal as raw bytes. An
+// incomplete UTF-8 character at the end of a read is held back until the rest arrives.
+func (m *Manager) streamOutput(session *Session) {
+	defer close(session.outputDone)
+
+	buf := make([]byte, 32*1024)
+	var pending []byte
+
+	for {
+		n, err := session.pty.Read(buf)
+		if n > 0 {
+			chunk := make([]byte, 0, len(pending)+n)
+			chunk = append(chunk, pending...)
+			chunk = append(chunk, buf[:n]...)
+
+			chunk, pending = splitIncompleteUTF8(chunk)
+			if len(chunk) > 0 {
+				m.emitOutput(session, chunk)
+			}
+		}
 
-		if isStderr {
-			m.sendCommandResponse(session.ID, "", "", output, false, 0)
-		} else {
-			m.sendCommandResponse(session.ID, "", output, "", false, 0)
+		if err != nil {
+			// Reads fail with EIO once every process has closed the terminal
+			if len(pending) > 0 {
+				m.emitOutput(session, pending)
+			}
+			return
 		}
 	}
+}
 
-	if err := scanner.Err(); err != nil {
-		log.Printf("Error reading output from session %s: %v", session.ID, err)
+// splitIncompleteUTF8 splits off a trailing partial UTF-8 character
+func splitIncompleteUTF8(data []byte) ([]byte, []byte) {
+	for i := len(data) - 1; i >= 0 && i >= len(data)-utf8.UTFMax+1; i-- {
+		if !utf8.RuneStart(data[i]) {
+			continue
+		}
+		if utf8.FullRune(data[i:]) {
+			return data, nil
+		}
+		return data[:i], append([]byte(nil), data[i:]...)
 	}
+	return data, nil
 }
 
 // monitorSession monitors the session process and cleans up when it exits
 func (m *Manager) monitorSession(session *Session) {
 	// Wait for process to complete
 	err := session.cmd.Wait()
+	close(session.done)
+
 	exitCode := 0
 	if err != nil {
 		if exitError, ok := err.(*exec.ExitError); ok {
@@ -241,17 +340,58 @@ func (m *Manager) monitorSession(session *Session) {
 		}
 	}
 
+	// Deliver the remaining output before announcing the end of the session
+	select {
+	case <-session.outputDone:
+	case <-time.After(outputDrainTimeout):
+	}
+	session.pty.Close()
+	<-session.outputDone
+
 	// Clean up session
 	m.mu.Lock()
-	delete(m.sessions, session.ID)
+	if m.sessions[session.ID] == session {
+		delete(m.sessions, session.ID)
+	}
 	m.mu.Unlock()
 
+	// Finish the session's own commands before the session itself
+	m.abandonCommands(session, int32(exitCode))
+
 	// Send final response
 	m.sendCommandResponse(session.ID, "", "", fmt.Sprintf("Session ended with exit code %d", exitCode), true, int32(exitCode))
 
 	log.Printf("Terminal session %s ended with exit code %d", session.ID, exitCode)
 }
 
+// terminalSize applies the default size to unset dimensions
+func terminalSize(rows, cols uint32) (uint16, uint16) {
+	if rows == 0 || rows > math.MaxUint16 {
+		rows = defaultRows
+	}
+	if cols == 0 || cols > math.MaxUint16 {
+		cols = defaultCols
+	}
+	return uint16(rows), uint16(cols)
+}
+
+// sendOutput sends raw terminal output along with the command that produced it, if known
+func (m *Manager) sendOutput(sessionID string, data []byte, commandID string) {
+	message := &pb.AgentMessage{
+		Message: &pb.AgentMessage_TerminalOutput{
+			TerminalOutput: &pb.TerminalOutput{
+				SessionId: sessionID,
+				Data:      data,
+				CommandId: commandID,
+			},
+		},
+	}
+
+	if err := m.messageSend(message); err != nil {
+		log.Printf("Failed to send terminal output: %v", err)
+	}
+}
+
 // sendCreateResponse sends a terminal create response
 func (m *Manager) sendCreateResponse(sessionID string, success bool, errorMsg, shell string) {
 	response := &pb.TerminalCreateResponse{
@@ -294,6 +434,28 @@ func (m *Manager) sendCommandResponse(sessionID, commandID, output, errorMsg str
 	}
 }
 
+// sendCommandFinished sends the final response of a tracked command
+func (m *Manager) sendCommandFinished(sessionID string, command *trackedCommand, exitCode int32, errorMsg string) {
+	response := &pb.TerminalCommandResponse{
+		SessionId:  sessionID,
+		CommandId:  command.id,
+		Error:      errorMsg,
+		IsFinal:    true,
+		ExitCode:   exitCode,
+		DurationMs: time.Since(command.started).Milliseconds(),
+	}
+
+	message := &pb.AgentMessage{
+		Message: &pb.AgentMessage_TerminalCommandResponse{
+			TerminalCommandResponse: response,
+		},
+	}
+
+	if err := m.messageSend(message); err != nil {
+		log.Printf("Failed to send terminal command response: %v", err)
+	}
+}
+
 // sendCloseResponse sends a terminal close response
 func (m *Manager) sendCloseResponse(sessionID string, success bool, errorMsg string) {
 	response := &pb.TerminalCloseResponse{
@@ -323,23 +485,35 @@ func (m *Manager) GetSessionStats() map[string]interface{} {
 	}
 }
 
+// ListSessions describes the running sessions so they can be re-announced after a reconnect
+func (m *Manager) ListSessions() []*pb.TerminalSessionInfo {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	sessions := make([]*pb.TerminalSessionInfo, 0, len(m.sessions))
+	for _, session := range m.sessions {
+		sessions = append(sessions, &pb.TerminalSessionInfo{
+			SessionId:  session.ID,
+			Shell:      session.Shell,
+			WorkingDir: session.WorkingDir,
+			CreatedAt:  session.createdAt.Unix(),
+		})
+	}
+
+	return sessions
+}
+
 // Cleanup closes all sessions (called during agent shutdown)
 func (m *Manager) Cleanup() {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
 	for sessionID, session := range m.sessions {
-		session.cancel()
-		session.stdin.Close()
-		session.stdout.Close()
-		session.stderr.Close()
-
-		if session.cmd.Process != nil {
-			session.cmd.Process.Kill()
-		}
+		session.terminate()
 
 		log.Printf("Cleaned up terminal session %s", sessionID)
 	}
 
 	m.sessions = make(map[string]*Session)
+	m.integration.remove()
 }
@@ -0,0 +1,47 @@
+//go:build darwin
+
+package terminal
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// openPTY allocates a pseudo-terminal pair and returns the master and the slave's path
+func openPTY() (*os.File, string, error) {
+	fd, err := unix.Open("/dev/ptmx", unix.O_RDWR|unix.O_NOCTTY|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to open /dev/ptmx: %w", err)
+	}
+
+	// Equivalent of grantpt, unlockpt and ptsname
+	if err := unix.IoctlSetInt(fd, unix.TIOCPTYGRANT, 0); err != nil {
+		unix.Close(fd)
+		return nil, "", fmt.Errorf("failed to grant pseudo-terminal: %w", err)
+	}
+	if err := unix.IoctlSetInt(fd, unix.TIOCPTYUNLK, 0); err != nil {
+		unix.Close(fd)
+		return nil, "", fmt.Errorf("failed to unlock pseudo-terminal: %w", err)
+	}
+	name := make([]byte, 128) // TIOCPTYGNAME fills a buffer of this size
+	if _, _, errno := unix.Syscall(unix.SYS_IOCTL, uintptr(fd), uintptr(unix.TIOCPTYGNAME), uintptr(unsafe.Pointer(&name[0]))); errno != 0 {
+		unix.Close(fd)
+		return nil, "", fmt.Errorf("failed to get pseudo-terminal name: %w", errno)
+	}
+	if end := bytes.IndexByte(name, 0); end >= 0 {
+		name = name[:end]
+	}
+
+	// A non-blocking descriptor goes through the runtime poller, so closing the
+	// master interrupts a pending read
+	if err := unix.SetNonblock(fd, true); err != nil {
+		unix.Close(fd)
+		return nil, "", fmt.Errorf("failed to configure pseudo-terminal: %w", err)
+	}
+
+	return os.NewFile(uintptr(fd), "/dev/ptmx"), string(name), nil
+}
@@ -0,0 +1,39 @@
+//go:build linux
+
+package terminal
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+
+	"golang.org/x/sys/unix"
+)
+
+// openPTY allocates a pseudo-terminal pair and returns the master and the slave's path
+func openPTY() (*os.File, string, error) {
+	fd, err := unix.Open("/dev/ptmx", unix.O_RDWR|unix.O_NOCTTY|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to open /dev/ptmx: %w", err)
+	}
+
+	// Equivalent of unlockpt and ptsname
+	if err := unix.IoctlSetPointerInt(fd, unix.TIOCSPTLCK, 0); err != nil {
+		unix.Close(fd)
+		return nil, "", fmt.Errorf("failed to unlock pseudo-terminal: %w", err)
+	}
+	number, err := unix.IoctlGetUint32(fd, unix.TIOCGPTN)
+	if err != nil {
+		unix.Close(fd)
+		return nil, "", fmt.Errorf("failed to get pseudo-terminal number: %w", err)
+	}
+
+	// A non-blocking descriptor goes through the runtime poller, so closing the
+	// master interrupts a pending read
+	if err := unix.SetNonblock(fd, true); err != nil {
+		unix.Close(fd)
+		return nil, "", fmt.Errorf("failed to configure pseudo-terminal: %w", err)
+	}
+
+	return os.NewFile(uintptr(fd), "/dev/ptmx"), "/dev/pts/" + strconv.FormatUint(uint64(number), 10), nil
+}
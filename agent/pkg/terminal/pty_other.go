@@ -0,0 +1,37 @@
+//go:build !linux && !darwin
+
+package terminal
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+)
+
+// errPTYUnsupported is returned where pseudo-terminals aren't implemented
+var errPTYUnsupported = errors.New("terminal sessions are only supported on Linux and macOS")
+
+// startPTY is not available on this platform
+func startPTY(cmd *exec.Cmd, rows, cols uint16) (*os.File, error) {
+	return nil, errPTYUnsupported
+}
+
+// resizePTY is not available on this platform
+func resizePTY(master *os.File, rows, cols uint16) error {
+	return errPTYUnsupported
+}
+
+// signalForeground is not available on this platform
+func signalForeground(master *os.File, name string) error {
+	return errPTYUnsupported
+}
+
+// hangup falls back to killing the shell
+func hangup(cmd *exec.Cmd) error {
+	return cmd.Process.Kill()
+}
+
+// kill falls back to killing the shell
+func kill(cmd *exec.Cmd) error {
+	return cmd.Process.Kill()
+}
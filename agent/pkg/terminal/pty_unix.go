@@ -0,0 +1,116 @@
+//go:build linux || darwin
+
+package terminal
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// startPTY starts the command on a new pseudo-terminal of the given size and
+// returns its master side. The command becomes a session leader with the
+// terminal as its controlling terminal, so job control and SIGHUP work as usual.
+func startPTY(cmd *exec.Cmd, rows, cols uint16) (*os.File, error) {
+	master, slaveName, err := openPTY()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := resizePTY(master, rows, cols); err != nil {
+		master.Close()
+		return nil, err
+	}
+
+	slave, err := os.OpenFile(slaveName, os.O_RDWR|syscall.O_NOCTTY, 0)
+	if err != nil {
+		master.Close()
+		return nil, fmt.Errorf("failed to open %s: %w", slaveName, err)
+	}
+	// The child keeps its own copies; closing ours lets reads on the master end once it exits
+	defer slave.Close()
+
+	cmd.Stdin = slave
+	cmd.Stdout = slave
+	cmd.Stderr = slave
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		Setsid:  true,
+		Setctty: true,
+		Ctty:    0, // stdin in the child
+	}
+
+	if err := cmd.Start(); err != nil {
+		master.Close()
+		return nil, err
+	}
+
+	return master, nil
+}
+
+// resizePTY sets the window size of a pseudo-terminal; the foreground process gets SIGWINCH
+func resizePTY(master *os.File, rows, cols uint16) error {
+	conn, err := master.SyscallConn()
+	if err != nil {
+		return err
+	}
+
+	var ioctlErr error
+	err = conn.Control(func(fd uintptr) {
+		ioctlErr = unix.IoctlSetWinsize(int(fd), unix.TIOCSWINSZ, &unix.Winsize{Row: rows, Col: cols})
+	})
+	if err != nil {
+		return err
+	}
+	return ioctlErr
+}
+
+// terminalSignals are the signals that can be sent to a terminal's foreground process group
+var terminalSignals = map[string]syscall.Signal{
+	"SIGINT":  syscall.SIGINT,
+	"SIGQUIT": syscall.SIGQUIT,
+	"SIGTSTP": syscall.SIGTSTP,
+	"SIGTERM": syscall.SIGTERM,
+	"SIGKILL": syscall.SIGKILL,
+	"SIGHUP":  syscall.SIGHUP,
+}
+
+// signalForeground sends a signal to the process group in the foreground of
+// a pseudo-terminal, which is what typing Ctrl-C or Ctrl-Z does
+func signalForeground(master *os.File, name string) error {
+	sig, ok := terminalSignals[name]
+	if !ok {
+		return fmt.Errorf("unsupported signal: %s", name)
+	}
+
+	conn, err := master.SyscallConn()
+	if err != nil {
+		return err
+	}
+
+	var pgrp int
+	var ioctlErr error
+	err = conn.Control(func(fd uintptr) {
+		pgrp, ioctlErr = unix.IoctlGetInt(int(fd), unix.TIOCGPGRP)
+	})
+	if err != nil {
+		return err
+	}
+	if ioctlErr != nil {
+		return fmt.Errorf("failed to get foreground process group: %w", ioctlErr)
+	}
+
+	return syscall.Kill(-pgrp, sig)
+}
+
+// hangup signals the session's whole process group like a terminal hangup would
+func hangup(cmd *exec.Cmd) error {
+	return syscall.Kill(-cmd.Process.Pid, syscall.SIGHUP)
+}
+
+// kill forcibly ends the session's whole process group
+func kill(cmd *exec.Cmd) error {
+	return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+}
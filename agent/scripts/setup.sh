@@ -17,9 +17,19 @@ SERVICE_USER="${SERVICE_USER:-nodelink}"
 # Version to install (will be replaced during build)
 VERSION="__VERSION_PLACEHOLDER__"
 
-# Required environment variables for the agent
+# Agent credentials: either AGENT_ID and AGENT_TOKEN, or a one-time ENROLLMENT_TOKEN
 AGENT_ID="${AGENT_ID:-}"
 AGENT_TOKEN="${AGENT_TOKEN:-}"
+ENROLLMENT_TOKEN="${ENROLLMENT_TOKEN:-}"
+
+# Optional TLS files: a private CA for the server and a client certificate for mTLS
+TLS_CA_FILE="${TLS_CA_FILE:-}"
+TLS_CERT_FILE="${TLS_CERT_FILE:-}"
+TLS_KEY_FILE="${TLS_KEY_FILE:-}"
+
+# Optional labels declared to the server, e.g. "env=prod,role=db"
+AGENT_LABELS="${AGENT_LABELS:-}"
+AGENT_LABELS_FILE="${AGENT_LABELS_FILE:-}"
 
 # Colors for output
 RED='\033[0;31m'
@@ -50,12 +60,22 @@ check_root() {
 
 # Validate required environment variables
 validate_config() {
-    if [[ -z "$AGENT_ID" ]]; then
-        error "AGENT_ID environment variable is required"
+    if [[ -n "$TLS_CERT_FILE" && -z "$TLS_KEY_FILE" ]] || [[ -z "$TLS_CERT_FILE" && -n "$TLS_KEY_FILE" ]]; then
+        error "TLS_CERT_FILE and TLS_KEY_FILE must be set together"
     fi
 
-    if [[ -z "$AGENT_TOKEN" ]]; then
-        error "AGENT_TOKEN environment variable is required"
+    if [[ -n "$TLS_CERT_FILE" ]]; then
+        log "Agent will authenticate with client certificate $TLS_CERT_FILE"
+    elif [[ -n "$ENROLLMENT_TOKEN" ]]; then
+        log "Agent will enroll with the server on first start"
+    else
+        if [[ -z "$AGENT_ID" ]]; then
+            error "AGENT_ID or ENROLLMENT_TOKEN environment variable is required"
+        fi
+
+        if [[ -z "$AGENT_TOKEN" ]]; then
+            error "AGENT_TOKEN or ENROLLMENT_TOKEN environment variable is required"
+        fi
     fi
 
     log "Configuration validated"
@@ -299,6 +319,24 @@ install_updater() {
 # Install systemd services
 install_service() {
     log "Installing systemd services..."
+
+    # Only pass the credentials that were provided. An enrolled agent keeps
+    # its credentials in $DATA_DIR, so the spent enrollment token is harmless.
+    local credential_env=""
+    if [[ -n "$AGENT_ID" ]]; then
+        credential_env+="Environment=AGENT_ID=${AGENT_ID}"$'\n'
+    fi
+    if [[ -n "$AGENT_TOKEN" ]]; then
+        credential_env+="Environment=AGENT_TOKEN=${AGENT_TOKEN}"$'\n'
+    fi
+    if [[ -n "$ENROLLMENT_TOKEN" ]]; then
+        credential_env+="Environment=ENROLLMENT_TOKEN=${ENROLLMENT_TOKEN}"$'\n'
+    fi
+    for var in TLS_CA_FILE TLS_CERT_FILE TLS_KEY_FILE AGENT_LABELS AGENT_LABELS_FILE; do
+        if [[ -n "${!var}" ]]; then
+            credential_env+="Environment=${var}=${!var}"$'\n'
+        fi
+    done
     
     log "Creating agent service file"
     # Create agent service file
@@ -313,9 +351,7 @@ Wants=network.target
 Type=simple
 User=nodelink
 Group=nodelink
-Environment=AGENT_ID=${AGENT_ID}
-Environment=AGENT_TOKEN=${AGENT_TOKEN}
-ExecStart=/usr/local/bin/nodelink-agent
+${credential_env}ExecStart=/usr/local/bin/nodelink-agent -credentials ${DATA_DIR}/credentials.json
 Restart=always
 RestartSec=5
 StartLimitInterval=60s
@@ -454,7 +490,7 @@ main() {
     start_service
     
     log "Clean install completed successfully!"
-    log "Agent ID: $AGENT_ID"
+    log "Agent ID: ${AGENT_ID:-assigned at enrollment}"
     log "Version: $installed_version"
     echo
     log "You can check the logs with:"
@@ -474,12 +510,25 @@ case "${1:-}" in
         echo "  2. Safely removing the existing installation (service, binary)"
         echo "  3. Installing the new version from scratch"
         echo
-        echo "Environment Variables (required):"
-        echo "  AGENT_ID        - Unique identifier"
-        echo "  AGENT_TOKEN     - Authentication token"
+        echo "Environment Variables (one of the three sets is required):"
+        echo "  AGENT_ID          - Unique identifier"
+        echo "  AGENT_TOKEN       - Authentication token"
+        echo
+        echo "  ENROLLMENT_TOKEN  - One-time token from POST /enrollment-tokens;"
+        echo "                      the agent exchanges it for credentials on first start"
+        echo "  AGENT_ID          - Optional requested ID (defaults to the hostname)"
+        echo
+        echo "  TLS_CERT_FILE     - Client certificate; the server takes the agent ID from it"
+        echo "  TLS_KEY_FILE      - Client private key"
+        echo
+        echo "Optional:"
+        echo "  TLS_CA_FILE       - CA that signed the server certificate"
+        echo "  AGENT_LABELS      - Labels declared to the server, e.g. env=prod,role=db"
+        echo "  AGENT_LABELS_FILE - File with one key=value label per line"
         echo
         echo "Usage:"
         echo "  sudo AGENT_ID=my-agent AGENT_TOKEN=secret ./setup.sh"
+        echo "  sudo ENROLLMENT_TOKEN=token ./setup.sh"
         echo
         echo "Note: This script will preserve user data and logs but replace"
         echo "      the agent binary and service configuration."
@@ -65,6 +65,21 @@ export interface NetworkMetrics {
   errors_out: number
   drops_in: number
   drops_out: number
+  bytes_sent_per_sec: number
+  bytes_recv_per_sec: number
+  packets_sent_per_sec: number
+  packets_recv_per_sec: number
+}
+
+export interface DiskIOMetrics {
+  device: string
+  reads_per_sec: number
+  writes_per_sec: number
+  read_bytes_per_sec: number
+  write_bytes_per_sec: number
+  util_percent: number
+  read_await_ms: number
+  write_await_ms: number
 }
 
 export interface ProcessMetrics {
@@ -78,6 +93,35 @@ export interface ProcessMetrics {
   num_threads: number
 }
 
+export interface CPUTimesMetrics {
+  user: number
+  system: number
+  idle: number
+  nice: number
+  iowait: number
+  irq: number
+  softirq: number
+  steal: number
+}
+
+export interface PressureAverages {
+  avg10: number
+  avg60: number
+  avg300: number
+  total_us: number
+}
+
+export interface PressureStall {
+  some: PressureAverages
+  full?: PressureAverages
+}
+
+export interface PressureMetrics {
+  cpu: PressureStall
+  memory: PressureStall
+  io: PressureStall
+}
+
 export interface SystemMetrics {
   cpu_usage_percent: number
   memory: MemoryMetrics
@@ -88,6 +132,10 @@ export interface SystemMetrics {
   load_average_1m: number
   load_average_5m: number
   load_average_15m: number
+  disk_io: DiskIOMetrics[]
+  cpu_core_usage_percent: number[]
+  cpu_times: CPUTimesMetrics
+  pressure?: PressureMetrics
 }
 
 // Terminal interfaces
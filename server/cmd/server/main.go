@@ -2,9 +2,14 @@ package main
 
 import (
 	"context"
+	"errors"
+	"flag"
 	"log"
 	"net"
+	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"github.com/gin-contrib/cors"
@@ -13,13 +18,21 @@ import (
 	"github.com/mooncorn/nodelink/server/internal/comm"
 	"github.com/mooncorn/nodelink/server/internal/command"
 	"github.com/mooncorn/nodelink/server/internal/common"
+	"github.com/mooncorn/nodelink/server/internal/enrollment"
+	"github.com/mooncorn/nodelink/server/internal/history"
 	"github.com/mooncorn/nodelink/server/internal/metrics"
 	"github.com/mooncorn/nodelink/server/internal/ping"
+	"github.com/mooncorn/nodelink/server/internal/prometheus"
 	pb "github.com/mooncorn/nodelink/server/internal/proto"
+	"github.com/mooncorn/nodelink/server/internal/recording"
+	"github.com/mooncorn/nodelink/server/internal/rotation"
 	"github.com/mooncorn/nodelink/server/internal/sse"
 	"github.com/mooncorn/nodelink/server/internal/status"
+	"github.com/mooncorn/nodelink/server/internal/storage"
 	"github.com/mooncorn/nodelink/server/internal/terminal"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/keepalive"
 )
 
 // AgentStatusLogger implements the StatusChangeListener interface
@@ -35,6 +48,18 @@ func (l *AgentStatusLogger) OnStatusChange(event common.StatusChangeEvent) {
 }
 
 func main() {
+	// TLS for the agent listener; each flag falls back to an environment variable
+	tlsCert := flag.String("tls-cert", os.Getenv("TLS_CERT_FILE"), "Server certificate for the gRPC listener")
+	tlsKey := flag.String("tls-key", os.Getenv("TLS_KEY_FILE"), "Server private key for the gRPC listener")
+	tlsClientCA := flag.String("tls-client-ca", os.Getenv("TLS_CLIENT_CA_FILE"), "CA for agent client certificates, enables mTLS")
+	requireClientCert := flag.Bool("require-client-cert", os.Getenv("REQUIRE_CLIENT_CERT") == "true", "Reject agents without a client certificate")
+	certIdentity := flag.String("cert-identity", os.Getenv("CERT_IDENTITY"), "Client certificate field holding the agent ID: cn or san (default cn)")
+	flag.Parse()
+
+	// Background routines run until the server is interrupted or terminated
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
 	// Get ports from environment variables
 	httpPort := os.Getenv("PORT")
 	if httpPort == "" {
@@ -46,36 +71,133 @@ func main() {
 		grpcPort = "9090"
 	}
 
-	defaultAgents := map[string]string{
-		"agent1": "secret_token1",
-		"agent2": "secret_token2",
+	// Open the embedded database used to persist the agent registry
+	dbPath := os.Getenv("DB_PATH")
+	if dbPath == "" {
+		dbPath = "nodelink.db"
+	}
+
+	store, err := storage.Open(dbPath)
+	if err != nil {
+		log.Fatalf("Failed to open storage: %v", err)
+	}
+	defer store.Close()
+
+	// Agent credentials come from a file if configured, otherwise from the database
+	var credentialStore common.CredentialStore = store
+	if credentialsFile := os.Getenv("AGENT_CREDENTIALS_FILE"); credentialsFile != "" {
+		fileStore, err := auth.NewFileCredentialStore(credentialsFile)
+		if err != nil {
+			log.Fatalf("Failed to load agent credentials: %v", err)
+		}
+		fileStore.Start(ctx)
+		credentialStore = fileStore
+	}
+
+	var authenticator auth.Authenticator = auth.NewStoreAuthenticator(credentialStore)
+
+	grpcOptions := []grpc.ServerOption{
+		// Keepalive lets dead agent links be detected so reconnecting agents aren't rejected as duplicates
+		grpc.KeepaliveParams(keepalive.ServerParameters{
+			Time:    30 * time.Second,
+			Timeout: 10 * time.Second,
+		}),
+		grpc.KeepaliveEnforcementPolicy(keepalive.EnforcementPolicy{
+			MinTime:             10 * time.Second,
+			PermitWithoutStream: true,
+		}),
 	}
 
-	auth := auth.NewDefaultAuthenticator(defaultAgents)
+	if *tlsCert != "" || *tlsKey != "" {
+		tlsConfig, err := auth.LoadServerTLSConfig(*tlsCert, *tlsKey, *tlsClientCA, *requireClientCert)
+		if err != nil {
+			log.Fatalf("Failed to configure TLS: %v", err)
+		}
+		grpcOptions = append(grpcOptions, grpc.Creds(credentials.NewTLS(tlsConfig)))
+
+		// With a client CA, a verified certificate identifies the agent
+		if *tlsClientCA != "" {
+			if *certIdentity == "" {
+				*certIdentity = string(auth.CertIdentityCommonName)
+			}
+			identity, err := auth.ParseCertIdentity(*certIdentity)
+			if err != nil {
+				log.Fatalf("Failed to configure mTLS: %v", err)
+			}
+
+			fallback := authenticator
+			if *requireClientCert {
+				fallback = nil
+			}
+			authenticator = auth.NewCertAuthenticator(identity, fallback)
+			log.Printf("mTLS enabled, agent ID taken from certificate %s", identity)
+		}
+	} else if *tlsClientCA != "" || *requireClientCert {
+		log.Fatal("Client certificate options need -tls-cert and -tls-key")
+	}
+
+	// Enrollment tokens let new agents obtain credentials on first start
+	enrollmentManager := enrollment.NewManager(store, credentialStore)
 
 	// Create status manager (replaces agentRepo)
-	statusManager := status.NewManager()
+	statusManager := status.NewManager(store)
 
 	// Create status change logger
 	logger := &AgentStatusLogger{}
 	statusManager.AddListener(logger)
 
+	// Record status transitions for availability reporting, closing periods
+	// left open by the previous shutdown first
+	historyRecorder := history.NewRecorder(store)
+	historyRecorder.Reconcile(statusManager.GetAllAgents())
+	statusManager.AddListener(historyRecorder)
+
+	// Create and start SSE manager (before ping, command and terminal handlers need it)
+	sseManager := sse.NewManager()
+	sseManager.Start()
+	defer sseManager.Stop()
+
 	// Create ping handler
-	pingHandler := ping.NewHandler(statusManager, ping.DefaultConfig())
+	pingHandler := ping.NewHandler(statusManager, sseManager, ping.DefaultConfig())
 
 	// Create command handler with status manager
-	commandHandler := command.NewHandler(statusManager)
+	commandHandler := command.NewHandler(statusManager, sseManager)
+
+	// Create job manager; finished jobs are kept for JOB_RETENTION (e.g. "72h")
+	jobRetention := common.DefaultJobRetention
+	if value := os.Getenv("JOB_RETENTION"); value != "" {
+		jobRetention, err = time.ParseDuration(value)
+		if err != nil {
+			log.Fatalf("Invalid JOB_RETENTION: %v", err)
+		}
+	}
+	jobManager := command.NewJobManager(commandHandler, jobRetention)
+	statusManager.AddListener(jobManager)
+
+	// Create fan-out manager for running a command on many agents at once
+	fanoutManager := command.NewFanoutManager(commandHandler)
 
 	// Create terminal session manager and handlers
 	terminalSessionManager := terminal.NewSessionManager()
 	defer terminalSessionManager.Stop()
 
-	// Create and start SSE manager (before terminal handlers need it)
-	sseManager := sse.NewManager()
-	sseManager.Start()
-	defer sseManager.Stop()
-
 	terminalHandler := terminal.NewHandler(terminalSessionManager, statusManager, sseManager)
+	terminalSessionManager.SetInactiveHandler(terminalHandler.CloseInactiveSession)
+	terminalHandler.SetAuditStore(store)
+	statusManager.AddListener(terminalHandler)
+
+	// Record terminal sessions unless disabled; agents can be set to always record
+	recordingDir := os.Getenv("TERMINAL_RECORDING_DIR")
+	if recordingDir == "" {
+		recordingDir = common.DefaultRecordingDir
+	}
+	recordingStore, err := recording.NewDirStore(recordingDir)
+	if err != nil {
+		log.Fatalf("Failed to open recording store: %v", err)
+	}
+	recordingManager := recording.NewManager(recordingStore, statusManager, os.Getenv("TERMINAL_RECORDING") != "false")
+	defer recordingManager.Close()
+	terminalHandler.SetRecorder(recordingManager)
 
 	// Create metrics handler
 	metricsHandler := metrics.NewHandler(statusManager)
@@ -83,6 +205,29 @@ func main() {
 	// Create metrics streaming manager
 	metricsStreamingManager := metrics.NewStreamingManager(metricsHandler, statusManager, sseManager)
 
+	// Agents that push their metrics collect only METRICS_FIELDS (e.g. "cpu_usage_percent,memory") if set
+	if value := os.Getenv("METRICS_FIELDS"); value != "" {
+		metricsFields, err := metrics.ParseFields(value)
+		if err != nil {
+			log.Fatalf("Invalid METRICS_FIELDS: %v", err)
+		}
+		metricsStreamingManager.SetMetricsFields(metricsFields)
+	}
+
+	// Keep collected metrics; raw samples are kept for METRICS_RAW_RETENTION (e.g. "48h"), rollups for longer
+	metricsRawRetention := common.DefaultMetricsRawRetention
+	if value := os.Getenv("METRICS_RAW_RETENTION"); value != "" {
+		metricsRawRetention, err = time.ParseDuration(value)
+		if err != nil || metricsRawRetention <= 0 {
+			log.Fatalf("Invalid METRICS_RAW_RETENTION: %q", value)
+		}
+	}
+	metricsHistory := metrics.NewHistory(store, metricsRawRetention)
+	metricsStreamingManager.SetHistory(metricsHistory)
+
+	// Create credential rotation manager
+	rotationManager := rotation.NewManager(credentialStore, statusManager, common.DefaultRotationGracePeriod)
+
 	// Create communication server with all dependencies
 	commServer := comm.NewCommunicationServer(comm.CommunicationConfig{
 		StatusManager:   statusManager,
@@ -90,24 +235,39 @@ func main() {
 		CommandHandler:  commandHandler,
 		TerminalHandler: terminalHandler,
 		MetricsHandler:  metricsHandler,
-		Authenticator:   auth,
+		Enrollment:      enrollmentManager,
+		Rotation:        rotationManager,
+		Authenticator:   authenticator,
 	})
 
 	// Start all services
-	pingHandler.Start(context.Background())
+	pingHandler.Start(ctx)
 	defer pingHandler.Stop()
 
+	// Start job cleanup routine
+	go jobManager.Start(ctx)
+
+	// Start fan-out cleanup routine
+	go fanoutManager.Start(ctx)
+
 	// Start metrics handler cleanup routine
-	go metricsHandler.Start(context.Background())
+	go metricsHandler.Start(ctx)
+
+	// Start metrics rollup and retention routine
+	go metricsHistory.Start(ctx)
+
+	// Start terminal audit log flushing and retention routine
+	go terminalHandler.Start(ctx)
+	defer terminalHandler.Stop()
 
 	// Start metrics streaming manager
 	metricsStreamingManager.Start()
 	defer metricsStreamingManager.Stop()
 
-	commServer.Start(context.Background())
+	commServer.Start(ctx)
 	defer commServer.Stop()
 
-	grpcServer := grpc.NewServer()
+	grpcServer := grpc.NewServer(grpcOptions...)
 	pb.RegisterAgentServiceServer(grpcServer, commServer)
 
 	// Create HTTP and SSE handlers for status management
@@ -116,19 +276,55 @@ func main() {
 	statusSSEHandler := status.NewSSEHandler(statusManager, sseManager)
 	defer statusSSEHandler.Stop()
 
+	// Create status history HTTP handler
+	historyHTTPHandler := history.NewHTTPHandler(historyRecorder, statusManager)
+
+	// Create per-agent heartbeat settings HTTP handler
+	pingHTTPHandler := ping.NewHTTPHandler(pingHandler)
+
+	// Create credential management HTTP handler
+	authHTTPHandler := auth.NewHTTPHandler(credentialStore, commServer)
+
+	// Create enrollment token HTTP handler
+	enrollmentHTTPHandler := enrollment.NewHTTPHandler(enrollmentManager)
+
+	// Create credential rotation HTTP handler
+	rotationHTTPHandler := rotation.NewHTTPHandler(rotationManager)
+
 	// Create command HTTP handler
-	commandHTTPHandler := command.NewHTTPHandler(commandHandler)
+	commandHTTPHandler := command.NewHTTPHandler(commandHandler, fanoutManager)
+	commandSSEHandler := command.NewSSEHandler(commandHandler, sseManager)
+	jobHTTPHandler := command.NewJobHTTPHandler(jobManager)
+	fanoutHTTPHandler := command.NewFanoutHTTPHandler(fanoutManager)
+	fanoutSSEHandler := command.NewFanoutSSEHandler(fanoutManager, sseManager)
 
-	// Create terminal HTTP and SSE handlers
+	// Create terminal HTTP, SSE and WebSocket handlers
 	terminalHTTPHandler := terminal.NewHTTPHandler(terminalHandler)
 	terminalSSEHandler := terminal.NewSSEHandler(terminalHandler, sseManager)
+	terminalWSHandler := terminal.NewWSHandler(terminalHandler)
+
+	// Create terminal recording HTTP and replay SSE handlers
+	recordingHTTPHandler := recording.NewHTTPHandler(recordingManager, statusManager)
+	recordingSSEHandler := recording.NewSSEHandler(recordingManager, sseManager)
 
 	// Create metrics HTTP handler
-	metricsHTTPHandler := metrics.NewHTTPHandler(metricsHandler, sseManager, metricsStreamingManager)
+	metricsHTTPHandler := metrics.NewHTTPHandler(metricsHandler, sseManager, metricsStreamingManager, metricsHistory)
 
 	// Create metrics SSE handler
 	metricsSSEHandler := metrics.NewSSEHandler(metricsHandler, metricsStreamingManager, sseManager)
 
+	// Create Prometheus exposition handler for the fleet and server metrics
+	prometheusHTTPHandler := prometheus.NewHTTPHandler(prometheus.Config{
+		StatusManager:    statusManager,
+		MetricsStreaming: metricsStreamingManager,
+		MetricsHandler:   metricsHandler,
+		CommandHandler:   commandHandler,
+		TerminalHandler:  terminalHandler,
+		TerminalSessions: terminalSessionManager,
+		SSEManager:       sseManager,
+		CommServer:       commServer,
+	})
+
 	router := gin.Default()
 
 	// Configure CORS middleware
@@ -138,7 +334,7 @@ func main() {
 		"http://127.0.0.1:5173",
 		"https://mooncorn.github.io",
 	}
-	config.AllowMethods = []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"}
+	config.AllowMethods = []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"}
 	config.AllowHeaders = []string{"Origin", "Content-Type", "Accept", "Authorization", "Cache-Control"}
 	config.ExposeHeaders = []string{"Content-Length"}
 	config.AllowCredentials = true
@@ -147,17 +343,32 @@ func main() {
 	// Register status routes (replaces agent routes)
 	statusHTTPHandler.RegisterRoutes(router)
 	statusSSEHandler.RegisterRoutes(router)
+	historyHTTPHandler.RegisterRoutes(router)
+	pingHTTPHandler.RegisterRoutes(router)
+
+	// Register credential routes
+	authHTTPHandler.RegisterRoutes(router)
+	enrollmentHTTPHandler.RegisterRoutes(router)
+	rotationHTTPHandler.RegisterRoutes(router)
 
 	// Register command routes
 	commandHTTPHandler.RegisterRoutes(router)
+	commandSSEHandler.RegisterRoutes(router)
+	jobHTTPHandler.RegisterRoutes(router)
+	fanoutHTTPHandler.RegisterRoutes(router)
+	fanoutSSEHandler.RegisterRoutes(router)
 
 	// Register terminal routes
 	terminalHTTPHandler.RegisterRoutes(router)
 	terminalSSEHandler.RegisterRoutes(router)
+	terminalWSHandler.RegisterRoutes(router)
+	recordingHTTPHandler.RegisterRoutes(router)
+	recordingSSEHandler.RegisterRoutes(router)
 
 	// Register metrics routes
 	metricsHTTPHandler.RegisterRoutes(router)
 	metricsSSEHandler.RegisterRoutes(router)
+	prometheusHTTPHandler.RegisterRoutes(router)
 
 	// Start gRPC server in background
 	lis, err := net.Listen("tcp", ":"+grpcPort)
@@ -172,6 +383,23 @@ func main() {
 		}
 	}()
 
-	log.Printf("HTTP Server starting on :%s", httpPort)
-	router.Run(":" + httpPort)
+	httpServer := &http.Server{
+		Addr:    ":" + httpPort,
+		Handler: router,
+	}
+
+	go func() {
+		log.Printf("HTTP Server starting on :%s", httpPort)
+		if err := httpServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatalf("Failed to serve HTTP: %v", err)
+		}
+	}()
+
+	<-ctx.Done()
+	log.Printf("Shutting down")
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	httpServer.Shutdown(shutdownCtx)
+	grpcServer.Stop()
 }
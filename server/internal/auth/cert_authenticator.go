@@ -0,0 +1,102 @@
+package auth
+
+import (
+	"context"
+	"crypto/x509"
+	"fmt"
+
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+
+	"github.com/mooncorn/nodelink/server/internal/common"
+)
+
+// CertIdentity selects which part of a client certificate names the agent
+type CertIdentity string
+
+const (
+	// CertIdentityCommonName uses the certificate subject's common name
+	CertIdentityCommonName CertIdentity = "cn"
+	// CertIdentityDNSName uses the first DNS subject alternative name
+	CertIdentityDNSName CertIdentity = "san"
+)
+
+// ParseCertIdentity validates a certificate identity setting
+func ParseCertIdentity(value string) (CertIdentity, error) {
+	switch identity := CertIdentity(value); identity {
+	case CertIdentityCommonName, CertIdentityDNSName:
+		return identity, nil
+	default:
+		return "", fmt.Errorf("unknown certificate identity %q (expected %q or %q)", value, CertIdentityCommonName, CertIdentityDNSName)
+	}
+}
+
+// CertAuthenticator derives the agent ID from a verified TLS client certificate.
+// Agents without a certificate are passed to the fallback authenticator, if any.
+type CertAuthenticator struct {
+	identity CertIdentity
+	fallback Authenticator
+}
+
+// NewCertAuthenticator creates a new client certificate authenticator. A nil
+// fallback makes a client certificate mandatory.
+func NewCertAuthenticator(identity CertIdentity, fallback Authenticator) *CertAuthenticator {
+	return &CertAuthenticator{
+		identity: identity,
+		fallback: fallback,
+	}
+}
+
+// Authenticate validates agent credentials
+func (a *CertAuthenticator) Authenticate(ctx context.Context) (string, error) {
+	cert := verifiedClientCert(ctx)
+	if cert == nil {
+		if a.fallback != nil {
+			return a.fallback.Authenticate(ctx)
+		}
+		return "", common.ErrMissingClientCert
+	}
+
+	agentID := a.agentID(cert)
+	if agentID == "" {
+		return "", common.ErrCertIdentityEmpty
+	}
+
+	// An agent may still send its ID, but it has to agree with the certificate
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if agentIDs := md.Get("agent_id"); len(agentIDs) > 0 && agentIDs[0] != agentID {
+			return "", common.ErrCertAgentMismatch
+		}
+	}
+
+	return agentID, nil
+}
+
+// agentID extracts the agent ID from a certificate
+func (a *CertAuthenticator) agentID(cert *x509.Certificate) string {
+	switch a.identity {
+	case CertIdentityDNSName:
+		if len(cert.DNSNames) > 0 {
+			return cert.DNSNames[0]
+		}
+		return ""
+	default:
+		return cert.Subject.CommonName
+	}
+}
+
+// verifiedClientCert returns the peer's client certificate if the TLS handshake verified it
+func verifiedClientCert(ctx context.Context) *x509.Certificate {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return nil
+	}
+
+	tlsInfo, ok := p.AuthInfo.(credentials.TLSInfo)
+	if !ok || len(tlsInfo.State.VerifiedChains) == 0 || len(tlsInfo.State.VerifiedChains[0]) == 0 {
+		return nil
+	}
+
+	return tlsInfo.State.VerifiedChains[0][0]
+}
@@ -0,0 +1,38 @@
+package auth
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// tokenBytes is the amount of randomness in generated agent tokens
+const tokenBytes = 32
+
+// dummyHash is compared against when an agent is unknown so lookups take the same time either way
+var dummyHash, _ = bcrypt.GenerateFromPassword([]byte("nodelink-dummy-token"), bcrypt.DefaultCost)
+
+// GenerateToken creates a new random agent token
+func GenerateToken() (string, error) {
+	buf := make([]byte, tokenBytes)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("failed to generate token: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// HashToken returns a salted bcrypt hash of a token
+func HashToken(token string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(token), bcrypt.DefaultCost)
+	if err != nil {
+		return "", fmt.Errorf("failed to hash token: %w", err)
+	}
+	return string(hash), nil
+}
+
+// VerifyToken checks a token against a stored hash in constant time
+func VerifyToken(hash, token string) bool {
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(token)) == nil
+}
@@ -0,0 +1,261 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/mooncorn/nodelink/server/internal/common"
+)
+
+// DefaultFileCheckInterval is how often the credentials file is checked for changes
+const DefaultFileCheckInterval = 5 * time.Second
+
+// credentialsFile is the on-disk format of the credentials file
+type credentialsFile struct {
+	Agents []*common.AgentCredential `json:"agents"`
+}
+
+// FileCredentialStore keeps agent credentials in a JSON file and reloads it
+// on SIGHUP or whenever the file changes
+type FileCredentialStore struct {
+	path string
+
+	mu          sync.RWMutex
+	credentials map[string]*common.AgentCredential
+	modTime     time.Time
+	size        int64
+}
+
+// NewFileCredentialStore creates a credential store backed by the given file.
+// A missing file is treated as an empty store and created on the first write.
+func NewFileCredentialStore(path string) (*FileCredentialStore, error) {
+	store := &FileCredentialStore{
+		path:        path,
+		credentials: make(map[string]*common.AgentCredential),
+	}
+
+	if err := store.Reload(); err != nil {
+		return nil, err
+	}
+
+	return store, nil
+}
+
+// Start watches for SIGHUP and file changes until the context is cancelled
+func (s *FileCredentialStore) Start(ctx context.Context) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+
+	go func() {
+		defer signal.Stop(hup)
+
+		ticker := time.NewTicker(DefaultFileCheckInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-hup:
+				log.Printf("SIGHUP received, reloading credentials from %s", s.path)
+				if err := s.Reload(); err != nil {
+					log.Printf("Failed to reload credentials: %v", err)
+				}
+			case <-ticker.C:
+				if !s.changed() {
+					continue
+				}
+				log.Printf("Credentials file %s changed, reloading", s.path)
+				if err := s.Reload(); err != nil {
+					log.Printf("Failed to reload credentials: %v", err)
+				}
+			}
+		}
+	}()
+}
+
+// Reload re-reads the credentials file. On error the previous credentials are kept.
+func (s *FileCredentialStore) Reload() error {
+	info, err := os.Stat(s.path)
+	if os.IsNotExist(err) {
+		s.mu.Lock()
+		s.credentials = make(map[string]*common.AgentCredential)
+		s.modTime = time.Time{}
+		s.size = 0
+		s.mu.Unlock()
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to stat credentials file: %w", err)
+	}
+
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		return fmt.Errorf("failed to read credentials file: %w", err)
+	}
+
+	var file credentialsFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return fmt.Errorf("failed to parse credentials file: %w", err)
+	}
+
+	credentials := make(map[string]*common.AgentCredential, len(file.Agents))
+	for _, credential := range file.Agents {
+		if credential.AgentID == "" || credential.TokenHash == "" {
+			return fmt.Errorf("credentials file contains an entry without agent_id or token_hash")
+		}
+		credentials[credential.AgentID] = credential
+	}
+
+	s.mu.Lock()
+	s.credentials = credentials
+	s.modTime = info.ModTime()
+	s.size = info.Size()
+	s.mu.Unlock()
+
+	log.Printf("Loaded %d agent credentials from %s", len(credentials), s.path)
+	return nil
+}
+
+// GetCredential returns the credential for an agent
+func (s *FileCredentialStore) GetCredential(agentID string) (*common.AgentCredential, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	credential, exists := s.credentials[agentID]
+	if !exists {
+		return nil, common.ErrCredentialNotFound
+	}
+
+	credentialCopy := *credential
+	return &credentialCopy, nil
+}
+
+// ListCredentials returns all credentials ordered by agent ID
+func (s *FileCredentialStore) ListCredentials() ([]*common.AgentCredential, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.sortedCredentials(), nil
+}
+
+// SaveCredential inserts or replaces a credential and writes the file back
+func (s *FileCredentialStore) SaveCredential(credential *common.AgentCredential) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	credentialCopy := *credential
+	previous, existed := s.credentials[credential.AgentID]
+	s.credentials[credential.AgentID] = &credentialCopy
+
+	if err := s.writeFile(); err != nil {
+		// Keep memory consistent with what is on disk
+		if existed {
+			s.credentials[credential.AgentID] = previous
+		} else {
+			delete(s.credentials, credential.AgentID)
+		}
+		return err
+	}
+
+	return nil
+}
+
+// MarkCredentialAuthenticated records the first authentication with a
+// credential, unless its token has been replaced since
+func (s *FileCredentialStore) MarkCredentialAuthenticated(agentID, tokenHash string, at time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	credential, exists := s.credentials[agentID]
+	if !exists {
+		return common.ErrCredentialNotFound
+	}
+	if credential.AuthenticatedAt != nil || credential.TokenHash != tokenHash {
+		return nil
+	}
+
+	credential.AuthenticatedAt = &at
+	if err := s.writeFile(); err != nil {
+		// Keep memory consistent with what is on disk
+		credential.AuthenticatedAt = nil
+		return err
+	}
+
+	return nil
+}
+
+// writeFile atomically replaces the credentials file. Must be called with the lock held.
+func (s *FileCredentialStore) writeFile() error {
+	data, err := json.MarshalIndent(credentialsFile{Agents: s.sortedCredentials()}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode credentials: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), ".credentials-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary credentials file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write credentials: %w", err)
+	}
+	if err := tmp.Chmod(0600); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to set credentials file permissions: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write credentials: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		return fmt.Errorf("failed to replace credentials file: %w", err)
+	}
+
+	// Our own write shouldn't trigger a reload
+	if info, err := os.Stat(s.path); err == nil {
+		s.modTime = info.ModTime()
+		s.size = info.Size()
+	}
+
+	return nil
+}
+
+// sortedCredentials returns copies of all credentials ordered by agent ID. Must be called with the lock held.
+func (s *FileCredentialStore) sortedCredentials() []*common.AgentCredential {
+	credentials := make([]*common.AgentCredential, 0, len(s.credentials))
+	for _, credential := range s.credentials {
+		credentialCopy := *credential
+		credentials = append(credentials, &credentialCopy)
+	}
+
+	sort.Slice(credentials, func(i, j int) bool {
+		return credentials[i].AgentID < credentials[j].AgentID
+	})
+
+	return credentials
+}
+
+// changed reports whether the file differs from what was last loaded
+func (s *FileCredentialStore) changed() bool {
+	info, err := os.Stat(s.path)
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if err != nil {
+		// A deleted file only counts as a change if something was loaded from it
+		return os.IsNotExist(err) && !s.modTime.IsZero()
+	}
+	return !info.ModTime().Equal(s.modTime) || info.Size() != s.size
+}
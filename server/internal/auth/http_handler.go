@@ -0,0 +1,168 @@
+package auth
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mooncorn/nodelink/server/internal/common"
+)
+
+// HTTPHandler handles HTTP requests for managing agent credentials
+type HTTPHandler struct {
+	store        common.CredentialStore
+	disconnector common.AgentDisconnector
+}
+
+// NewHTTPHandler creates a new HTTP handler for agent credentials. Agents
+// whose credential is revoked are disconnected through the disconnector.
+func NewHTTPHandler(store common.CredentialStore, disconnector common.AgentDisconnector) *HTTPHandler {
+	return &HTTPHandler{
+		store:        store,
+		disconnector: disconnector,
+	}
+}
+
+// RegisterRoutes registers credential routes with the given router
+func (h *HTTPHandler) RegisterRoutes(router gin.IRouter) {
+	credentials := router.Group("/credentials")
+	{
+		credentials.GET("", h.listCredentials)
+		credentials.POST("", h.createCredential)
+		credentials.DELETE("/:agentId", h.revokeCredential)
+	}
+}
+
+// CreateCredentialRequest represents the request to add an agent
+type CreateCredentialRequest struct {
+	AgentID string `json:"agent_id" binding:"required"`
+}
+
+// CredentialResponse describes a credential without its hash
+type CredentialResponse struct {
+	AgentID             string     `json:"agent_id"`
+	CreatedAt           time.Time  `json:"created_at"`
+	RevokedAt           *time.Time `json:"revoked_at,omitempty"`
+	RotatedAt           *time.Time `json:"rotated_at,omitempty"`
+	RotationConfirmedAt *time.Time `json:"rotation_confirmed_at,omitempty"`
+	PreviousExpiresAt   *time.Time `json:"previous_expires_at,omitempty"`
+}
+
+// CreateCredentialResponse carries the generated token, which is only ever shown once
+type CreateCredentialResponse struct {
+	CredentialResponse
+	AgentToken string `json:"agent_token"`
+}
+
+// listCredentials handles GET /credentials
+func (h *HTTPHandler) listCredentials(c *gin.Context) {
+	credentials, err := h.store.ListCredentials()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	response := make([]CredentialResponse, len(credentials))
+	for i, credential := range credentials {
+		response[i] = toCredentialResponse(credential)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"credentials": response,
+		"count":       len(response),
+	})
+}
+
+// createCredential handles POST /credentials
+func (h *HTTPHandler) createCredential(c *gin.Context) {
+	var req CreateCredentialRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON body"})
+		return
+	}
+
+	existing, err := h.store.GetCredential(req.AgentID)
+	if err != nil && !errors.Is(err, common.ErrCredentialNotFound) {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if existing != nil && existing.RevokedAt == nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "Agent already has an active credential"})
+		return
+	}
+
+	token, err := GenerateToken()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	hash, err := HashToken(token)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	credential := &common.AgentCredential{
+		AgentID:   req.AgentID,
+		TokenHash: hash,
+		CreatedAt: time.Now(),
+	}
+
+	if err := h.store.SaveCredential(credential); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, CreateCredentialResponse{
+		CredentialResponse: toCredentialResponse(credential),
+		AgentToken:         token,
+	})
+}
+
+// revokeCredential handles DELETE /credentials/:agentId. It responds once a
+// connected agent has been disconnected, so it can't be sent anything else.
+func (h *HTTPHandler) revokeCredential(c *gin.Context) {
+	agentID := c.Param("agentId")
+
+	credential, err := h.store.GetCredential(agentID)
+	if err != nil {
+		if errors.Is(err, common.ErrCredentialNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Credential not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if credential.RevokedAt == nil {
+		now := time.Now()
+		credential.RevokedAt = &now
+
+		if err := h.store.SaveCredential(credential); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	// The agent can't reconnect with the revoked credential
+	if err := h.disconnector.DisconnectAgent(c.Request.Context(), agentID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Credential revoked but the agent could not be disconnected: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, toCredentialResponse(credential))
+}
+
+// toCredentialResponse strips the hash from a credential
+func toCredentialResponse(credential *common.AgentCredential) CredentialResponse {
+	return CredentialResponse{
+		AgentID:             credential.AgentID,
+		CreatedAt:           credential.CreatedAt,
+		RevokedAt:           credential.RevokedAt,
+		RotatedAt:           credential.RotatedAt,
+		RotationConfirmedAt: credential.RotationConfirmedAt,
+		PreviousExpiresAt:   credential.PreviousExpiresAt,
+	}
+}
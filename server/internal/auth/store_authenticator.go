@@ -0,0 +1,72 @@
+package auth
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/mooncorn/nodelink/server/internal/common"
+)
+
+// StoreAuthenticator validates agent tokens against hashed credentials in a CredentialStore
+type StoreAuthenticator struct {
+	store common.CredentialStore
+}
+
+// NewStoreAuthenticator creates a new authenticator backed by a credential store
+func NewStoreAuthenticator(store common.CredentialStore) *StoreAuthenticator {
+	return &StoreAuthenticator{
+		store: store,
+	}
+}
+
+// Authenticate validates agent credentials
+func (a *StoreAuthenticator) Authenticate(ctx context.Context) (string, error) {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return "", status.Error(codes.Unauthenticated, common.ErrMissingMetadata.Error())
+	}
+
+	agentIDs := md.Get("agent_id")
+	if len(agentIDs) == 0 {
+		return "", status.Error(codes.Unauthenticated, common.ErrMissingAgentID.Error())
+	}
+
+	agentTokens := md.Get("agent_token")
+	if len(agentTokens) == 0 {
+		return "", status.Error(codes.Unauthenticated, common.ErrMissingAgentToken.Error())
+	}
+
+	agentID := agentIDs[0]
+	agentToken := agentTokens[0]
+
+	credential, err := a.store.GetCredential(agentID)
+	if err != nil || credential.RevokedAt != nil {
+		// Spend the same time as a real comparison so unknown agent IDs can't be probed
+		VerifyToken(string(dummyHash), agentToken)
+		return "", common.ErrInvalidCredentials
+	}
+
+	if VerifyToken(credential.TokenHash, agentToken) {
+		// The first use of a credential ends any retry of the enrollment that issued it
+		if credential.AuthenticatedAt == nil {
+			if err := a.store.MarkCredentialAuthenticated(agentID, credential.TokenHash, time.Now()); err != nil {
+				log.Printf("Failed to record authentication of agent %s: %v", agentID, err)
+			}
+		}
+		return agentID, nil
+	}
+
+	// Agents that haven't picked up a rotated token yet may use the old one during the grace period
+	if credential.PreviousTokenHash != "" && credential.PreviousExpiresAt != nil &&
+		time.Now().Before(*credential.PreviousExpiresAt) &&
+		VerifyToken(credential.PreviousTokenHash, agentToken) {
+		return agentID, nil
+	}
+
+	return "", common.ErrInvalidCredentials
+}
@@ -0,0 +1,21 @@
+package auth
+
+import (
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// UserIDFromContext extracts the user ID from the request context
+// This should be set by authentication middleware
+func UserIDFromContext(c *gin.Context) string {
+	// For now, we'll use a simple approach with a header
+	// In a real implementation, this would come from JWT token or session
+	userID := c.GetHeader("X-User-ID")
+	if userID == "" {
+		// Fallback to query parameter, e.g. for EventSource and WebSocket clients which can't set headers
+		userID = c.Query("user_id")
+	}
+
+	return strings.TrimSpace(userID)
+}
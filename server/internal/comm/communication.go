@@ -5,16 +5,21 @@ import (
 	"errors"
 	"io"
 	"log"
+	"strings"
 	"sync"
 
 	pb "github.com/mooncorn/nodelink/server/internal/proto"
 	"github.com/mooncorn/nodelink/server/internal/auth"
 	"github.com/mooncorn/nodelink/server/internal/command"
 	"github.com/mooncorn/nodelink/server/internal/common"
+	"github.com/mooncorn/nodelink/server/internal/enrollment"
+	"github.com/mooncorn/nodelink/server/internal/labels"
 	"github.com/mooncorn/nodelink/server/internal/metrics"
 	"github.com/mooncorn/nodelink/server/internal/ping"
+	"github.com/mooncorn/nodelink/server/internal/rotation"
 	"github.com/mooncorn/nodelink/server/internal/status"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
 	grpcstatus "google.golang.org/grpc/status"
 )
 
@@ -23,7 +28,11 @@ type CommunicationServer struct {
 	pb.UnimplementedAgentServiceServer
 
 	mu            sync.RWMutex
-	activeStreams map[string]pb.AgentService_StreamCommunicationServer
+	activeStreams map[string]*agentStream
+
+	// Stream messages by type
+	received messageCounts
+	sent     messageCounts
 
 	// Dependencies
 	statusManager   *status.Manager
@@ -31,6 +40,8 @@ type CommunicationServer struct {
 	commandHandler  *command.Handler
 	terminalHandler common.TerminalResponseHandler
 	metricsHandler  *metrics.Handler
+	enrollment      *enrollment.Manager
+	rotation        *rotation.Manager
 	auth            auth.Authenticator
 
 	// Background context and cleanup
@@ -39,6 +50,13 @@ type CommunicationServer struct {
 	wg     sync.WaitGroup
 }
 
+// agentStream is the open stream of a connected agent
+type agentStream struct {
+	stream pb.AgentService_StreamCommunicationServer
+	cancel context.CancelFunc // ends the stream from the server side
+	done   chan struct{}      // closed once the agent's disconnect has been handled
+}
+
 // CommunicationConfig contains configuration for the communication server
 type CommunicationConfig struct {
 	StatusManager   *status.Manager
@@ -46,6 +64,8 @@ type CommunicationConfig struct {
 	CommandHandler  *command.Handler
 	TerminalHandler common.TerminalResponseHandler
 	MetricsHandler  *metrics.Handler
+	Enrollment      *enrollment.Manager
+	Rotation        *rotation.Manager
 	Authenticator   auth.Authenticator
 }
 
@@ -54,12 +74,14 @@ func NewCommunicationServer(config CommunicationConfig) *CommunicationServer {
 	ctx, cancel := context.WithCancel(context.Background())
 
 	server := &CommunicationServer{
-		activeStreams:   make(map[string]pb.AgentService_StreamCommunicationServer),
+		activeStreams:   make(map[string]*agentStream),
 		statusManager:   config.StatusManager,
 		pingHandler:     config.PingHandler,
 		commandHandler:  config.CommandHandler,
 		terminalHandler: config.TerminalHandler,
 		metricsHandler:  config.MetricsHandler,
+		enrollment:      config.Enrollment,
+		rotation:        config.Rotation,
 		auth:            config.Authenticator,
 		ctx:             ctx,
 		cancel:          cancel,
@@ -75,6 +97,9 @@ func NewCommunicationServer(config CommunicationConfig) *CommunicationServer {
 	if config.MetricsHandler != nil {
 		config.MetricsHandler.SetStreamSender(server)
 	}
+	if config.Rotation != nil {
+		config.Rotation.SetStreamSender(server)
+	}
 
 	return server
 }
@@ -102,6 +127,33 @@ func (s *CommunicationServer) Stop() {
 	s.wg.Wait()
 }
 
+// Enroll exchanges a one-time enrollment token for agent credentials
+func (s *CommunicationServer) Enroll(ctx context.Context, req *pb.EnrollRequest) (*pb.EnrollResponse, error) {
+	if s.enrollment == nil {
+		return nil, grpcstatus.Error(codes.Unimplemented, "enrollment is not enabled")
+	}
+
+	agentID, agentToken, err := s.enrollment.Enroll(req.EnrollmentToken, req.AgentId, req.Hostname, req.Nonce)
+	if err != nil {
+		log.Printf("Enrollment failed: %v", err)
+		switch {
+		case errors.Is(err, common.ErrEnrollmentTokenNotFound), errors.Is(err, common.ErrEnrollmentTokenExpired):
+			return nil, grpcstatus.Error(codes.PermissionDenied, "invalid or expired enrollment token")
+		case errors.Is(err, common.ErrAgentAlreadyEnrolled):
+			return nil, grpcstatus.Error(codes.AlreadyExists, err.Error())
+		case errors.Is(err, common.ErrMissingAgentID):
+			return nil, grpcstatus.Error(codes.InvalidArgument, err.Error())
+		default:
+			return nil, grpcstatus.Error(codes.Internal, "enrollment failed")
+		}
+	}
+
+	return &pb.EnrollResponse{
+		AgentId:    agentID,
+		AgentToken: agentToken,
+	}, nil
+}
+
 // StreamCommunication implements the gRPC bidirectional streaming
 func (s *CommunicationServer) StreamCommunication(stream pb.AgentService_StreamCommunicationServer) error {
 	// Authenticate agent from stream context
@@ -112,15 +164,27 @@ func (s *CommunicationServer) StreamCommunication(stream pb.AgentService_StreamC
 
 	log.Printf("Agent %s connected via communication stream", agentID)
 
+	// Create a context the server cancels to disconnect the agent
+	streamCtx, streamCancel := context.WithCancel(stream.Context())
+	defer streamCancel()
+
 	// Check if agent is already connected
 	s.mu.Lock()
 	if _, exists := s.activeStreams[agentID]; exists {
 		s.mu.Unlock()
 		return grpcstatus.Errorf(codes.AlreadyExists, "agent %s is already connected", agentID)
 	}
-	s.activeStreams[agentID] = stream
+	conn := &agentStream{
+		stream: stream,
+		cancel: streamCancel,
+		done:   make(chan struct{}),
+	}
+	s.activeStreams[agentID] = conn
 	s.mu.Unlock()
 
+	// Labels declared by the agent replace those from its previous connection
+	s.statusManager.SetAgentLabels(agentID, agentLabels(stream.Context(), agentID))
+
 	// Register with ping handler
 	s.pingHandler.RegisterAgent(agentID, s)
 
@@ -133,35 +197,50 @@ func (s *CommunicationServer) StreamCommunication(stream pb.AgentService_StreamC
 		delete(s.activeStreams, agentID)
 		s.mu.Unlock()
 
+		if s.terminalHandler != nil {
+			s.terminalHandler.HandleAgentDisconnected(agentID)
+		}
+		if s.metricsHandler != nil {
+			s.metricsHandler.HandleAgentDisconnected(agentID)
+		}
 		s.pingHandler.UnregisterAgent(agentID)
 		log.Printf("Agent %s disconnected", agentID)
+		close(conn.done)
 	}()
 
-	// Create a context that cancels when the stream is done
-	streamCtx, streamCancel := context.WithCancel(stream.Context())
-	defer streamCancel()
+	// Receive in the background so the server can end the stream while
+	// waiting for the agent. Returning ends the stream and the receive loop.
+	received := make(chan error, 1)
+	go func() {
+		received <- s.receive(stream, agentID)
+	}()
 
-	// Handle incoming messages from agent
-	for {
-		// Check if context is cancelled
-		if streamCtx.Err() != nil {
-			if errors.Is(streamCtx.Err(), context.Canceled) {
-				log.Printf("Stream context cancelled for agent %s", agentID)
-			} else {
-				log.Printf("Stream context error for agent %s: %v", agentID, streamCtx.Err())
-			}
-			return streamCtx.Err()
+	select {
+	case err := <-received:
+		return err
+	case <-streamCtx.Done():
+		if stream.Context().Err() != nil {
+			log.Printf("Stream context error for agent %s: %v", agentID, stream.Context().Err())
+			return stream.Context().Err()
 		}
+		log.Printf("Disconnecting agent %s", agentID)
+		return grpcstatus.Error(codes.Unauthenticated, "disconnected by the server")
+	}
+}
 
+// receive handles incoming messages from an agent until its stream ends
+func (s *CommunicationServer) receive(stream pb.AgentService_StreamCommunicationServer, agentID string) error {
+	for {
 		agentMsg, err := stream.Recv()
 		if err != nil {
 			if err == io.EOF {
 				log.Printf("Agent %s closed communication stream", agentID)
-				break
+				return nil
 			}
 			log.Printf("Error receiving message from agent %s: %v", agentID, err)
 			return err
 		}
+		s.received.add(messageType(agentMsg.ProtoReflect()))
 
 		// Handle different message types
 		switch msg := agentMsg.Message.(type) {
@@ -177,6 +256,27 @@ func (s *CommunicationServer) StreamCommunication(stream pb.AgentService_StreamC
 					log.Printf("Error processing command response from agent %s: %v", agentID, err)
 				}
 			}
+		case *pb.AgentMessage_CommandOutput:
+			// Process streaming command output through command handler
+			if s.commandHandler != nil {
+				if err := s.commandHandler.HandleCommandOutput(msg.CommandOutput); err != nil {
+					log.Printf("Error processing command output from agent %s: %v", agentID, err)
+				}
+			}
+		case *pb.AgentMessage_CommandExit:
+			// Process streaming command exit through command handler
+			if s.commandHandler != nil {
+				if err := s.commandHandler.HandleCommandExit(msg.CommandExit); err != nil {
+					log.Printf("Error processing command exit from agent %s: %v", agentID, err)
+				}
+			}
+		case *pb.AgentMessage_CommandCancelResponse:
+			// Process command cancel confirmation through command handler
+			if s.commandHandler != nil {
+				if err := s.commandHandler.HandleCommandCancelResponse(msg.CommandCancelResponse); err != nil {
+					log.Printf("Error processing command cancel response from agent %s: %v", agentID, err)
+				}
+			}
 		case *pb.AgentMessage_TerminalCreateResponse:
 			// Process terminal create response through terminal handler
 			if s.terminalHandler != nil {
@@ -191,6 +291,13 @@ func (s *CommunicationServer) StreamCommunication(stream pb.AgentService_StreamC
 					log.Printf("Error processing terminal command response from agent %s: %v", agentID, err)
 				}
 			}
+		case *pb.AgentMessage_TerminalOutput:
+			// Process raw terminal output through terminal handler
+			if s.terminalHandler != nil {
+				if err := s.terminalHandler.HandleTerminalOutput(msg.TerminalOutput); err != nil {
+					log.Printf("Error processing terminal output from agent %s: %v", agentID, err)
+				}
+			}
 		case *pb.AgentMessage_TerminalCloseResponse:
 			// Process terminal close response through terminal handler
 			if s.terminalHandler != nil {
@@ -198,33 +305,116 @@ func (s *CommunicationServer) StreamCommunication(stream pb.AgentService_StreamC
 					log.Printf("Error processing terminal close response from agent %s: %v", agentID, err)
 				}
 			}
+		case *pb.AgentMessage_TerminalSessionsAnnouncement:
+			// Re-attach terminal sessions that survived a reconnect
+			if s.terminalHandler != nil {
+				if err := s.terminalHandler.HandleTerminalSessionsAnnouncement(agentID, msg.TerminalSessionsAnnouncement); err != nil {
+					log.Printf("Error processing terminal sessions announcement from agent %s: %v", agentID, err)
+				}
+			}
 		case *pb.AgentMessage_MetricsResponse:
 			// Process metrics response through metrics handler
 			if s.metricsHandler != nil {
 				s.metricsHandler.HandleMetricsResponse(msg.MetricsResponse)
 			}
+		case *pb.AgentMessage_MetricsSubscribeResponse:
+			// Process metrics subscription acknowledgement through metrics handler
+			if s.metricsHandler != nil {
+				s.metricsHandler.HandleMetricsSubscribeResponse(agentID, msg.MetricsSubscribeResponse)
+			}
+		case *pb.AgentMessage_MetricsPush:
+			// Process pushed metrics through metrics handler
+			if s.metricsHandler != nil {
+				s.metricsHandler.HandleMetricsPush(agentID, msg.MetricsPush)
+			}
 		case *pb.AgentMessage_SystemInfoResponse:
 			// Process system info response through metrics handler
 			if s.metricsHandler != nil {
 				s.metricsHandler.HandleSystemInfoResponse(msg.SystemInfoResponse)
 			}
+		case *pb.AgentMessage_CredentialRotationResponse:
+			// Record the outcome of a credential rotation
+			if s.rotation != nil {
+				if err := s.rotation.HandleRotationResponse(agentID, msg.CredentialRotationResponse); err != nil {
+					log.Printf("Error processing credential rotation response from agent %s: %v", agentID, err)
+				}
+			}
 		default:
 			log.Printf("Unknown message type received from agent %s: %T", agentID, msg)
 		}
 	}
+}
 
-	return nil
+// DisconnectAgent ends an agent's stream and waits until its disconnect has
+// been handled, e.g. after its credential was revoked. Agents that aren't
+// connected are ignored.
+func (s *CommunicationServer) DisconnectAgent(ctx context.Context, agentID string) error {
+	s.mu.RLock()
+	conn, exists := s.activeStreams[agentID]
+	s.mu.RUnlock()
+
+	if !exists {
+		return nil
+	}
+
+	conn.cancel()
+	select {
+	case <-conn.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
 }
 
 // SendToAgent implements the StreamSender interface for sending messages to agents
 func (s *CommunicationServer) SendToAgent(agentID string, message *pb.ServerMessage) error {
 	s.mu.RLock()
-	stream, exists := s.activeStreams[agentID]
+	conn, exists := s.activeStreams[agentID]
 	s.mu.RUnlock()
 
 	if !exists {
 		return errors.New("agent not connected or stream not found")
 	}
 
-	return stream.Send(message)
+	if err := conn.stream.Send(message); err != nil {
+		return err
+	}
+	s.sent.add(messageType(message.ProtoReflect()))
+	return nil
+}
+
+// ConnectedAgents returns the number of agents with an open stream
+func (s *CommunicationServer) ConnectedAgents() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return len(s.activeStreams)
+}
+
+// MessageCounts returns how many stream messages of each type were received
+// from and sent to agents since the server started
+func (s *CommunicationServer) MessageCounts() (received, sent map[string]uint64) {
+	return s.received.snapshot(), s.sent.snapshot()
+}
+
+// agentLabels returns the labels an agent declared in its stream metadata.
+// Invalid labels are ignored so a typo doesn't keep the agent from connecting.
+func agentLabels(ctx context.Context, agentID string) map[string]string {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return nil
+	}
+
+	values := md.Get("agent_labels")
+	if len(values) == 0 {
+		return nil
+	}
+
+	agentLabels, err := labels.ParseSet(strings.Join(values, ","))
+	if err != nil {
+		log.Printf("Ignoring invalid labels from agent %s: %v", agentID, err)
+		return nil
+	}
+
+	return agentLabels
 }
@@ -0,0 +1,45 @@
+package comm
+
+import (
+	"sync"
+
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// messageCounts counts stream messages by type
+type messageCounts struct {
+	counts map[string]uint64
+	mu     sync.Mutex
+}
+
+// add counts a message of the given type
+func (c *messageCounts) add(messageType string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.counts == nil {
+		c.counts = make(map[string]uint64)
+	}
+	c.counts[messageType]++
+}
+
+// snapshot returns a copy of the counts
+func (c *messageCounts) snapshot() map[string]uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	counts := make(map[string]uint64, len(c.counts))
+	for messageType, count := range c.counts {
+		counts[messageType] = count
+	}
+	return counts
+}
+
+// messageType names the field set in a stream message's oneof, e.g. command_response
+func messageType(message protoreflect.Message) string {
+	field := message.WhichOneof(message.Descriptor().Oneofs().ByName("message"))
+	if field == nil {
+		return "unknown"
+	}
+	return string(field.Name())
+}
@@ -0,0 +1,364 @@
+package command
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mooncorn/nodelink/server/internal/common"
+	"github.com/mooncorn/nodelink/server/internal/labels"
+)
+
+// FanoutOptions controls how a fan-out is spread over its targets
+type FanoutOptions struct {
+	Concurrency int           // targets running at once, DefaultFanoutConcurrency if zero
+	Timeout     time.Duration // per target
+	FailFast    bool          // same as MaxFailures = 1
+	MaxFailures int           // stop starting new targets after this many failures, 0 means never
+}
+
+// FanoutManager runs the same command on many agents and aggregates the results
+type FanoutManager struct {
+	handler *Handler
+
+	mu      sync.RWMutex
+	fanouts map[string]*fanoutState
+}
+
+// fanoutState is a fan-out and the channel closed once it completes
+type fanoutState struct {
+	fanout *common.Fanout
+	done   chan struct{}
+}
+
+// NewFanoutManager creates a new fan-out manager
+func NewFanoutManager(handler *Handler) *FanoutManager {
+	return &FanoutManager{
+		handler: handler,
+		fanouts: make(map[string]*fanoutState),
+	}
+}
+
+// Start removes expired fan-outs until the context is cancelled
+func (m *FanoutManager) Start(ctx context.Context) {
+	ticker := time.NewTicker(common.JobCleanupInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if removed := m.CleanupExpiredFanouts(); removed > 0 {
+				log.Printf("Removed %d expired fan-outs", removed)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// ResolveTargets returns the agents a fan-out should run on. Explicit agent IDs
+// must all be known; a selector matches the agents that are currently connected.
+func (m *FanoutManager) ResolveTargets(agentIDs []string, selector string) ([]string, error) {
+	if len(agentIDs) > 0 {
+		seen := make(map[string]bool, len(agentIDs))
+		var targets []string
+		for _, agentID := range agentIDs {
+			if seen[agentID] {
+				continue
+			}
+			if _, exists := m.handler.statusManager.GetAgent(agentID); !exists {
+				return nil, fmt.Errorf("%w: %s", common.ErrAgentNotFound, agentID)
+			}
+			seen[agentID] = true
+			targets = append(targets, agentID)
+		}
+		return targets, nil
+	}
+
+	parsed, err := labels.Parse(selector)
+	if err != nil {
+		return nil, err
+	}
+
+	var targets []string
+	for _, agent := range m.handler.statusManager.SelectAgents(parsed) {
+		if agent.Status.IsAvailable() {
+			targets = append(targets, agent.AgentID)
+		}
+	}
+	if len(targets) == 0 {
+		return nil, common.ErrNoMatchingAgents
+	}
+
+	return targets, nil
+}
+
+// Run starts a command on all targets in the background. The returned channel
+// is closed once every target has finished or been skipped.
+func (m *FanoutManager) Run(targets []string, selector, command string, args []string, env map[string]string, workingDir string, opts FanoutOptions) (*common.Fanout, <-chan struct{}, error) {
+	if len(targets) == 0 {
+		return nil, nil, common.ErrNoFanoutTargets
+	}
+
+	// Validate and set limits
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = common.DefaultFanoutConcurrency
+	}
+	if opts.Concurrency > common.MaxFanoutConcurrency {
+		opts.Concurrency = common.MaxFanoutConcurrency
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = m.handler.defaultTimeout
+	}
+	if opts.Timeout > m.handler.maxTimeout {
+		opts.Timeout = m.handler.maxTimeout
+	}
+	if opts.FailFast {
+		opts.MaxFailures = 1
+	}
+
+	fanout := &common.Fanout{
+		ID:             uuid.New().String(),
+		Command:        command,
+		Args:           args,
+		Env:            env,
+		WorkingDir:     workingDir,
+		Selector:       selector,
+		TimeoutSeconds: int(opts.Timeout.Seconds()),
+		Concurrency:    opts.Concurrency,
+		MaxFailures:    opts.MaxFailures,
+		Status:         common.FanoutRunning,
+		CreatedAt:      time.Now(),
+	}
+	for _, agentID := range targets {
+		fanout.Results = append(fanout.Results, &common.FanoutResult{
+			FanoutID: fanout.ID,
+			AgentID:  agentID,
+			Status:   common.FanoutTargetPending,
+		})
+	}
+	fanout.Summary = summarize(fanout.Results)
+
+	state := &fanoutState{
+		fanout: fanout,
+		done:   make(chan struct{}),
+	}
+
+	m.mu.Lock()
+	m.fanouts[fanout.ID] = state
+	snapshot := copyFanout(fanout)
+	m.mu.Unlock()
+
+	go m.execute(state, opts.Timeout)
+
+	return snapshot, state.done, nil
+}
+
+// GetFanout returns a snapshot of a fan-out by ID
+func (m *FanoutManager) GetFanout(fanoutID string) (*common.Fanout, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	state, exists := m.fanouts[fanoutID]
+	if !exists {
+		return nil, common.ErrFanoutNotFound
+	}
+
+	return copyFanout(state.fanout), nil
+}
+
+// ListFanouts returns snapshots of all fan-outs, newest first
+func (m *FanoutManager) ListFanouts() []*common.Fanout {
+	m.mu.RLock()
+	fanouts := make([]*common.Fanout, 0, len(m.fanouts))
+	for _, state := range m.fanouts {
+		fanouts = append(fanouts, copyFanout(state.fanout))
+	}
+	m.mu.RUnlock()
+
+	sort.Slice(fanouts, func(i, j int) bool {
+		return fanouts[i].CreatedAt.After(fanouts[j].CreatedAt)
+	})
+
+	return fanouts
+}
+
+// CleanupExpiredFanouts removes fan-outs that completed longer ago than the
+// retention period and returns how many were removed
+func (m *FanoutManager) CleanupExpiredFanouts() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	cutoff := time.Now().Add(-common.FanoutRetention)
+	removed := 0
+	for id, state := range m.fanouts {
+		if state.fanout.CompletedAt != nil && state.fanout.CompletedAt.Before(cutoff) {
+			delete(m.fanouts, id)
+			removed++
+		}
+	}
+
+	return removed
+}
+
+// execute runs the targets with bounded concurrency. Once the failure limit is
+// reached no new targets are started; running ones are left to finish.
+func (m *FanoutManager) execute(state *fanoutState, timeout time.Duration) {
+	fanout := state.fanout
+	slots := make(chan struct{}, fanout.Concurrency)
+	var wg sync.WaitGroup
+
+	for i := range fanout.Results {
+		slots <- struct{}{}
+
+		m.mu.Lock()
+		if fanout.MaxFailures > 0 && failures(fanout.Results) >= fanout.MaxFailures {
+			m.mu.Unlock()
+			<-slots
+			break
+		}
+		result := fanout.Results[i]
+		now := time.Now()
+		result.Status = common.FanoutTargetRunning
+		result.StartedAt = &now
+		m.mu.Unlock()
+
+		wg.Add(1)
+		go func(agentID string) {
+			defer wg.Done()
+			defer func() { <-slots }()
+
+			m.record(result, m.runTarget(fanout, agentID, timeout))
+		}(result.AgentID)
+	}
+
+	wg.Wait()
+
+	m.mu.Lock()
+	now := time.Now()
+	fanout.Status = common.FanoutCompleted
+	for _, result := range fanout.Results {
+		if result.Status == common.FanoutTargetPending {
+			result.Status = common.FanoutTargetSkipped
+			result.Error = "skipped after reaching the failure limit"
+			fanout.Status = common.FanoutAborted
+		}
+	}
+	fanout.Summary = summarize(fanout.Results)
+	fanout.CompletedAt = &now
+	snapshot := copyFanout(fanout)
+	m.mu.Unlock()
+
+	close(state.done)
+	m.handler.broadcaster.FanoutComplete(snapshot)
+
+	log.Printf("Fan-out %s %s: %d succeeded, %d failed, %d timed out, %d skipped",
+		fanout.ID, snapshot.Status, snapshot.Summary.Succeeded, snapshot.Summary.Failed,
+		snapshot.Summary.TimedOut, snapshot.Summary.Skipped)
+}
+
+// runTarget executes the command on one agent and converts the outcome to a result
+func (m *FanoutManager) runTarget(fanout *common.Fanout, agentID string, timeout time.Duration) *common.FanoutResult {
+	result := &common.FanoutResult{}
+
+	response, err := m.handler.ExecuteCommand(
+		context.Background(),
+		agentID,
+		fanout.Command,
+		fanout.Args,
+		fanout.Env,
+		fanout.WorkingDir,
+		timeout,
+	)
+	if err != nil {
+		result.Error = err.Error()
+		result.Status = common.FanoutTargetFailed
+		if errors.Is(err, ErrRequestTimeout) {
+			result.Status = common.FanoutTargetTimedOut
+		}
+		return result
+	}
+
+	result.RequestID = response.RequestId
+	result.ExitCode = response.ExitCode
+	result.Stdout = response.Stdout
+	result.Stderr = response.Stderr
+	result.Error = response.Error
+
+	switch {
+	case response.Timeout:
+		result.Status = common.FanoutTargetTimedOut
+	case response.Error != "" || response.ExitCode != 0:
+		result.Status = common.FanoutTargetFailed
+	default:
+		result.Status = common.FanoutTargetSucceeded
+	}
+
+	return result
+}
+
+// record stores the outcome of a target and broadcasts it
+func (m *FanoutManager) record(result *common.FanoutResult, outcome *common.FanoutResult) {
+	m.mu.Lock()
+	now := time.Now()
+	result.Status = outcome.Status
+	result.RequestID = outcome.RequestID
+	result.ExitCode = outcome.ExitCode
+	result.Stdout = outcome.Stdout
+	result.Stderr = outcome.Stderr
+	result.Error = outcome.Error
+	result.CompletedAt = &now
+	result.DurationMs = now.Sub(*result.StartedAt).Milliseconds()
+	snapshot := *result
+	m.mu.Unlock()
+
+	m.handler.broadcaster.FanoutResult(&snapshot)
+}
+
+// failures counts failed and timed out targets
+func failures(results []*common.FanoutResult) int {
+	count := 0
+	for _, result := range results {
+		if result.Status == common.FanoutTargetFailed || result.Status == common.FanoutTargetTimedOut {
+			count++
+		}
+	}
+	return count
+}
+
+// summarize counts results by status
+func summarize(results []*common.FanoutResult) common.FanoutSummary {
+	summary := common.FanoutSummary{Total: len(results)}
+	for _, result := range results {
+		switch result.Status {
+		case common.FanoutTargetSucceeded:
+			summary.Succeeded++
+		case common.FanoutTargetFailed:
+			summary.Failed++
+		case common.FanoutTargetTimedOut:
+			summary.TimedOut++
+		case common.FanoutTargetSkipped:
+			summary.Skipped++
+		default:
+			summary.Pending++
+		}
+	}
+	return summary
+}
+
+// copyFanout returns a snapshot of a fan-out with an up to date summary. Must be called with the lock held.
+func copyFanout(fanout *common.Fanout) *common.Fanout {
+	fanoutCopy := *fanout
+	fanoutCopy.Results = make([]*common.FanoutResult, len(fanout.Results))
+	for i, result := range fanout.Results {
+		resultCopy := *result
+		fanoutCopy.Results[i] = &resultCopy
+	}
+	fanoutCopy.Summary = summarize(fanoutCopy.Results)
+	return &fanoutCopy
+}
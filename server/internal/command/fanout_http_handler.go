@@ -0,0 +1,155 @@
+package command
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mooncorn/nodelink/server/internal/common"
+)
+
+// FanoutRequest represents the HTTP request for running a command on several agents.
+// Exactly one of AgentIDs and Selector must be set.
+type FanoutRequest struct {
+	AgentIDs    []string          `json:"agent_ids,omitempty"`
+	Selector    string            `json:"selector,omitempty"`
+	Command     string            `json:"command" binding:"required"`
+	Args        []string          `json:"args,omitempty"`
+	Env         map[string]string `json:"env,omitempty"`
+	WorkingDir  string            `json:"working_dir,omitempty"`
+	Timeout     int               `json:"timeout_seconds,omitempty"` // per target
+	Concurrency int               `json:"concurrency,omitempty"`
+	FailFast    bool              `json:"fail_fast,omitempty"`
+	MaxFailures int               `json:"max_failures,omitempty"`
+	Stream      bool              `json:"stream,omitempty"`
+}
+
+// FanoutStartedResponse is returned when a fan-out is started in streaming mode
+type FanoutStartedResponse struct {
+	FanoutID  string `json:"fanout_id"`
+	Targets   int    `json:"targets"`
+	StreamURL string `json:"stream_url"`
+}
+
+// FanoutHTTPHandler handles HTTP requests for fan-out command execution
+type FanoutHTTPHandler struct {
+	fanoutManager *FanoutManager
+}
+
+// NewFanoutHTTPHandler creates a new HTTP handler for fan-outs
+func NewFanoutHTTPHandler(fanoutManager *FanoutManager) *FanoutHTTPHandler {
+	return &FanoutHTTPHandler{
+		fanoutManager: fanoutManager,
+	}
+}
+
+// RegisterRoutes registers fan-out routes
+func (h *FanoutHTTPHandler) RegisterRoutes(router gin.IRouter) {
+	router.POST("/fanouts", h.runFanout)
+	router.GET("/fanouts", h.listFanouts)
+	router.GET("/fanouts/:fanoutId", h.getFanout)
+}
+
+// runFanout handles POST /fanouts. Without "stream" it waits for all targets
+// and returns the results; with it, it returns right away and results follow
+// on the stream endpoint.
+func (h *FanoutHTTPHandler) runFanout(c *gin.Context) {
+	var req FanoutRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON body"})
+		return
+	}
+
+	if (len(req.AgentIDs) == 0) == (req.Selector == "") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Exactly one of agent_ids and selector is required"})
+		return
+	}
+
+	serveFanout(c, h.fanoutManager, req)
+}
+
+// serveFanout runs a fan-out request and writes the response
+func serveFanout(c *gin.Context, fanoutManager *FanoutManager, req FanoutRequest) {
+	if req.Concurrency < 0 || req.MaxFailures < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "concurrency and max_failures must not be negative"})
+		return
+	}
+
+	targets, err := fanoutManager.ResolveTargets(req.AgentIDs, req.Selector)
+	if err != nil {
+		switch {
+		case errors.Is(err, common.ErrAgentNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		case errors.Is(err, common.ErrNoMatchingAgents):
+			c.JSON(http.StatusNotFound, gin.H{"error": "No online agents match the selector"})
+		default:
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	fanout, done, err := fanoutManager.Run(
+		targets,
+		req.Selector,
+		req.Command,
+		req.Args,
+		req.Env,
+		req.WorkingDir,
+		FanoutOptions{
+			Concurrency: req.Concurrency,
+			Timeout:     time.Duration(req.Timeout) * time.Second,
+			FailFast:    req.FailFast,
+			MaxFailures: req.MaxFailures,
+		},
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if req.Stream {
+		c.JSON(http.StatusAccepted, FanoutStartedResponse{
+			FanoutID:  fanout.ID,
+			Targets:   len(targets),
+			StreamURL: "/fanouts/" + fanout.ID + "/stream",
+		})
+		return
+	}
+
+	select {
+	case <-done:
+	case <-c.Request.Context().Done():
+		// The fan-out keeps running and can still be fetched by ID
+		return
+	}
+
+	fanout, err = fanoutManager.GetFanout(fanout.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, fanout)
+}
+
+// listFanouts handles GET /fanouts
+func (h *FanoutHTTPHandler) listFanouts(c *gin.Context) {
+	fanouts := h.fanoutManager.ListFanouts()
+
+	c.JSON(http.StatusOK, gin.H{
+		"fanouts": fanouts,
+		"count":   len(fanouts),
+	})
+}
+
+// getFanout handles GET /fanouts/:fanoutId
+func (h *FanoutHTTPHandler) getFanout(c *gin.Context) {
+	fanout, err := h.fanoutManager.GetFanout(c.Param("fanoutId"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Fan-out not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, fanout)
+}
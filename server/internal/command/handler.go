@@ -8,12 +8,15 @@ import (
 
 	pb "github.com/mooncorn/nodelink/server/internal/proto"
 	"github.com/mooncorn/nodelink/server/internal/common"
+	"github.com/mooncorn/nodelink/server/internal/sse"
 	"github.com/mooncorn/nodelink/server/internal/status"
 )
 
 var (
 	ErrAgentNotConnected = common.ErrAgentNotConnected
 	ErrRequestTimeout    = common.ErrRequestTimeout
+	ErrCommandNotFound   = common.ErrCommandNotFound
+	ErrInvalidSignal     = common.ErrInvalidSignal
 )
 
 // Request represents a pending command request
@@ -25,6 +28,7 @@ type Request struct {
 	Env        map[string]string
 	WorkingDir string
 	Timeout    time.Duration
+	Stream     bool
 	Response   chan *pb.CommandResponse
 	CreatedAt  time.Time
 }
@@ -33,18 +37,24 @@ type Request struct {
 type Handler struct {
 	mu              sync.RWMutex
 	pendingRequests map[string]*Request
+	streams         map[string]*streamingCommand
+	pendingCancels  map[string]chan *pb.CommandCancelResponse
 	statusManager   *status.Manager
 	streamSender    common.StreamSender
+	broadcaster     *sse.Broadcaster
 	defaultTimeout  time.Duration
 	maxTimeout      time.Duration
 	requestCounter  int64
 }
 
 // NewHandler creates a new command handler
-func NewHandler(statusManager *status.Manager) *Handler {
+func NewHandler(statusManager *status.Manager, sseManager common.SSEManager) *Handler {
 	return &Handler{
 		pendingRequests: make(map[string]*Request),
+		streams:         make(map[string]*streamingCommand),
+		pendingCancels:  make(map[string]chan *pb.CommandCancelResponse),
 		statusManager:   statusManager,
+		broadcaster:     sse.NewBroadcaster(sseManager),
 		defaultTimeout:  30 * time.Second,
 		maxTimeout:      5 * time.Minute,
 	}
@@ -145,6 +155,89 @@ func (h *Handler) HandleCommandResponse(response *pb.CommandResponse) error {
 	}
 }
 
+// CancelCommand asks the agent to signal a running command's process group and
+// waits for it to confirm. The command's own response reports it as canceled.
+func (h *Handler) CancelCommand(ctx context.Context, requestID, signal string, grace time.Duration) error {
+	switch signal {
+	case "":
+		signal = "SIGTERM"
+	case "SIGTERM", "SIGINT", "SIGKILL":
+	default:
+		return ErrInvalidSignal
+	}
+
+	h.mu.Lock()
+	agentID := ""
+	if request, exists := h.pendingRequests[requestID]; exists {
+		agentID = request.AgentID
+	} else if stream, exists := h.streams[requestID]; exists && stream.exit == nil {
+		agentID = stream.request.AgentID
+	}
+	if agentID == "" {
+		h.mu.Unlock()
+		return ErrCommandNotFound
+	}
+
+	ack := make(chan *pb.CommandCancelResponse, 1)
+	h.pendingCancels[requestID] = ack
+	sender := h.streamSender
+	h.mu.Unlock()
+
+	defer func() {
+		h.mu.Lock()
+		delete(h.pendingCancels, requestID)
+		h.mu.Unlock()
+	}()
+
+	if sender == nil {
+		return fmt.Errorf("stream sender not configured")
+	}
+
+	err := sender.SendToAgent(agentID, &pb.ServerMessage{
+		Message: &pb.ServerMessage_CommandCancelRequest{
+			CommandCancelRequest: &pb.CommandCancelRequest{
+				RequestId:    requestID,
+				Signal:       signal,
+				GraceSeconds: int32(grace.Seconds()),
+			},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to send cancel request to agent: %w", err)
+	}
+
+	select {
+	case response := <-ack:
+		if !response.Success {
+			// Most likely the command finished before the signal arrived
+			return fmt.Errorf("%w: %s", ErrCommandNotFound, response.Error)
+		}
+		return nil
+	case <-time.After(common.CommandCancelTimeout):
+		return ErrRequestTimeout
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// HandleCommandCancelResponse processes an agent's confirmation of a cancel request
+func (h *Handler) HandleCommandCancelResponse(response *pb.CommandCancelResponse) error {
+	h.mu.RLock()
+	ack, exists := h.pendingCancels[response.RequestId]
+	h.mu.RUnlock()
+
+	if !exists {
+		return fmt.Errorf("no pending cancel request found for ID: %s", response.RequestId)
+	}
+
+	select {
+	case ack <- response:
+		return nil
+	default:
+		return fmt.Errorf("failed to deliver cancel response for request ID: %s", response.RequestId)
+	}
+}
+
 // GetPendingRequests returns all pending requests for monitoring
 func (h *Handler) GetPendingRequests() map[string]*Request {
 	h.mu.RLock()
@@ -154,6 +247,11 @@ func (h *Handler) GetPendingRequests() map[string]*Request {
 	for k, v := range h.pendingRequests {
 		result[k] = v
 	}
+	for k, v := range h.streams {
+		if v.exit == nil {
+			result[k] = v.request
+		}
+	}
 	return result
 }
 
@@ -1,20 +1,32 @@
 package command
 
 import (
+	"errors"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
-// ExecuteRequest represents the HTTP request for command execution
+// ExecuteRequest represents the HTTP request for command execution. Exactly one
+// of AgentID and Selector must be set; a selector runs the command on every
+// matching online agent, like a fan-out.
 type ExecuteRequest struct {
-	AgentID    string            `json:"agent_id" binding:"required"`
+	AgentID    string            `json:"agent_id,omitempty"`
+	Selector   string            `json:"selector,omitempty"`
 	Command    string            `json:"command" binding:"required"`
 	Args       []string          `json:"args,omitempty"`
 	Env        map[string]string `json:"env,omitempty"`
 	WorkingDir string            `json:"working_dir,omitempty"`
 	Timeout    int               `json:"timeout_seconds,omitempty"`
+	Stream     bool              `json:"stream,omitempty"`
+}
+
+// StreamStartedResponse is returned when a command is started in streaming mode
+type StreamStartedResponse struct {
+	RequestID string `json:"request_id"`
+	StreamURL string `json:"stream_url"`
 }
 
 // ExecuteResponse represents the HTTP response for command execution
@@ -25,17 +37,20 @@ type ExecuteResponse struct {
 	Stderr    string `json:"stderr"`
 	Error     string `json:"error,omitempty"`
 	Timeout   bool   `json:"timeout"`
+	Canceled  bool   `json:"canceled"`
 }
 
 // HTTPHandler handles HTTP requests for command execution
 type HTTPHandler struct {
 	commandHandler *Handler
+	fanoutManager  *FanoutManager
 }
 
 // NewHTTPHandler creates a new HTTP handler for commands
-func NewHTTPHandler(commandHandler *Handler) *HTTPHandler {
+func NewHTTPHandler(commandHandler *Handler, fanoutManager *FanoutManager) *HTTPHandler {
 	return &HTTPHandler{
 		commandHandler: commandHandler,
+		fanoutManager:  fanoutManager,
 	}
 }
 
@@ -43,6 +58,7 @@ func NewHTTPHandler(commandHandler *Handler) *HTTPHandler {
 func (h *HTTPHandler) RegisterRoutes(router *gin.Engine) {
 	router.POST("/commands", h.executeCommand)
 	router.GET("/commands/pending", h.getPendingRequests)
+	router.DELETE("/commands/:requestId", h.cancelCommand)
 }
 
 // executeCommand handles POST /commands
@@ -53,9 +69,34 @@ func (h *HTTPHandler) executeCommand(c *gin.Context) {
 		return
 	}
 
+	if (req.AgentID == "") == (req.Selector == "") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Exactly one of agent_id and selector is required"})
+		return
+	}
+
+	// Selector targets are run as a fan-out with default limits
+	if req.Selector != "" {
+		serveFanout(c, h.fanoutManager, FanoutRequest{
+			Selector:   req.Selector,
+			Command:    req.Command,
+			Args:       req.Args,
+			Env:        req.Env,
+			WorkingDir: req.WorkingDir,
+			Timeout:    req.Timeout,
+			Stream:     req.Stream,
+		})
+		return
+	}
+
 	// Convert timeout to duration
 	timeout := time.Duration(req.Timeout) * time.Second
 
+	// Streaming commands return right away; output follows on the stream endpoint
+	if req.Stream {
+		h.startStreamingCommand(c, req, timeout)
+		return
+	}
+
 	// Execute command
 	response, err := h.commandHandler.ExecuteCommand(
 		c.Request.Context(),
@@ -87,11 +128,75 @@ func (h *HTTPHandler) executeCommand(c *gin.Context) {
 		Stderr:    response.Stderr,
 		Error:     response.Error,
 		Timeout:   response.Timeout,
+		Canceled:  response.Canceled,
 	}
 
 	c.JSON(http.StatusOK, httpResponse)
 }
 
+// startStreamingCommand starts a command whose output is streamed over SSE
+func (h *HTTPHandler) startStreamingCommand(c *gin.Context, req ExecuteRequest, timeout time.Duration) {
+	request, err := h.commandHandler.StartStreamingCommand(
+		req.AgentID,
+		req.Command,
+		req.Args,
+		req.Env,
+		req.WorkingDir,
+		timeout,
+		nil,
+	)
+	if err != nil {
+		switch err {
+		case ErrAgentNotConnected:
+			c.JSON(http.StatusNotFound, gin.H{"error": "Agent is not connected"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusAccepted, StreamStartedResponse{
+		RequestID: request.ID,
+		StreamURL: "/commands/" + request.ID + "/stream",
+	})
+}
+
+// cancelCommand handles DELETE /commands/:requestId?signal=SIGTERM&grace_seconds=5
+func (h *HTTPHandler) cancelCommand(c *gin.Context) {
+	requestID := c.Param("requestId")
+	signal := c.Query("signal")
+
+	grace := time.Duration(0)
+	if value := c.Query("grace_seconds"); value != "" {
+		seconds, err := strconv.Atoi(value)
+		if err != nil || seconds < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid grace_seconds"})
+			return
+		}
+		grace = time.Duration(seconds) * time.Second
+	}
+
+	err := h.commandHandler.CancelCommand(c.Request.Context(), requestID, signal, grace)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrInvalidSignal):
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Signal must be SIGTERM, SIGINT or SIGKILL"})
+		case errors.Is(err, ErrCommandNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "Command is not running"})
+		case errors.Is(err, ErrRequestTimeout):
+			c.JSON(http.StatusRequestTimeout, gin.H{"error": "Agent did not confirm the cancellation"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":    "Cancellation requested",
+		"request_id": requestID,
+	})
+}
+
 // getPendingRequests handles GET /commands/pending
 func (h *HTTPHandler) getPendingRequests(c *gin.Context) {
 	pending := h.commandHandler.GetPendingRequests()
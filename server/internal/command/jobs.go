@@ -0,0 +1,288 @@
+package command
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mooncorn/nodelink/server/internal/common"
+)
+
+// JobManager runs commands as background jobs and keeps their results after they finish
+type JobManager struct {
+	handler      *Handler
+	retention    time.Duration
+	queueTimeout time.Duration
+
+	mu          sync.RWMutex
+	jobs        map[string]*common.Job
+	queueTimers map[string]*time.Timer
+}
+
+// NewJobManager creates a new job manager. Finished jobs are kept for the retention period.
+func NewJobManager(handler *Handler, retention time.Duration) *JobManager {
+	if retention <= 0 {
+		retention = common.DefaultJobRetention
+	}
+
+	return &JobManager{
+		handler:      handler,
+		retention:    retention,
+		queueTimeout: common.DefaultJobQueueTimeout,
+		jobs:         make(map[string]*common.Job),
+		queueTimers:  make(map[string]*time.Timer),
+	}
+}
+
+// Start removes expired jobs until the context is cancelled
+func (m *JobManager) Start(ctx context.Context) {
+	ticker := time.NewTicker(common.JobCleanupInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if removed := m.CleanupExpiredJobs(); removed > 0 {
+				log.Printf("Removed %d expired jobs", removed)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Submit queues a command as a job. It starts right away if the agent is online,
+// otherwise when the agent connects within the queue timeout.
+func (m *JobManager) Submit(agentID, command string, args []string, env map[string]string, workingDir string, timeout time.Duration) (*common.Job, error) {
+	if _, exists := m.handler.statusManager.GetAgent(agentID); !exists {
+		return nil, common.ErrAgentNotFound
+	}
+
+	// Validate and set timeout
+	if timeout <= 0 {
+		timeout = m.handler.defaultTimeout
+	}
+	if timeout > m.handler.maxTimeout {
+		timeout = m.handler.maxTimeout
+	}
+
+	job := &common.Job{
+		ID:             uuid.New().String(),
+		AgentID:        agentID,
+		Command:        command,
+		Args:           args,
+		Env:            env,
+		WorkingDir:     workingDir,
+		TimeoutSeconds: int(timeout.Seconds()),
+		Status:         common.JobQueued,
+		CreatedAt:      time.Now(),
+	}
+
+	m.mu.Lock()
+	m.jobs[job.ID] = job
+	m.queueTimers[job.ID] = time.AfterFunc(m.queueTimeout, func() {
+		m.expireQueued(job.ID)
+	})
+	snapshot := *job
+	m.mu.Unlock()
+
+	if m.handler.statusManager.IsAgentOnline(agentID) {
+		m.dispatch(job.ID)
+		return m.GetJob(job.ID)
+	}
+
+	return &snapshot, nil
+}
+
+// OnStatusChange starts queued jobs when their agent comes online
+func (m *JobManager) OnStatusChange(event common.StatusChangeEvent) {
+	if !event.NewStatus.IsAvailable() {
+		return
+	}
+
+	m.mu.RLock()
+	var queued []string
+	for _, job := range m.jobs {
+		if job.AgentID == event.AgentID && job.Status == common.JobQueued {
+			queued = append(queued, job.ID)
+		}
+	}
+	m.mu.RUnlock()
+
+	for _, jobID := range queued {
+		m.dispatch(jobID)
+	}
+}
+
+// GetJob returns a snapshot of a job
+func (m *JobManager) GetJob(jobID string) (*common.Job, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	job, exists := m.jobs[jobID]
+	if !exists {
+		return nil, common.ErrJobNotFound
+	}
+
+	snapshot := *job
+	return &snapshot, nil
+}
+
+// ListJobs returns snapshots of all jobs, newest first, optionally filtered by agent and status
+func (m *JobManager) ListJobs(agentID string, status common.JobStatus) []*common.Job {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	jobs := make([]*common.Job, 0, len(m.jobs))
+	for _, job := range m.jobs {
+		if agentID != "" && job.AgentID != agentID {
+			continue
+		}
+		if status != "" && job.Status != status {
+			continue
+		}
+		snapshot := *job
+		jobs = append(jobs, &snapshot)
+	}
+
+	sort.Slice(jobs, func(i, j int) bool {
+		return jobs[i].CreatedAt.After(jobs[j].CreatedAt)
+	})
+
+	return jobs
+}
+
+// CleanupExpiredJobs removes finished jobs older than the retention period
+func (m *JobManager) CleanupExpiredJobs() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	cutoff := time.Now().Add(-m.retention)
+	removed := 0
+	for jobID, job := range m.jobs {
+		if job.FinishedAt != nil && job.FinishedAt.Before(cutoff) {
+			delete(m.jobs, jobID)
+			removed++
+		}
+	}
+
+	return removed
+}
+
+// dispatch sends a queued job to its agent
+func (m *JobManager) dispatch(jobID string) {
+	m.mu.Lock()
+	job, exists := m.jobs[jobID]
+	if !exists || job.Status != common.JobQueued {
+		m.mu.Unlock()
+		return
+	}
+
+	now := time.Now()
+	job.Status = common.JobRunning
+	job.StartedAt = &now
+	m.stopQueueTimer(jobID)
+	snapshot := *job
+	m.mu.Unlock()
+
+	request, err := m.handler.StartStreamingCommand(
+		snapshot.AgentID,
+		snapshot.Command,
+		snapshot.Args,
+		snapshot.Env,
+		snapshot.WorkingDir,
+		time.Duration(snapshot.TimeoutSeconds)*time.Second,
+		func(chunks []*common.CommandOutputChunk, exit *common.CommandExit) {
+			m.complete(jobID, chunks, exit)
+		},
+	)
+	if err != nil {
+		m.finish(jobID, common.JobFailed, fmt.Sprintf("failed to start job: %v", err))
+		return
+	}
+
+	m.mu.Lock()
+	job.RequestID = request.ID
+	m.mu.Unlock()
+
+	log.Printf("Job %s started on agent %s (request %s)", jobID, snapshot.AgentID, request.ID)
+}
+
+// complete records the result of a job's command
+func (m *JobManager) complete(jobID string, chunks []*common.CommandOutputChunk, exit *common.CommandExit) {
+	var stdout, stderr strings.Builder
+	for _, chunk := range chunks {
+		if chunk.Stream == "stderr" {
+			stderr.WriteString(chunk.Data)
+		} else {
+			stdout.WriteString(chunk.Data)
+		}
+	}
+
+	status := common.JobSucceeded
+	switch {
+	case exit.Timeout:
+		status = common.JobTimedOut
+	case exit.Error != "" || exit.ExitCode != 0:
+		status = common.JobFailed
+	}
+
+	m.mu.Lock()
+	if job, exists := m.jobs[jobID]; exists {
+		job.ExitCode = exit.ExitCode
+		job.Stdout = stdout.String()
+		job.Stderr = stderr.String()
+		// The output buffer drops the oldest chunks once it is full
+		job.OutputTruncated = len(chunks) > 0 && chunks[0].Sequence != 1
+	}
+	m.mu.Unlock()
+
+	m.finish(jobID, status, exit.Error)
+}
+
+// expireQueued fails a job whose agent didn't come online in time
+func (m *JobManager) expireQueued(jobID string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if job, exists := m.jobs[jobID]; exists && job.Status == common.JobQueued {
+		m.finishLocked(jobID, common.JobFailed, fmt.Sprintf("agent did not come online within %s", m.queueTimeout))
+	}
+}
+
+// finish moves a job into a final state
+func (m *JobManager) finish(jobID string, status common.JobStatus, message string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.finishLocked(jobID, status, message)
+}
+
+// finishLocked moves a job into a final state. Must be called with the lock held.
+func (m *JobManager) finishLocked(jobID string, status common.JobStatus, message string) {
+	job, exists := m.jobs[jobID]
+	if !exists || job.IsFinished() {
+		return
+	}
+
+	now := time.Now()
+	job.Status = status
+	job.Error = message
+	job.FinishedAt = &now
+	m.stopQueueTimer(jobID)
+
+	log.Printf("Job %s on agent %s finished: %s", jobID, job.AgentID, status)
+}
+
+// stopQueueTimer cancels a job's queue timeout. Must be called with the lock held.
+func (m *JobManager) stopQueueTimer(jobID string) {
+	if timer, exists := m.queueTimers[jobID]; exists {
+		timer.Stop()
+		delete(m.queueTimers, jobID)
+	}
+}
@@ -0,0 +1,127 @@
+package command
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mooncorn/nodelink/server/internal/common"
+	"github.com/mooncorn/nodelink/server/internal/labels"
+)
+
+// JobHTTPHandler handles HTTP requests for asynchronous command jobs
+type JobHTTPHandler struct {
+	jobManager *JobManager
+}
+
+// NewJobHTTPHandler creates a new HTTP handler for jobs
+func NewJobHTTPHandler(jobManager *JobManager) *JobHTTPHandler {
+	return &JobHTTPHandler{
+		jobManager: jobManager,
+	}
+}
+
+// RegisterRoutes registers job-related routes
+func (h *JobHTTPHandler) RegisterRoutes(router gin.IRouter) {
+	router.POST("/jobs", h.submitJob)
+	router.GET("/jobs", h.listJobs)
+	router.GET("/jobs/:jobId", h.getJob)
+}
+
+// submitJob handles POST /jobs. With a selector, one job is submitted for
+// every matching agent, including offline ones whose jobs wait in the queue.
+func (h *JobHTTPHandler) submitJob(c *gin.Context) {
+	var req ExecuteRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON body"})
+		return
+	}
+
+	if (req.AgentID == "") == (req.Selector == "") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Exactly one of agent_id and selector is required"})
+		return
+	}
+
+	if req.Selector != "" {
+		h.submitSelectorJobs(c, req)
+		return
+	}
+
+	job, err := h.jobManager.Submit(
+		req.AgentID,
+		req.Command,
+		req.Args,
+		req.Env,
+		req.WorkingDir,
+		time.Duration(req.Timeout)*time.Second,
+	)
+	if err != nil {
+		switch err {
+		case common.ErrAgentNotFound:
+			c.JSON(http.StatusNotFound, gin.H{"error": "Agent not found"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusAccepted, job)
+}
+
+// submitSelectorJobs submits a job to every agent matching the request's selector
+func (h *JobHTTPHandler) submitSelectorJobs(c *gin.Context, req ExecuteRequest) {
+	selector, err := labels.Parse(req.Selector)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	agents := h.jobManager.handler.statusManager.SelectAgents(selector)
+	if len(agents) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No agents match the selector"})
+		return
+	}
+
+	jobs := make([]*common.Job, 0, len(agents))
+	for _, agent := range agents {
+		job, err := h.jobManager.Submit(
+			agent.AgentID,
+			req.Command,
+			req.Args,
+			req.Env,
+			req.WorkingDir,
+			time.Duration(req.Timeout)*time.Second,
+		)
+		if err != nil {
+			// The agent was removed since it was selected
+			continue
+		}
+		jobs = append(jobs, job)
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"jobs":  jobs,
+		"count": len(jobs),
+	})
+}
+
+// listJobs handles GET /jobs
+func (h *JobHTTPHandler) listJobs(c *gin.Context) {
+	jobs := h.jobManager.ListJobs(c.Query("agent_id"), common.JobStatus(c.Query("status")))
+
+	c.JSON(http.StatusOK, gin.H{
+		"jobs":  jobs,
+		"count": len(jobs),
+	})
+}
+
+// getJob handles GET /jobs/:jobId
+func (h *JobHTTPHandler) getJob(c *gin.Context) {
+	job, err := h.jobManager.GetJob(c.Param("jobId"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Job not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, job)
+}
@@ -0,0 +1,55 @@
+package command
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/mooncorn/nodelink/server/internal/common"
+	"github.com/mooncorn/nodelink/server/internal/sse"
+)
+
+// SSEHandler handles SSE streaming for streaming command output
+type SSEHandler struct {
+	commandHandler *Handler
+	streamBuilder  *sse.StreamBuilder
+}
+
+// NewSSEHandler creates a new SSE handler for command output
+func NewSSEHandler(commandHandler *Handler, sseManager common.SSEManager) *SSEHandler {
+	return &SSEHandler{
+		commandHandler: commandHandler,
+		streamBuilder:  sse.NewStreamBuilder(sseManager),
+	}
+}
+
+// RegisterRoutes registers SSE routes for command output
+func (h *SSEHandler) RegisterRoutes(router gin.IRouter) {
+	router.GET("/commands/:requestId/stream", h.handleCommandStream)
+}
+
+// handleCommandStream handles SSE connections for streaming command output
+func (h *SSEHandler) handleCommandStream(c *gin.Context) {
+	h.streamBuilder.ForCommand("").WithOutputSource(h.commandHandler).Handle(c)
+}
+
+// FanoutSSEHandler handles SSE streaming for fan-out results
+type FanoutSSEHandler struct {
+	fanoutManager *FanoutManager
+	streamBuilder *sse.StreamBuilder
+}
+
+// NewFanoutSSEHandler creates a new SSE handler for fan-out results
+func NewFanoutSSEHandler(fanoutManager *FanoutManager, sseManager common.SSEManager) *FanoutSSEHandler {
+	return &FanoutSSEHandler{
+		fanoutManager: fanoutManager,
+		streamBuilder: sse.NewStreamBuilder(sseManager),
+	}
+}
+
+// RegisterRoutes registers SSE routes for fan-out results
+func (h *FanoutSSEHandler) RegisterRoutes(router gin.IRouter) {
+	router.GET("/fanouts/:fanoutId/stream", h.handleFanoutStream)
+}
+
+// handleFanoutStream handles SSE connections streaming results as each agent completes
+func (h *FanoutSSEHandler) handleFanoutStream(c *gin.Context) {
+	h.streamBuilder.ForFanout("").WithSource(h.fanoutManager).Handle(c)
+}
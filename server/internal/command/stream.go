@@ -0,0 +1,196 @@
+package command
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/mooncorn/nodelink/server/internal/common"
+	pb "github.com/mooncorn/nodelink/server/internal/proto"
+)
+
+// ExitFunc is called once a streaming command finishes, with its buffered output
+type ExitFunc func(chunks []*common.CommandOutputChunk, exit *common.CommandExit)
+
+// streamingCommand buffers the output of a streaming command for late subscribers
+type streamingCommand struct {
+	request *Request
+	chunks  []*common.CommandOutputChunk
+	size    int
+	exit    *common.CommandExit
+	timer   *time.Timer
+	onExit  ExitFunc
+}
+
+// StartStreamingCommand sends a command to an agent without waiting for it to
+// finish. Output is delivered through HandleCommandOutput and HandleCommandExit,
+// and onExit (if not nil) is called when the command finishes.
+func (h *Handler) StartStreamingCommand(agentID, command string, args []string, env map[string]string, workingDir string, timeout time.Duration, onExit ExitFunc) (*Request, error) {
+	// Validate agent is connected using status manager
+	if !h.statusManager.IsAgentOnline(agentID) {
+		return nil, ErrAgentNotConnected
+	}
+
+	// Validate and set timeout
+	if timeout <= 0 {
+		timeout = h.defaultTimeout
+	}
+	if timeout > h.maxTimeout {
+		timeout = h.maxTimeout
+	}
+
+	requestID := h.generateRequestID()
+
+	request := &Request{
+		ID:         requestID,
+		AgentID:    agentID,
+		Command:    command,
+		Args:       args,
+		Env:        env,
+		WorkingDir: workingDir,
+		Timeout:    timeout,
+		Stream:     true,
+		CreatedAt:  time.Now(),
+	}
+
+	stream := &streamingCommand{
+		request: request,
+		onExit:  onExit,
+	}
+
+	h.mu.Lock()
+	h.streams[requestID] = stream
+	// Give up on the agent if it never reports an exit status
+	stream.timer = time.AfterFunc(timeout+5*time.Second, func() {
+		h.finishStream(&common.CommandExit{
+			RequestID: requestID,
+			Timeout:   true,
+			Error:     "no exit status received from agent",
+		})
+	})
+	h.mu.Unlock()
+
+	cmdReq := &pb.CommandRequest{
+		RequestId:      requestID,
+		Command:        command,
+		Args:           args,
+		Env:            env,
+		WorkingDir:     workingDir,
+		TimeoutSeconds: int32(timeout.Seconds()),
+		Stream:         true,
+	}
+
+	if err := h.sendCommandToAgent(agentID, cmdReq); err != nil {
+		h.mu.Lock()
+		stream.timer.Stop()
+		delete(h.streams, requestID)
+		h.mu.Unlock()
+		return nil, fmt.Errorf("failed to send command to agent: %w", err)
+	}
+
+	return request, nil
+}
+
+// HandleCommandOutput processes a chunk of output from a streaming command
+func (h *Handler) HandleCommandOutput(output *pb.CommandOutput) error {
+	chunk := &common.CommandOutputChunk{
+		RequestID: output.RequestId,
+		Sequence:  output.Sequence,
+		Stream:    output.Stream,
+		Data:      string(output.Data),
+		Timestamp: time.Now().UnixMilli(),
+	}
+
+	h.mu.Lock()
+	stream, exists := h.streams[output.RequestId]
+	if !exists || stream.exit != nil {
+		h.mu.Unlock()
+		return fmt.Errorf("no running streaming command found for ID: %s", output.RequestId)
+	}
+
+	stream.chunks = append(stream.chunks, chunk)
+	stream.size += len(chunk.Data)
+
+	// Keep the most recent output within the buffer limit
+	for stream.size > common.MaxCommandOutputBuffer && len(stream.chunks) > 1 {
+		stream.size -= len(stream.chunks[0].Data)
+		stream.chunks[0] = nil
+		stream.chunks = stream.chunks[1:]
+	}
+	h.mu.Unlock()
+
+	h.broadcaster.CommandOutput(chunk)
+	return nil
+}
+
+// HandleCommandExit processes the final message of a streaming command
+func (h *Handler) HandleCommandExit(exit *pb.CommandExit) error {
+	finished := h.finishStream(&common.CommandExit{
+		RequestID:  exit.RequestId,
+		Sequence:   exit.Sequence,
+		ExitCode:   exit.ExitCode,
+		Error:      exit.Error,
+		Timeout:    exit.Timeout,
+		Canceled:   exit.Canceled,
+		DurationMs: exit.DurationMs,
+	})
+	if !finished {
+		return fmt.Errorf("no running streaming command found for ID: %s", exit.RequestId)
+	}
+	return nil
+}
+
+// GetCommandOutput returns the buffered output of a streaming command and its
+// exit status once it has finished
+func (h *Handler) GetCommandOutput(requestID string) ([]*common.CommandOutputChunk, *common.CommandExit, error) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	stream, exists := h.streams[requestID]
+	if !exists {
+		return nil, nil, ErrCommandNotFound
+	}
+
+	chunks := make([]*common.CommandOutputChunk, len(stream.chunks))
+	copy(chunks, stream.chunks)
+	return chunks, stream.exit, nil
+}
+
+// finishStream records the exit of a streaming command and keeps its output
+// around for a while for late subscribers. It reports whether the command was running.
+func (h *Handler) finishStream(exit *common.CommandExit) bool {
+	h.mu.Lock()
+	stream, exists := h.streams[exit.RequestID]
+	if !exists || stream.exit != nil {
+		h.mu.Unlock()
+		return false
+	}
+
+	// A synthesized exit continues the sequence after the last chunk we saw
+	if exit.Sequence == 0 {
+		exit.Sequence = 1
+		if n := len(stream.chunks); n > 0 {
+			exit.Sequence = stream.chunks[n-1].Sequence + 1
+		}
+	}
+	if exit.DurationMs == 0 {
+		exit.DurationMs = time.Since(stream.request.CreatedAt).Milliseconds()
+	}
+	exit.Timestamp = time.Now().UnixMilli()
+
+	stream.exit = exit
+	chunks := make([]*common.CommandOutputChunk, len(stream.chunks))
+	copy(chunks, stream.chunks)
+	stream.timer.Stop()
+	stream.timer = time.AfterFunc(common.CommandOutputRetention, func() {
+		h.mu.Lock()
+		delete(h.streams, exit.RequestID)
+		h.mu.Unlock()
+	})
+	h.mu.Unlock()
+
+	h.broadcaster.CommandExit(exit)
+	if stream.onExit != nil {
+		stream.onExit(chunks, exit)
+	}
+	return true
+}
@@ -11,12 +11,36 @@ var (
 	ErrAgentNotConnected     = errors.New("agent is not connected")
 	ErrAgentAlreadyConnected = errors.New("agent is already connected")
 	ErrRequestTimeout        = errors.New("request timed out")
+	ErrCommandNotFound       = errors.New("command not found")
+	ErrJobNotFound           = errors.New("job not found")
+	ErrInvalidSignal         = errors.New("invalid signal")
+	ErrFanoutNotFound        = errors.New("fan-out not found")
+	ErrNoFanoutTargets       = errors.New("no agents match the fan-out targets")
+	ErrNoMatchingAgents      = errors.New("no agents match the selector")
+	ErrMetricRangeTooLarge   = errors.New("metric range has too many points, use a larger step")
 
 	// Authentication error definitions
 	ErrMissingMetadata    = errors.New("missing metadata")
 	ErrMissingAgentID     = errors.New("missing agent_id")
 	ErrMissingAgentToken  = errors.New("missing agent_token")
 	ErrInvalidCredentials = errors.New("invalid credentials")
+	ErrCredentialNotFound = errors.New("credential not found")
+	ErrCredentialRevoked  = errors.New("credential revoked")
+	ErrMissingClientCert  = errors.New("missing client certificate")
+	ErrCertIdentityEmpty  = errors.New("client certificate has no agent identity")
+	ErrCertAgentMismatch  = errors.New("agent_id does not match client certificate")
+
+	// Metrics errors
+	ErrMetricsPushNotSupported = errors.New("agent did not acknowledge the metrics subscription")
+
+	// Enrollment errors
+	ErrEnrollmentTokenNotFound = errors.New("enrollment token not found")
+	ErrEnrollmentTokenExpired  = errors.New("enrollment token expired")
+	ErrAgentAlreadyEnrolled    = errors.New("agent already has an active credential")
+
+	// Credential rotation errors
+	ErrRotationInProgress  = errors.New("credential rotation already in progress")
+	ErrRotationUnconfirmed = errors.New("agent has not confirmed the previous credential rotation")
 
 	// Terminal-specific errors
 	ErrTerminalSessionNotFound    = errors.New("terminal session not found")
@@ -24,22 +48,84 @@ var (
 	ErrMaxTerminalSessionsReached = errors.New("maximum terminal sessions reached for user")
 	ErrTerminalSessionClosed      = errors.New("terminal session is closed")
 	ErrUnauthorizedTerminalAccess = errors.New("unauthorized access to terminal session")
+	ErrInvalidTerminalSize        = errors.New("terminal rows and cols must be between 1 and 1000")
+	ErrInvalidControlMessage      = errors.New("invalid terminal control message")
+	ErrInsufficientTerminalRole   = errors.New("terminal session role does not allow this")
+	ErrInvalidTerminalInvite      = errors.New("invite another user as collaborator or observer")
+	ErrParticipantNotFound        = errors.New("user is not a participant of the terminal session")
+	ErrRecordingNotFound          = errors.New("recording not found")
+	ErrAuditLogNotFound           = errors.New("terminal audit log not found")
 )
 
 const (
 	// Ping/Pong defaults
 	DefaultPingInterval    = 3 * time.Second
 	DefaultOfflineTimeout  = 6 * time.Second
+	MinPingInterval        = 500 * time.Millisecond
+	LatencyWindowSize      = 100 // round-trip times latency statistics are computed over
 	DefaultCleanupInterval = 10 * time.Second
 	DefaultStaleAgentTTL   = 30 * time.Second
+	PingCheckDisabled      = -1 // per-agent setting that turns a degraded or flap check off
 
 	// Command execution constants
 	DefaultCommandTimeout = 30 * time.Second
 	MaxCommandTimeout     = 5 * time.Minute
+	CommandCancelTimeout  = 5 * time.Second
+
+	// Streaming command constants
+	MaxCommandOutputBuffer = 1 << 20 // bytes of output kept for replay per command
+	CommandOutputRetention = 5 * time.Minute
+
+	// Job constants
+	DefaultJobRetention    = 24 * time.Hour
+	DefaultJobQueueTimeout = 10 * time.Minute
+	JobCleanupInterval     = 1 * time.Minute
+
+	// Status history constants
+	MaxStatusHistory       = 5000                // transitions kept per agent
+	StatusHistoryRetention = 31 * 24 * time.Hour // just over the longest availability window
+
+	// Metrics collection and history constants
+	DefaultMetricsInterval     = 5 * time.Second // how often agents push or are polled for metrics
+	MetricsSubscribeTimeout    = 5 * time.Second // agents that don't acknowledge by then are polled
+	DefaultMetricsRawRetention = 24 * time.Hour
+	MetricsRollupInterval      = 1 * time.Minute
+	MetricsRollupDelay         = 15 * time.Second // lets a window's last samples arrive before it is rolled up
+	MaxMetricRangePoints       = 11000            // per series in a range query
+	SystemInfoConcurrency      = 10               // agents asked for system info at once
+	MetricsDeleteBatchSize     = 1000             // expired points deleted per transaction
+
+	// Fan-out constants
+	DefaultFanoutConcurrency = 10
+	MaxFanoutConcurrency     = 100
+	FanoutRetention          = 1 * time.Hour
+
+	// Enrollment constants
+	DefaultEnrollmentTokenTTL = 1 * time.Hour
+	MaxEnrollmentTokenTTL     = 7 * 24 * time.Hour
+	EnrollmentRetryWindow     = 5 * time.Minute // how long an agent may retry an enrollment that succeeded
+
+	// Credential rotation constants
+	DefaultRotationGracePeriod = 24 * time.Hour
+	RotationAckTimeout         = 30 * time.Second
+	RotationConcurrency        = 10 // agents rotated at once by a bulk rotation
 
 	// Terminal session constants
-	DefaultTerminalTimeout     = 30 * time.Minute
-	DefaultTerminalShell       = "bash"
-	MaxTerminalSessionsPerUser = 10
-	TerminalCleanupInterval    = 5 * time.Minute
+	DefaultTerminalTimeout       = 30 * time.Minute
+	DefaultTerminalShell         = "bash"
+	MaxTerminalSessionsPerUser   = 10
+	DefaultTerminalRows          = 24
+	DefaultTerminalCols          = 80
+	MaxTerminalSize              = 1000 // rows or cols
+	TerminalCleanupInterval      = 5 * time.Minute
+	DetachedTerminalTimeout      = 24 * time.Hour
+	TerminalScrollbackSize       = 256 * 1024          // bytes of output replayed to clients that connect later
+	TerminalAuditRetention       = 90 * 24 * time.Hour // how long audit logs are kept after their session closes
+	TerminalAuditFlushInterval   = 1 * time.Second     // how often buffered audit entries are written to the database
+	TerminalAuditCleanupInterval = 1 * time.Hour       // how often expired audit logs are deleted
+	TerminalAuditDeleteBatchSize = 100                 // expired audit logs deleted per transaction
+
+	// Terminal recording constants
+	DefaultRecordingDir = "recordings"
+	MaxReplaySpeed      = 100.0
 )
@@ -2,8 +2,10 @@ package common
 
 import (
 	"context"
+	"io"
 	"time"
 
+	"github.com/mooncorn/nodelink/server/internal/labels"
 	pb "github.com/mooncorn/nodelink/server/internal/proto"
 )
 
@@ -26,23 +28,96 @@ type StreamSender interface {
 	SendToAgent(agentID string, message *pb.ServerMessage) error
 }
 
+// AgentDisconnector ends the streams of connected agents
+type AgentDisconnector interface {
+	DisconnectAgent(ctx context.Context, agentID string) error
+}
+
 // CommandResponseHandler interface for handling command responses
 type CommandResponseHandler interface {
 	HandleCommandResponse(response *pb.CommandResponse) error
+	HandleCommandOutput(output *pb.CommandOutput) error
+	HandleCommandExit(exit *pb.CommandExit) error
+	HandleCommandCancelResponse(response *pb.CommandCancelResponse) error
 	SetStreamSender(sender StreamSender)
 }
 
+// CommandOutputSource provides the buffered output of streaming commands so
+// late subscribers can catch up
+type CommandOutputSource interface {
+	GetCommandOutput(requestID string) ([]*CommandOutputChunk, *CommandExit, error)
+}
+
+// FanoutSource provides fan-out state so late subscribers can catch up
+type FanoutSource interface {
+	GetFanout(fanoutID string) (*Fanout, error)
+}
+
 // Authenticator interface for agent authentication
 type Authenticator interface {
 	Authenticate(ctx context.Context) (string, error)
 }
 
+// CredentialStore interface for loading and managing agent credentials
+type CredentialStore interface {
+	GetCredential(agentID string) (*AgentCredential, error)
+	ListCredentials() ([]*AgentCredential, error)
+	SaveCredential(credential *AgentCredential) error
+	// MarkCredentialAuthenticated records the first authentication with a
+	// credential, unless its token has been replaced since
+	MarkCredentialAuthenticated(agentID, tokenHash string, at time.Time) error
+}
+
+// EnrollmentStore interface for persisting enrollment tokens
+type EnrollmentStore interface {
+	SaveEnrollmentToken(token *EnrollmentToken) error
+	GetEnrollmentToken(tokenHash string) (*EnrollmentToken, error)
+	ListEnrollmentTokens() ([]*EnrollmentToken, error)
+	DeleteEnrollmentToken(id string) error
+}
+
 // StatusManager interface for managing agent status
 type StatusManager interface {
 	GetAgent(agentID string) (*AgentInfo, bool)
 	GetAllAgents() []*AgentInfo
 	IsAgentOnline(agentID string) bool
 	AddListener(listener StatusChangeListener)
+	UpdateSystemInfo(agentID string, systemInfo *pb.SystemInfo)
+	SelectAgents(selector labels.Selector) []*AgentInfo
+	SetForceRecording(agentID string, force bool) (*AgentInfo, error)
+}
+
+// AgentStore interface for persisting agent records across server restarts
+type AgentStore interface {
+	SaveAgent(agent *AgentInfo) error
+	DeleteAgent(agentID string) error
+	LoadAgents() ([]*AgentInfo, error)
+}
+
+// HistoryStore interface for persisting agent status transitions
+type HistoryStore interface {
+	// AppendTransition records a transition, keeping at most limit per agent and
+	// dropping those older than before except the latest of them
+	AppendTransition(transition *StatusTransition, limit int, before time.Time) error
+	// LoadTransitions returns an agent's transitions since the given time in
+	// chronological order, preceded by the latest earlier one if there is any
+	LoadTransitions(agentID string, since time.Time) ([]*StatusTransition, error)
+}
+
+// MetricsStore interface for persisting agent metrics at several resolutions
+type MetricsStore interface {
+	// SaveMetricPoints stores points of an agent at a resolution, replacing
+	// those with the same timestamps
+	SaveMetricPoints(agentID, resolution string, points []*MetricPoint) error
+	// LoadMetricPoints returns an agent's points at a resolution from from up
+	// to but excluding to, in chronological order
+	LoadMetricPoints(agentID, resolution string, from, to time.Time) ([]*MetricPoint, error)
+	// LastMetricPoint returns an agent's latest point at a resolution, or nil if there is none
+	LastMetricPoint(agentID, resolution string) (*MetricPoint, error)
+	// DeleteMetricPoints drops the points of every agent at a resolution older than before
+	DeleteMetricPoints(resolution string, before time.Time) error
+	// MetricAgents returns the agents that have stored metrics
+	MetricAgents() ([]string, error)
 }
 
 // SSEManager interface for managing Server-Sent Events
@@ -61,16 +136,98 @@ type TerminalSessionManager interface {
 	CreateSession(userID, agentID, shell, workingDir string, env map[string]string) (*TerminalSession, error)
 	GetSession(sessionID string) (*TerminalSession, error)
 	GetUserSessions(userID string) []*TerminalSession
+	GetAgentSessions(agentID string) []*TerminalSession
+	SetSessionStatus(sessionID string, status TerminalStatus) error
+	SetSessionSize(sessionID string, rows, cols int) error
+	SetSessionRecorded(sessionID string, recorded bool) error
+	SetSessionDetached(sessionID string, detached bool) error
 	CloseSession(sessionID string) error
 	UpdateLastActivity(sessionID string) error
 	CleanupInactiveSessions(maxInactivity time.Duration) int
-	ValidateSessionAccess(sessionID, userID string) error
+	SetParticipant(sessionID string, participant TerminalParticipant) error
+	RemoveParticipant(sessionID, userID string) error
+	GetSessionRole(sessionID, userID string) (TerminalRole, error)
+	// ValidateSessionAccess checks that the user's role in an open session
+	// grants at least the required role
+	ValidateSessionAccess(sessionID, userID string, required TerminalRole) error
+}
+
+// TerminalPresenceTracker tracks which users are attached to terminal sessions
+type TerminalPresenceTracker interface {
+	// Join records a user attaching to a session over the given transport. The
+	// returned channel is closed if the user's access is revoked; leave must be
+	// called once the user disconnects.
+	Join(sessionID, userID, via string) (revoked <-chan struct{}, leave func())
+}
+
+// TerminalHistorySource provides the recent output of terminal sessions
+type TerminalHistorySource interface {
+	// GetScrollback returns the buffered output of a session and the number of
+	// bytes it has written in total, which is the offset at the end of the output
+	GetScrollback(sessionID string) ([]byte, int64, error)
+}
+
+// TerminalRecorder records terminal sessions. Calls for sessions that aren't
+// being recorded are ignored.
+type TerminalRecorder interface {
+	// ShouldRecord decides whether a new session is recorded; requested is the
+	// client's choice, nil to use the default
+	ShouldRecord(agentID string, requested *bool) bool
+	Start(session *TerminalSession) error
+	RecordOutput(sessionID string, data []byte)
+	// RecordInput records input typed into a session by the given user
+	RecordInput(sessionID, userID string, data []byte)
+	RecordResize(sessionID string, rows, cols int)
+	Stop(sessionID string)
+}
+
+// TerminalAuditStore interface for persisting the audit logs of terminal sessions
+type TerminalAuditStore interface {
+	SaveAuditLog(log *TerminalAuditLog) error
+	GetAuditLog(sessionID string) (*TerminalAuditLog, error)
+	// SaveAuditEntries stores entries of a session's log under their sequence
+	// numbers, replacing the entries stored under them before
+	SaveAuditEntries(sessionID string, entries map[uint64]TerminalAuditEntry) error
+	// LoadAuditEntries returns a session's entries, oldest first
+	LoadAuditEntries(sessionID string) ([]TerminalAuditEntry, error)
+	// DeleteAuditLogs deletes up to limit logs of sessions closed before the
+	// given time, and of sessions never closed that were created before it,
+	// and returns how many it deleted
+	DeleteAuditLogs(closedBefore time.Time, limit int) (int, error)
+}
+
+// TerminalReplaySource opens terminal recordings for replay
+type TerminalReplaySource interface {
+	// OpenReplay returns the recording of a session if the user may access it
+	OpenReplay(sessionID, userID string) (TerminalReplay, error)
+}
+
+// TerminalReplay reads the events of a terminal recording in order
+type TerminalReplay interface {
+	// Info describes the recording for the replay_started event
+	Info() map[string]interface{}
+	// Next returns the next event, or io.EOF after the last one
+	Next() (*TerminalReplayEvent, error)
+	Close() error
+}
+
+// RecordingStore interface for storing terminal session recordings
+type RecordingStore interface {
+	// Create starts a new recording, returning a writer for its contents
+	Create(info *RecordingInfo) (io.WriteCloser, error)
+	// Open returns a reader for a recording's contents
+	Open(sessionID string) (io.ReadCloser, error)
+	GetInfo(sessionID string) (*RecordingInfo, error)
+	SaveInfo(info *RecordingInfo) error
 }
 
 // TerminalResponseHandler interface for handling terminal command responses
 type TerminalResponseHandler interface {
 	HandleTerminalCreateResponse(response *pb.TerminalCreateResponse) error
 	HandleTerminalCommandResponse(response *pb.TerminalCommandResponse) error
+	HandleTerminalOutput(output *pb.TerminalOutput) error
 	HandleTerminalCloseResponse(response *pb.TerminalCloseResponse) error
+	HandleTerminalSessionsAnnouncement(agentID string, announcement *pb.TerminalSessionsAnnouncement) error
+	HandleAgentDisconnected(agentID string)
 	SetStreamSender(sender StreamSender)
 }
@@ -2,25 +2,133 @@ package common
 
 import (
 	"time"
+
+	pb "github.com/mooncorn/nodelink/server/internal/proto"
 )
 
 // AgentStatus represents the current status of an agent
 type AgentStatus string
 
 const (
-	AgentStatusOnline  AgentStatus = "online"
-	AgentStatusOffline AgentStatus = "offline"
+	AgentStatusOnline   AgentStatus = "online"
+	AgentStatusDegraded AgentStatus = "degraded" // connected, but missing pongs, slow to answer or flapping
+	AgentStatusOffline  AgentStatus = "offline"
 )
 
+// IsAvailable reports whether an agent with this status accepts requests
+func (s AgentStatus) IsAvailable() bool {
+	return s == AgentStatusOnline || s == AgentStatusDegraded
+}
+
 // AgentInfo contains information about an agent
 type AgentInfo struct {
-	AgentID     string            `json:"agent_id"`
-	Status      AgentStatus       `json:"status"`
-	LastSeen    time.Time         `json:"last_seen"`
-	ConnectedAt *time.Time        `json:"connected_at,omitempty"`
-	Metadata    map[string]string `json:"metadata,omitempty"`
-	CreatedAt   time.Time         `json:"created_at"`
-	UpdatedAt   time.Time         `json:"updated_at"`
+	AgentID      string            `json:"agent_id"`
+	Status       AgentStatus       `json:"status"`
+	StatusReason string            `json:"status_reason,omitempty"` // why the agent is degraded or offline
+	Flapping     bool              `json:"flapping,omitempty"`      // status changing too often, notifications are held back
+	LastSeen     time.Time         `json:"last_seen"`
+	ConnectedAt  *time.Time        `json:"connected_at,omitempty"`
+	Metadata     map[string]string `json:"metadata,omitempty"`
+	Labels       map[string]string `json:"labels,omitempty"` // agent labels with operator labels applied on top
+
+	AgentLabels    map[string]string `json:"agent_labels,omitempty"`    // declared by the agent when it connects
+	OperatorLabels map[string]string `json:"operator_labels,omitempty"` // set through the API, survive reconnects
+	PingConfig     *PingConfig       `json:"ping_config,omitempty"`     // heartbeat settings overriding the server defaults
+	Latency        *LatencyStats     `json:"latency,omitempty"`         // ping round-trip times, not kept across server restarts
+	ForceRecording bool              `json:"force_recording,omitempty"` // terminal sessions are always recorded, whatever the client asks
+	SystemInfo     *pb.SystemInfo    `json:"system_info,omitempty"`     // Last known system information
+	CreatedAt      time.Time         `json:"created_at"`
+	UpdatedAt      time.Time         `json:"updated_at"`
+}
+
+// AgentCredential is a stored agent credential. Only a salted hash of the token is kept.
+type AgentCredential struct {
+	AgentID   string     `json:"agent_id"`
+	TokenHash string     `json:"token_hash"`
+	CreatedAt time.Time  `json:"created_at"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+
+	// First time the agent authenticated with the token, which ends any retry of its enrollment
+	AuthenticatedAt *time.Time `json:"authenticated_at,omitempty"`
+
+	// After a rotation the previous token keeps working until PreviousExpiresAt
+	PreviousTokenHash   string     `json:"previous_token_hash,omitempty"`
+	PreviousExpiresAt   *time.Time `json:"previous_expires_at,omitempty"`
+	RotatedAt           *time.Time `json:"rotated_at,omitempty"`
+	RotationConfirmedAt *time.Time `json:"rotation_confirmed_at,omitempty"` // when the agent last acknowledged a rotation
+}
+
+// RotationUnconfirmed reports whether the agent may still hold the previous
+// token because it never acknowledged the last rotation
+func (c *AgentCredential) RotationUnconfirmed(now time.Time) bool {
+	if c.PreviousTokenHash == "" || c.PreviousExpiresAt == nil || !now.Before(*c.PreviousExpiresAt) {
+		return false
+	}
+	return c.RotationConfirmedAt == nil || c.RotatedAt == nil || c.RotationConfirmedAt.Before(*c.RotatedAt)
+}
+
+// RotationStatus represents the outcome of a credential rotation
+type RotationStatus string
+
+const (
+	RotationPending   RotationStatus = "pending"
+	RotationSucceeded RotationStatus = "succeeded"
+	RotationFailed    RotationStatus = "failed"
+	RotationTimedOut  RotationStatus = "timed_out"
+	RotationSkipped   RotationStatus = "skipped"
+)
+
+// CredentialRotation tracks a server-initiated credential rotation for one agent
+type CredentialRotation struct {
+	ID          string         `json:"id"`
+	AgentID     string         `json:"agent_id"`
+	Status      RotationStatus `json:"status"`
+	Error       string         `json:"error,omitempty"`
+	StartedAt   time.Time      `json:"started_at"`
+	CompletedAt *time.Time     `json:"completed_at,omitempty"`
+}
+
+// EnrollmentToken is a short-lived, single-use token an agent can exchange for a credential.
+// Only a hash of the token itself is stored.
+type EnrollmentToken struct {
+	ID        string    `json:"id"`
+	TokenHash string    `json:"token_hash"`
+	AgentID   string    `json:"agent_id,omitempty"` // optional, binds the enrolled agent to this ID
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+
+	// Set once the token was exchanged. The same agent may exchange it again
+	// for a little while in case the response never reached it, proving it is
+	// the same by repeating its nonce, until it uses the credential it got.
+	UsedAt               *time.Time `json:"used_at,omitempty"`
+	UsedAgentID          string     `json:"used_agent_id,omitempty"`
+	UsedHostname         string     `json:"used_hostname,omitempty"`
+	UsedNonceHash        string     `json:"used_nonce_hash,omitempty"`
+	IssuedCredentialHash string     `json:"issued_credential_hash,omitempty"` // token hash of the credential issued last
+}
+
+// PingConfig overrides the heartbeat settings of a single agent. Zero fields
+// fall back to the server defaults, PingCheckDisabled turns a degraded or flap
+// check off.
+type PingConfig struct {
+	IntervalMs          int64 `json:"interval_ms,omitempty"`
+	OfflineTimeoutMs    int64 `json:"offline_timeout_ms,omitempty"`    // without a pong for this long the agent is offline
+	DegradedMissedPongs int   `json:"degraded_missed_pongs,omitempty"` // unanswered pings before the agent is degraded
+	DegradedRTTMs       int64 `json:"degraded_rtt_ms,omitempty"`       // round-trip time above which the agent is degraded
+	FlapWindowMs        int64 `json:"flap_window_ms,omitempty"`
+	FlapThreshold       int   `json:"flap_threshold,omitempty"` // status changes within the window that make an agent flap
+}
+
+// LatencyStats summarizes an agent's recent ping round-trip times
+type LatencyStats struct {
+	AgentID   string    `json:"agent_id"`
+	LastMs    float64   `json:"last_ms"`
+	MinMs     float64   `json:"min_ms"`
+	AvgMs     float64   `json:"avg_ms"`
+	P95Ms     float64   `json:"p95_ms"`
+	JitterMs  float64   `json:"jitter_ms"` // mean difference between consecutive round-trip times
+	Samples   int       `json:"samples"`
+	UpdatedAt time.Time `json:"updated_at"`
 }
 
 // StatusChangeEvent represents a status change notification
@@ -32,6 +140,73 @@ type StatusChangeEvent struct {
 	Agent     *AgentInfo  `json:"agent"`
 }
 
+// StatusTransition is a recorded change of an agent's status
+type StatusTransition struct {
+	AgentID   string      `json:"agent_id"`
+	From      AgentStatus `json:"from"`
+	To        AgentStatus `json:"to"`
+	Timestamp time.Time   `json:"timestamp"`
+}
+
+// MetricPoint holds an agent's metric series at one time. Raw samples have a
+// single value per series; rollups summarize the window starting at Timestamp.
+type MetricPoint struct {
+	Timestamp time.Time              `json:"timestamp"`
+	Values    map[string]MetricValue `json:"values"`
+}
+
+// MetricValue summarizes the samples of a series
+type MetricValue struct {
+	Avg   float64 `json:"avg"`
+	Min   float64 `json:"min"`
+	Max   float64 `json:"max"`
+	Count int     `json:"count"`
+}
+
+// Merge adds the samples summarized by another value
+func (v *MetricValue) Merge(other MetricValue) {
+	if v.Count == 0 {
+		*v = other
+		return
+	}
+
+	count := v.Count + other.Count
+	v.Avg = (v.Avg*float64(v.Count) + other.Avg*float64(other.Count)) / float64(count)
+	v.Min = min(v.Min, other.Min)
+	v.Max = max(v.Max, other.Max)
+	v.Count = count
+}
+
+// MetricRange is an agent's metric series over a period, one point per step
+type MetricRange struct {
+	AgentID     string                        `json:"agent_id"`
+	From        time.Time                     `json:"from"`
+	To          time.Time                     `json:"to"`
+	StepSeconds float64                       `json:"step_seconds"`
+	Resolution  string                        `json:"resolution"` // raw, 1m, 5m or 1h
+	Series      map[string][]MetricRangePoint `json:"series"`
+}
+
+// MetricRangePoint is the value of a series over one step
+type MetricRangePoint struct {
+	Timestamp time.Time `json:"timestamp"`
+	Avg       float64   `json:"avg"`
+	Min       float64   `json:"min"`
+	Max       float64   `json:"max"`
+}
+
+// Availability summarizes an agent's status history over a time window
+type Availability struct {
+	Window               string   `json:"window"`
+	CoveredSeconds       float64  `json:"covered_seconds"` // part of the window the agent was known to the server
+	UptimeSeconds        float64  `json:"uptime_seconds"`
+	UptimePercent        float64  `json:"uptime_percent"`
+	Outages              int      `json:"outages"`
+	LongestOutageSeconds float64  `json:"longest_outage_seconds"`
+	MTBFSeconds          *float64 `json:"mtbf_seconds,omitempty"` // mean time between failures, unset without failures
+	MTTRSeconds          *float64 `json:"mttr_seconds,omitempty"` // mean time to recovery, unset without outages
+}
+
 // StatusChangeListener defines the interface for status change notifications
 type StatusChangeListener interface {
 	OnStatusChange(event StatusChangeEvent)
@@ -45,9 +220,24 @@ type TerminalSession struct {
 	Shell        string            `json:"shell"`
 	WorkingDir   string            `json:"working_dir"`
 	Status       TerminalStatus    `json:"status"`
+	Rows         int               `json:"rows"`
+	Cols         int               `json:"cols"`
+	Recorded     bool              `json:"recorded"`
+	Detached     bool              `json:"detached"` // left running without a client, kept longer when idle
 	CreatedAt    time.Time         `json:"created_at"`
 	LastActivity time.Time         `json:"last_activity"`
 	Env          map[string]string `json:"env,omitempty"`
+
+	// Users the owner shared the session with, by user ID
+	Participants map[string]TerminalParticipant `json:"participants,omitempty"`
+}
+
+// RoleOf returns the user's role in the session, empty if the user has no access
+func (s *TerminalSession) RoleOf(userID string) TerminalRole {
+	if userID == s.UserID {
+		return TerminalRoleOwner
+	}
+	return s.Participants[userID].Role
 }
 
 // TerminalStatus represents the status of a terminal session
@@ -59,6 +249,95 @@ const (
 	TerminalStatusClosed   TerminalStatus = "closed"
 )
 
+// TerminalRole is what a user may do in a terminal session
+type TerminalRole string
+
+const (
+	TerminalRoleOwner        TerminalRole = "owner"        // created the session, may share and close it
+	TerminalRoleCollaborator TerminalRole = "collaborator" // may type into the terminal
+	TerminalRoleObserver     TerminalRole = "observer"     // may only watch
+)
+
+// terminalRoleRank orders roles by the access they grant
+var terminalRoleRank = map[TerminalRole]int{
+	TerminalRoleObserver:     1,
+	TerminalRoleCollaborator: 2,
+	TerminalRoleOwner:        3,
+}
+
+// Allows reports whether the role grants at least the access of the required role
+func (r TerminalRole) Allows(required TerminalRole) bool {
+	return terminalRoleRank[r] > 0 && terminalRoleRank[r] >= terminalRoleRank[required]
+}
+
+// TerminalParticipant is a user the owner invited into a terminal session
+type TerminalParticipant struct {
+	UserID    string       `json:"user_id"`
+	Role      TerminalRole `json:"role"` // collaborator or observer
+	InvitedAt time.Time    `json:"invited_at"`
+}
+
+// TerminalPresence describes a user attached to a terminal session
+type TerminalPresence struct {
+	UserID      string       `json:"user_id"`
+	Role        TerminalRole `json:"role"`
+	Connections int          `json:"connections"` // open SSE streams and WebSockets
+	Since       time.Time    `json:"since"`
+}
+
+// TerminalAuditAction identifies what a terminal audit entry records
+type TerminalAuditAction string
+
+const (
+	TerminalAuditInput   TerminalAuditAction = "input"   // keystrokes, coalesced while typing
+	TerminalAuditCommand TerminalAuditAction = "command" // command sent through the HTTP API
+	TerminalAuditSignal  TerminalAuditAction = "signal"
+	TerminalAuditResize  TerminalAuditAction = "resize"
+	TerminalAuditJoin    TerminalAuditAction = "join"
+	TerminalAuditLeave   TerminalAuditAction = "leave"
+	TerminalAuditInvite  TerminalAuditAction = "invite"
+	TerminalAuditRevoke  TerminalAuditAction = "revoke"
+	TerminalAuditDetach  TerminalAuditAction = "detach"
+)
+
+// TerminalAuditEntry attributes an action in a terminal session to a user
+type TerminalAuditEntry struct {
+	Timestamp time.Time           `json:"timestamp"`
+	UserID    string              `json:"user_id"`
+	Action    TerminalAuditAction `json:"action"`
+	Data      string              `json:"data,omitempty"`
+}
+
+// TerminalAuditLog describes the audit log of a terminal session, which is
+// kept after the session closes
+type TerminalAuditLog struct {
+	SessionID string     `json:"session_id"`
+	UserID    string     `json:"user_id"` // the session's owner, who may read the log
+	AgentID   string     `json:"agent_id"`
+	CreatedAt time.Time  `json:"created_at"`
+	ClosedAt  *time.Time `json:"closed_at,omitempty"`
+}
+
+// RecordingInfo describes the asciicast recording of a terminal session
+type RecordingInfo struct {
+	SessionID string     `json:"session_id"`
+	UserID    string     `json:"user_id"`
+	AgentID   string     `json:"agent_id"`
+	Shell     string     `json:"shell"`
+	Rows      int        `json:"rows"` // initial terminal size
+	Cols      int        `json:"cols"`
+	StartedAt time.Time  `json:"started_at"`
+	EndedAt   *time.Time `json:"ended_at,omitempty"` // unset while the session is still recording
+	Size      int64      `json:"size"`               // bytes written so far
+}
+
+// TerminalReplayEvent is an event of a terminal recording as sent to replay clients
+type TerminalReplayEvent struct {
+	Time float64 // seconds since the recording started
+	Type string  // SSE event type, e.g. replay_output
+	Data map[string]interface{}
+}
+
 // TerminalCommand represents a command being executed in a terminal session
 type TerminalCommand struct {
 	CommandID string    `json:"command_id"`
@@ -67,3 +346,130 @@ type TerminalCommand struct {
 	Status    string    `json:"status"`
 	CreatedAt time.Time `json:"created_at"`
 }
+
+// CommandOutputChunk is a piece of output from a streaming command
+type CommandOutputChunk struct {
+	RequestID string `json:"request_id"`
+	Sequence  int64  `json:"sequence"`
+	Stream    string `json:"stream"` // stdout or stderr
+	Data      string `json:"data"`
+	Timestamp int64  `json:"timestamp"`
+}
+
+// CommandExit is the final event of a streaming command
+type CommandExit struct {
+	RequestID  string `json:"request_id"`
+	Sequence   int64  `json:"sequence"`
+	ExitCode   int32  `json:"exit_code"`
+	Error      string `json:"error,omitempty"`
+	Timeout    bool   `json:"timeout"`
+	Canceled   bool   `json:"canceled"`
+	DurationMs int64  `json:"duration_ms"`
+	Timestamp  int64  `json:"timestamp"`
+}
+
+// JobStatus represents the state of an asynchronous command job
+type JobStatus string
+
+const (
+	JobQueued    JobStatus = "queued"
+	JobRunning   JobStatus = "running"
+	JobSucceeded JobStatus = "succeeded"
+	JobFailed    JobStatus = "failed"
+	JobTimedOut  JobStatus = "timed_out"
+)
+
+// Job is a command that runs in the background and whose result is kept after it finishes
+type Job struct {
+	ID              string            `json:"id"`
+	AgentID         string            `json:"agent_id"`
+	Command         string            `json:"command"`
+	Args            []string          `json:"args,omitempty"`
+	Env             map[string]string `json:"env,omitempty"`
+	WorkingDir      string            `json:"working_dir,omitempty"`
+	TimeoutSeconds  int               `json:"timeout_seconds"`
+	Status          JobStatus         `json:"status"`
+	RequestID       string            `json:"request_id,omitempty"`
+	ExitCode        int32             `json:"exit_code"`
+	Stdout          string            `json:"stdout"`
+	Stderr          string            `json:"stderr"`
+	OutputTruncated bool              `json:"output_truncated,omitempty"`
+	Error           string            `json:"error,omitempty"`
+	CreatedAt       time.Time         `json:"created_at"`
+	StartedAt       *time.Time        `json:"started_at,omitempty"`
+	FinishedAt      *time.Time        `json:"finished_at,omitempty"`
+}
+
+// IsFinished reports whether the job has reached a final state
+func (j *Job) IsFinished() bool {
+	return j.Status == JobSucceeded || j.Status == JobFailed || j.Status == JobTimedOut
+}
+
+// FanoutStatus represents the state of a command fanned out to several agents
+type FanoutStatus string
+
+const (
+	FanoutRunning   FanoutStatus = "running"
+	FanoutCompleted FanoutStatus = "completed"
+	FanoutAborted   FanoutStatus = "aborted" // stopped early after too many failures
+)
+
+// FanoutTargetStatus represents the state of one agent within a fan-out
+type FanoutTargetStatus string
+
+const (
+	FanoutTargetPending   FanoutTargetStatus = "pending"
+	FanoutTargetRunning   FanoutTargetStatus = "running"
+	FanoutTargetSucceeded FanoutTargetStatus = "succeeded"
+	FanoutTargetFailed    FanoutTargetStatus = "failed"
+	FanoutTargetTimedOut  FanoutTargetStatus = "timed_out"
+	FanoutTargetSkipped   FanoutTargetStatus = "skipped"
+)
+
+// FanoutResult is the outcome of a fan-out on a single agent
+type FanoutResult struct {
+	FanoutID    string             `json:"fanout_id"`
+	AgentID     string             `json:"agent_id"`
+	Status      FanoutTargetStatus `json:"status"`
+	RequestID   string             `json:"request_id,omitempty"`
+	ExitCode    int32              `json:"exit_code"`
+	Stdout      string             `json:"stdout"`
+	Stderr      string             `json:"stderr"`
+	Error       string             `json:"error,omitempty"`
+	DurationMs  int64              `json:"duration_ms"`
+	StartedAt   *time.Time         `json:"started_at,omitempty"`
+	CompletedAt *time.Time         `json:"completed_at,omitempty"`
+}
+
+// FanoutSummary counts fan-out targets by outcome
+type FanoutSummary struct {
+	Total     int `json:"total"`
+	Succeeded int `json:"succeeded"`
+	Failed    int `json:"failed"`
+	TimedOut  int `json:"timed_out"`
+	Skipped   int `json:"skipped"`
+	Pending   int `json:"pending"` // not finished yet, including running targets
+}
+
+// Fanout is a command executed on several agents with bounded concurrency
+type Fanout struct {
+	ID             string            `json:"id"`
+	Command        string            `json:"command"`
+	Args           []string          `json:"args,omitempty"`
+	Env            map[string]string `json:"env,omitempty"`
+	WorkingDir     string            `json:"working_dir,omitempty"`
+	Selector       string            `json:"selector,omitempty"`
+	TimeoutSeconds int               `json:"timeout_seconds"` // per target
+	Concurrency    int               `json:"concurrency"`
+	MaxFailures    int               `json:"max_failures,omitempty"` // 0 means never stop early
+	Status         FanoutStatus      `json:"status"`
+	Results        []*FanoutResult   `json:"results"`
+	Summary        FanoutSummary     `json:"summary"`
+	CreatedAt      time.Time         `json:"created_at"`
+	CompletedAt    *time.Time        `json:"completed_at,omitempty"`
+}
+
+// IsFinished reports whether the target has reached a final state
+func (r *FanoutResult) IsFinished() bool {
+	return r.Status != FanoutTargetPending && r.Status != FanoutTargetRunning
+}
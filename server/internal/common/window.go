@@ -0,0 +1,36 @@
+package common
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ParseWindow parses a window such as "24h", "7d" or "90m"
+func ParseWindow(window string) (time.Duration, error) {
+	if days, found := strings.CutSuffix(window, "d"); found {
+		n, err := strconv.Atoi(days)
+		if err != nil || n <= 0 {
+			return 0, fmt.Errorf("invalid window %q", window)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+
+	duration, err := time.ParseDuration(window)
+	if err != nil || duration <= 0 {
+		return 0, fmt.Errorf("invalid window %q", window)
+	}
+	return duration, nil
+}
+
+// FormatWindow formats a window the way ParseWindow accepts it, e.g. "24h", "7d" or "1h30m0s"
+func FormatWindow(window time.Duration) string {
+	if window > 24*time.Hour && window%(24*time.Hour) == 0 {
+		return strconv.Itoa(int(window/(24*time.Hour))) + "d"
+	}
+	if window%time.Hour == 0 {
+		return strconv.Itoa(int(window/time.Hour)) + "h"
+	}
+	return window.String()
+}
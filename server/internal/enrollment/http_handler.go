@@ -0,0 +1,115 @@
+package enrollment
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mooncorn/nodelink/server/internal/common"
+)
+
+// HTTPHandler handles HTTP requests for enrollment tokens
+type HTTPHandler struct {
+	manager *Manager
+}
+
+// NewHTTPHandler creates a new HTTP handler for enrollment tokens
+func NewHTTPHandler(manager *Manager) *HTTPHandler {
+	return &HTTPHandler{
+		manager: manager,
+	}
+}
+
+// RegisterRoutes registers enrollment routes with the given router
+func (h *HTTPHandler) RegisterRoutes(router gin.IRouter) {
+	tokens := router.Group("/enrollment-tokens")
+	{
+		tokens.GET("", h.listTokens)
+		tokens.POST("", h.createToken)
+		tokens.DELETE("/:tokenId", h.revokeToken)
+	}
+}
+
+// CreateTokenRequest represents the request to mint an enrollment token
+type CreateTokenRequest struct {
+	AgentID    string `json:"agent_id,omitempty"`
+	TTLSeconds int    `json:"ttl_seconds,omitempty"`
+}
+
+// TokenResponse describes an enrollment token without its secret
+type TokenResponse struct {
+	ID        string    `json:"id"`
+	AgentID   string    `json:"agent_id,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// CreateTokenResponse carries the token secret, which is only ever shown once
+type CreateTokenResponse struct {
+	TokenResponse
+	Token string `json:"token"`
+}
+
+// listTokens handles GET /enrollment-tokens
+func (h *HTTPHandler) listTokens(c *gin.Context) {
+	tokens, err := h.manager.ListTokens()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	response := make([]TokenResponse, len(tokens))
+	for i, token := range tokens {
+		response[i] = toTokenResponse(token)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"tokens": response,
+		"count":  len(response),
+	})
+}
+
+// createToken handles POST /enrollment-tokens
+func (h *HTTPHandler) createToken(c *gin.Context) {
+	var req CreateTokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON body"})
+		return
+	}
+
+	token, secret, err := h.manager.CreateToken(req.AgentID, time.Duration(req.TTLSeconds)*time.Second)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, CreateTokenResponse{
+		TokenResponse: toTokenResponse(token),
+		Token:         secret,
+	})
+}
+
+// revokeToken handles DELETE /enrollment-tokens/:tokenId
+func (h *HTTPHandler) revokeToken(c *gin.Context) {
+	if err := h.manager.RevokeToken(c.Param("tokenId")); err != nil {
+		if errors.Is(err, common.ErrEnrollmentTokenNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Enrollment token not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Enrollment token revoked"})
+}
+
+// toTokenResponse strips the hash from an enrollment token
+func toTokenResponse(token *common.EnrollmentToken) TokenResponse {
+	return TokenResponse{
+		ID:        token.ID,
+		AgentID:   token.AgentID,
+		CreatedAt: token.CreatedAt,
+		ExpiresAt: token.ExpiresAt,
+	}
+}
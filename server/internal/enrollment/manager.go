@@ -0,0 +1,251 @@
+package enrollment
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mooncorn/nodelink/server/internal/auth"
+	"github.com/mooncorn/nodelink/server/internal/common"
+)
+
+// Manager mints enrollment tokens and exchanges them for agent credentials
+type Manager struct {
+	store       common.EnrollmentStore
+	credentials common.CredentialStore
+
+	// Serializes enrollments so two tokens can't claim the same agent ID
+	mu sync.Mutex
+}
+
+// NewManager creates a new enrollment manager
+func NewManager(store common.EnrollmentStore, credentials common.CredentialStore) *Manager {
+	return &Manager{
+		store:       store,
+		credentials: credentials,
+	}
+}
+
+// CreateToken mints a new single-use enrollment token. The plaintext token is only returned here.
+func (m *Manager) CreateToken(agentID string, ttl time.Duration) (*common.EnrollmentToken, string, error) {
+	if ttl <= 0 {
+		ttl = common.DefaultEnrollmentTokenTTL
+	}
+	if ttl > common.MaxEnrollmentTokenTTL {
+		ttl = common.MaxEnrollmentTokenTTL
+	}
+
+	secret, err := auth.GenerateToken()
+	if err != nil {
+		return nil, "", err
+	}
+
+	now := time.Now()
+	token := &common.EnrollmentToken{
+		ID:        uuid.New().String(),
+		TokenHash: hashEnrollmentToken(secret),
+		AgentID:   agentID,
+		CreatedAt: now,
+		ExpiresAt: now.Add(ttl),
+	}
+
+	if err := m.store.SaveEnrollmentToken(token); err != nil {
+		return nil, "", fmt.Errorf("failed to save enrollment token: %w", err)
+	}
+
+	return token, secret, nil
+}
+
+// ListTokens returns outstanding enrollment tokens, dropping expired ones and
+// used ones that can no longer be retried
+func (m *Manager) ListTokens() ([]*common.EnrollmentToken, error) {
+	tokens, err := m.store.ListEnrollmentTokens()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	active := make([]*common.EnrollmentToken, 0, len(tokens))
+	for _, token := range tokens {
+		if token.UsedAt != nil {
+			if now.After(token.UsedAt.Add(common.EnrollmentRetryWindow)) {
+				if err := m.store.DeleteEnrollmentToken(token.ID); err != nil {
+					log.Printf("Failed to delete used enrollment token %s: %v", token.ID, err)
+				}
+			}
+			continue
+		}
+		if now.After(token.ExpiresAt) {
+			if err := m.store.DeleteEnrollmentToken(token.ID); err != nil {
+				log.Printf("Failed to delete expired enrollment token %s: %v", token.ID, err)
+			}
+			continue
+		}
+		active = append(active, token)
+	}
+
+	return active, nil
+}
+
+// RevokeToken deletes an outstanding enrollment token
+func (m *Manager) RevokeToken(id string) error {
+	return m.store.DeleteEnrollmentToken(id)
+}
+
+// Enroll uses up an enrollment token and issues a long-lived credential for
+// the agent. The same agent may repeat the enrollment for EnrollmentRetryWindow,
+// e.g. when the response was lost, and gets a new credential replacing the
+// first one, which it never received. A retry must repeat the nonce of the
+// first request and is refused once the credential was used, rotated or revoked.
+func (m *Manager) Enroll(secret, requestedAgentID, hostname, nonce string) (string, string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	token, err := m.store.GetEnrollmentToken(hashEnrollmentToken(secret))
+	if err != nil {
+		return "", "", err
+	}
+
+	now := time.Now()
+	if token.UsedAt != nil {
+		if !m.canRetry(token, requestedAgentID, hostname, nonce, now) {
+			return "", "", common.ErrEnrollmentTokenNotFound
+		}
+
+		agentToken, credentialHash, err := m.saveCredential(token.UsedAgentID)
+		if err != nil {
+			return "", "", err
+		}
+
+		token.IssuedCredentialHash = credentialHash
+		if err := m.store.SaveEnrollmentToken(token); err != nil {
+			return "", "", fmt.Errorf("failed to save enrollment token: %w", err)
+		}
+
+		log.Printf("Agent %s repeated its enrollment with token %s", token.UsedAgentID, token.ID)
+		return token.UsedAgentID, agentToken, nil
+	}
+
+	if now.After(token.ExpiresAt) {
+		return "", "", common.ErrEnrollmentTokenExpired
+	}
+
+	agentID, agentToken, credentialHash, err := m.issueCredential(token, requestedAgentID, hostname)
+	if err != nil {
+		return "", "", err
+	}
+
+	token.UsedAt = &now
+	token.UsedAgentID = agentID
+	token.UsedHostname = hostname
+	token.IssuedCredentialHash = credentialHash
+	if nonce != "" {
+		token.UsedNonceHash = hashEnrollmentToken(nonce)
+	}
+	if err := m.store.SaveEnrollmentToken(token); err != nil {
+		return "", "", fmt.Errorf("failed to mark enrollment token as used: %w", err)
+	}
+
+	log.Printf("Agent %s enrolled with token %s", agentID, token.ID)
+	return agentID, agentToken, nil
+}
+
+// canRetry reports whether a used token may be exchanged again: by the same
+// agent, within the retry window, and only while the credential it was issued
+// is still unused and neither rotated nor revoked
+func (m *Manager) canRetry(token *common.EnrollmentToken, requestedAgentID, hostname, nonce string, now time.Time) bool {
+	if now.After(token.UsedAt.Add(common.EnrollmentRetryWindow)) ||
+		agentIDFor(token, requestedAgentID, hostname) != token.UsedAgentID ||
+		hostname != token.UsedHostname {
+		return false
+	}
+
+	// Agents that sent no nonce can't prove they are the same, so they never retry
+	if token.UsedNonceHash == "" || nonce == "" ||
+		subtle.ConstantTimeCompare([]byte(hashEnrollmentToken(nonce)), []byte(token.UsedNonceHash)) != 1 {
+		return false
+	}
+
+	credential, err := m.credentials.GetCredential(token.UsedAgentID)
+	if err != nil {
+		return false
+	}
+	return credential.TokenHash == token.IssuedCredentialHash &&
+		credential.AuthenticatedAt == nil &&
+		credential.RevokedAt == nil &&
+		credential.RotatedAt == nil
+}
+
+// issueCredential picks the agent ID and stores a freshly generated credential
+// for it. It returns the agent ID, the token and its hash.
+func (m *Manager) issueCredential(token *common.EnrollmentToken, requestedAgentID, hostname string) (string, string, string, error) {
+	agentID := agentIDFor(token, requestedAgentID, hostname)
+	if agentID == "" {
+		return "", "", "", common.ErrMissingAgentID
+	}
+
+	existing, err := m.credentials.GetCredential(agentID)
+	if err != nil && !errors.Is(err, common.ErrCredentialNotFound) {
+		return "", "", "", err
+	}
+	if existing != nil && existing.RevokedAt == nil {
+		return "", "", "", common.ErrAgentAlreadyEnrolled
+	}
+
+	agentToken, credentialHash, err := m.saveCredential(agentID)
+	if err != nil {
+		return "", "", "", err
+	}
+
+	return agentID, agentToken, credentialHash, nil
+}
+
+// agentIDFor picks the ID an agent enrolls under. A token bound to an agent
+// ID wins over whatever the agent asks for, which falls back to its hostname.
+func agentIDFor(token *common.EnrollmentToken, requestedAgentID, hostname string) string {
+	if token.AgentID != "" {
+		return token.AgentID
+	}
+	if requestedAgentID != "" {
+		return requestedAgentID
+	}
+	return hostname
+}
+
+// saveCredential stores a freshly generated credential for an agent and
+// returns its token and the token's hash
+func (m *Manager) saveCredential(agentID string) (string, string, error) {
+	agentToken, err := auth.GenerateToken()
+	if err != nil {
+		return "", "", err
+	}
+
+	hash, err := auth.HashToken(agentToken)
+	if err != nil {
+		return "", "", err
+	}
+
+	err = m.credentials.SaveCredential(&common.AgentCredential{
+		AgentID:   agentID,
+		TokenHash: hash,
+		CreatedAt: time.Now(),
+	})
+	if err != nil {
+		return "", "", fmt.Errorf("failed to save credential: %w", err)
+	}
+
+	return agentToken, hash, nil
+}
+
+// hashEnrollmentToken hashes an enrollment token for lookup. Tokens are random,
+// so a fast unsalted hash is enough to keep them out of the database.
+func hashEnrollmentToken(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
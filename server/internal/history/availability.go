@@ -0,0 +1,111 @@
+package history
+
+import (
+	"time"
+
+	"github.com/mooncorn/nodelink/server/internal/common"
+)
+
+// Compute derives availability between start and end from chronologically
+// ordered transitions. Time before the first known status is left out, so an
+// agent added during the window is measured from when it was first seen.
+func Compute(transitions []*common.StatusTransition, start, end time.Time) *common.Availability {
+	availability := &common.Availability{}
+
+	var (
+		status      common.AgentStatus
+		cursor      time.Time
+		known       bool
+		outageStart time.Time
+		downtime    time.Duration
+		uptime      time.Duration
+		failures    int
+		longest     time.Duration
+	)
+
+	// closeSegment accounts for the time from the cursor up to t in the current status
+	closeSegment := func(t time.Time) {
+		if !known || !t.After(cursor) {
+			return
+		}
+		if isUp(status) {
+			uptime += t.Sub(cursor)
+		} else {
+			downtime += t.Sub(cursor)
+		}
+		cursor = t
+	}
+
+	// endOutage records an outage that lasted until t
+	endOutage := func(t time.Time) {
+		if outage := t.Sub(outageStart); outage > longest {
+			longest = outage
+		}
+	}
+
+	for _, transition := range transitions {
+		if transition.Timestamp.After(end) {
+			break
+		}
+
+		// Transitions up to the start only establish the starting status
+		if !transition.Timestamp.After(start) {
+			status, cursor, known = transition.To, start, true
+			availability.Outages = 0
+			if !isUp(status) {
+				availability.Outages = 1
+				outageStart = start
+			}
+			continue
+		}
+
+		// Without an earlier status, measuring starts at the first transition
+		if !known {
+			status, cursor, known = transition.From, transition.Timestamp, true
+			outageStart = cursor
+		}
+
+		closeSegment(transition.Timestamp)
+
+		wasUp, nowUp := isUp(status), isUp(transition.To)
+		switch {
+		case wasUp && !nowUp:
+			failures++
+			availability.Outages++
+			outageStart = transition.Timestamp
+		case !wasUp && nowUp:
+			endOutage(transition.Timestamp)
+		}
+
+		status = transition.To
+	}
+
+	closeSegment(end)
+	if known && !isUp(status) {
+		// An outage still in progress counts up to now
+		endOutage(end)
+	}
+
+	covered := uptime + downtime
+	availability.CoveredSeconds = covered.Seconds()
+	availability.UptimeSeconds = uptime.Seconds()
+	availability.LongestOutageSeconds = longest.Seconds()
+	if covered > 0 {
+		availability.UptimePercent = float64(uptime) / float64(covered) * 100
+	}
+	if failures > 0 {
+		mtbf := uptime.Seconds() / float64(failures)
+		availability.MTBFSeconds = &mtbf
+	}
+	if availability.Outages > 0 {
+		mttr := downtime.Seconds() / float64(availability.Outages)
+		availability.MTTRSeconds = &mttr
+	}
+
+	return availability
+}
+
+// isUp reports whether a status counts as available
+func isUp(status common.AgentStatus) bool {
+	return status.IsAvailable()
+}
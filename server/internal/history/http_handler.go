@@ -0,0 +1,123 @@
+package history
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mooncorn/nodelink/server/internal/common"
+)
+
+// HTTPHandler handles HTTP requests for agent status history
+type HTTPHandler struct {
+	recorder      *Recorder
+	statusManager common.StatusManager
+}
+
+// NewHTTPHandler creates a new HTTP handler for status history
+func NewHTTPHandler(recorder *Recorder, statusManager common.StatusManager) *HTTPHandler {
+	return &HTTPHandler{
+		recorder:      recorder,
+		statusManager: statusManager,
+	}
+}
+
+// RegisterRoutes registers status history routes
+func (h *HTTPHandler) RegisterRoutes(router gin.IRouter) {
+	router.GET("/agents/:agentId/history", h.getHistory)
+	router.GET("/agents/:agentId/availability", h.getAvailability)
+}
+
+// getHistory handles GET /agents/:agentId/history?since=7d&limit=100
+func (h *HTTPHandler) getHistory(c *gin.Context) {
+	agentID := c.Param("agentId")
+	agent, exists := h.statusManager.GetAgent(agentID)
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{"error": "agent not found"})
+		return
+	}
+
+	since := time.Now().Add(-common.StatusHistoryRetention)
+	if value := c.Query("since"); value != "" {
+		window, err := common.ParseWindow(value)
+		if err != nil {
+			// Also accept an absolute time
+			since, err = time.Parse(time.RFC3339, value)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "since must be a window like 24h or 7d, or an RFC 3339 time"})
+				return
+			}
+		} else {
+			since = time.Now().Add(-window)
+		}
+	}
+
+	limit := 0
+	if value := c.Query("limit"); value != "" {
+		var err error
+		limit, err = strconv.Atoi(value)
+		if err != nil || limit < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid limit"})
+			return
+		}
+	}
+
+	transitions, err := h.recorder.History(agentID, since, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	availability, err := h.recorder.Availability(agentID, Windows)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"agent_id":     agentID,
+		"status":       agent.Status,
+		"transitions":  transitions,
+		"count":        len(transitions),
+		"availability": availability,
+	})
+}
+
+// getAvailability handles GET /agents/:agentId/availability?windows=24h,7d,30d
+func (h *HTTPHandler) getAvailability(c *gin.Context) {
+	agentID := c.Param("agentId")
+	if _, exists := h.statusManager.GetAgent(agentID); !exists {
+		c.JSON(http.StatusNotFound, gin.H{"error": "agent not found"})
+		return
+	}
+
+	windows := Windows
+	if value := c.Query("windows"); value != "" {
+		windows = nil
+		for _, part := range strings.Split(value, ",") {
+			window, err := common.ParseWindow(strings.TrimSpace(part))
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			if window > common.StatusHistoryRetention {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Windows longer than the retained history are not supported"})
+				return
+			}
+			windows = append(windows, window)
+		}
+	}
+
+	availability, err := h.recorder.Availability(agentID, windows)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"agent_id":     agentID,
+		"availability": availability,
+	})
+}
@@ -0,0 +1,132 @@
+package history
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/mooncorn/nodelink/server/internal/common"
+)
+
+// Windows are the periods availability is reported for by default
+var Windows = []time.Duration{24 * time.Hour, 7 * 24 * time.Hour, 30 * 24 * time.Hour}
+
+// Recorder keeps a bounded, persistent history of agent status transitions
+type Recorder struct {
+	store     common.HistoryStore
+	limit     int
+	retention time.Duration
+
+	mu sync.Mutex // serializes appends, listeners are notified concurrently
+}
+
+// NewRecorder creates a new status history recorder
+func NewRecorder(store common.HistoryStore) *Recorder {
+	return &Recorder{
+		store:     store,
+		limit:     common.MaxStatusHistory,
+		retention: common.StatusHistoryRetention,
+	}
+}
+
+// OnStatusChange records a status transition
+func (r *Recorder) OnStatusChange(event common.StatusChangeEvent) {
+	r.record(&common.StatusTransition{
+		AgentID:   event.AgentID,
+		From:      event.OldStatus,
+		To:        event.NewStatus,
+		Timestamp: event.Timestamp,
+	})
+}
+
+// Reconcile closes periods left open by a server shutdown. Agents whose last
+// recorded status was not offline are marked offline as of when they were
+// last seen, since nothing is known about them while the server was down.
+func (r *Recorder) Reconcile(agents []*common.AgentInfo) {
+	for _, agent := range agents {
+		transitions, err := r.store.LoadTransitions(agent.AgentID, time.Now())
+		if err != nil {
+			log.Printf("Failed to load status history of agent %s: %v", agent.AgentID, err)
+			continue
+		}
+		if len(transitions) == 0 {
+			continue
+		}
+
+		last := transitions[len(transitions)-1]
+		if last.To == common.AgentStatusOffline {
+			continue
+		}
+
+		at := agent.LastSeen
+		if at.Before(last.Timestamp) {
+			at = last.Timestamp
+		}
+		r.record(&common.StatusTransition{
+			AgentID:   agent.AgentID,
+			From:      last.To,
+			To:        common.AgentStatusOffline,
+			Timestamp: at,
+		})
+	}
+}
+
+// History returns an agent's transitions since the given time, newest first,
+// limited to the given number if it is positive
+func (r *Recorder) History(agentID string, since time.Time, limit int) ([]*common.StatusTransition, error) {
+	transitions, err := r.store.LoadTransitions(agentID, since)
+	if err != nil {
+		return nil, err
+	}
+
+	// Drop the transition from before the period that tells the starting status
+	if len(transitions) > 0 && transitions[0].Timestamp.Before(since) {
+		transitions = transitions[1:]
+	}
+
+	history := make([]*common.StatusTransition, 0, len(transitions))
+	for i := len(transitions) - 1; i >= 0; i-- {
+		if limit > 0 && len(history) == limit {
+			break
+		}
+		history = append(history, transitions[i])
+	}
+
+	return history, nil
+}
+
+// Availability computes an agent's availability over each of the given windows ending now
+func (r *Recorder) Availability(agentID string, windows []time.Duration) ([]*common.Availability, error) {
+	now := time.Now()
+
+	longest := time.Duration(0)
+	for _, window := range windows {
+		if window > longest {
+			longest = window
+		}
+	}
+
+	transitions, err := r.store.LoadTransitions(agentID, now.Add(-longest))
+	if err != nil {
+		return nil, err
+	}
+
+	availability := make([]*common.Availability, len(windows))
+	for i, window := range windows {
+		availability[i] = Compute(transitions, now.Add(-window), now)
+		availability[i].Window = common.FormatWindow(window)
+	}
+
+	return availability, nil
+}
+
+// record appends a transition to the store
+func (r *Recorder) record(transition *common.StatusTransition) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	before := time.Now().Add(-r.retention)
+	if err := r.store.AppendTransition(transition, r.limit, before); err != nil {
+		log.Printf("Failed to record status transition of agent %s: %v", transition.AgentID, err)
+	}
+}
@@ -0,0 +1,290 @@
+package labels
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Operator is the comparison a requirement applies to a label
+type Operator string
+
+const (
+	Equals       Operator = "="
+	NotEquals    Operator = "!="
+	In           Operator = "in"
+	NotIn        Operator = "notin"
+	Exists       Operator = "exists"
+	DoesNotExist Operator = "!"
+)
+
+// Requirement is a single condition of a selector, e.g. "env in (prod,staging)"
+type Requirement struct {
+	Key      string
+	Operator Operator
+	Values   []string
+}
+
+// Selector is a set of requirements that must all match. The syntax follows
+// Kubernetes label selectors:
+//
+//	env=prod,tier!=db,region in (eu,us),!canary,gpu
+type Selector []Requirement
+
+// Parse parses a comma-separated list of requirements. An empty string
+// selects everything.
+func Parse(selector string) (Selector, error) {
+	var result Selector
+
+	for _, part := range splitRequirements(selector) {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			return nil, fmt.Errorf("invalid selector %q: empty requirement", selector)
+		}
+
+		requirement, err := parseRequirement(part)
+		if err != nil {
+			return nil, fmt.Errorf("invalid selector %q: %w", selector, err)
+		}
+		result = append(result, requirement)
+	}
+
+	return result, nil
+}
+
+// Empty reports whether the selector matches everything
+func (s Selector) Empty() bool {
+	return len(s) == 0
+}
+
+// Matches reports whether the given labels satisfy every requirement
+func (s Selector) Matches(labels map[string]string) bool {
+	for _, requirement := range s {
+		if !requirement.Matches(labels) {
+			return false
+		}
+	}
+	return true
+}
+
+// String returns the selector in its canonical form
+func (s Selector) String() string {
+	parts := make([]string, len(s))
+	for i, requirement := range s {
+		parts[i] = requirement.String()
+	}
+	return strings.Join(parts, ",")
+}
+
+// Matches reports whether the given labels satisfy the requirement
+func (r Requirement) Matches(labels map[string]string) bool {
+	value, exists := labels[r.Key]
+
+	switch r.Operator {
+	case Exists:
+		return exists
+	case DoesNotExist:
+		return !exists
+	case Equals, In:
+		return exists && contains(r.Values, value)
+	case NotEquals, NotIn:
+		// Like Kubernetes, a missing label satisfies != and notin
+		return !exists || !contains(r.Values, value)
+	default:
+		return false
+	}
+}
+
+// String returns the requirement in selector syntax
+func (r Requirement) String() string {
+	switch r.Operator {
+	case Exists:
+		return r.Key
+	case DoesNotExist:
+		return "!" + r.Key
+	case In, NotIn:
+		return fmt.Sprintf("%s %s (%s)", r.Key, r.Operator, strings.Join(r.Values, ","))
+	default:
+		return r.Key + string(r.Operator) + r.Values[0]
+	}
+}
+
+// ValidateKey checks that a label key is usable in selectors
+func ValidateKey(key string) error {
+	if key == "" {
+		return fmt.Errorf("label key must not be empty")
+	}
+	if len(key) > 253 {
+		return fmt.Errorf("label key %q is longer than 253 characters", key)
+	}
+	if !validChars(key, "._-/") {
+		return fmt.Errorf("label key %q may only contain letters, digits, '.', '_', '-' and '/'", key)
+	}
+	return nil
+}
+
+// ValidateValue checks that a label value is usable in selectors
+func ValidateValue(value string) error {
+	if len(value) > 63 {
+		return fmt.Errorf("label value %q is longer than 63 characters", value)
+	}
+	if !validChars(value, "._-") {
+		return fmt.Errorf("label value %q may only contain letters, digits, '.', '_' and '-'", value)
+	}
+	return nil
+}
+
+// parseRequirement parses one requirement of a selector
+func parseRequirement(part string) (Requirement, error) {
+	// !key
+	if strings.HasPrefix(part, "!") && !strings.Contains(part, "=") {
+		key := strings.TrimSpace(part[1:])
+		if err := ValidateKey(key); err != nil {
+			return Requirement{}, err
+		}
+		return Requirement{Key: key, Operator: DoesNotExist}, nil
+	}
+
+	// key in (a,b) / key notin (a,b)
+	if open := strings.Index(part, "("); open >= 0 {
+		fields := strings.Fields(part[:open])
+		if len(fields) != 2 || (fields[1] != string(In) && fields[1] != string(NotIn)) {
+			return Requirement{}, fmt.Errorf("expected \"key in (...)\" or \"key notin (...)\" in %q", part)
+		}
+		if !strings.HasSuffix(part, ")") {
+			return Requirement{}, fmt.Errorf("missing closing parenthesis in %q", part)
+		}
+		if err := ValidateKey(fields[0]); err != nil {
+			return Requirement{}, err
+		}
+
+		var values []string
+		for _, value := range strings.Split(part[open+1:len(part)-1], ",") {
+			value = strings.TrimSpace(value)
+			if err := ValidateValue(value); err != nil {
+				return Requirement{}, err
+			}
+			values = append(values, value)
+		}
+		sort.Strings(values)
+
+		return Requirement{Key: fields[0], Operator: Operator(fields[1]), Values: values}, nil
+	}
+
+	// key!=value, key==value, key=value
+	for _, op := range []string{"!=", "==", "="} {
+		index := strings.Index(part, op)
+		if index < 0 {
+			continue
+		}
+
+		key := strings.TrimSpace(part[:index])
+		value := strings.TrimSpace(part[index+len(op):])
+		if err := ValidateKey(key); err != nil {
+			return Requirement{}, err
+		}
+		if err := ValidateValue(value); err != nil {
+			return Requirement{}, err
+		}
+
+		operator := Equals
+		if op == "!=" {
+			operator = NotEquals
+		}
+		return Requirement{Key: key, Operator: operator, Values: []string{value}}, nil
+	}
+
+	// key
+	if err := ValidateKey(part); err != nil {
+		return Requirement{}, err
+	}
+	return Requirement{Key: part, Operator: Exists}, nil
+}
+
+// splitRequirements splits a selector on commas outside of parentheses
+func splitRequirements(selector string) []string {
+	if strings.TrimSpace(selector) == "" {
+		return nil
+	}
+
+	var parts []string
+	depth, start := 0, 0
+	for i, char := range selector {
+		switch char {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ',':
+			if depth == 0 {
+				parts = append(parts, selector[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(parts, selector[start:])
+}
+
+// validChars reports whether s consists of ASCII letters, digits and the given extra characters
+func validChars(s, extra string) bool {
+	for _, char := range s {
+		switch {
+		case char >= 'a' && char <= 'z', char >= 'A' && char <= 'Z', char >= '0' && char <= '9':
+		case strings.ContainsRune(extra, char):
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// contains reports whether values contains value
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseSet parses a comma-separated list of key=value pairs, e.g. "env=prod,role=db"
+func ParseSet(set string) (map[string]string, error) {
+	result := make(map[string]string)
+
+	for _, pair := range strings.Split(set, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+
+		key, value, found := strings.Cut(pair, "=")
+		if !found {
+			return nil, fmt.Errorf("invalid label %q: expected key=value", pair)
+		}
+
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+		if err := ValidateKey(key); err != nil {
+			return nil, err
+		}
+		if err := ValidateValue(value); err != nil {
+			return nil, err
+		}
+		result[key] = value
+	}
+
+	return result, nil
+}
+
+// Validate checks every key and value of a label set
+func Validate(set map[string]string) error {
+	for key, value := range set {
+		if err := ValidateKey(key); err != nil {
+			return err
+		}
+		if err := ValidateValue(value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -18,6 +18,10 @@ type Handler struct {
 	streamSender  common.StreamSender
 	mu            sync.RWMutex
 	requests      map[string]*MetricsRequest
+
+	// Agents pushing metrics and where their pushes go
+	subscriptions map[string]*subscription
+	pushListener  PushListener
 }
 
 // MetricsRequest tracks a pending metrics request
@@ -41,6 +45,7 @@ func NewHandler(statusManager common.StatusManager) *Handler {
 	return &Handler{
 		statusManager: statusManager,
 		requests:      make(map[string]*MetricsRequest),
+		subscriptions: make(map[string]*subscription),
 	}
 }
 
@@ -219,6 +224,14 @@ func (h *Handler) CleanupExpiredRequests() {
 	}
 }
 
+// PendingRequests returns the number of requests waiting for an agent's response
+func (h *Handler) PendingRequests() int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	return len(h.requests)
+}
+
 // Start starts the cleanup routine
 func (h *Handler) Start(ctx context.Context) {
 	ticker := time.NewTicker(30 * time.Second)
@@ -0,0 +1,309 @@
+package metrics
+
+import (
+	"context"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mooncorn/nodelink/server/internal/common"
+	pb "github.com/mooncorn/nodelink/server/internal/proto"
+)
+
+// rawResolution names the samples as they were polled
+const rawResolution = "raw"
+
+// resolution is a granularity metrics are stored at
+type resolution struct {
+	name      string
+	step      time.Duration
+	retention time.Duration
+}
+
+// rollups are the coarser resolutions samples are summarized at, each built
+// from the one before it
+var rollups = []resolution{
+	{name: "1m", step: time.Minute, retention: 7 * 24 * time.Hour},
+	{name: "5m", step: 5 * time.Minute, retention: 30 * 24 * time.Hour},
+	{name: "1h", step: time.Hour, retention: 365 * 24 * time.Hour},
+}
+
+// History keeps a persistent time series of the metrics polled from agents:
+// the raw samples for a limited time and rollups with the average, minimum
+// and maximum of each series for longer
+type History struct {
+	store        common.MetricsStore
+	rawRetention time.Duration
+}
+
+// NewHistory creates a metrics history keeping raw samples for rawRetention
+func NewHistory(store common.MetricsStore, rawRetention time.Duration) *History {
+	return &History{
+		store:        store,
+		rawRetention: rawRetention,
+	}
+}
+
+// Start rolls up and expires stored metrics periodically until the context is done
+func (h *History) Start(ctx context.Context) {
+	ticker := time.NewTicker(common.MetricsRollupInterval)
+	defer ticker.Stop()
+
+	h.compact(time.Now())
+	for {
+		select {
+		case now := <-ticker.C:
+			h.compact(now)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Record stores a sample of an agent's metrics taken at the given time
+func (h *History) Record(agentID string, metrics *pb.SystemMetrics, at time.Time) {
+	values := make(map[string]common.MetricValue)
+	for name, value := range seriesValues(metrics) {
+		values[name] = common.MetricValue{Avg: value, Min: value, Max: value, Count: 1}
+	}
+
+	point := &common.MetricPoint{Timestamp: at, Values: values}
+	if err := h.store.SaveMetricPoints(agentID, rawResolution, []*common.MetricPoint{point}); err != nil {
+		log.Printf("Failed to record metrics of agent %s: %v", agentID, err)
+	}
+}
+
+// Range returns an agent's series between from and to, one point per step.
+// It reads the coarsest resolution that is at least as fine as the step and
+// still reaches back to from, and picks the step itself if it is zero. Only
+// the named series are returned if any are given; a name without a colon
+// also selects its per-device series, e.g. disk selects disk:/.
+func (h *History) Range(agentID string, from, to time.Time, step time.Duration, series []string) (*common.MetricRange, error) {
+	res := h.resolutionFor(from, to, step)
+	if step < res.step {
+		step = res.step
+	}
+	if to.Sub(from)/step > common.MaxMetricRangePoints {
+		return nil, common.ErrMetricRangeTooLarge
+	}
+
+	// Include the rollup whose window contains from
+	start := from
+	if res.name != rawResolution {
+		start = from.Truncate(res.step)
+	}
+	points, err := h.store.LoadMetricPoints(agentID, res.name, start, to)
+	if err != nil {
+		return nil, err
+	}
+	if step > res.step {
+		points = downsample(points, step)
+	}
+
+	result := &common.MetricRange{
+		AgentID:     agentID,
+		From:        from,
+		To:          to,
+		StepSeconds: step.Seconds(),
+		Resolution:  res.name,
+		Series:      make(map[string][]common.MetricRangePoint),
+	}
+	for _, point := range points {
+		for name, value := range point.Values {
+			if !selected(name, series) {
+				continue
+			}
+			result.Series[name] = append(result.Series[name], common.MetricRangePoint{
+				Timestamp: point.Timestamp,
+				Avg:       value.Avg,
+				Min:       value.Min,
+				Max:       value.Max,
+			})
+		}
+	}
+
+	return result, nil
+}
+
+// resolutions returns every resolution from finest to coarsest
+func (h *History) resolutions() []resolution {
+	raw := resolution{name: rawResolution, step: common.DefaultMetricsInterval, retention: h.rawRetention}
+	return append([]resolution{raw}, rollups...)
+}
+
+// resolutionFor picks the resolution to answer a range query from
+func (h *History) resolutionFor(from, to time.Time, step time.Duration) resolution {
+	resolutions := h.resolutions()
+
+	// Finer resolutions may have expired by from
+	now := time.Now()
+	candidates := resolutions[len(resolutions)-1:]
+	for i, res := range resolutions {
+		if !from.Before(now.Add(-res.retention)) {
+			candidates = resolutions[i:]
+			break
+		}
+	}
+
+	if step > 0 {
+		chosen := candidates[0]
+		for _, res := range candidates {
+			if res.step <= step {
+				chosen = res
+			}
+		}
+		return chosen
+	}
+
+	for _, res := range candidates {
+		if to.Sub(from)/res.step <= common.MaxMetricRangePoints {
+			return res
+		}
+	}
+	return candidates[len(candidates)-1]
+}
+
+// compact rolls up the windows that ended since the last run and drops the
+// points that are past their retention
+func (h *History) compact(now time.Time) {
+	agentIDs, err := h.store.MetricAgents()
+	if err != nil {
+		log.Printf("Failed to list agents with metrics: %v", err)
+		return
+	}
+
+	for _, agentID := range agentIDs {
+		source := rawResolution
+		for _, res := range rollups {
+			if err := h.rollUp(agentID, source, res, now); err != nil {
+				log.Printf("Failed to roll up %s metrics of agent %s: %v", res.name, agentID, err)
+				break
+			}
+			source = res.name
+		}
+	}
+
+	for _, res := range h.resolutions() {
+		if err := h.store.DeleteMetricPoints(res.name, now.Add(-res.retention)); err != nil {
+			log.Printf("Failed to expire %s metrics: %v", res.name, err)
+		}
+	}
+}
+
+// rollUp summarizes an agent's points at the source resolution into every
+// complete window of the target resolution that hasn't been rolled up yet
+func (h *History) rollUp(agentID, source string, target resolution, now time.Time) error {
+	end := now.Add(-common.MetricsRollupDelay).Truncate(target.step)
+	from := now.Add(-target.retention).Truncate(target.step)
+
+	last, err := h.store.LastMetricPoint(agentID, target.name)
+	if err != nil {
+		return err
+	}
+	if last != nil && last.Timestamp.Add(target.step).After(from) {
+		from = last.Timestamp.Add(target.step)
+	}
+	if !from.Before(end) {
+		return nil
+	}
+
+	points, err := h.store.LoadMetricPoints(agentID, source, from, end)
+	if err != nil {
+		return err
+	}
+	if len(points) == 0 {
+		return nil
+	}
+
+	return h.store.SaveMetricPoints(agentID, target.name, downsample(points, target.step))
+}
+
+// downsample merges chronological points into one per window of the given
+// step, each timestamped with the start of its window
+func downsample(points []*common.MetricPoint, step time.Duration) []*common.MetricPoint {
+	var windows []*common.MetricPoint
+
+	for _, point := range points {
+		start := point.Timestamp.Truncate(step)
+
+		var window *common.MetricPoint
+		if len(windows) > 0 && windows[len(windows)-1].Timestamp.Equal(start) {
+			window = windows[len(windows)-1]
+		} else {
+			window = &common.MetricPoint{Timestamp: start, Values: make(map[string]common.MetricValue)}
+			windows = append(windows, window)
+		}
+
+		for name, value := range point.Values {
+			merged := window.Values[name]
+			merged.Merge(value)
+			window.Values[name] = merged
+		}
+	}
+
+	return windows
+}
+
+// seriesValues extracts the series recorded from a metrics sample
+func seriesValues(metrics *pb.SystemMetrics) map[string]float64 {
+	values := map[string]float64{
+		"cpu":    metrics.GetCpuUsagePercent(),
+		"load1":  metrics.GetLoadAverage_1M(),
+		"load5":  metrics.GetLoadAverage_5M(),
+		"load15": metrics.GetLoadAverage_15M(),
+	}
+
+	for core, usage := range metrics.GetCpuCoreUsagePercent() {
+		values["cpu_core:"+strconv.Itoa(core)] = usage
+	}
+	if times := metrics.GetCpuTimes(); times != nil {
+		values["cpu_user"] = times.GetUser()
+		values["cpu_system"] = times.GetSystem()
+		values["cpu_iowait"] = times.GetIowait()
+		values["cpu_steal"] = times.GetSteal()
+	}
+
+	if pressure := metrics.GetPressure(); pressure != nil {
+		values["psi_cpu"] = pressure.GetCpu().GetSome().GetAvg10()
+		values["psi_memory"] = pressure.GetMemory().GetSome().GetAvg10()
+		values["psi_io"] = pressure.GetIo().GetSome().GetAvg10()
+	}
+
+	if memory := metrics.GetMemory(); memory != nil {
+		values["mem"] = memory.GetUsedPercent()
+		values["mem_used"] = float64(memory.GetUsed())
+		values["mem_available"] = float64(memory.GetAvailable())
+	}
+
+	for _, disk := range metrics.GetDisks() {
+		values["disk:"+disk.GetMountpoint()] = disk.GetUsedPercent()
+	}
+
+	for _, network := range metrics.GetNetworkInterfaces() {
+		values["net_rx:"+network.GetInterface()] = network.GetBytesRecvPerSec()
+		values["net_tx:"+network.GetInterface()] = network.GetBytesSentPerSec()
+	}
+
+	for _, diskIO := range metrics.GetDiskIo() {
+		values["disk_read:"+diskIO.GetDevice()] = diskIO.GetReadBytesPerSec()
+		values["disk_write:"+diskIO.GetDevice()] = diskIO.GetWriteBytesPerSec()
+		values["disk_util:"+diskIO.GetDevice()] = diskIO.GetUtilPercent()
+	}
+
+	return values
+}
+
+// selected reports whether a series is among the requested ones
+func selected(name string, series []string) bool {
+	if len(series) == 0 {
+		return true
+	}
+
+	for _, requested := range series {
+		if name == requested || strings.HasPrefix(name, requested+":") {
+			return true
+		}
+	}
+	return false
+}
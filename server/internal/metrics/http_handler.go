@@ -1,11 +1,17 @@
 package metrics
 
 import (
+	"context"
+	"errors"
 	"net/http"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/mooncorn/nodelink/server/internal/common"
+	"github.com/mooncorn/nodelink/server/internal/labels"
 )
 
 // HTTPHandler handles HTTP requests for metrics
@@ -13,51 +19,215 @@ type HTTPHandler struct {
 	handler          *Handler
 	sseManager       common.SSEManager
 	streamingManager *StreamingManager
+	history          *History
 }
 
 // NewHTTPHandler creates a new HTTP handler for metrics
-func NewHTTPHandler(handler *Handler, sseManager common.SSEManager, streamingManager *StreamingManager) *HTTPHandler {
+func NewHTTPHandler(handler *Handler, sseManager common.SSEManager, streamingManager *StreamingManager, history *History) *HTTPHandler {
 	return &HTTPHandler{
 		handler:          handler,
 		sseManager:       sseManager,
 		streamingManager: streamingManager,
+		history:          history,
 	}
 }
 
 // RegisterRoutes registers the metrics routes
 func (h *HTTPHandler) RegisterRoutes(router *gin.Engine) {
+	router.GET("/metrics", h.getSelectedSystemInfo)
 	router.GET("/metrics/:agentID", h.getSystemInfo)
+	router.GET("/metrics/:agentID/range", h.getRange)
 }
 
 // getSystemInfo handles GET /metrics/:agentID
 func (h *HTTPHandler) getSystemInfo(c *gin.Context) {
 	agentID := c.Param("agentID")
 
-	// Check if agent exists and is online
-	if !h.handler.statusManager.IsAgentOnline(agentID) {
-		c.JSON(http.StatusNotFound, gin.H{
-			"error": "Agent not found or offline",
+	response, err := h.systemInfo(c.Request.Context(), agentID)
+	if err != nil {
+		if err == common.ErrAgentNotFound {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": "Agent not found or offline",
+			})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
 		})
 		return
 	}
 
+	c.JSON(http.StatusOK, response)
+}
+
+// getSelectedSystemInfo handles GET /metrics?selector=env=prod, returning the
+// system info of every matching agent. Agents whose info can't be fetched are
+// reported with an error instead of failing the whole request.
+func (h *HTTPHandler) getSelectedSystemInfo(c *gin.Context) {
+	selector, err := labels.Parse(c.Query("selector"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	// Ask the agents in parallel, a limited number at a time
+	selected := h.handler.statusManager.SelectAgents(selector)
+	responses := make([]gin.H, len(selected))
+	semaphore := make(chan struct{}, common.SystemInfoConcurrency)
+	var wg sync.WaitGroup
+	for i, agent := range selected {
+		wg.Add(1)
+		semaphore <- struct{}{}
+		go func(i int, agentID string) {
+			defer wg.Done()
+			defer func() { <-semaphore }()
+
+			response, err := h.systemInfo(c.Request.Context(), agentID)
+			if err != nil {
+				// Offline agents that never reported system info have nothing to show
+				if err == common.ErrAgentNotFound {
+					return
+				}
+				response = gin.H{
+					"agent_id": agentID,
+					"error":    err.Error(),
+				}
+			}
+			responses[i] = response
+		}(i, agent.AgentID)
+	}
+	wg.Wait()
+
+	agents := make([]gin.H, 0, len(responses))
+	for _, response := range responses {
+		if response != nil {
+			agents = append(agents, response)
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"agents": agents,
+		"count":  len(agents),
+	})
+}
+
+// systemInfo returns the system info of an agent, falling back to the last
+// known info for offline agents. It returns ErrAgentNotFound if there is none.
+func (h *HTTPHandler) systemInfo(ctx context.Context, agentID string) (gin.H, error) {
+	// Check if agent exists and is online
+	if !h.handler.statusManager.IsAgentOnline(agentID) {
+		// Fall back to the last known system info for offline agents
+		if agent, exists := h.handler.statusManager.GetAgent(agentID); exists && agent.SystemInfo != nil {
+			return gin.H{
+				"agent_id":    agentID,
+				"system_info": agent.SystemInfo,
+				"timestamp":   agent.LastSeen.Unix(),
+				"stale":       true,
+			}, nil
+		}
+
+		return nil, common.ErrAgentNotFound
+	}
+
 	// Try to get cached system info first
 	systemInfo, exists := h.streamingManager.GetCachedSystemInfo(agentID)
 	if !exists {
 		// If not cached, request it directly
 		var err error
-		systemInfo, err = h.handler.RequestSystemInfo(c.Request.Context(), agentID)
+		systemInfo, err = h.handler.RequestSystemInfo(ctx, agentID)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{
-				"error": err.Error(),
-			})
-			return
+			return nil, err
 		}
 	}
 
-	c.JSON(http.StatusOK, gin.H{
+	return gin.H{
 		"agent_id":    agentID,
 		"system_info": systemInfo,
 		"timestamp":   time.Now().Unix(),
-	})
+	}, nil
+}
+
+// getRange handles GET /metrics/:agentID/range?from=6h&to=&step=1m&series=cpu,mem.
+// Times are RFC 3339, Unix seconds or a window before now; from defaults to an
+// hour before to, which defaults to now. Without a step the finest stored
+// resolution is used.
+func (h *HTTPHandler) getRange(c *gin.Context) {
+	agentID := c.Param("agentID")
+	if _, exists := h.handler.statusManager.GetAgent(agentID); !exists {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Agent not found"})
+		return
+	}
+
+	now := time.Now()
+	to := now
+	if value := c.Query("to"); value != "" {
+		var err error
+		if to, err = parseRangeTime(value, now); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "to " + err.Error()})
+			return
+		}
+	}
+
+	from := to.Add(-time.Hour)
+	if value := c.Query("from"); value != "" {
+		var err error
+		if from, err = parseRangeTime(value, now); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "from " + err.Error()})
+			return
+		}
+	}
+	if !from.Before(to) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "from must be before to"})
+		return
+	}
+
+	var step time.Duration
+	if value := c.Query("step"); value != "" {
+		var err error
+		if step, err = common.ParseWindow(value); err != nil {
+			// Also accept plain seconds
+			seconds, err := strconv.ParseFloat(value, 64)
+			if err != nil || seconds <= 0 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "step must be a duration like 30s or 5m, or seconds"})
+				return
+			}
+			step = time.Duration(seconds * float64(time.Second))
+		}
+	}
+
+	var series []string
+	for _, name := range strings.Split(c.Query("series"), ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			series = append(series, name)
+		}
+	}
+
+	result, err := h.history.Range(agentID, from, to, step, series)
+	if err != nil {
+		if errors.Is(err, common.ErrMetricRangeTooLarge) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// parseRangeTime parses an RFC 3339 time, Unix seconds or a window like 24h
+// or 7d before now
+func parseRangeTime(value string, now time.Time) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	if seconds, err := strconv.ParseFloat(value, 64); err == nil {
+		return time.Unix(0, int64(seconds*float64(time.Second))), nil
+	}
+	if window, err := common.ParseWindow(value); err == nil {
+		return now.Add(-window), nil
+	}
+	return time.Time{}, errors.New("must be an RFC 3339 time, Unix seconds or a window like 24h or 7d")
 }
@@ -10,7 +10,8 @@ import (
 	pb "github.com/mooncorn/nodelink/server/internal/proto"
 )
 
-// StreamingManager manages continuous metrics collection and distribution
+// StreamingManager manages continuous metrics collection and distribution.
+// Agents are asked to push their metrics; those that don't are polled.
 type StreamingManager struct {
 	handler       *Handler
 	statusManager common.StatusManager
@@ -22,6 +23,7 @@ type StreamingManager struct {
 
 	// Configuration
 	metricsInterval time.Duration
+	metricsFields   []string // collected by pushing agents, all if empty
 	sysInfoInterval time.Duration
 
 	// Control
@@ -34,6 +36,9 @@ type StreamingManager struct {
 
 	// SSE Handler for broadcasting
 	sseHandler *SSEHandler
+
+	// History storing collected metrics, if any
+	history *History
 }
 
 // metricsStatusListener listens for agent status changes
@@ -43,11 +48,11 @@ type metricsStatusListener struct {
 
 // OnStatusChange handles agent status changes
 func (l *metricsStatusListener) OnStatusChange(event common.StatusChangeEvent) {
-	switch event.NewStatus {
-	case common.AgentStatusOnline:
-		// Start polling when agent comes online
+	switch {
+	case event.NewStatus.IsAvailable() && !event.OldStatus.IsAvailable():
+		// Start polling when agent comes online; degraded agents keep being polled
 		go l.manager.startAgentPolling(event.AgentID)
-	case common.AgentStatusOffline:
+	case event.NewStatus == common.AgentStatusOffline:
 		// Clean up when agent goes offline
 		l.manager.cleanupAgent(event.AgentID)
 	}
@@ -63,7 +68,7 @@ func NewStreamingManager(handler *Handler, statusManager common.StatusManager, s
 		sseManager:      sseManager,
 		agentMetrics:    make(map[string]*pb.SystemMetrics),
 		agentSystemInfo: make(map[string]*pb.SystemInfo),
-		metricsInterval: 5 * time.Second,  // Poll metrics every 5 seconds
+		metricsInterval: common.DefaultMetricsInterval,
 		sysInfoInterval: 60 * time.Second, // Poll system info every 60 seconds
 		ctx:             ctx,
 		cancel:          cancel,
@@ -71,6 +76,7 @@ func NewStreamingManager(handler *Handler, statusManager common.StatusManager, s
 	}
 
 	manager.statusListener = &metricsStatusListener{manager: manager}
+	handler.SetPushListener(manager)
 
 	return manager
 }
@@ -85,7 +91,7 @@ func (m *StreamingManager) Start() {
 	// Start polling for already online agents
 	agents := m.statusManager.GetAllAgents()
 	for _, agent := range agents {
-		if agent.Status == common.AgentStatusOnline {
+		if agent.Status.IsAvailable() {
 			go m.startAgentPolling(agent.AgentID)
 		}
 	}
@@ -116,8 +122,11 @@ func (m *StreamingManager) startAgentPolling(agentID string) {
 	// Collect initial system info
 	m.collectSystemInfo(agentID)
 
-	// Collect initial metrics
-	m.collectMetrics(agentID)
+	// Collect initial metrics unless the agent pushes them
+	pushing := m.subscribe(agentID)
+	if !pushing {
+		m.collectMetrics(agentID)
+	}
 
 	for {
 		select {
@@ -128,6 +137,15 @@ func (m *StreamingManager) startAgentPolling(agentID string) {
 				log.Printf("Agent %s went offline, stopping metrics polling", agentID)
 				return
 			}
+			if pushing {
+				// Subscribe again if the agent reconnected meanwhile
+				if m.handler.Subscribed(agentID) {
+					continue
+				}
+				if pushing = m.subscribe(agentID); pushing {
+					continue
+				}
+			}
 			m.collectMetrics(agentID)
 		case <-sysInfoTicker.C:
 			if !m.statusManager.IsAgentOnline(agentID) {
@@ -152,11 +170,42 @@ func (m *StreamingManager) collectMetrics(agentID string) {
 		return
 	}
 
+	m.storeMetrics(agentID, metrics)
+}
+
+// subscribe asks an agent to push its metrics, reporting false if it has to be polled
+func (m *StreamingManager) subscribe(agentID string) bool {
+	if err := m.handler.Subscribe(m.ctx, agentID, m.metricsInterval, m.metricsFields, true); err != nil {
+		log.Printf("Polling metrics of agent %s instead of subscribing: %v", agentID, err)
+		return false
+	}
+
+	log.Printf("Agent %s is pushing metrics every %v", agentID, m.metricsInterval)
+	return true
+}
+
+// OnMetricsPush handles metrics pushed by a subscribed agent
+func (m *StreamingManager) OnMetricsPush(agentID string, metrics *pb.SystemMetrics) {
+	m.storeMetrics(agentID, metrics)
+}
+
+// OnMetricsPushError handles a subscribed agent failing to collect its metrics
+func (m *StreamingManager) OnMetricsPushError(agentID string, errorMsg string) {
+	log.Printf("Error collecting metrics from agent %s: %s", agentID, errorMsg)
+	m.broadcastMetricsError(agentID, errorMsg)
+}
+
+// storeMetrics caches, records and broadcasts metrics received from an agent
+func (m *StreamingManager) storeMetrics(agentID string, metrics *pb.SystemMetrics) {
 	// Update cached metrics
 	m.mu.Lock()
 	m.agentMetrics[agentID] = metrics
 	m.mu.Unlock()
 
+	if m.history != nil {
+		m.history.Record(agentID, metrics, time.Now())
+	}
+
 	// Broadcast to interested clients
 	m.broadcastMetrics(agentID, metrics)
 }
@@ -176,6 +225,9 @@ func (m *StreamingManager) collectSystemInfo(agentID string) {
 	m.mu.Lock()
 	m.agentSystemInfo[agentID] = systemInfo
 	m.mu.Unlock()
+
+	// Keep the last known system info with the agent record so it survives going offline
+	m.statusManager.UpdateSystemInfo(agentID, systemInfo)
 }
 
 // broadcastMetrics broadcasts metrics to all clients interested in this agent
@@ -194,6 +246,8 @@ func (m *StreamingManager) broadcastMetricsError(agentID string, errorMsg string
 
 // cleanupAgent removes cached data for an offline agent
 func (m *StreamingManager) cleanupAgent(agentID string) {
+	m.handler.Unsubscribe(agentID)
+
 	m.mu.Lock()
 	delete(m.agentMetrics, agentID)
 	delete(m.agentSystemInfo, agentID)
@@ -210,6 +264,11 @@ func (m *StreamingManager) SetSSEHandler(handler *SSEHandler) {
 	m.sseHandler = handler
 }
 
+// SetHistory sets the history collected metrics are recorded in
+func (m *StreamingManager) SetHistory(history *History) {
+	m.history = history
+}
+
 // GetCachedMetrics returns cached metrics for an agent
 func (m *StreamingManager) GetCachedMetrics(agentID string) (*pb.SystemMetrics, bool) {
 	m.mu.RLock()
@@ -233,6 +292,11 @@ func (m *StreamingManager) SetMetricsInterval(interval time.Duration) {
 	m.metricsInterval = interval
 }
 
+// SetMetricsFields sets the SystemMetrics fields pushing agents collect, all if empty
+func (m *StreamingManager) SetMetricsFields(fields []string) {
+	m.metricsFields = fields
+}
+
 // SetSystemInfoInterval sets the system info polling interval
 func (m *StreamingManager) SetSystemInfoInterval(interval time.Duration) {
 	m.sysInfoInterval = interval
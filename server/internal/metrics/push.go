@@ -0,0 +1,254 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mooncorn/nodelink/server/internal/common"
+	pb "github.com/mooncorn/nodelink/server/internal/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// errMissedPush means a delta push can't be applied because the push before it is missing
+var errMissedPush = errors.New("delta push does not follow the previous push")
+
+// PushListener receives the metrics that subscribed agents push
+type PushListener interface {
+	OnMetricsPush(agentID string, metrics *pb.SystemMetrics)
+	OnMetricsPushError(agentID string, errorMsg string)
+}
+
+// subscription tracks an agent asked to push metrics
+type subscription struct {
+	id       string
+	ack      chan *pb.MetricsSubscribeResponse
+	active   bool // acknowledged by the agent
+	sequence uint64
+	last     *pb.SystemMetrics // the sample delta pushes build on
+}
+
+// SetPushListener sets where pushed metrics are delivered
+func (h *Handler) SetPushListener(listener PushListener) {
+	h.pushListener = listener
+}
+
+// Subscribe asks an agent to push the given SystemMetrics fields (all if
+// empty) every interval, leaving out unchanged fields if delta is set. It
+// returns ErrMetricsPushNotSupported if the agent doesn't acknowledge in time,
+// which older agents that only answer MetricsRequest never do.
+func (h *Handler) Subscribe(ctx context.Context, agentID string, interval time.Duration, fields []string, delta bool) error {
+	sub := &subscription{
+		id:  uuid.New().String(),
+		ack: make(chan *pb.MetricsSubscribeResponse, 1),
+	}
+
+	// Replaces the agent's previous subscription, whose pushes are ignored from now on
+	h.mu.Lock()
+	h.subscriptions[agentID] = sub
+	h.mu.Unlock()
+
+	message := &pb.ServerMessage{
+		Message: &pb.ServerMessage_MetricsSubscribeRequest{
+			MetricsSubscribeRequest: &pb.MetricsSubscribeRequest{
+				SubscriptionId: sub.id,
+				IntervalMs:     interval.Milliseconds(),
+				Fields:         fields,
+				Delta:          delta,
+			},
+		},
+	}
+
+	if err := h.streamSender.SendToAgent(agentID, message); err != nil {
+		h.dropSubscription(agentID, sub)
+		return fmt.Errorf("failed to send metrics subscription to agent %s: %w", agentID, err)
+	}
+
+	select {
+	case response := <-sub.ack:
+		if response.Error != "" {
+			h.dropSubscription(agentID, sub)
+			return fmt.Errorf("agent error: %s", response.Error)
+		}
+		return nil
+	case <-time.After(common.MetricsSubscribeTimeout):
+		h.dropSubscription(agentID, sub)
+		return common.ErrMetricsPushNotSupported
+	case <-ctx.Done():
+		h.dropSubscription(agentID, sub)
+		return ctx.Err()
+	}
+}
+
+// Unsubscribe tells an agent to stop pushing metrics
+func (h *Handler) Unsubscribe(agentID string) {
+	h.mu.Lock()
+	sub, exists := h.subscriptions[agentID]
+	delete(h.subscriptions, agentID)
+	h.mu.Unlock()
+
+	if !exists || !sub.active {
+		return
+	}
+
+	message := &pb.ServerMessage{
+		Message: &pb.ServerMessage_MetricsUnsubscribeRequest{
+			MetricsUnsubscribeRequest: &pb.MetricsUnsubscribeRequest{
+				SubscriptionId: sub.id,
+			},
+		},
+	}
+
+	// The agent may already be gone, which ends the subscription as well
+	if err := h.streamSender.SendToAgent(agentID, message); err != nil {
+		log.Printf("Failed to send metrics unsubscription to agent %s: %v", agentID, err)
+	}
+}
+
+// Subscribed reports whether an agent acknowledged pushing metrics and is still connected
+func (h *Handler) Subscribed(agentID string) bool {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	sub, exists := h.subscriptions[agentID]
+	return exists && sub.active
+}
+
+// PushingAgents returns the number of agents pushing metrics
+func (h *Handler) PushingAgents() int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	count := 0
+	for _, sub := range h.subscriptions {
+		if sub.active {
+			count++
+		}
+	}
+	return count
+}
+
+// HandleAgentDisconnected forgets an agent's subscription, which ends with
+// its stream; it has to be subscribed again once it reconnects
+func (h *Handler) HandleAgentDisconnected(agentID string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	delete(h.subscriptions, agentID)
+}
+
+// HandleMetricsSubscribeResponse handles an agent acknowledging or rejecting a subscription
+func (h *Handler) HandleMetricsSubscribeResponse(agentID string, response *pb.MetricsSubscribeResponse) {
+	h.mu.Lock()
+	sub, exists := h.subscriptions[agentID]
+	if !exists || sub.id != response.SubscriptionId {
+		h.mu.Unlock()
+		log.Printf("Received metrics subscription response from agent %s for unknown subscription: %s", agentID, response.SubscriptionId)
+		return
+	}
+	sub.active = response.Error == ""
+	h.mu.Unlock()
+
+	select {
+	case sub.ack <- response:
+	default:
+	}
+}
+
+// HandleMetricsPush rebuilds the sample an agent pushed and passes it on to the listener
+func (h *Handler) HandleMetricsPush(agentID string, push *pb.MetricsPush) {
+	h.mu.Lock()
+	sub, exists := h.subscriptions[agentID]
+	if !exists || sub.id != push.SubscriptionId {
+		// Late pushes of a replaced or ended subscription
+		h.mu.Unlock()
+		return
+	}
+
+	if push.Error != "" {
+		sub.sequence = push.Sequence
+		h.mu.Unlock()
+
+		if h.pushListener != nil {
+			h.pushListener.OnMetricsPushError(agentID, push.Error)
+		}
+		return
+	}
+
+	metrics, err := sub.apply(push)
+	h.mu.Unlock()
+
+	if err != nil {
+		log.Printf("Dropping metrics push %d from agent %s until the next full push: %v", push.Sequence, agentID, err)
+		return
+	}
+	if h.pushListener != nil {
+		h.pushListener.OnMetricsPush(agentID, metrics)
+	}
+}
+
+// apply rebuilds the full sample of a push, taking the fields it lists as
+// unchanged from the previous sample
+func (s *subscription) apply(push *pb.MetricsPush) (*pb.SystemMetrics, error) {
+	inSequence := push.Sequence == s.sequence+1
+	s.sequence = push.Sequence
+
+	sample := push.GetMetrics()
+	if sample == nil {
+		sample = &pb.SystemMetrics{}
+	}
+
+	if push.Full {
+		s.last = sample
+		return sample, nil
+	}
+	if s.last == nil || !inSequence {
+		s.last = nil
+		return nil, errMissedPush
+	}
+
+	before := s.last.ProtoReflect()
+	after := sample.ProtoReflect()
+	fields := after.Descriptor().Fields()
+	for _, name := range push.Unchanged {
+		field := fields.ByName(protoreflect.Name(name))
+		if field != nil && before.Has(field) {
+			after.Set(field, before.Get(field))
+		}
+	}
+
+	s.last = sample
+	return sample, nil
+}
+
+// dropSubscription removes a subscription unless it was replaced meanwhile
+func (h *Handler) dropSubscription(agentID string, sub *subscription) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.subscriptions[agentID] == sub {
+		delete(h.subscriptions, agentID)
+	}
+}
+
+// ParseFields parses a comma-separated list of SystemMetrics fields to subscribe to
+func ParseFields(value string) ([]string, error) {
+	descriptor := (&pb.SystemMetrics{}).ProtoReflect().Descriptor().Fields()
+
+	var fields []string
+	for _, name := range strings.Split(value, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if descriptor.ByName(protoreflect.Name(name)) == nil {
+			return nil, fmt.Errorf("unknown metrics field %q", name)
+		}
+		fields = append(fields, name)
+	}
+	return fields, nil
+}
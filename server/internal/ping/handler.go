@@ -2,12 +2,15 @@ package ping
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"log"
 	"sync"
 	"time"
 
-	pb "github.com/mooncorn/nodelink/server/internal/proto"
 	"github.com/mooncorn/nodelink/server/internal/common"
+	pb "github.com/mooncorn/nodelink/server/internal/proto"
+	"github.com/mooncorn/nodelink/server/internal/sse"
 	"github.com/mooncorn/nodelink/server/internal/status"
 )
 
@@ -17,25 +20,110 @@ type Config struct {
 	OfflineTimeout  time.Duration
 	CleanupInterval time.Duration
 	StaleAgentTTL   time.Duration
+
+	// An agent is degraded after this many unanswered pings in a row, or while
+	// its round-trip time exceeds DegradedRTT. Zero disables the check.
+	DegradedMissedPongs int
+	DegradedRTT         time.Duration
+
+	// An agent whose status changes FlapThreshold times within FlapWindow is
+	// flapping. While it stays connected it is reported as degraded and its
+	// changes are held back, until fewer than half as many fall within the window.
+	FlapWindow    time.Duration
+	FlapThreshold int
 }
 
 // DefaultConfig returns a default ping configuration
 func DefaultConfig() Config {
 	return Config{
-		PingInterval:    3 * time.Second,
-		OfflineTimeout:  6 * time.Second,
-		CleanupInterval: 1 * time.Hour,
-		StaleAgentTTL:   24 * time.Hour,
+		PingInterval:        3 * time.Second,
+		OfflineTimeout:      6 * time.Second,
+		CleanupInterval:     1 * time.Hour,
+		StaleAgentTTL:       30 * 24 * time.Hour, // Agents are persisted, so keep offline machines visible for a while
+		DegradedMissedPongs: 1,
+		DegradedRTT:         time.Second,
+		FlapWindow:          2 * time.Minute,
+		FlapThreshold:       6,
 	}
 }
 
+// WithOverrides returns the configuration with an agent's overrides applied
+func (c Config) WithOverrides(overrides *common.PingConfig) (Config, error) {
+	if overrides == nil {
+		return c, nil
+	}
+
+	if overrides.IntervalMs < 0 || overrides.OfflineTimeoutMs < 0 || overrides.FlapWindowMs < 0 {
+		return c, errors.New("ping settings must not be negative")
+	}
+	if overrides.DegradedMissedPongs < common.PingCheckDisabled || overrides.DegradedRTTMs < common.PingCheckDisabled ||
+		overrides.FlapThreshold < common.PingCheckDisabled {
+		return c, fmt.Errorf("degraded and flap settings must not be negative, except %d to disable the check", common.PingCheckDisabled)
+	}
+
+	if overrides.IntervalMs > 0 {
+		c.PingInterval = time.Duration(overrides.IntervalMs) * time.Millisecond
+	}
+	if overrides.OfflineTimeoutMs > 0 {
+		c.OfflineTimeout = time.Duration(overrides.OfflineTimeoutMs) * time.Millisecond
+	}
+	if overrides.DegradedMissedPongs != 0 {
+		c.DegradedMissedPongs = max(overrides.DegradedMissedPongs, 0)
+	}
+	if overrides.DegradedRTTMs != 0 {
+		c.DegradedRTT = time.Duration(max(overrides.DegradedRTTMs, 0)) * time.Millisecond
+	}
+	if overrides.FlapWindowMs > 0 {
+		c.FlapWindow = time.Duration(overrides.FlapWindowMs) * time.Millisecond
+	}
+	if overrides.FlapThreshold != 0 {
+		c.FlapThreshold = max(overrides.FlapThreshold, 0)
+	}
+
+	if c.PingInterval < common.MinPingInterval {
+		return c, fmt.Errorf("ping interval must be at least %s", common.MinPingInterval)
+	}
+	if c.OfflineTimeout <= c.PingInterval {
+		return c, fmt.Errorf("offline timeout (%s) must be longer than the ping interval (%s)", c.OfflineTimeout, c.PingInterval)
+	}
+	if c.FlapThreshold == 1 {
+		return c, errors.New("flap threshold must be at least 2")
+	}
+
+	return c, nil
+}
+
+// Settings returns the per-agent part of the configuration, with disabled
+// checks reported the way they are overridden
+func (c Config) Settings() common.PingConfig {
+	settings := common.PingConfig{
+		IntervalMs:          c.PingInterval.Milliseconds(),
+		OfflineTimeoutMs:    c.OfflineTimeout.Milliseconds(),
+		DegradedMissedPongs: c.DegradedMissedPongs,
+		DegradedRTTMs:       c.DegradedRTT.Milliseconds(),
+		FlapWindowMs:        c.FlapWindow.Milliseconds(),
+		FlapThreshold:       c.FlapThreshold,
+	}
+	if settings.DegradedMissedPongs == 0 {
+		settings.DegradedMissedPongs = common.PingCheckDisabled
+	}
+	if settings.DegradedRTTMs == 0 {
+		settings.DegradedRTTMs = common.PingCheckDisabled
+	}
+	if settings.FlapThreshold == 0 {
+		settings.FlapThreshold = common.PingCheckDisabled
+	}
+	return settings
+}
+
 // Handler manages ping/pong communication and heartbeat monitoring
 type Handler struct {
 	mu            sync.RWMutex
+	reportMu      sync.Mutex // orders status reports made after mu is released
 	config        Config
 	statusManager *status.Manager
-	streamSenders map[string]common.StreamSender
-	offlineTimers map[string]*time.Timer
+	broadcaster   *sse.Broadcaster
+	agents        map[string]*agentState
 
 	// Background context and cleanup
 	ctx    context.Context
@@ -43,13 +131,49 @@ type Handler struct {
 	wg     sync.WaitGroup
 }
 
+// agentState tracks the heartbeat of one agent. It outlives the connection so
+// that reconnect loops count towards flapping.
+type agentState struct {
+	sender       common.StreamSender // nil while the agent is disconnected
+	done         chan struct{}       // closed when the connection is unregistered
+	reconfigure  chan struct{}       // signals the ping loop that the interval changed
+	config       Config
+	offlineTimer *time.Timer
+	timedOut     bool
+	connectedAt  time.Time
+
+	pingSentAt  time.Time
+	awaiting    bool // the latest ping has not been answered yet
+	missedPongs int
+	rtt         time.Duration
+	latency     *latencyWindow
+
+	observed common.AgentStatus // status derived from the heartbeat alone
+	changes  []time.Time        // when the observed status changed, within the flap window
+	flapping bool
+
+	evaluated uint64 // evaluations so far, guarded by mu
+	reported  uint64 // latest evaluation reported, guarded by reportMu
+}
+
+// statusUpdate is the outcome of an evaluation, reported to the status manager
+// once the handler's lock is released
+type statusUpdate struct {
+	agentID  string
+	state    *agentState
+	version  uint64
+	status   common.AgentStatus
+	reason   string
+	flapping bool
+}
+
 // NewHandler creates a new ping handler
-func NewHandler(statusManager *status.Manager, config Config) *Handler {
+func NewHandler(statusManager *status.Manager, sseManager common.SSEManager, config Config) *Handler {
 	return &Handler{
 		config:        config,
 		statusManager: statusManager,
-		streamSenders: make(map[string]common.StreamSender),
-		offlineTimers: make(map[string]*time.Timer),
+		broadcaster:   sse.NewBroadcaster(sseManager),
+		agents:        make(map[string]*agentState),
 	}
 }
 
@@ -73,10 +197,11 @@ func (h *Handler) Stop() {
 	h.mu.Lock()
 
 	// Stop all offline timers
-	for _, timer := range h.offlineTimers {
-		timer.Stop()
+	for _, state := range h.agents {
+		if state.offlineTimer != nil {
+			state.offlineTimer.Stop()
+		}
 	}
-	h.offlineTimers = make(map[string]*time.Timer)
 
 	h.mu.Unlock()
 
@@ -86,20 +211,37 @@ func (h *Handler) Stop() {
 
 // RegisterAgent registers an agent for ping monitoring
 func (h *Handler) RegisterAgent(agentID string, sender common.StreamSender) {
-	h.mu.Lock()
-	defer h.mu.Unlock()
+	config := h.agentConfig(agentID)
 
-	// Store the stream sender
-	h.streamSenders[agentID] = sender
+	h.mu.Lock()
 
-	// Stop existing offline timer if present
-	if timer, exists := h.offlineTimers[agentID]; exists {
-		timer.Stop()
-		delete(h.offlineTimers, agentID)
+	state, exists := h.agents[agentID]
+	if !exists {
+		// The first connection is not a status change worth counting towards flapping
+		state = &agentState{observed: common.AgentStatusOnline}
+		h.agents[agentID] = state
+	}
+	if state.sender != nil {
+		close(state.done)
 	}
 
-	// Mark agent as online in status manager
-	h.statusManager.SetAgentOnline(agentID)
+	state.sender = sender
+	state.done = make(chan struct{})
+	state.reconfigure = make(chan struct{}, 1)
+	state.config = config
+	state.timedOut = false
+	state.connectedAt = time.Now()
+	state.awaiting = false
+	state.missedPongs = 0
+	state.rtt = 0
+	state.latency = newLatencyWindow(common.LatencyWindowSize)
+
+	// An agent that never answers goes offline just like one that stops answering
+	h.armOfflineTimer(agentID, state)
+
+	update := h.evaluate(agentID, state)
+	h.mu.Unlock()
+	h.report(update)
 
 	log.Printf("Agent %s registered for ping monitoring", agentID)
 }
@@ -107,19 +249,26 @@ func (h *Handler) RegisterAgent(agentID string, sender common.StreamSender) {
 // UnregisterAgent unregisters an agent from ping monitoring
 func (h *Handler) UnregisterAgent(agentID string) {
 	h.mu.Lock()
-	defer h.mu.Unlock()
 
-	// Remove stream sender
-	delete(h.streamSenders, agentID)
+	state, exists := h.agents[agentID]
+	if !exists || state.sender == nil {
+		h.mu.Unlock()
+		h.statusManager.SetAgentOffline(agentID)
+		return
+	}
 
-	// Stop offline timer
-	if timer, exists := h.offlineTimers[agentID]; exists {
-		timer.Stop()
-		delete(h.offlineTimers, agentID)
+	if state.offlineTimer != nil {
+		state.offlineTimer.Stop()
+		state.offlineTimer = nil
 	}
+	close(state.done)
+	state.sender = nil
+	state.awaiting = false
 
-	// Mark agent as offline in status manager
-	h.statusManager.SetAgentOffline(agentID)
+	// A disconnected agent is offline even while flapping, its stream is gone
+	update := h.evaluate(agentID, state)
+	h.mu.Unlock()
+	h.report(update)
 
 	log.Printf("Agent %s unregistered from ping monitoring", agentID)
 }
@@ -127,51 +276,74 @@ func (h *Handler) UnregisterAgent(agentID string) {
 // HandlePong processes a pong message from an agent
 func (h *Handler) HandlePong(agentID string, pong *pb.Pong) error {
 	h.mu.Lock()
-	defer h.mu.Unlock()
 
 	// Verify agent is registered
-	if _, exists := h.streamSenders[agentID]; !exists {
+	state, exists := h.agents[agentID]
+	if !exists || state.sender == nil {
+		h.mu.Unlock()
 		return nil // Agent not registered, ignore pong
 	}
 
-	// Update last seen time in status manager
-	h.statusManager.UpdateLastSeen(agentID)
+	// The echoed timestamp tells the round-trip time, also for a late pong. Pings
+	// sent before this connection can't be answered on it, so anything older is bogus.
+	var stats *common.LatencyStats
+	sentAt := time.Unix(0, pong.PingTimestamp)
+	if !sentAt.Before(state.connectedAt) {
+		state.rtt = time.Since(sentAt)
+		state.latency.add(state.rtt)
+		stats = state.latency.stats(agentID)
+	}
 
-	// Stop existing offline timer
-	if timer, exists := h.offlineTimers[agentID]; exists {
-		timer.Stop()
-		delete(h.offlineTimers, agentID)
+	// Only the pong to the latest ping settles it; a late one still shows the agent is alive
+	if state.awaiting && sentAt.Equal(state.pingSentAt) {
+		state.awaiting = false
 	}
+	state.missedPongs = 0
+	state.timedOut = false
 
-	// Create new offline timer
-	h.offlineTimers[agentID] = time.AfterFunc(h.config.OfflineTimeout, func() {
-		h.mu.Lock()
-		defer h.mu.Unlock()
+	h.armOfflineTimer(agentID, state)
+	update := h.evaluate(agentID, state)
+	h.mu.Unlock()
 
-		// Double-check agent still exists before marking offline
-		if _, exists := h.streamSenders[agentID]; exists {
-			log.Printf("Agent %s marked as offline due to timeout", agentID)
-			h.statusManager.SetAgentOffline(agentID)
-		}
-	})
+	// Update last seen time in status manager
+	h.statusManager.UpdateLastSeen(agentID)
+	h.report(update)
+
+	if stats != nil {
+		h.statusManager.UpdateLatency(agentID, stats)
+		h.broadcaster.AgentLatency(stats)
+	}
 
 	return nil
 }
 
-// SendPing sends a ping message to a specific agent
+// SendPing sends a ping message to a specific agent. A previous ping that is
+// still unanswered counts as a missed pong.
 func (h *Handler) SendPing(agentID string) error {
-	h.mu.RLock()
-	sender, exists := h.streamSenders[agentID]
-	h.mu.RUnlock()
-
-	if !exists {
+	h.mu.Lock()
+	state, exists := h.agents[agentID]
+	if !exists || state.sender == nil {
+		h.mu.Unlock()
 		return nil // Agent not registered
 	}
 
+	if state.awaiting {
+		state.missedPongs++
+	}
+	update := h.evaluate(agentID, state)
+
+	now := time.Now()
+	state.pingSentAt = now
+	state.awaiting = true
+	sender := state.sender
+	h.mu.Unlock()
+
+	h.report(update)
+
 	ping := &pb.ServerMessage{
 		Message: &pb.ServerMessage_Ping{
 			Ping: &pb.Ping{
-				Timestamp: time.Now().UTC().Unix(),
+				Timestamp: now.UnixNano(),
 			},
 		},
 	}
@@ -181,15 +353,75 @@ func (h *Handler) SendPing(agentID string) error {
 
 // StartPingLoop starts a periodic ping loop for an agent
 func (h *Handler) StartPingLoop(agentID string) {
+	h.mu.RLock()
+	state, exists := h.agents[agentID]
+	if !exists || state.sender == nil {
+		h.mu.RUnlock()
+		return
+	}
+	done, reconfigure := state.done, state.reconfigure
+	h.mu.RUnlock()
+
 	h.wg.Add(1)
-	go h.pingLoop(agentID)
+	go h.pingLoop(agentID, done, reconfigure)
+}
+
+// AgentConfig returns an agent's heartbeat overrides and the configuration in effect for it
+func (h *Handler) AgentConfig(agentID string) (*common.PingConfig, Config, error) {
+	agent, exists := h.statusManager.GetAgent(agentID)
+	if !exists {
+		return nil, Config{}, common.ErrAgentNotFound
+	}
+
+	config, err := h.config.WithOverrides(agent.PingConfig)
+	if err != nil {
+		config = h.config
+	}
+
+	return agent.PingConfig, config, nil
+}
+
+// SetAgentConfig stores an agent's heartbeat overrides, nil restoring the
+// defaults, and applies them right away if the agent is connected
+func (h *Handler) SetAgentConfig(agentID string, overrides *common.PingConfig) (Config, error) {
+	config, err := h.config.WithOverrides(overrides)
+	if err != nil {
+		return Config{}, err
+	}
+
+	if _, err := h.statusManager.SetPingConfig(agentID, overrides); err != nil {
+		return Config{}, err
+	}
+
+	h.mu.Lock()
+	var update *statusUpdate
+	if state, exists := h.agents[agentID]; exists && state.sender != nil {
+		state.config = config
+		if !state.timedOut {
+			h.armOfflineTimer(agentID, state)
+		}
+
+		select {
+		case state.reconfigure <- struct{}{}:
+		default:
+		}
+
+		update = h.evaluate(agentID, state)
+	}
+	h.mu.Unlock()
+
+	if update != nil {
+		h.report(update)
+	}
+
+	return config, nil
 }
 
-// pingLoop sends periodic pings to an agent
-func (h *Handler) pingLoop(agentID string) {
+// pingLoop sends periodic pings to an agent until its connection is unregistered
+func (h *Handler) pingLoop(agentID string, done, reconfigure <-chan struct{}) {
 	defer h.wg.Done()
 
-	ticker := time.NewTicker(h.config.PingInterval)
+	ticker := time.NewTicker(h.pingInterval(agentID))
 	defer ticker.Stop()
 
 	for {
@@ -197,16 +429,12 @@ func (h *Handler) pingLoop(agentID string) {
 		case <-h.ctx.Done():
 			log.Printf("Stopping ping loop for agent %s", agentID)
 			return
+		case <-done:
+			log.Printf("Agent %s disconnected, stopping ping loop", agentID)
+			return
+		case <-reconfigure:
+			ticker.Reset(h.pingInterval(agentID))
 		case <-ticker.C:
-			h.mu.RLock()
-			_, exists := h.streamSenders[agentID]
-			h.mu.RUnlock()
-
-			if !exists {
-				log.Printf("Agent %s disconnected, stopping ping loop", agentID)
-				return
-			}
-
 			if err := h.SendPing(agentID); err != nil {
 				log.Printf("Error sending ping to agent %s: %v", agentID, err)
 				return
@@ -215,6 +443,144 @@ func (h *Handler) pingLoop(agentID string) {
 	}
 }
 
+// pingInterval returns the interval an agent is pinged at
+func (h *Handler) pingInterval(agentID string) time.Duration {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	if state, exists := h.agents[agentID]; exists {
+		return state.config.PingInterval
+	}
+	return h.config.PingInterval
+}
+
+// agentConfig returns the configuration for an agent with its overrides applied
+func (h *Handler) agentConfig(agentID string) Config {
+	agent, exists := h.statusManager.GetAgent(agentID)
+	if !exists {
+		return h.config
+	}
+
+	config, err := h.config.WithOverrides(agent.PingConfig)
+	if err != nil {
+		log.Printf("Ignoring invalid ping settings of agent %s: %v", agentID, err)
+		return h.config
+	}
+	return config
+}
+
+// armOfflineTimer (re)starts the timer that marks an agent offline when no pong
+// arrives in time. Must be called with the lock held.
+func (h *Handler) armOfflineTimer(agentID string, state *agentState) {
+	if state.offlineTimer != nil {
+		state.offlineTimer.Stop()
+	}
+
+	var timer *time.Timer
+	timer = time.AfterFunc(state.config.OfflineTimeout, func() {
+		h.mu.Lock()
+
+		// Ignore timers that were replaced or stopped after firing
+		if state.offlineTimer != timer || state.sender == nil {
+			h.mu.Unlock()
+			return
+		}
+
+		log.Printf("Agent %s timed out waiting for a pong", agentID)
+		state.timedOut = true
+		update := h.evaluate(agentID, state)
+		h.mu.Unlock()
+
+		h.report(update)
+	})
+	state.offlineTimer = timer
+}
+
+// evaluate derives an agent's status from its heartbeat and tracks whether it
+// is flapping. Must be called with the lock held, the result is reported once
+// it is released.
+func (h *Handler) evaluate(agentID string, state *agentState) *statusUpdate {
+	now := time.Now()
+
+	observed, reason := state.observe()
+	if observed != state.observed {
+		state.observed = observed
+		state.changes = append(state.changes, now)
+	}
+	state.pruneChanges(now)
+
+	threshold := state.config.FlapThreshold
+	switch {
+	case threshold <= 0:
+		state.flapping = false
+	case !state.flapping && len(state.changes) >= threshold:
+		state.flapping = true
+		log.Printf("Agent %s is flapping: %d status changes within %s", agentID, len(state.changes), state.config.FlapWindow)
+	case state.flapping && len(state.changes) < (threshold+1)/2:
+		state.flapping = false
+		log.Printf("Agent %s stopped flapping", agentID)
+	}
+
+	// Hold a flapping agent at degraded while it flips between online and
+	// degraded so listeners aren't notified of every flip. An agent seen
+	// offline is always reported offline, so no work is sent to it.
+	status := observed
+	if state.flapping && observed != common.AgentStatusOffline {
+		status = common.AgentStatusDegraded
+		reason = "status is flapping"
+	}
+
+	state.evaluated++
+	return &statusUpdate{
+		agentID:  agentID,
+		state:    state,
+		version:  state.evaluated,
+		status:   status,
+		reason:   reason,
+		flapping: state.flapping,
+	}
+}
+
+// report passes an evaluation on to the status manager, unless a later one
+// was reported already by a caller that released the lock first
+func (h *Handler) report(update *statusUpdate) {
+	h.reportMu.Lock()
+	defer h.reportMu.Unlock()
+
+	if update.version <= update.state.reported {
+		return
+	}
+	update.state.reported = update.version
+
+	h.statusManager.SetAgentStatus(update.agentID, update.status, update.reason, update.flapping)
+}
+
+// observe derives the status from the heartbeat alone
+func (s *agentState) observe() (common.AgentStatus, string) {
+	switch {
+	case s.sender == nil:
+		return common.AgentStatusOffline, "disconnected"
+	case s.timedOut:
+		return common.AgentStatusOffline, fmt.Sprintf("no pong within %s", s.config.OfflineTimeout)
+	case s.config.DegradedMissedPongs > 0 && s.missedPongs >= s.config.DegradedMissedPongs:
+		return common.AgentStatusDegraded, fmt.Sprintf("missed %d or more pongs in a row", s.config.DegradedMissedPongs)
+	case s.config.DegradedRTT > 0 && s.rtt > s.config.DegradedRTT:
+		return common.AgentStatusDegraded, fmt.Sprintf("round-trip time above %s", s.config.DegradedRTT)
+	default:
+		return common.AgentStatusOnline, ""
+	}
+}
+
+// pruneChanges forgets status changes that fell out of the flap window
+func (s *agentState) pruneChanges(now time.Time) {
+	cutoff := now.Add(-s.config.FlapWindow)
+	expired := 0
+	for expired < len(s.changes) && s.changes[expired].Before(cutoff) {
+		expired++
+	}
+	s.changes = s.changes[expired:]
+}
+
 // cleanupStaleAgents periodically cleans up stale agent records
 func (h *Handler) cleanupStaleAgents() {
 	defer h.wg.Done()
@@ -233,6 +599,32 @@ func (h *Handler) cleanupStaleAgents() {
 			if count > 0 {
 				log.Printf("Cleaned up %d stale agent records", count)
 			}
+
+			h.forgetDisconnectedAgents()
+		}
+	}
+}
+
+// forgetDisconnectedAgents drops the heartbeat state of disconnected agents
+// that have no status changes left within their flap window
+func (h *Handler) forgetDisconnectedAgents() {
+	h.mu.Lock()
+
+	var updates []*statusUpdate
+	for agentID, state := range h.agents {
+		if state.sender != nil {
+			continue
 		}
+
+		// Re-evaluating ages out old changes and ends flapping that has calmed down
+		updates = append(updates, h.evaluate(agentID, state))
+		if len(state.changes) == 0 {
+			delete(h.agents, agentID)
+		}
+	}
+	h.mu.Unlock()
+
+	for _, update := range updates {
+		h.report(update)
 	}
 }
@@ -0,0 +1,94 @@
+package ping
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mooncorn/nodelink/server/internal/common"
+)
+
+// HTTPHandler handles HTTP requests for per-agent heartbeat settings
+type HTTPHandler struct {
+	handler *Handler
+}
+
+// NewHTTPHandler creates a new HTTP handler for heartbeat settings
+func NewHTTPHandler(handler *Handler) *HTTPHandler {
+	return &HTTPHandler{
+		handler: handler,
+	}
+}
+
+// RegisterRoutes registers heartbeat settings routes
+func (h *HTTPHandler) RegisterRoutes(router gin.IRouter) {
+	router.GET("/agents/:agentId/ping-config", h.getPingConfig)
+	router.PUT("/agents/:agentId/ping-config", h.setPingConfig)
+	router.DELETE("/agents/:agentId/ping-config", h.resetPingConfig)
+}
+
+// PingConfigResponse describes an agent's heartbeat overrides and the settings in effect
+type PingConfigResponse struct {
+	AgentID   string             `json:"agent_id"`
+	Overrides *common.PingConfig `json:"overrides"`
+	Effective common.PingConfig  `json:"effective"`
+}
+
+// getPingConfig handles GET /agents/:agentId/ping-config
+func (h *HTTPHandler) getPingConfig(c *gin.Context) {
+	agentID := c.Param("agentId")
+
+	overrides, config, err := h.handler.AgentConfig(agentID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, PingConfigResponse{
+		AgentID:   agentID,
+		Overrides: overrides,
+		Effective: config.Settings(),
+	})
+}
+
+// setPingConfig handles PUT /agents/:agentId/ping-config, replacing all overrides
+func (h *HTTPHandler) setPingConfig(c *gin.Context) {
+	var overrides common.PingConfig
+	if err := c.ShouldBindJSON(&overrides); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	h.apply(c, &overrides)
+}
+
+// resetPingConfig handles DELETE /agents/:agentId/ping-config, restoring the server defaults
+func (h *HTTPHandler) resetPingConfig(c *gin.Context) {
+	h.apply(c, nil)
+}
+
+// apply stores the overrides and responds with the resulting settings
+func (h *HTTPHandler) apply(c *gin.Context, overrides *common.PingConfig) {
+	agentID := c.Param("agentId")
+
+	// Overrides that change nothing are dropped so the agent follows future default changes
+	if overrides != nil && *overrides == (common.PingConfig{}) {
+		overrides = nil
+	}
+
+	config, err := h.handler.SetAgentConfig(agentID, overrides)
+	if err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, common.ErrAgentNotFound) {
+			status = http.StatusNotFound
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, PingConfigResponse{
+		AgentID:   agentID,
+		Overrides: overrides,
+		Effective: config.Settings(),
+	})
+}
@@ -0,0 +1,80 @@
+package ping
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"github.com/mooncorn/nodelink/server/internal/common"
+)
+
+// latencyWindow keeps the most recent round-trip times of an agent
+type latencyWindow struct {
+	samples []time.Duration // ring buffer, oldest at next once full
+	next    int
+}
+
+// newLatencyWindow creates a window holding up to size round-trip times
+func newLatencyWindow(size int) *latencyWindow {
+	return &latencyWindow{samples: make([]time.Duration, 0, size)}
+}
+
+// add records a round-trip time, replacing the oldest once the window is full
+func (w *latencyWindow) add(rtt time.Duration) {
+	if len(w.samples) < cap(w.samples) {
+		w.samples = append(w.samples, rtt)
+		return
+	}
+	w.samples[w.next] = rtt
+	w.next = (w.next + 1) % len(w.samples)
+}
+
+// ordered returns the round-trip times from oldest to newest
+func (w *latencyWindow) ordered() []time.Duration {
+	ordered := make([]time.Duration, 0, len(w.samples))
+	ordered = append(ordered, w.samples[w.next:]...)
+	return append(ordered, w.samples[:w.next]...)
+}
+
+// stats summarizes the window, or returns nil if it is empty
+func (w *latencyWindow) stats(agentID string) *common.LatencyStats {
+	samples := w.ordered()
+	if len(samples) == 0 {
+		return nil
+	}
+
+	var total, jitter time.Duration
+	for i, rtt := range samples {
+		total += rtt
+		if i > 0 {
+			diff := rtt - samples[i-1]
+			if diff < 0 {
+				diff = -diff
+			}
+			jitter += diff
+		}
+	}
+
+	sorted := append([]time.Duration(nil), samples...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	stats := &common.LatencyStats{
+		AgentID:   agentID,
+		LastMs:    milliseconds(samples[len(samples)-1]),
+		MinMs:     milliseconds(sorted[0]),
+		AvgMs:     milliseconds(total / time.Duration(len(samples))),
+		P95Ms:     milliseconds(sorted[int(math.Ceil(0.95*float64(len(sorted))))-1]),
+		Samples:   len(samples),
+		UpdatedAt: time.Now(),
+	}
+	if len(samples) > 1 {
+		stats.JitterMs = milliseconds(jitter / time.Duration(len(samples)-1))
+	}
+
+	return stats
+}
+
+// milliseconds converts a duration to fractional milliseconds
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
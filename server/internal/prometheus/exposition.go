@@ -0,0 +1,141 @@
+package prometheus
+
+import (
+	"bufio"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// contentType is the version of the text exposition format that is written
+const contentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// Metric types
+const (
+	gauge   = "gauge"
+	counter = "counter"
+)
+
+// label is a dimension of a sample
+type label struct {
+	name  string
+	value string
+}
+
+// sample is one value of a metric
+type sample struct {
+	labels []label
+	value  float64
+}
+
+// family is a metric and all of its samples
+type family struct {
+	name    string
+	help    string
+	kind    string
+	samples []sample
+}
+
+// registry gathers the metrics of one scrape, keeping each metric's samples
+// together as the format requires
+type registry struct {
+	families []*family
+	byName   map[string]*family
+}
+
+// newRegistry creates an empty registry
+func newRegistry() *registry {
+	return &registry{
+		byName: make(map[string]*family),
+	}
+}
+
+// add records a sample of a metric, declaring the metric on first use
+func (r *registry) add(name, kind, help string, value float64, labels ...label) {
+	f, exists := r.byName[name]
+	if !exists {
+		f = &family{name: name, help: help, kind: kind}
+		r.byName[name] = f
+		r.families = append(r.families, f)
+	}
+	f.samples = append(f.samples, sample{labels: labels, value: value})
+}
+
+// write encodes the metrics in the Prometheus text format
+func (r *registry) write(w io.Writer) error {
+	out := bufio.NewWriter(w)
+
+	for _, f := range r.families {
+		out.WriteString("# HELP " + f.name + " " + escapeHelp(f.help) + "\n")
+		out.WriteString("# TYPE " + f.name + " " + f.kind + "\n")
+
+		for _, s := range f.samples {
+			out.WriteString(f.name)
+			if len(s.labels) > 0 {
+				out.WriteByte('{')
+				for i, l := range s.labels {
+					if i > 0 {
+						out.WriteByte(',')
+					}
+					out.WriteString(l.name + `="` + escapeValue(l.value) + `"`)
+				}
+				out.WriteByte('}')
+			}
+			out.WriteString(" " + formatValue(s.value) + "\n")
+		}
+	}
+
+	return out.Flush()
+}
+
+// with returns the labels followed by more, leaving the original slice untouched
+func with(labels []label, more ...label) []label {
+	combined := make([]label, 0, len(labels)+len(more))
+	combined = append(combined, labels...)
+	return append(combined, more...)
+}
+
+// labelName turns an agent label key such as app.kubernetes.io/name into a
+// valid label name, label_app_kubernetes_io_name
+func labelName(key string) string {
+	var name strings.Builder
+	name.WriteString("label_")
+	for _, r := range key {
+		if r < 128 && (r == '_' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9') {
+			name.WriteRune(r)
+		} else {
+			name.WriteByte('_')
+		}
+	}
+	return name.String()
+}
+
+var (
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	valueEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+// escapeHelp escapes a metric's help text
+func escapeHelp(help string) string {
+	return helpEscaper.Replace(help)
+}
+
+// escapeValue escapes a label value
+func escapeValue(value string) string {
+	return valueEscaper.Replace(value)
+}
+
+// formatValue formats a sample value, including the special values
+func formatValue(value float64) string {
+	switch {
+	case math.IsNaN(value):
+		return "NaN"
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	default:
+		return strconv.FormatFloat(value, 'g', -1, 64)
+	}
+}
@@ -0,0 +1,253 @@
+package prometheus
+
+import (
+	"bytes"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mooncorn/nodelink/server/internal/comm"
+	"github.com/mooncorn/nodelink/server/internal/command"
+	"github.com/mooncorn/nodelink/server/internal/common"
+	"github.com/mooncorn/nodelink/server/internal/metrics"
+	pb "github.com/mooncorn/nodelink/server/internal/proto"
+	"github.com/mooncorn/nodelink/server/internal/sse"
+	"github.com/mooncorn/nodelink/server/internal/status"
+	"github.com/mooncorn/nodelink/server/internal/terminal"
+)
+
+// HTTPHandler exports the fleet's metrics and the server's own state for
+// Prometheus to scrape
+type HTTPHandler struct {
+	config Config
+}
+
+// Config contains the components whose state is exported
+type Config struct {
+	StatusManager    *status.Manager
+	MetricsStreaming *metrics.StreamingManager
+	MetricsHandler   *metrics.Handler
+	CommandHandler   *command.Handler
+	TerminalHandler  *terminal.Handler
+	TerminalSessions *terminal.SessionManager
+	SSEManager       *sse.Manager
+	CommServer       *comm.CommunicationServer
+}
+
+// NewHTTPHandler creates a new Prometheus exposition handler
+func NewHTTPHandler(config Config) *HTTPHandler {
+	return &HTTPHandler{config: config}
+}
+
+// RegisterRoutes registers the Prometheus exposition route
+func (h *HTTPHandler) RegisterRoutes(router gin.IRouter) {
+	router.GET("/prometheus", h.getMetrics)
+}
+
+// getMetrics handles GET /prometheus
+func (h *HTTPHandler) getMetrics(c *gin.Context) {
+	r := newRegistry()
+	h.collectAgents(r)
+	h.collectServer(r)
+
+	var buf bytes.Buffer
+	if err := r.write(&buf); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Data(http.StatusOK, contentType, buf.Bytes())
+}
+
+// collectAgents exports whether each agent is up and the last metrics received from it
+func (h *HTTPHandler) collectAgents(r *registry) {
+	agents := h.config.StatusManager.GetAllAgents()
+	sort.Slice(agents, func(i, j int) bool { return agents[i].AgentID < agents[j].AgentID })
+
+	for _, agent := range agents {
+		labels := agentLabels(agent)
+
+		up := 0.0
+		if agent.Status.IsAvailable() {
+			up = 1
+		}
+		r.add("nodelink_agent_up", gauge, "Whether the agent is connected and answering pings.", up, labels...)
+
+		// Only agents whose metrics are being collected have them
+		if systemMetrics, exists := h.config.MetricsStreaming.GetCachedMetrics(agent.AgentID); exists {
+			collectSystemMetrics(r, labels, systemMetrics)
+		}
+	}
+}
+
+// collectSystemMetrics exports a metrics sample of an agent
+func collectSystemMetrics(r *registry, labels []label, m *pb.SystemMetrics) {
+	r.add("nodelink_agent_metrics_timestamp_seconds", gauge, "When the agent took its last metrics sample.", float64(m.GetTimestamp()), labels...)
+	r.add("nodelink_agent_cpu_usage_percent", gauge, "CPU usage of the agent's host.", m.GetCpuUsagePercent(), labels...)
+	for core, usage := range m.GetCpuCoreUsagePercent() {
+		r.add("nodelink_agent_cpu_core_usage_percent", gauge, "Usage of each logical CPU of the agent's host.", usage, with(labels, label{"core", strconv.Itoa(core)})...)
+	}
+	if times := m.GetCpuTimes(); times != nil {
+		for _, mode := range []struct {
+			name  string
+			value float64
+		}{
+			{"user", times.GetUser()},
+			{"system", times.GetSystem()},
+			{"idle", times.GetIdle()},
+			{"nice", times.GetNice()},
+			{"iowait", times.GetIowait()},
+			{"irq", times.GetIrq()},
+			{"softirq", times.GetSoftirq()},
+			{"steal", times.GetSteal()},
+		} {
+			r.add("nodelink_agent_cpu_time_percent", gauge, "Share of CPU time spent in each mode since the previous sample.", mode.value, with(labels, label{"mode", mode.name})...)
+		}
+	}
+	r.add("nodelink_agent_load1", gauge, "1-minute load average of the agent's host.", m.GetLoadAverage_1M(), labels...)
+	r.add("nodelink_agent_load5", gauge, "5-minute load average of the agent's host.", m.GetLoadAverage_5M(), labels...)
+	r.add("nodelink_agent_load15", gauge, "15-minute load average of the agent's host.", m.GetLoadAverage_15M(), labels...)
+
+	if memory := m.GetMemory(); memory != nil {
+		r.add("nodelink_agent_memory_total_bytes", gauge, "Total memory of the agent's host.", float64(memory.GetTotal()), labels...)
+		r.add("nodelink_agent_memory_available_bytes", gauge, "Memory available for new processes.", float64(memory.GetAvailable()), labels...)
+		r.add("nodelink_agent_memory_used_bytes", gauge, "Memory in use.", float64(memory.GetUsed()), labels...)
+		r.add("nodelink_agent_memory_free_bytes", gauge, "Unused memory.", float64(memory.GetFree()), labels...)
+		r.add("nodelink_agent_memory_cached_bytes", gauge, "Memory used by the page cache.", float64(memory.GetCached()), labels...)
+		r.add("nodelink_agent_memory_buffers_bytes", gauge, "Memory used by kernel buffers.", float64(memory.GetBuffers()), labels...)
+		r.add("nodelink_agent_memory_used_percent", gauge, "Memory in use as a percentage of the total.", memory.GetUsedPercent(), labels...)
+	}
+
+	for _, disk := range m.GetDisks() {
+		diskLabels := with(labels,
+			label{"device", disk.GetDevice()},
+			label{"mountpoint", disk.GetMountpoint()},
+			label{"fstype", disk.GetFilesystem()},
+		)
+		r.add("nodelink_agent_disk_total_bytes", gauge, "Size of the filesystem.", float64(disk.GetTotal()), diskLabels...)
+		r.add("nodelink_agent_disk_used_bytes", gauge, "Space used on the filesystem.", float64(disk.GetUsed()), diskLabels...)
+		r.add("nodelink_agent_disk_free_bytes", gauge, "Space free on the filesystem.", float64(disk.GetFree()), diskLabels...)
+		r.add("nodelink_agent_disk_used_percent", gauge, "Space used as a percentage of the filesystem's size.", disk.GetUsedPercent(), diskLabels...)
+	}
+
+	if pressure := m.GetPressure(); pressure != nil {
+		collectPressure(r, labels, "cpu", pressure.GetCpu())
+		collectPressure(r, labels, "memory", pressure.GetMemory())
+		collectPressure(r, labels, "io", pressure.GetIo())
+	}
+
+	for _, network := range m.GetNetworkInterfaces() {
+		networkLabels := with(labels, label{"interface", network.GetInterface()})
+		r.add("nodelink_agent_network_receive_bytes_total", counter, "Bytes received on the interface.", float64(network.GetBytesRecv()), networkLabels...)
+		r.add("nodelink_agent_network_transmit_bytes_total", counter, "Bytes sent on the interface.", float64(network.GetBytesSent()), networkLabels...)
+		r.add("nodelink_agent_network_receive_packets_total", counter, "Packets received on the interface.", float64(network.GetPacketsRecv()), networkLabels...)
+		r.add("nodelink_agent_network_transmit_packets_total", counter, "Packets sent on the interface.", float64(network.GetPacketsSent()), networkLabels...)
+		r.add("nodelink_agent_network_receive_errors_total", counter, "Receive errors on the interface.", float64(network.GetErrorsIn()), networkLabels...)
+		r.add("nodelink_agent_network_transmit_errors_total", counter, "Transmit errors on the interface.", float64(network.GetErrorsOut()), networkLabels...)
+		r.add("nodelink_agent_network_receive_drops_total", counter, "Incoming packets dropped on the interface.", float64(network.GetDropsIn()), networkLabels...)
+		r.add("nodelink_agent_network_transmit_drops_total", counter, "Outgoing packets dropped on the interface.", float64(network.GetDropsOut()), networkLabels...)
+		r.add("nodelink_agent_network_receive_bytes_per_second", gauge, "Bytes received on the interface per second since the previous sample.", network.GetBytesRecvPerSec(), networkLabels...)
+		r.add("nodelink_agent_network_transmit_bytes_per_second", gauge, "Bytes sent on the interface per second since the previous sample.", network.GetBytesSentPerSec(), networkLabels...)
+		r.add("nodelink_agent_network_receive_packets_per_second", gauge, "Packets received on the interface per second since the previous sample.", network.GetPacketsRecvPerSec(), networkLabels...)
+		r.add("nodelink_agent_network_transmit_packets_per_second", gauge, "Packets sent on the interface per second since the previous sample.", network.GetPacketsSentPerSec(), networkLabels...)
+	}
+
+	for _, diskIO := range m.GetDiskIo() {
+		deviceLabels := with(labels, label{"device", diskIO.GetDevice()})
+		r.add("nodelink_agent_disk_reads_per_second", gauge, "Reads completed on the device per second.", diskIO.GetReadsPerSec(), deviceLabels...)
+		r.add("nodelink_agent_disk_writes_per_second", gauge, "Writes completed on the device per second.", diskIO.GetWritesPerSec(), deviceLabels...)
+		r.add("nodelink_agent_disk_read_bytes_per_second", gauge, "Bytes read from the device per second.", diskIO.GetReadBytesPerSec(), deviceLabels...)
+		r.add("nodelink_agent_disk_written_bytes_per_second", gauge, "Bytes written to the device per second.", diskIO.GetWriteBytesPerSec(), deviceLabels...)
+		r.add("nodelink_agent_disk_util_percent", gauge, "Share of time the device was busy.", diskIO.GetUtilPercent(), deviceLabels...)
+		r.add("nodelink_agent_disk_read_await_milliseconds", gauge, "Average time a read on the device took.", diskIO.GetReadAwaitMs(), deviceLabels...)
+		r.add("nodelink_agent_disk_write_await_milliseconds", gauge, "Average time a write on the device took.", diskIO.GetWriteAwaitMs(), deviceLabels...)
+	}
+}
+
+// collectPressure exports the pressure stall information of a resource
+func collectPressure(r *registry, labels []label, resource string, stall *pb.PressureStall) {
+	for _, kind := range []struct {
+		name     string
+		averages *pb.PressureAverages
+	}{
+		{"some", stall.GetSome()},
+		{"full", stall.GetFull()},
+	} {
+		if kind.averages == nil {
+			continue
+		}
+		const averageHelp = "Share of time tasks were stalled waiting for the resource, averaged over a window."
+		stallLabels := with(labels, label{"resource", resource}, label{"kind", kind.name})
+		r.add("nodelink_agent_pressure_stalled_seconds_total", counter, "Time tasks were stalled waiting for the resource.", float64(kind.averages.GetTotalUs())/1e6, stallLabels...)
+		r.add("nodelink_agent_pressure_percent", gauge, averageHelp, kind.averages.GetAvg10(), with(stallLabels, label{"window", "10s"})...)
+		r.add("nodelink_agent_pressure_percent", gauge, averageHelp, kind.averages.GetAvg60(), with(stallLabels, label{"window", "60s"})...)
+		r.add("nodelink_agent_pressure_percent", gauge, averageHelp, kind.averages.GetAvg300(), with(stallLabels, label{"window", "300s"})...)
+	}
+}
+
+// collectServer exports the state of the server itself
+func (h *HTTPHandler) collectServer(r *registry) {
+	byStatus := make(map[common.AgentStatus]int)
+	for _, agent := range h.config.StatusManager.GetAllAgents() {
+		byStatus[agent.Status]++
+	}
+	for _, agentStatus := range []common.AgentStatus{common.AgentStatusOnline, common.AgentStatusDegraded, common.AgentStatusOffline} {
+		r.add("nodelink_agents", gauge, "Known agents by status.", float64(byStatus[agentStatus]), label{"status", string(agentStatus)})
+	}
+	r.add("nodelink_connected_agents", gauge, "Agents with an open gRPC stream.", float64(h.config.CommServer.ConnectedAgents()))
+
+	const pendingHelp = "Requests sent to agents that are waiting for a response."
+	r.add("nodelink_pending_requests", gauge, pendingHelp, float64(len(h.config.CommandHandler.GetPendingRequests())), label{"kind", "command"})
+	r.add("nodelink_pending_requests", gauge, pendingHelp, float64(h.config.MetricsHandler.PendingRequests()), label{"kind", "metrics"})
+	r.add("nodelink_pending_requests", gauge, pendingHelp, float64(h.config.TerminalHandler.PendingCommands()), label{"kind", "terminal_command"})
+
+	r.add("nodelink_metrics_pushing_agents", gauge, "Agents pushing their metrics rather than being polled.", float64(h.config.MetricsHandler.PushingAgents()))
+
+	r.add("nodelink_sse_clients", gauge, "Connected SSE clients.", float64(h.config.SSEManager.ClientCount()))
+	rooms := h.config.SSEManager.RoomClients()
+	for _, room := range sortedKeys(rooms) {
+		r.add("nodelink_sse_room_clients", gauge, "SSE clients subscribed to each room.", float64(rooms[room]), label{"room", room})
+	}
+
+	sessions := h.config.TerminalSessions.SessionCounts()
+	for _, sessionStatus := range []common.TerminalStatus{common.TerminalStatusActive, common.TerminalStatusInactive, common.TerminalStatusClosed} {
+		r.add("nodelink_terminal_sessions", gauge, "Terminal sessions by status.", float64(sessions[sessionStatus]), label{"status", string(sessionStatus)})
+	}
+
+	received, sent := h.config.CommServer.MessageCounts()
+	for _, messageType := range sortedKeys(received) {
+		r.add("nodelink_grpc_messages_received_total", counter, "Stream messages received from agents by type.", float64(received[messageType]), label{"type", messageType})
+	}
+	for _, messageType := range sortedKeys(sent) {
+		r.add("nodelink_grpc_messages_sent_total", counter, "Stream messages sent to agents by type.", float64(sent[messageType]), label{"type", messageType})
+	}
+}
+
+// agentLabels returns the labels identifying an agent's samples: its ID and
+// its labels. Keys that end up with the same name keep the first value.
+func agentLabels(agent *common.AgentInfo) []label {
+	labels := []label{{"agent_id", agent.AgentID}}
+
+	seen := make(map[string]bool)
+	for _, key := range sortedKeys(agent.Labels) {
+		name := labelName(key)
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+		labels = append(labels, label{name, agent.Labels[key]})
+	}
+
+	return labels
+}
+
+// sortedKeys returns the keys of a map in order
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
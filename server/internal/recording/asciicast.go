@@ -0,0 +1,151 @@
+package recording
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+
+	"github.com/mooncorn/nodelink/server/internal/common"
+)
+
+// Event codes of an asciicast v2 file
+const (
+	EventOutput = "o" // data written to the terminal
+	EventInput  = "i" // data typed into the terminal
+	EventResize = "r" // data is the new size as COLSxROWS
+	EventMarker = "m" // data is a label, here the user whose input follows
+)
+
+// Header is the first line of an asciicast v2 file
+type Header struct {
+	Version   int               `json:"version"`
+	Width     int               `json:"width"`
+	Height    int               `json:"height"`
+	Timestamp int64             `json:"timestamp,omitempty"`
+	Title     string            `json:"title,omitempty"`
+	Env       map[string]string `json:"env,omitempty"`
+}
+
+// Event is a line after the header, encoded as [time, code, data] where time
+// is in seconds since the start of the recording
+type Event struct {
+	Time float64
+	Code string
+	Data string
+}
+
+// MarshalJSON encodes the event as an asciicast array
+func (e Event) MarshalJSON() ([]byte, error) {
+	// Microsecond precision, as written by asciinema itself
+	return json.Marshal([]interface{}{math.Round(e.Time*1e6) / 1e6, e.Code, e.Data})
+}
+
+// UnmarshalJSON decodes an asciicast event array
+func (e *Event) UnmarshalJSON(data []byte) error {
+	var fields []json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+	if len(fields) != 3 {
+		return fmt.Errorf("asciicast event has %d fields, want 3", len(fields))
+	}
+
+	if err := json.Unmarshal(fields[0], &e.Time); err != nil {
+		return err
+	}
+	if err := json.Unmarshal(fields[1], &e.Code); err != nil {
+		return err
+	}
+	return json.Unmarshal(fields[2], &e.Data)
+}
+
+// Reader reads an asciicast v2 file event by event
+type Reader struct {
+	Header Header
+	reader *bufio.Reader
+}
+
+// NewReader reads the header of an asciicast v2 file
+func NewReader(r io.Reader) (*Reader, error) {
+	reader := &Reader{reader: bufio.NewReader(r)}
+
+	line, err := reader.reader.ReadBytes('\n')
+	if err != nil && len(line) == 0 {
+		return nil, fmt.Errorf("failed to read asciicast header: %w", err)
+	}
+	if err := json.Unmarshal(line, &reader.Header); err != nil {
+		return nil, fmt.Errorf("invalid asciicast header: %w", err)
+	}
+	if reader.Header.Version != 2 {
+		return nil, fmt.Errorf("unsupported asciicast version %d", reader.Header.Version)
+	}
+
+	return reader, nil
+}
+
+// Next returns the next event, or io.EOF after the last one. A truncated last
+// line, as left by a recording still in progress, counts as the end.
+func (r *Reader) Next() (*Event, error) {
+	for {
+		line, err := r.reader.ReadBytes('\n')
+		if err != nil {
+			return nil, io.EOF
+		}
+		if len(line) <= 1 {
+			continue
+		}
+
+		var event Event
+		if err := json.Unmarshal(line, &event); err != nil {
+			return nil, fmt.Errorf("invalid asciicast event: %w", err)
+		}
+		return &event, nil
+	}
+}
+
+// replay reads a recording as the events sent to replay clients
+type replay struct {
+	reader *Reader
+	file   io.Closer
+}
+
+// Info describes the recording from its header
+func (r *replay) Info() map[string]interface{} {
+	return map[string]interface{}{
+		"rows":      r.reader.Header.Height,
+		"cols":      r.reader.Header.Width,
+		"title":     r.reader.Header.Title,
+		"timestamp": r.reader.Header.Timestamp,
+	}
+}
+
+// Next returns the next output, input or resize event, skipping markers and
+// codes from other recorders
+func (r *replay) Next() (*common.TerminalReplayEvent, error) {
+	for {
+		event, err := r.reader.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		switch event.Code {
+		case EventOutput:
+			return &common.TerminalReplayEvent{Time: event.Time, Type: "replay_output", Data: map[string]interface{}{"output": event.Data}}, nil
+		case EventInput:
+			return &common.TerminalReplayEvent{Time: event.Time, Type: "replay_input", Data: map[string]interface{}{"input": event.Data}}, nil
+		case EventResize:
+			var cols, rows int
+			if _, err := fmt.Sscanf(event.Data, "%dx%d", &cols, &rows); err != nil {
+				continue
+			}
+			return &common.TerminalReplayEvent{Time: event.Time, Type: "replay_resize", Data: map[string]interface{}{"rows": rows, "cols": cols}}, nil
+		}
+	}
+}
+
+// Close closes the recording file
+func (r *replay) Close() error {
+	return r.file.Close()
+}
@@ -0,0 +1,112 @@
+package recording
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mooncorn/nodelink/server/internal/auth"
+	"github.com/mooncorn/nodelink/server/internal/common"
+)
+
+// HTTPHandler handles HTTP requests for terminal recordings and recording policies
+type HTTPHandler struct {
+	manager       *Manager
+	statusManager common.StatusManager
+}
+
+// NewHTTPHandler creates a new HTTP handler for terminal recordings
+func NewHTTPHandler(manager *Manager, statusManager common.StatusManager) *HTTPHandler {
+	return &HTTPHandler{
+		manager:       manager,
+		statusManager: statusManager,
+	}
+}
+
+// RegisterRoutes registers recording routes
+func (h *HTTPHandler) RegisterRoutes(router gin.IRouter) {
+	router.GET("/terminals/:sessionId/recording", h.downloadRecording)
+	router.GET("/agents/:agentId/recording-policy", h.getRecordingPolicy)
+	router.PUT("/agents/:agentId/recording-policy", h.setRecordingPolicy)
+}
+
+// RecordingPolicyRequest represents the request to change an agent's recording policy
+type RecordingPolicyRequest struct {
+	Force *bool `json:"force" binding:"required"`
+}
+
+// RecordingPolicyResponse describes whether an agent's terminal sessions are recorded
+type RecordingPolicyResponse struct {
+	AgentID        string `json:"agent_id"`
+	Force          bool   `json:"force"`           // recorded even if the client opts out
+	DefaultEnabled bool   `json:"default_enabled"` // recorded unless the client opts out
+}
+
+// downloadRecording handles GET /terminals/:sessionId/recording
+func (h *HTTPHandler) downloadRecording(c *gin.Context) {
+	sessionID := c.Param("sessionId")
+
+	userID := auth.UserIDFromContext(c)
+	if userID == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User authentication required"})
+		return
+	}
+
+	_, reader, err := h.manager.Open(sessionID, userID)
+	if err != nil {
+		switch err {
+		case common.ErrRecordingNotFound:
+			c.JSON(http.StatusNotFound, gin.H{"error": "Recording not found"})
+		case common.ErrUnauthorizedTerminalAccess:
+			c.JSON(http.StatusForbidden, gin.H{"error": "Unauthorized access to recording"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+	defer reader.Close()
+
+	// The length isn't known up front since the session may still be recording
+	c.DataFromReader(http.StatusOK, -1, "application/x-asciicast", reader, map[string]string{
+		"Content-Disposition": fmt.Sprintf(`attachment; filename="%s.cast"`, sessionID),
+	})
+}
+
+// getRecordingPolicy handles GET /agents/:agentId/recording-policy
+func (h *HTTPHandler) getRecordingPolicy(c *gin.Context) {
+	agentID := c.Param("agentId")
+
+	agent, exists := h.statusManager.GetAgent(agentID)
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{"error": common.ErrAgentNotFound.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, h.policyResponse(agent))
+}
+
+// setRecordingPolicy handles PUT /agents/:agentId/recording-policy
+func (h *HTTPHandler) setRecordingPolicy(c *gin.Context) {
+	var req RecordingPolicyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON body, force is required"})
+		return
+	}
+
+	agent, err := h.statusManager.SetForceRecording(c.Param("agentId"), *req.Force)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, h.policyResponse(agent))
+}
+
+// policyResponse describes an agent's recording policy
+func (h *HTTPHandler) policyResponse(agent *common.AgentInfo) RecordingPolicyResponse {
+	return RecordingPolicyResponse{
+		AgentID:        agent.AgentID,
+		Force:          agent.ForceRecording,
+		DefaultEnabled: h.manager.DefaultEnabled(),
+	}
+}
@@ -0,0 +1,248 @@
+package recording
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/mooncorn/nodelink/server/internal/common"
+)
+
+// Manager records terminal sessions in asciicast v2 format
+type Manager struct {
+	store          common.RecordingStore
+	statusManager  common.StatusManager
+	defaultEnabled bool
+
+	recordings map[string]*recording
+	mu         sync.Mutex
+}
+
+// recording is a session being recorded
+type recording struct {
+	info      *common.RecordingInfo
+	writer    io.WriteCloser
+	inputUser string // user who typed the latest input
+	failed    bool   // stop writing after an error rather than leave a corrupt file
+	mu        sync.Mutex
+}
+
+// NewManager creates a recording manager. With defaultEnabled, sessions are
+// recorded unless the client opts out.
+func NewManager(store common.RecordingStore, statusManager common.StatusManager, defaultEnabled bool) *Manager {
+	return &Manager{
+		store:          store,
+		statusManager:  statusManager,
+		defaultEnabled: defaultEnabled,
+		recordings:     make(map[string]*recording),
+	}
+}
+
+// DefaultEnabled reports whether sessions are recorded when the client doesn't say
+func (m *Manager) DefaultEnabled() bool {
+	return m.defaultEnabled
+}
+
+// ShouldRecord decides whether a new session is recorded. Agents with a forced
+// recording policy are always recorded.
+func (m *Manager) ShouldRecord(agentID string, requested *bool) bool {
+	if agent, exists := m.statusManager.GetAgent(agentID); exists && agent.ForceRecording {
+		return true
+	}
+	if requested != nil {
+		return *requested
+	}
+	return m.defaultEnabled
+}
+
+// Start begins recording a session
+func (m *Manager) Start(session *common.TerminalSession) error {
+	now := time.Now()
+	info := &common.RecordingInfo{
+		SessionID: session.SessionID,
+		UserID:    session.UserID,
+		AgentID:   session.AgentID,
+		Shell:     session.Shell,
+		Rows:      session.Rows,
+		Cols:      session.Cols,
+		StartedAt: now,
+	}
+
+	writer, err := m.store.Create(info)
+	if err != nil {
+		return err
+	}
+
+	rec := &recording{info: info, writer: writer}
+	header := Header{
+		Version:   2,
+		Width:     session.Cols,
+		Height:    session.Rows,
+		Timestamp: now.Unix(),
+		Title:     fmt.Sprintf("%s on %s", session.Shell, session.AgentID),
+		Env:       map[string]string{"SHELL": session.Shell, "TERM": "xterm-256color"},
+	}
+	if err := rec.writeLine(header); err != nil {
+		writer.Close()
+		return err
+	}
+
+	m.mu.Lock()
+	m.recordings[session.SessionID] = rec
+	m.mu.Unlock()
+
+	return nil
+}
+
+// RecordOutput records output written to a session's terminal
+func (m *Manager) RecordOutput(sessionID string, data []byte) {
+	m.record(sessionID, EventOutput, string(data))
+}
+
+// RecordInput records input typed into a session's terminal. A marker naming
+// the user precedes input typed by someone else than the input before it.
+func (m *Manager) RecordInput(sessionID, userID string, data []byte) {
+	m.mu.Lock()
+	rec, exists := m.recordings[sessionID]
+	m.mu.Unlock()
+
+	if !exists {
+		return
+	}
+
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+
+	if rec.inputUser != userID {
+		rec.inputUser = userID
+		rec.writeEvent(EventMarker, "input by "+userID)
+	}
+	rec.writeEvent(EventInput, string(data))
+}
+
+// RecordResize records a change of a session's terminal size
+func (m *Manager) RecordResize(sessionID string, rows, cols int) {
+	m.record(sessionID, EventResize, fmt.Sprintf("%dx%d", cols, rows))
+}
+
+// Stop finishes a session's recording. Stopping a session that isn't being
+// recorded does nothing.
+func (m *Manager) Stop(sessionID string) {
+	m.mu.Lock()
+	rec, exists := m.recordings[sessionID]
+	delete(m.recordings, sessionID)
+	m.mu.Unlock()
+
+	if exists {
+		m.finish(rec)
+	}
+}
+
+// Close finishes all recordings, e.g. on shutdown
+func (m *Manager) Close() {
+	m.mu.Lock()
+	recordings := m.recordings
+	m.recordings = make(map[string]*recording)
+	m.mu.Unlock()
+
+	for _, rec := range recordings {
+		m.finish(rec)
+	}
+}
+
+// Open returns a recording's metadata and contents if the user may access it
+func (m *Manager) Open(sessionID, userID string) (*common.RecordingInfo, io.ReadCloser, error) {
+	info, err := m.store.GetInfo(sessionID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if info.UserID != userID {
+		return nil, nil, common.ErrUnauthorizedTerminalAccess
+	}
+
+	reader, err := m.store.Open(sessionID)
+	if err != nil {
+		return nil, nil, err
+	}
+	return info, reader, nil
+}
+
+// OpenReplay opens a recording for replay if the user may access it
+func (m *Manager) OpenReplay(sessionID, userID string) (common.TerminalReplay, error) {
+	_, file, err := m.Open(sessionID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	reader, err := NewReader(file)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return &replay{reader: reader, file: file}, nil
+}
+
+// record appends an event to a session's recording
+func (m *Manager) record(sessionID, code, data string) {
+	m.mu.Lock()
+	rec, exists := m.recordings[sessionID]
+	m.mu.Unlock()
+
+	if !exists {
+		return
+	}
+
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+
+	rec.writeEvent(code, data)
+}
+
+// finish closes a recording and stores its final metadata
+func (m *Manager) finish(rec *recording) {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+
+	if err := rec.writer.Close(); err != nil {
+		log.Printf("Failed to close recording of terminal session %s: %v", rec.info.SessionID, err)
+	}
+
+	endedAt := time.Now()
+	rec.info.EndedAt = &endedAt
+	if err := m.store.SaveInfo(rec.info); err != nil {
+		log.Printf("Failed to save recording of terminal session %s: %v", rec.info.SessionID, err)
+	}
+}
+
+// writeEvent writes an event timed from the start of the recording; the caller must hold the lock
+func (r *recording) writeEvent(code, data string) {
+	event := Event{Time: time.Since(r.info.StartedAt).Seconds(), Code: code, Data: data}
+	if err := r.writeLine(event); err != nil {
+		log.Printf("Failed to record terminal session %s: %v", r.info.SessionID, err)
+	}
+}
+
+// writeLine writes a JSON value as one line; the caller must hold the lock
+// unless the recording isn't shared yet
+func (r *recording) writeLine(value interface{}) error {
+	if r.failed {
+		return nil
+	}
+
+	line, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	// Each line is written at once so the file is always readable up to the last event
+	n, err := r.writer.Write(line)
+	r.info.Size += int64(n)
+	if err != nil {
+		r.failed = true
+	}
+	return err
+}
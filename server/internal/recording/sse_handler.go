@@ -0,0 +1,57 @@
+package recording
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mooncorn/nodelink/server/internal/common"
+	"github.com/mooncorn/nodelink/server/internal/sse"
+)
+
+// SSEHandler replays terminal recordings over SSE
+type SSEHandler struct {
+	manager       *Manager
+	streamBuilder *sse.StreamBuilder
+}
+
+// NewSSEHandler creates a new SSE handler for replaying recordings
+func NewSSEHandler(manager *Manager, sseManager common.SSEManager) *SSEHandler {
+	return &SSEHandler{
+		manager:       manager,
+		streamBuilder: sse.NewStreamBuilder(sseManager),
+	}
+}
+
+// RegisterRoutes registers SSE routes for recording replay
+func (h *SSEHandler) RegisterRoutes(router gin.IRouter) {
+	router.GET("/terminals/:sessionId/recording/replay", h.handleReplay)
+}
+
+// handleReplay handles GET /terminals/:sessionId/recording/replay. The events
+// of the recording are re-emitted with their original timing divided by
+// speed; max_idle caps pauses to that many seconds.
+func (h *SSEHandler) handleReplay(c *gin.Context) {
+	speed := 1.0
+	if value := c.Query("speed"); value != "" {
+		parsed, err := strconv.ParseFloat(value, 64)
+		if err != nil || parsed <= 0 || parsed > common.MaxReplaySpeed {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("speed must be greater than 0 and at most %g", common.MaxReplaySpeed)})
+			return
+		}
+		speed = parsed
+	}
+
+	var maxIdle float64
+	if value := c.Query("max_idle"); value != "" {
+		parsed, err := strconv.ParseFloat(value, 64)
+		if err != nil || parsed <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "max_idle must be a positive number of seconds"})
+			return
+		}
+		maxIdle = parsed
+	}
+
+	h.streamBuilder.ForReplay("").WithSource(h.manager).WithTiming(speed, maxIdle).Handle(c)
+}
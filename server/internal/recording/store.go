@@ -0,0 +1,117 @@
+package recording
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/mooncorn/nodelink/server/internal/common"
+)
+
+// DirStore keeps recordings in a directory, each as SESSION.cast with its
+// metadata next to it in SESSION.json
+type DirStore struct {
+	dir string
+}
+
+// NewDirStore creates a store in the given directory, creating it if needed
+func NewDirStore(dir string) (*DirStore, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create recording directory: %w", err)
+	}
+	return &DirStore{dir: dir}, nil
+}
+
+// Create starts a new recording, returning a writer for its contents
+func (s *DirStore) Create(info *common.RecordingInfo) (io.WriteCloser, error) {
+	path, err := s.path(info.SessionID, ".cast")
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create recording: %w", err)
+	}
+
+	if err := s.SaveInfo(info); err != nil {
+		file.Close()
+		os.Remove(path)
+		return nil, err
+	}
+
+	return file, nil
+}
+
+// Open returns a reader for a recording's contents
+func (s *DirStore) Open(sessionID string) (io.ReadCloser, error) {
+	path, err := s.path(sessionID, ".cast")
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, common.ErrRecordingNotFound
+	}
+	return file, err
+}
+
+// GetInfo returns a recording's metadata
+func (s *DirStore) GetInfo(sessionID string) (*common.RecordingInfo, error) {
+	path, err := s.path(sessionID, ".json")
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, common.ErrRecordingNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var info common.RecordingInfo
+	if err := json.Unmarshal(data, &info); err != nil {
+		return nil, fmt.Errorf("invalid recording metadata: %w", err)
+	}
+	return &info, nil
+}
+
+// SaveInfo replaces a recording's metadata
+func (s *DirStore) SaveInfo(info *common.RecordingInfo) error {
+	path, err := s.path(info.SessionID, ".json")
+	if err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(info, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// Write to a temporary file first so readers never see partial metadata
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("failed to save recording metadata: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to save recording metadata: %w", err)
+	}
+	return nil
+}
+
+// path returns the file for a session, refusing IDs that would leave the directory
+func (s *DirStore) path(sessionID, ext string) (string, error) {
+	if sessionID == "" || sessionID == "." || sessionID == ".." || strings.ContainsAny(sessionID, `/\`) {
+		return "", common.ErrRecordingNotFound
+	}
+	return filepath.Join(s.dir, sessionID+ext), nil
+}
@@ -0,0 +1,91 @@
+package rotation
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mooncorn/nodelink/server/internal/common"
+)
+
+// HTTPHandler handles HTTP requests for credential rotation
+type HTTPHandler struct {
+	manager *Manager
+}
+
+// NewHTTPHandler creates a new HTTP handler for credential rotation
+func NewHTTPHandler(manager *Manager) *HTTPHandler {
+	return &HTTPHandler{
+		manager: manager,
+	}
+}
+
+// RegisterRoutes registers credential rotation routes with the given router
+func (h *HTTPHandler) RegisterRoutes(router gin.IRouter) {
+	credentials := router.Group("/credentials")
+	{
+		credentials.POST("/rotate", h.rotateAll)
+		credentials.GET("/rotations", h.listRotations)
+		credentials.POST("/:agentId/rotate", h.rotateAgent)
+		credentials.GET("/:agentId/rotation", h.getRotation)
+	}
+}
+
+// rotateAll handles POST /credentials/rotate
+func (h *HTTPHandler) rotateAll(c *gin.Context) {
+	rotations, err := h.manager.RotateAll()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"rotations": rotations,
+		"count":     len(rotations),
+	})
+}
+
+// rotateAgent handles POST /credentials/:agentId/rotate
+func (h *HTTPHandler) rotateAgent(c *gin.Context) {
+	rotation, err := h.manager.Rotate(c.Param("agentId"))
+	if err != nil {
+		switch {
+		case errors.Is(err, common.ErrCredentialNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "Credential not found"})
+		case errors.Is(err, common.ErrCredentialRevoked):
+			c.JSON(http.StatusConflict, gin.H{"error": "Credential is revoked"})
+		case errors.Is(err, common.ErrAgentNotConnected):
+			c.JSON(http.StatusConflict, gin.H{"error": "Agent is not connected"})
+		case errors.Is(err, common.ErrRotationInProgress):
+			c.JSON(http.StatusConflict, gin.H{"error": "Credential rotation already in progress"})
+		case errors.Is(err, common.ErrRotationUnconfirmed):
+			c.JSON(http.StatusConflict, gin.H{"error": "Agent has not confirmed the previous rotation, try again once its grace period ends"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusAccepted, rotation)
+}
+
+// listRotations handles GET /credentials/rotations
+func (h *HTTPHandler) listRotations(c *gin.Context) {
+	rotations := h.manager.ListRotations()
+
+	c.JSON(http.StatusOK, gin.H{
+		"rotations": rotations,
+		"count":     len(rotations),
+	})
+}
+
+// getRotation handles GET /credentials/:agentId/rotation
+func (h *HTTPHandler) getRotation(c *gin.Context) {
+	rotation, exists := h.manager.GetRotation(c.Param("agentId"))
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No rotation found for agent"})
+		return
+	}
+
+	c.JSON(http.StatusOK, rotation)
+}
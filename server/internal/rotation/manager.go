@@ -0,0 +1,395 @@
+package rotation
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mooncorn/nodelink/server/internal/auth"
+	"github.com/mooncorn/nodelink/server/internal/common"
+	pb "github.com/mooncorn/nodelink/server/internal/proto"
+)
+
+// pendingRotation is a rotation waiting for the agent's acknowledgement
+type pendingRotation struct {
+	rotation *common.CredentialRotation
+	timer    *time.Timer
+}
+
+// Manager pushes new tokens to connected agents and tracks the outcome per agent
+type Manager struct {
+	store         common.CredentialStore
+	statusManager common.StatusManager
+	gracePeriod   time.Duration
+	ackTimeout    time.Duration
+
+	mu           sync.Mutex
+	streamSender common.StreamSender
+	pending      map[string]*pendingRotation           // by rotation ID
+	latest       map[string]*common.CredentialRotation // by agent ID
+	rotating     map[string]bool                       // agents a rotation is being prepared for
+}
+
+// NewManager creates a new credential rotation manager
+func NewManager(store common.CredentialStore, statusManager common.StatusManager, gracePeriod time.Duration) *Manager {
+	if gracePeriod <= 0 {
+		gracePeriod = common.DefaultRotationGracePeriod
+	}
+
+	return &Manager{
+		store:         store,
+		statusManager: statusManager,
+		gracePeriod:   gracePeriod,
+		ackTimeout:    common.RotationAckTimeout,
+		pending:       make(map[string]*pendingRotation),
+		latest:        make(map[string]*common.CredentialRotation),
+		rotating:      make(map[string]bool),
+	}
+}
+
+// SetStreamSender sets the stream sender for the manager
+func (m *Manager) SetStreamSender(sender common.StreamSender) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.streamSender = sender
+}
+
+// Rotate issues a new token to a connected agent. The returned rotation is
+// pending until the agent acknowledges it. An agent that didn't acknowledge
+// its last rotation may still hold the token before it, so it isn't rotated
+// again until that token's grace period is over.
+func (m *Manager) Rotate(agentID string) (*common.CredentialRotation, error) {
+	if err := m.begin(agentID); err != nil {
+		return nil, err
+	}
+	defer m.end(agentID)
+
+	if !m.statusManager.IsAgentOnline(agentID) {
+		return nil, common.ErrAgentNotConnected
+	}
+
+	m.mu.Lock()
+	streamSender := m.streamSender
+	m.mu.Unlock()
+	if streamSender == nil {
+		return nil, fmt.Errorf("stream sender not configured")
+	}
+
+	// Hashing is slow, so it happens before taking the lock
+	token, err := auth.GenerateToken()
+	if err != nil {
+		return nil, err
+	}
+
+	hash, err := auth.HashToken(token)
+	if err != nil {
+		return nil, err
+	}
+
+	rotation := &common.CredentialRotation{
+		ID:        uuid.New().String(),
+		AgentID:   agentID,
+		Status:    common.RotationPending,
+		StartedAt: time.Now(),
+	}
+
+	previous, err := m.saveRotated(rotation, hash)
+	if err != nil {
+		return nil, err
+	}
+
+	err = streamSender.SendToAgent(agentID, &pb.ServerMessage{
+		Message: &pb.ServerMessage_CredentialRotationRequest{
+			CredentialRotationRequest: &pb.CredentialRotationRequest{
+				RotationId: rotation.ID,
+				AgentToken: token,
+			},
+		},
+	})
+	if err != nil {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+
+		if pending, exists := m.pending[rotation.ID]; exists {
+			pending.timer.Stop()
+			delete(m.pending, rotation.ID)
+		}
+
+		// The agent never saw the new token, so it must keep the old one
+		if restoreErr := m.restore(agentID, previous); restoreErr != nil {
+			log.Printf("Failed to restore credential for agent %s: %v", agentID, restoreErr)
+		}
+		m.complete(rotation, common.RotationFailed, fmt.Sprintf("failed to send rotation: %v", err))
+		return copyRotation(rotation), nil
+	}
+
+	log.Printf("Credential rotation %s sent to agent %s", rotation.ID, agentID)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return copyRotation(rotation), nil
+}
+
+// begin claims an agent for a rotation so that only one runs at a time
+func (m *Manager) begin(agentID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.rotating[agentID] {
+		return common.ErrRotationInProgress
+	}
+	if latest, exists := m.latest[agentID]; exists && latest.Status == common.RotationPending {
+		return common.ErrRotationInProgress
+	}
+
+	m.rotating[agentID] = true
+	return nil
+}
+
+// end releases an agent claimed by begin
+func (m *Manager) end(agentID string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.rotating, agentID)
+}
+
+// saveRotated makes the new token hash current, keeping the old one for the
+// grace period, and starts waiting for the agent's acknowledgement. It returns
+// the credential as it was before.
+func (m *Manager) saveRotated(rotation *common.CredentialRotation, hash string) (*common.AgentCredential, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	credential, err := m.store.GetCredential(rotation.AgentID)
+	if err != nil {
+		return nil, err
+	}
+	if credential.RevokedAt != nil {
+		return nil, common.ErrCredentialRevoked
+	}
+
+	now := rotation.StartedAt
+	if credential.RotationUnconfirmed(now) {
+		return nil, common.ErrRotationUnconfirmed
+	}
+
+	// The new token takes effect immediately; the old one stays valid for the grace period
+	previous := *credential
+	graceEnd := now.Add(m.gracePeriod)
+	credential.PreviousTokenHash = credential.TokenHash
+	credential.PreviousExpiresAt = &graceEnd
+	credential.TokenHash = hash
+	credential.RotatedAt = &now
+
+	if err := m.store.SaveCredential(credential); err != nil {
+		return nil, fmt.Errorf("failed to save rotated credential: %w", err)
+	}
+
+	// Registered before sending so an early acknowledgement finds it
+	m.latest[rotation.AgentID] = rotation
+	m.pending[rotation.ID] = &pendingRotation{
+		rotation: rotation,
+		timer: time.AfterFunc(m.ackTimeout, func() {
+			m.expire(rotation.ID)
+		}),
+	}
+
+	return &previous, nil
+}
+
+// RotateAll rotates the credentials of every agent with an active credential.
+// Agents that aren't connected are skipped and keep their current token.
+func (m *Manager) RotateAll() ([]*common.CredentialRotation, error) {
+	credentials, err := m.store.ListCredentials()
+	if err != nil {
+		return nil, err
+	}
+
+	var active []*common.AgentCredential
+	for _, credential := range credentials {
+		if credential.RevokedAt == nil {
+			active = append(active, credential)
+		}
+	}
+
+	rotations := make([]*common.CredentialRotation, len(active))
+	semaphore := make(chan struct{}, common.RotationConcurrency)
+	var wg sync.WaitGroup
+	for i, credential := range active {
+		wg.Add(1)
+		semaphore <- struct{}{}
+		go func(i int, agentID string) {
+			defer wg.Done()
+			defer func() { <-semaphore }()
+
+			rotation, err := m.Rotate(agentID)
+			if err != nil {
+				rotation = m.skip(agentID, err)
+			}
+			rotations[i] = rotation
+		}(i, credential.AgentID)
+	}
+	wg.Wait()
+
+	return rotations, nil
+}
+
+// HandleRotationResponse records an agent's acknowledgement of a rotation
+func (m *Manager) HandleRotationResponse(agentID string, response *pb.CredentialRotationResponse) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	pending, exists := m.pending[response.RotationId]
+	if !exists || pending.rotation.AgentID != agentID {
+		return fmt.Errorf("no pending rotation found for ID: %s", response.RotationId)
+	}
+
+	pending.timer.Stop()
+	delete(m.pending, response.RotationId)
+
+	if response.Success {
+		if err := m.confirm(agentID); err != nil {
+			log.Printf("Failed to record confirmed rotation for agent %s: %v", agentID, err)
+		}
+		m.complete(pending.rotation, common.RotationSucceeded, "")
+		log.Printf("Agent %s completed credential rotation %s", agentID, response.RotationId)
+		return nil
+	}
+
+	// The agent couldn't persist the new token, so put the old one back
+	if err := m.restorePrevious(agentID); err != nil {
+		log.Printf("Failed to restore credential for agent %s: %v", agentID, err)
+	}
+	m.complete(pending.rotation, common.RotationFailed, response.Error)
+	log.Printf("Agent %s failed credential rotation %s: %s", agentID, response.RotationId, response.Error)
+	return nil
+}
+
+// GetRotation returns the most recent rotation for an agent
+func (m *Manager) GetRotation(agentID string) (*common.CredentialRotation, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	rotation, exists := m.latest[agentID]
+	if !exists {
+		return nil, false
+	}
+	return copyRotation(rotation), true
+}
+
+// ListRotations returns the most recent rotation for every agent
+func (m *Manager) ListRotations() []*common.CredentialRotation {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	rotations := make([]*common.CredentialRotation, 0, len(m.latest))
+	for _, rotation := range m.latest {
+		rotations = append(rotations, copyRotation(rotation))
+	}
+
+	sort.Slice(rotations, func(i, j int) bool {
+		return rotations[i].AgentID < rotations[j].AgentID
+	})
+
+	return rotations
+}
+
+// expire marks a rotation as timed out. Both tokens stay valid for the grace
+// period because the agent may have persisted the new one without acknowledging.
+func (m *Manager) expire(rotationID string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	pending, exists := m.pending[rotationID]
+	if !exists {
+		return
+	}
+	delete(m.pending, rotationID)
+
+	m.complete(pending.rotation, common.RotationTimedOut, "agent did not acknowledge the rotation")
+	log.Printf("Credential rotation %s for agent %s timed out", rotationID, pending.rotation.AgentID)
+}
+
+// skip records a rotation that was never attempted
+func (m *Manager) skip(agentID string, reason error) *common.CredentialRotation {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// Don't hide a rotation that is still waiting for its acknowledgement
+	if errors.Is(reason, common.ErrRotationInProgress) {
+		return copyRotation(m.latest[agentID])
+	}
+
+	rotation := &common.CredentialRotation{
+		ID:        uuid.New().String(),
+		AgentID:   agentID,
+		StartedAt: time.Now(),
+	}
+	m.complete(rotation, common.RotationSkipped, reason.Error())
+	return copyRotation(rotation)
+}
+
+// complete finalizes a rotation. Must be called with the lock held.
+func (m *Manager) complete(rotation *common.CredentialRotation, status common.RotationStatus, message string) {
+	now := time.Now()
+	rotation.Status = status
+	rotation.Error = message
+	rotation.CompletedAt = &now
+	m.latest[rotation.AgentID] = rotation
+}
+
+// confirm records that the agent holds the current token. Must be called with the lock held.
+func (m *Manager) confirm(agentID string) error {
+	credential, err := m.store.GetCredential(agentID)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	credential.RotationConfirmedAt = &now
+	return m.store.SaveCredential(credential)
+}
+
+// restore puts back the tokens a credential had before a rotation, keeping
+// other changes such as a revocation. Must be called with the lock held.
+func (m *Manager) restore(agentID string, previous *common.AgentCredential) error {
+	credential, err := m.store.GetCredential(agentID)
+	if err != nil {
+		return err
+	}
+
+	credential.TokenHash = previous.TokenHash
+	credential.PreviousTokenHash = previous.PreviousTokenHash
+	credential.PreviousExpiresAt = previous.PreviousExpiresAt
+	credential.RotatedAt = previous.RotatedAt
+
+	return m.store.SaveCredential(credential)
+}
+
+// restorePrevious makes the pre-rotation token current again. Must be called with the lock held.
+func (m *Manager) restorePrevious(agentID string) error {
+	credential, err := m.store.GetCredential(agentID)
+	if err != nil {
+		return err
+	}
+	if credential.PreviousTokenHash == "" {
+		return nil
+	}
+
+	credential.TokenHash = credential.PreviousTokenHash
+	credential.PreviousTokenHash = ""
+	credential.PreviousExpiresAt = nil
+
+	return m.store.SaveCredential(credential)
+}
+
+// copyRotation returns a snapshot of a rotation that is safe to hand out
+func copyRotation(rotation *common.CredentialRotation) *common.CredentialRotation {
+	rotationCopy := *rotation
+	return &rotationCopy
+}
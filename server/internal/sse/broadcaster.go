@@ -34,15 +34,33 @@ func (b *Broadcaster) AgentStatus(event common.StatusChangeEvent) {
 	}
 }
 
-// TerminalOutput broadcasts terminal output to the session-specific room
-func (b *Broadcaster) TerminalOutput(sessionID string, output []byte) {
+// AgentLatency broadcasts an agent's ping round-trip statistics
+func (b *Broadcaster) AgentLatency(stats *common.LatencyStats) {
+	if err := b.sseManager.SendToRoom("agents", stats, "agent_latency"); err != nil {
+		log.Printf("Failed to broadcast agent latency to agents room: %v", err)
+	}
+
+	agentRoom := "agent_" + stats.AgentID
+	if err := b.sseManager.SendToRoom(agentRoom, stats, "latency"); err != nil {
+		log.Printf("Failed to broadcast latency to agent room %s: %v", agentRoom, err)
+	}
+}
+
+// TerminalOutput broadcasts terminal output to the session-specific room. The
+// offset is the number of bytes the session has written up to the end of it;
+// the command ID names the command that produced it, if known.
+func (b *Broadcaster) TerminalOutput(sessionID string, output []byte, offset int64, commandID string) {
 	room := "terminal_" + sessionID
 	
 	outputData := map[string]interface{}{
 		"session_id": sessionID,
 		"output":     string(output),
+		"offset":     offset,
 		"timestamp":  time.Now().Unix(),
 	}
+	if commandID != "" {
+		outputData["command_id"] = commandID
+	}
 
 	if err := b.sseManager.SendToRoom(room, outputData, "terminal_output"); err != nil {
 		log.Printf("Failed to broadcast terminal output to room %s: %v", room, err)
@@ -65,6 +83,60 @@ func (b *Broadcaster) TerminalStatus(sessionID, status, message string) {
 	}
 }
 
+// TerminalPresence broadcasts a user joining or leaving a terminal session,
+// along with everyone attached afterwards
+func (b *Broadcaster) TerminalPresence(sessionID, userID, action string, attached []common.TerminalPresence) {
+	room := "terminal_" + sessionID
+
+	presenceData := map[string]interface{}{
+		"session_id": sessionID,
+		"user_id":    userID,
+		"action":     action,
+		"attached":   attached,
+		"timestamp":  time.Now().Unix(),
+	}
+
+	if err := b.sseManager.SendToRoom(room, presenceData, "terminal_presence"); err != nil {
+		log.Printf("Failed to broadcast terminal presence to room %s: %v", room, err)
+	}
+}
+
+// CommandOutput broadcasts a chunk of streaming command output to the command room
+func (b *Broadcaster) CommandOutput(chunk *common.CommandOutputChunk) {
+	room := "command_" + chunk.RequestID
+
+	if err := b.sseManager.SendToRoom(room, chunk, "command_output"); err != nil {
+		log.Printf("Failed to broadcast command output to room %s: %v", room, err)
+	}
+}
+
+// CommandExit broadcasts the final status of a streaming command to the command room
+func (b *Broadcaster) CommandExit(exit *common.CommandExit) {
+	room := "command_" + exit.RequestID
+
+	if err := b.sseManager.SendToRoom(room, exit, "command_exit"); err != nil {
+		log.Printf("Failed to broadcast command exit to room %s: %v", room, err)
+	}
+}
+
+// FanoutResult broadcasts the outcome of a fan-out on one agent to the fan-out room
+func (b *Broadcaster) FanoutResult(result *common.FanoutResult) {
+	room := "fanout_" + result.FanoutID
+
+	if err := b.sseManager.SendToRoom(room, result, "fanout_result"); err != nil {
+		log.Printf("Failed to broadcast fan-out result to room %s: %v", room, err)
+	}
+}
+
+// FanoutComplete broadcasts the final state of a fan-out to the fan-out room
+func (b *Broadcaster) FanoutComplete(fanout *common.Fanout) {
+	room := "fanout_" + fanout.ID
+
+	if err := b.sseManager.SendToRoom(room, fanout, "fanout_complete"); err != nil {
+		log.Printf("Failed to broadcast fan-out completion to room %s: %v", room, err)
+	}
+}
+
 // Metrics broadcasts system metrics to the agent-specific metrics room
 func (b *Broadcaster) Metrics(agentID string, metrics *pb.SystemMetrics) {
 	room := "metrics_" + agentID
@@ -135,6 +135,26 @@ func (m *Manager) RemoveClient(clientID string) {
 	log.Printf("SSE Client disconnected: %s", clientID)
 }
 
+// ClientCount returns the number of connected clients
+func (m *Manager) ClientCount() int {
+	m.clientsMu.RLock()
+	defer m.clientsMu.RUnlock()
+
+	return len(m.clients)
+}
+
+// RoomClients returns the number of clients in each room
+func (m *Manager) RoomClients() map[string]int {
+	m.roomsMu.RLock()
+	defer m.roomsMu.RUnlock()
+
+	counts := make(map[string]int, len(m.rooms))
+	for room, clients := range m.rooms {
+		counts[room] = len(clients)
+	}
+	return counts
+}
+
 // JoinRoom adds a client to a room
 func (m *Manager) JoinRoom(clientID, room string) error {
 	m.clientsMu.RLock()
@@ -3,10 +3,12 @@ package sse
 import (
 	"encoding/json"
 	"fmt"
+	"io"
 	"log"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/mooncorn/nodelink/server/internal/auth"
 	"github.com/mooncorn/nodelink/server/internal/common"
 )
 
@@ -46,6 +48,32 @@ func (b *StreamBuilder) ForMetrics(agentID string) *MetricsStreamBuilder {
 	}
 }
 
+// ForCommand creates a streaming command output builder
+func (b *StreamBuilder) ForCommand(requestID string) *CommandStreamBuilder {
+	return &CommandStreamBuilder{
+		builder:   b,
+		requestID: requestID,
+	}
+}
+
+// ForFanout creates a fan-out stream builder
+func (b *StreamBuilder) ForFanout(fanoutID string) *FanoutStreamBuilder {
+	return &FanoutStreamBuilder{
+		builder:  b,
+		fanoutID: fanoutID,
+		sent:     make(map[string]bool),
+	}
+}
+
+// ForReplay creates a stream builder replaying a terminal recording
+func (b *StreamBuilder) ForReplay(sessionID string) *ReplayStreamBuilder {
+	return &ReplayStreamBuilder{
+		builder:   b,
+		sessionID: sessionID,
+		speed:     1,
+	}
+}
+
 // Global creates a global stream builder
 func (b *StreamBuilder) Global() *GlobalStreamBuilder {
 	return &GlobalStreamBuilder{
@@ -229,6 +257,10 @@ type TerminalStreamBuilder struct {
 	sessionManager common.TerminalSessionManager
 	requireAuth    bool
 	includeHistory bool
+	history        common.TerminalHistorySource
+	offset         int64 // session output already sent to the client, in bytes
+	presence       common.TerminalPresenceTracker
+	userID         string
 }
 
 // RequireAuth enables authentication validation
@@ -238,9 +270,17 @@ func (t *TerminalStreamBuilder) RequireAuth(sessionManager common.TerminalSessio
 	return t
 }
 
-// WithHistory includes terminal history in initial messages
-func (t *TerminalStreamBuilder) WithHistory() *TerminalStreamBuilder {
+// WithHistory replays the session's scrollback from the given source before live output
+func (t *TerminalStreamBuilder) WithHistory(source common.TerminalHistorySource) *TerminalStreamBuilder {
 	t.includeHistory = true
+	t.history = source
+	return t
+}
+
+// WithPresence announces the authenticated user as attached while the stream
+// is open, and ends the stream if the user's access is revoked
+func (t *TerminalStreamBuilder) WithPresence(tracker common.TerminalPresenceTracker) *TerminalStreamBuilder {
+	t.presence = tracker
 	return t
 }
 
@@ -258,13 +298,13 @@ func (t *TerminalStreamBuilder) Handle(c *gin.Context) error {
 
 	// Authentication if required
 	if t.requireAuth {
-		userID := t.getUserIDFromContext(c)
+		userID := auth.UserIDFromContext(c)
 		if userID == "" {
 			c.JSON(401, gin.H{"error": "User authentication required"})
 			return fmt.Errorf("user authentication required")
 		}
 
-		if err := t.sessionManager.ValidateSessionAccess(t.sessionID, userID); err != nil {
+		if err := t.sessionManager.ValidateSessionAccess(t.sessionID, userID, common.TerminalRoleObserver); err != nil {
 			switch err {
 			case common.ErrTerminalSessionNotFound:
 				c.JSON(404, gin.H{"error": "Terminal session not found"})
@@ -280,6 +320,7 @@ func (t *TerminalStreamBuilder) Handle(c *gin.Context) error {
 
 		// Update last activity
 		t.sessionManager.UpdateLastActivity(t.sessionID)
+		t.userID = userID
 	}
 
 	// Setup headers
@@ -309,8 +350,20 @@ func (t *TerminalStreamBuilder) Handle(c *gin.Context) error {
 	// Send initial message
 	t.sendInitialMessage(c)
 
+	// The room was joined first, so live output overlapping the history is recognized by its offset
+	if t.includeHistory {
+		t.sendHistory(c)
+	}
+
+	var revoked <-chan struct{}
+	if t.presence != nil && t.userID != "" {
+		var leave func()
+		revoked, leave = t.presence.Join(t.sessionID, t.userID, "sse")
+		defer leave()
+	}
+
 	// Handle connection
-	return t.handleConnection(c, client)
+	return t.handleConnection(c, client, revoked)
 }
 
 func (t *TerminalStreamBuilder) sendInitialMessage(c *gin.Context) {
@@ -327,16 +380,47 @@ func (t *TerminalStreamBuilder) sendInitialMessage(c *gin.Context) {
 	}
 }
 
-func (t *TerminalStreamBuilder) handleConnection(c *gin.Context, client common.SSEClient) error {
+// sendHistory writes the session's buffered output as a single terminal_history event
+func (t *TerminalStreamBuilder) sendHistory(c *gin.Context) {
+	output, offset, err := t.history.GetScrollback(t.sessionID)
+	if err != nil {
+		return
+	}
+	t.offset = offset
+
+	data := map[string]interface{}{
+		"event": "terminal_history",
+		"data": map[string]interface{}{
+			"session_id": t.sessionID,
+			"output":     string(output),
+			"offset":     offset,
+		},
+		"room": "terminal_" + t.sessionID,
+	}
+	msg, _ := json.Marshal(data)
+	if _, err := fmt.Fprintf(c.Writer, "data: %s\n\n", string(msg)); err == nil {
+		c.Writer.Flush()
+	}
+}
+
+func (t *TerminalStreamBuilder) handleConnection(c *gin.Context, client common.SSEClient, revoked <-chan struct{}) error {
 	for {
 		select {
 		case msg := <-client.GetChannel():
+			if offset, ok := terminalOutputOffset(msg); ok && offset <= t.offset {
+				// Already part of the history
+				continue
+			}
+
 			formattedMsg := t.formatMessage(msg)
 			if _, err := fmt.Fprintf(c.Writer, "data: %s\n\n", formattedMsg); err != nil {
 				return fmt.Errorf("error writing SSE message: %v", err)
 			}
 			c.Writer.Flush()
 
+		case <-revoked:
+			t.sendRevoked(c)
+			return nil
 		case <-c.Request.Context().Done():
 			return nil
 		case <-client.GetContext().Done():
@@ -345,6 +429,23 @@ func (t *TerminalStreamBuilder) handleConnection(c *gin.Context, client common.S
 	}
 }
 
+// sendRevoked tells the client its access to the session was revoked before the stream ends
+func (t *TerminalStreamBuilder) sendRevoked(c *gin.Context) {
+	data := map[string]interface{}{
+		"event": "terminal_access_revoked",
+		"data": map[string]interface{}{
+			"session_id": t.sessionID,
+			"user_id":    t.userID,
+			"message":    "Access to terminal session revoked",
+		},
+		"room": "terminal_" + t.sessionID,
+	}
+	msg, _ := json.Marshal(data)
+	if _, err := fmt.Fprintf(c.Writer, "data: %s\n\n", string(msg)); err == nil {
+		c.Writer.Flush()
+	}
+}
+
 func (t *TerminalStreamBuilder) formatMessage(msg common.SSEMessage) string {
 	data := map[string]interface{}{
 		"event": msg.EventType,
@@ -355,12 +456,18 @@ func (t *TerminalStreamBuilder) formatMessage(msg common.SSEMessage) string {
 	return string(result)
 }
 
-func (t *TerminalStreamBuilder) getUserIDFromContext(c *gin.Context) string {
-	userID := c.GetHeader("X-User-ID")
-	if userID == "" {
-		userID = c.Query("user_id")
+// terminalOutputOffset extracts the offset of raw terminal output. Command
+// responses share the event type but carry no offset.
+func terminalOutputOffset(msg common.SSEMessage) (int64, bool) {
+	if msg.EventType != "terminal_output" {
+		return 0, false
+	}
+	data, ok := msg.Data.(map[string]interface{})
+	if !ok {
+		return 0, false
 	}
-	return userID
+	offset, ok := data["offset"].(int64)
+	return offset, ok
 }
 
 // MetricsStreamBuilder handles metrics stream patterns
@@ -464,6 +571,487 @@ func (m *MetricsStreamBuilder) handleConnection(c *gin.Context, client common.SS
 	}
 }
 
+// CommandStreamBuilder handles streaming command output patterns
+type CommandStreamBuilder struct {
+	builder   *StreamBuilder
+	requestID string
+	source    common.CommandOutputSource
+	sequence  int64 // last sequence written to the client
+}
+
+// WithOutputSource replays buffered output and fills gaps from the given source
+func (s *CommandStreamBuilder) WithOutputSource(source common.CommandOutputSource) *CommandStreamBuilder {
+	s.source = source
+	return s
+}
+
+// Handle processes the SSE connection with command-specific conventions. The
+// stream ends after the command's exit event.
+func (s *CommandStreamBuilder) Handle(c *gin.Context) error {
+	// Extract request ID from URL if not provided
+	if s.requestID == "" {
+		s.requestID = c.Param("requestId")
+	}
+
+	if s.source == nil {
+		c.JSON(500, gin.H{"error": "Command output source not configured"})
+		return fmt.Errorf("command output source not configured")
+	}
+
+	if _, _, err := s.source.GetCommandOutput(s.requestID); err != nil {
+		if err == common.ErrCommandNotFound {
+			c.JSON(404, gin.H{"error": "Streaming command not found"})
+		} else {
+			c.JSON(500, gin.H{"error": err.Error()})
+		}
+		return err
+	}
+
+	// Setup headers
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("Access-Control-Allow-Origin", "*")
+
+	// Generate client ID
+	clientID := fmt.Sprintf("command_%s_%d", s.requestID, time.Now().UnixNano())
+
+	// Add client
+	client := s.builder.sseManager.AddClient(clientID)
+	if client == nil {
+		c.JSON(500, gin.H{"error": "Failed to create SSE client"})
+		return fmt.Errorf("failed to create SSE client")
+	}
+
+	// Join the room before replaying so nothing falls between replay and live output
+	room := "command_" + s.requestID
+	if err := s.builder.sseManager.JoinRoom(clientID, room); err != nil {
+		log.Printf("Error joining command room %s: %v", room, err)
+	}
+
+	defer s.builder.sseManager.RemoveClient(clientID)
+
+	// Send initial message
+	s.sendInitialMessage(c)
+
+	done, err := s.catchUp(c, room, -1)
+	if err != nil || done {
+		return err
+	}
+
+	// Handle connection
+	return s.handleConnection(c, client, room)
+}
+
+func (s *CommandStreamBuilder) sendInitialMessage(c *gin.Context) {
+	data := map[string]interface{}{
+		"event": "command_connected",
+		"data": map[string]interface{}{
+			"request_id": s.requestID,
+			"message":    "Connected to command output stream",
+		},
+	}
+	msg, _ := json.Marshal(data)
+	if _, err := fmt.Fprintf(c.Writer, "data: %s\n\n", string(msg)); err == nil {
+		c.Writer.Flush()
+	}
+}
+
+func (s *CommandStreamBuilder) handleConnection(c *gin.Context, client common.SSEClient, room string) error {
+	for {
+		select {
+		case msg := <-client.GetChannel():
+			sequence := commandEventSequence(msg.Data)
+			if sequence <= s.sequence {
+				// Already sent during replay
+				continue
+			}
+
+			// Live messages can be dropped when the client falls behind; fill in from the buffer
+			if sequence > s.sequence+1 {
+				done, err := s.catchUp(c, room, sequence)
+				if err != nil || done {
+					return err
+				}
+			}
+
+			if err := s.write(c, msg); err != nil {
+				return err
+			}
+			if msg.EventType == "command_exit" {
+				return nil
+			}
+
+		case <-c.Request.Context().Done():
+			return nil
+		case <-client.GetContext().Done():
+			return nil
+		}
+	}
+}
+
+// catchUp writes buffered events after the last sent sequence and before the
+// given one (or all of them when before is negative). It reports whether the
+// exit event was written.
+func (s *CommandStreamBuilder) catchUp(c *gin.Context, room string, before int64) (bool, error) {
+	chunks, exit, err := s.source.GetCommandOutput(s.requestID)
+	if err != nil {
+		// Output expired from the buffer; live events continue where they are
+		return false, nil
+	}
+
+	for _, chunk := range chunks {
+		if chunk.Sequence <= s.sequence || (before >= 0 && chunk.Sequence >= before) {
+			continue
+		}
+		if err := s.write(c, common.SSEMessage{EventType: "command_output", Data: chunk, Room: room}); err != nil {
+			return false, err
+		}
+	}
+
+	if exit != nil && exit.Sequence > s.sequence && (before < 0 || exit.Sequence < before) {
+		if err := s.write(c, common.SSEMessage{EventType: "command_exit", Data: exit, Room: room}); err != nil {
+			return false, err
+		}
+		return true, nil
+	}
+
+	return false, nil
+}
+
+func (s *CommandStreamBuilder) write(c *gin.Context, msg common.SSEMessage) error {
+	data := map[string]interface{}{
+		"event": msg.EventType,
+		"data":  msg.Data,
+		"room":  msg.Room,
+	}
+	result, _ := json.Marshal(data)
+
+	if _, err := fmt.Fprintf(c.Writer, "data: %s\n\n", string(result)); err != nil {
+		return fmt.Errorf("error writing SSE message: %v", err)
+	}
+	c.Writer.Flush()
+
+	if sequence := commandEventSequence(msg.Data); sequence > s.sequence {
+		s.sequence = sequence
+	}
+	return nil
+}
+
+// commandEventSequence extracts the sequence number of a command event
+func commandEventSequence(data any) int64 {
+	switch event := data.(type) {
+	case *common.CommandOutputChunk:
+		return event.Sequence
+	case *common.CommandExit:
+		return event.Sequence
+	default:
+		return 0
+	}
+}
+
+// FanoutStreamBuilder handles fan-out result stream patterns
+type FanoutStreamBuilder struct {
+	builder  *StreamBuilder
+	fanoutID string
+	source   common.FanoutSource
+	sent     map[string]bool // agents whose result was written to the client
+}
+
+// WithSource replays finished results and fills gaps from the given source
+func (f *FanoutStreamBuilder) WithSource(source common.FanoutSource) *FanoutStreamBuilder {
+	f.source = source
+	return f
+}
+
+// Handle processes the SSE connection with fan-out conventions. The stream
+// ends after the fan-out's complete event.
+func (f *FanoutStreamBuilder) Handle(c *gin.Context) error {
+	// Extract fan-out ID from URL if not provided
+	if f.fanoutID == "" {
+		f.fanoutID = c.Param("fanoutId")
+	}
+
+	if f.source == nil {
+		c.JSON(500, gin.H{"error": "Fan-out source not configured"})
+		return fmt.Errorf("fan-out source not configured")
+	}
+
+	if _, err := f.source.GetFanout(f.fanoutID); err != nil {
+		if err == common.ErrFanoutNotFound {
+			c.JSON(404, gin.H{"error": "Fan-out not found"})
+		} else {
+			c.JSON(500, gin.H{"error": err.Error()})
+		}
+		return err
+	}
+
+	// Setup headers
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("Access-Control-Allow-Origin", "*")
+
+	// Generate client ID
+	clientID := fmt.Sprintf("fanout_%s_%d", f.fanoutID, time.Now().UnixNano())
+
+	// Add client
+	client := f.builder.sseManager.AddClient(clientID)
+	if client == nil {
+		c.JSON(500, gin.H{"error": "Failed to create SSE client"})
+		return fmt.Errorf("failed to create SSE client")
+	}
+
+	// Join the room before replaying so no result falls between replay and live events
+	room := "fanout_" + f.fanoutID
+	if err := f.builder.sseManager.JoinRoom(clientID, room); err != nil {
+		log.Printf("Error joining fan-out room %s: %v", room, err)
+	}
+
+	defer f.builder.sseManager.RemoveClient(clientID)
+
+	// Send initial message
+	f.sendInitialMessage(c)
+
+	done, err := f.catchUp(c, room)
+	if err != nil || done {
+		return err
+	}
+
+	// Handle connection
+	return f.handleConnection(c, client, room)
+}
+
+func (f *FanoutStreamBuilder) sendInitialMessage(c *gin.Context) {
+	data := map[string]interface{}{
+		"event": "fanout_connected",
+		"data": map[string]interface{}{
+			"fanout_id": f.fanoutID,
+			"message":   "Connected to fan-out stream",
+		},
+	}
+	msg, _ := json.Marshal(data)
+	if _, err := fmt.Fprintf(c.Writer, "data: %s\n\n", string(msg)); err == nil {
+		c.Writer.Flush()
+	}
+}
+
+func (f *FanoutStreamBuilder) handleConnection(c *gin.Context, client common.SSEClient, room string) error {
+	for {
+		select {
+		case msg := <-client.GetChannel():
+			switch data := msg.Data.(type) {
+			case *common.FanoutResult:
+				if f.sent[data.AgentID] {
+					// Already sent during replay
+					continue
+				}
+				if err := f.write(c, msg); err != nil {
+					return err
+				}
+				f.sent[data.AgentID] = true
+
+			case *common.Fanout:
+				// Live results may have been dropped for a slow client; send what is missing first
+				_, err := f.catchUp(c, room)
+				return err
+			}
+
+		case <-c.Request.Context().Done():
+			return nil
+		case <-client.GetContext().Done():
+			return nil
+		}
+	}
+}
+
+// catchUp writes finished results that were not sent yet, followed by the
+// complete event once the fan-out is done. It reports whether the fan-out is done.
+func (f *FanoutStreamBuilder) catchUp(c *gin.Context, room string) (bool, error) {
+	fanout, err := f.source.GetFanout(f.fanoutID)
+	if err != nil {
+		// Expired; live events continue where they are
+		return false, nil
+	}
+
+	for _, result := range fanout.Results {
+		if !result.IsFinished() || f.sent[result.AgentID] {
+			continue
+		}
+		if err := f.write(c, common.SSEMessage{EventType: "fanout_result", Data: result, Room: room}); err != nil {
+			return false, err
+		}
+		f.sent[result.AgentID] = true
+	}
+
+	if fanout.Status == common.FanoutRunning {
+		return false, nil
+	}
+
+	return true, f.write(c, common.SSEMessage{EventType: "fanout_complete", Data: fanout, Room: room})
+}
+
+func (f *FanoutStreamBuilder) write(c *gin.Context, msg common.SSEMessage) error {
+	data := map[string]interface{}{
+		"event": msg.EventType,
+		"data":  msg.Data,
+		"room":  msg.Room,
+	}
+	result, _ := json.Marshal(data)
+
+	if _, err := fmt.Fprintf(c.Writer, "data: %s\n\n", string(result)); err != nil {
+		return fmt.Errorf("error writing SSE message: %v", err)
+	}
+	c.Writer.Flush()
+	return nil
+}
+
+// ReplayStreamBuilder handles terminal recording replay patterns
+type ReplayStreamBuilder struct {
+	builder   *StreamBuilder
+	sessionID string
+	source    common.TerminalReplaySource
+	speed     float64
+	maxIdle   float64 // longest pause in seconds, zero to keep all pauses
+}
+
+// WithSource replays recordings opened from the given source
+func (r *ReplayStreamBuilder) WithSource(source common.TerminalReplaySource) *ReplayStreamBuilder {
+	r.source = source
+	return r
+}
+
+// WithTiming divides the recorded timing by speed and caps pauses to maxIdle seconds
+func (r *ReplayStreamBuilder) WithTiming(speed, maxIdle float64) *ReplayStreamBuilder {
+	r.speed = speed
+	r.maxIdle = maxIdle
+	return r
+}
+
+// Handle processes the SSE connection with replay conventions. The recorded
+// events are re-emitted with their original timing and the stream ends after
+// the replay_finished event.
+func (r *ReplayStreamBuilder) Handle(c *gin.Context) error {
+	// Extract session ID from URL if not provided
+	if r.sessionID == "" {
+		r.sessionID = c.Param("sessionId")
+	}
+
+	if r.source == nil {
+		c.JSON(500, gin.H{"error": "Replay source not configured"})
+		return fmt.Errorf("replay source not configured")
+	}
+
+	userID := auth.UserIDFromContext(c)
+	if userID == "" {
+		c.JSON(401, gin.H{"error": "User authentication required"})
+		return fmt.Errorf("user authentication required")
+	}
+
+	replay, err := r.source.OpenReplay(r.sessionID, userID)
+	if err != nil {
+		switch err {
+		case common.ErrRecordingNotFound:
+			c.JSON(404, gin.H{"error": "Recording not found"})
+		case common.ErrUnauthorizedTerminalAccess:
+			c.JSON(403, gin.H{"error": "Unauthorized access to recording"})
+		default:
+			c.JSON(500, gin.H{"error": err.Error()})
+		}
+		return err
+	}
+	defer replay.Close()
+
+	// Setup headers
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("Access-Control-Allow-Origin", "*")
+
+	// Generate client ID
+	clientID := fmt.Sprintf("replay_%s_%d", r.sessionID, time.Now().UnixNano())
+
+	// Add client; it joins no room, but ends the replay when the manager stops
+	client := r.builder.sseManager.AddClient(clientID)
+	if client == nil {
+		c.JSON(500, gin.H{"error": "Failed to create SSE client"})
+		return fmt.Errorf("failed to create SSE client")
+	}
+
+	defer r.builder.sseManager.RemoveClient(clientID)
+
+	// Handle connection
+	return r.handleConnection(c, client, replay)
+}
+
+// handleConnection writes the recording's events at their scheduled times
+func (r *ReplayStreamBuilder) handleConnection(c *gin.Context, client common.SSEClient, replay common.TerminalReplay) error {
+	started := replay.Info()
+	started["session_id"] = r.sessionID
+	started["speed"] = r.speed
+	if err := r.write(c, "replay_started", started); err != nil {
+		return err
+	}
+
+	start := time.Now()
+	var last, skipped float64 // recording time of the previous event and idle time cut out so far
+	for {
+		event, err := replay.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			r.write(c, "replay_error", map[string]interface{}{"session_id": r.sessionID, "error": err.Error()})
+			return err
+		}
+
+		if r.maxIdle > 0 && event.Time-last > r.maxIdle {
+			skipped += event.Time - last - r.maxIdle
+		}
+		last = event.Time
+
+		due := start.Add(time.Duration((event.Time - skipped) / r.speed * float64(time.Second)))
+		if wait := time.Until(due); wait > 0 {
+			select {
+			case <-time.After(wait):
+			case <-c.Request.Context().Done():
+				return nil
+			case <-client.GetContext().Done():
+				return nil
+			}
+		}
+
+		data := map[string]interface{}{
+			"session_id": r.sessionID,
+			"time":       event.Time,
+		}
+		for key, value := range event.Data {
+			data[key] = value
+		}
+		if err := r.write(c, event.Type, data); err != nil {
+			return err
+		}
+	}
+
+	return r.write(c, "replay_finished", map[string]interface{}{
+		"session_id": r.sessionID,
+		"duration":   last,
+	})
+}
+
+func (r *ReplayStreamBuilder) write(c *gin.Context, eventType string, data interface{}) error {
+	result, _ := json.Marshal(map[string]interface{}{
+		"event": eventType,
+		"data":  data,
+	})
+
+	if _, err := fmt.Fprintf(c.Writer, "data: %s\n\n", string(result)); err != nil {
+		return fmt.Errorf("error writing SSE message: %v", err)
+	}
+	c.Writer.Flush()
+	return nil
+}
+
 // GlobalStreamBuilder handles global stream patterns
 type GlobalStreamBuilder struct {
 	builder *StreamBuilder
@@ -6,6 +6,7 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/mooncorn/nodelink/server/internal/common"
+	"github.com/mooncorn/nodelink/server/internal/labels"
 )
 
 // HTTPHandler handles HTTP requests for agent status management
@@ -26,11 +27,34 @@ func (h *HTTPHandler) RegisterRoutes(router gin.IRouter) {
 	router.GET("/health", h.HealthCheck)
 	router.GET("/ping", h.HealthCheck)
 
-	// Get all agents with optional status filter
+	// Get all agents with optional status and label selector filters
 	router.GET("/agents", h.GetAgents)
 
 	// Get specific agent by ID
 	router.GET("/agents/:agentId", h.GetAgent)
+
+	// Operator-managed agent labels
+	router.GET("/agents/:agentId/labels", h.GetLabels)
+	router.PUT("/agents/:agentId/labels", h.ReplaceLabels)
+	router.PATCH("/agents/:agentId/labels", h.PatchLabels)
+}
+
+// LabelsResponse describes an agent's labels and where they come from
+type LabelsResponse struct {
+	AgentID        string            `json:"agent_id"`
+	Labels         map[string]string `json:"labels"`
+	AgentLabels    map[string]string `json:"agent_labels"`
+	OperatorLabels map[string]string `json:"operator_labels"`
+}
+
+// ReplaceLabelsRequest replaces all operator labels of an agent
+type ReplaceLabelsRequest struct {
+	Labels map[string]string `json:"labels"`
+}
+
+// PatchLabelsRequest sets operator labels; a null value removes the label
+type PatchLabelsRequest struct {
+	Labels map[string]*string `json:"labels" binding:"required"`
 }
 
 // GetAgentsResponse represents the response for getting all agents
@@ -63,38 +87,47 @@ func (h *HTTPHandler) GetAgent(c *gin.Context) {
 	})
 }
 
-// GetAgents handles GET /agents with optional status filter
+// GetAgents handles GET /agents with optional status and selector filters,
+// e.g. ?selector=env=prod,role in (db,cache)
 func (h *HTTPHandler) GetAgents(c *gin.Context) {
-	// Get status filter from query parameter
+	// Get filters from query parameters
 	statusFilter := c.Query("status")
 
+	selector, err := labels.Parse(c.Query("selector"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
 	var agents []*common.AgentInfo
-	if statusFilter != "" {
-		// Filter by status
-		allAgents := h.manager.GetAllAgents()
-		for _, agent := range allAgents {
-			if strings.EqualFold(string(agent.Status), statusFilter) {
-				agents = append(agents, agent)
-			}
+	for _, agent := range h.manager.SelectAgents(selector) {
+		if statusFilter == "" || strings.EqualFold(string(agent.Status), statusFilter) {
+			agents = append(agents, agent)
 		}
-	} else {
-		// Get all agents
-		agents = h.manager.GetAllAgents()
 	}
 
 	// Calculate statistics
 	stats := make(map[string]int)
 	stats["total"] = len(agents)
 	stats["online"] = 0
+	stats["degraded"] = 0
 	stats["offline"] = 0
+	stats["flapping"] = 0
 
 	for _, agent := range agents {
 		switch agent.Status {
 		case common.AgentStatusOnline:
 			stats["online"]++
+		case common.AgentStatusDegraded:
+			stats["degraded"]++
 		case common.AgentStatusOffline:
 			stats["offline"]++
 		}
+		if agent.Flapping {
+			stats["flapping"]++
+		}
 	}
 
 	response := GetAgentsResponse{
@@ -111,6 +144,92 @@ func (h *HTTPHandler) GetAgents(c *gin.Context) {
 	c.JSON(http.StatusOK, response)
 }
 
+// GetLabels handles GET /agents/:agentId/labels
+func (h *HTTPHandler) GetLabels(c *gin.Context) {
+	agent, exists := h.manager.GetAgent(c.Param("agentId"))
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "agent not found",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, toLabelsResponse(agent))
+}
+
+// ReplaceLabels handles PUT /agents/:agentId/labels
+func (h *HTTPHandler) ReplaceLabels(c *gin.Context) {
+	var req ReplaceLabelsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON body"})
+		return
+	}
+
+	if err := labels.Validate(req.Labels); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	agent, err := h.manager.SetOperatorLabels(c.Param("agentId"), req.Labels)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "agent not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, toLabelsResponse(agent))
+}
+
+// PatchLabels handles PATCH /agents/:agentId/labels
+func (h *HTTPHandler) PatchLabels(c *gin.Context) {
+	var req PatchLabelsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON body"})
+		return
+	}
+
+	for key, value := range req.Labels {
+		if err := labels.ValidateKey(key); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if value == nil {
+			continue
+		}
+		if err := labels.ValidateValue(*value); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	agent, err := h.manager.PatchOperatorLabels(c.Param("agentId"), req.Labels)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "agent not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, toLabelsResponse(agent))
+}
+
+// toLabelsResponse returns an agent's label sets, empty rather than null
+func toLabelsResponse(agent *common.AgentInfo) LabelsResponse {
+	response := LabelsResponse{
+		AgentID:        agent.AgentID,
+		Labels:         agent.Labels,
+		AgentLabels:    agent.AgentLabels,
+		OperatorLabels: agent.OperatorLabels,
+	}
+	if response.Labels == nil {
+		response.Labels = map[string]string{}
+	}
+	if response.AgentLabels == nil {
+		response.AgentLabels = map[string]string{}
+	}
+	if response.OperatorLabels == nil {
+		response.OperatorLabels = map[string]string{}
+	}
+	return response
+}
+
 // HealthCheck handles GET /health and GET /ping for Railway health checks
 func (h *HTTPHandler) HealthCheck(c *gin.Context) {
 	allAgents := h.manager.GetAllAgents()
@@ -119,9 +238,10 @@ func (h *HTTPHandler) HealthCheck(c *gin.Context) {
 		"status":    "healthy",
 		"timestamp": c.Request.Header.Get("Date"),
 		"agents": map[string]int{
-			"total":   len(allAgents),
-			"online":  0,
-			"offline": 0,
+			"total":    len(allAgents),
+			"online":   0,
+			"degraded": 0,
+			"offline":  0,
 		},
 	}
 
@@ -130,6 +250,8 @@ func (h *HTTPHandler) HealthCheck(c *gin.Context) {
 		switch agent.Status {
 		case common.AgentStatusOnline:
 			stats["agents"].(map[string]int)["online"]++
+		case common.AgentStatusDegraded:
+			stats["agents"].(map[string]int)["degraded"]++
 		case common.AgentStatusOffline:
 			stats["agents"].(map[string]int)["offline"]++
 		}
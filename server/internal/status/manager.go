@@ -1,25 +1,76 @@
 package status
 
 import (
+	"log"
+	"sort"
 	"sync"
 	"time"
 
 	"github.com/mooncorn/nodelink/server/internal/common"
+	"github.com/mooncorn/nodelink/server/internal/labels"
+	pb "github.com/mooncorn/nodelink/server/internal/proto"
 )
 
+// lastSeenPersistInterval limits how often heartbeat-only updates are written to the store
+const lastSeenPersistInterval = time.Minute
+
 // Manager manages agent status and provides a centralized status tracking system
 type Manager struct {
-	mu        sync.RWMutex
-	agents    map[string]*common.AgentInfo
-	listeners []common.StatusChangeListener
+	mu          sync.RWMutex
+	agents      map[string]*common.AgentInfo
+	listeners   []common.StatusChangeListener
+	store       common.AgentStore
+	persistedAt map[string]time.Time
+}
+
+// NewManager creates a new status manager. A nil store keeps agents in memory only.
+func NewManager(store common.AgentStore) *Manager {
+	manager := &Manager{
+		agents:      make(map[string]*common.AgentInfo),
+		listeners:   make([]common.StatusChangeListener, 0),
+		store:       store,
+		persistedAt: make(map[string]time.Time),
+	}
+
+	manager.loadAgents()
+
+	return manager
+}
+
+// loadAgents restores persisted agents. None of them has a stream yet, so all start offline.
+func (m *Manager) loadAgents() {
+	if m.store == nil {
+		return
+	}
+
+	agents, err := m.store.LoadAgents()
+	if err != nil {
+		log.Printf("Failed to load persisted agents: %v", err)
+		return
+	}
+
+	for _, agent := range agents {
+		agent.Status = common.AgentStatusOffline
+		agent.StatusReason = ""
+		agent.Flapping = false
+		agent.Latency = nil
+		m.agents[agent.AgentID] = agent
+	}
+
+	log.Printf("Loaded %d persisted agents", len(agents))
 }
 
-// NewManager creates a new status manager
-func NewManager() *Manager {
-	return &Manager{
-		agents:    make(map[string]*common.AgentInfo),
-		listeners: make([]common.StatusChangeListener, 0),
+// persist writes an agent record to the store. Must be called with the lock held.
+func (m *Manager) persist(agent *common.AgentInfo) {
+	if m.store == nil {
+		return
+	}
+
+	if err := m.store.SaveAgent(agent); err != nil {
+		log.Printf("Failed to persist agent %s: %v", agent.AgentID, err)
+		return
 	}
+	m.persistedAt[agent.AgentID] = time.Now()
 }
 
 // RegisterAgent registers a new agent with the status manager
@@ -44,15 +95,40 @@ func (m *Manager) RegisterAgent(agentID string, metadata map[string]string) {
 	}
 
 	m.agents[agentID] = agent
+	m.persist(agent)
 }
 
 // SetAgentOnline marks an agent as online
 func (m *Manager) SetAgentOnline(agentID string) {
+	m.SetAgentStatus(agentID, common.AgentStatusOnline, "", false)
+}
+
+// SetAgentOffline marks an agent as offline
+func (m *Manager) SetAgentOffline(agentID string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	agent, exists := m.agents[agentID]
+	if !exists || agent.Status == common.AgentStatusOffline {
+		return
+	}
+
+	m.setStatus(agent, common.AgentStatusOffline, "", agent.Flapping)
+}
+
+// SetAgentStatus records an agent's status along with why it has it and
+// whether it is flapping. Listeners are only notified when the status itself
+// changes. Agents that are not offline are registered if they are new.
+func (m *Manager) SetAgentStatus(agentID string, status common.AgentStatus, reason string, flapping bool) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
 	agent, exists := m.agents[agentID]
 	if !exists {
+		if !status.IsAvailable() {
+			return
+		}
+
 		// Auto-register if agent doesn't exist
 		now := time.Now()
 		agent = &common.AgentInfo{
@@ -65,23 +141,38 @@ func (m *Manager) SetAgentOnline(agentID string) {
 		m.agents[agentID] = agent
 	}
 
+	m.setStatus(agent, status, reason, flapping)
+}
+
+// setStatus updates an agent's status and notifies listeners if it changed. Must be called with the lock held.
+func (m *Manager) setStatus(agent *common.AgentInfo, status common.AgentStatus, reason string, flapping bool) {
 	oldStatus := agent.Status
-	now := time.Now()
+	if oldStatus == status && agent.StatusReason == reason && agent.Flapping == flapping {
+		return
+	}
 
-	agent.Status = common.AgentStatusOnline
-	agent.LastSeen = now
+	now := time.Now()
+	agent.Status = status
+	agent.StatusReason = reason
+	agent.Flapping = flapping
 	agent.UpdatedAt = now
 
-	if agent.ConnectedAt == nil {
-		agent.ConnectedAt = &now
+	if status.IsAvailable() {
+		agent.LastSeen = now
+
+		// A persisted agent carries its previous connection time, so refresh it on every reconnect
+		if !oldStatus.IsAvailable() {
+			agent.ConnectedAt = &now
+		}
 	}
 
-	// Notify listeners if status changed
-	if oldStatus != common.AgentStatusOnline {
+	m.persist(agent)
+
+	if oldStatus != status {
 		event := common.StatusChangeEvent{
-			AgentID:   agentID,
+			AgentID:   agent.AgentID,
 			OldStatus: oldStatus,
-			NewStatus: common.AgentStatusOnline,
+			NewStatus: status,
 			Timestamp: now,
 			Agent:     agent,
 		}
@@ -89,50 +180,192 @@ func (m *Manager) SetAgentOnline(agentID string) {
 	}
 }
 
-// SetAgentOffline marks an agent as offline
-func (m *Manager) SetAgentOffline(agentID string) {
+// UpdateLastSeen updates the last seen timestamp for an agent
+func (m *Manager) UpdateLastSeen(agentID string) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	agent, exists := m.agents[agentID]
-	if !exists || agent.Status == common.AgentStatusOffline {
-		return
-	}
+	if agent, exists := m.agents[agentID]; exists {
+		agent.LastSeen = time.Now()
+		agent.UpdatedAt = time.Now()
 
-	oldStatus := agent.Status
-	now := time.Now()
+		// Heartbeats are frequent; only write them through occasionally
+		if time.Since(m.persistedAt[agentID]) >= lastSeenPersistInterval {
+			m.persist(agent)
+		}
+	}
+}
 
-	agent.Status = common.AgentStatusOffline
-	agent.UpdatedAt = now
+// UpdateLatency records an agent's latest ping round-trip statistics. Like
+// heartbeats they change too often to be written through on every update.
+func (m *Manager) UpdateLatency(agentID string, stats *common.LatencyStats) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
 
-	event := common.StatusChangeEvent{
-		AgentID:   agentID,
-		OldStatus: oldStatus,
-		NewStatus: common.AgentStatusOffline,
-		Timestamp: now,
-		Agent:     agent,
+	if agent, exists := m.agents[agentID]; exists {
+		agent.Latency = stats
 	}
-	m.notifyStatusChange(event)
 }
 
-// UpdateLastSeen updates the last seen timestamp for an agent
-func (m *Manager) UpdateLastSeen(agentID string) {
+// UpdateSystemInfo records the last known system information for an agent
+func (m *Manager) UpdateSystemInfo(agentID string, systemInfo *pb.SystemInfo) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
 	if agent, exists := m.agents[agentID]; exists {
-		agent.LastSeen = time.Now()
+		agent.SystemInfo = systemInfo
 		agent.UpdatedAt = time.Now()
+		m.persist(agent)
 	}
 }
 
-// IsAgentOnline checks if an agent is currently online
+// SetAgentLabels replaces the labels an agent declared when connecting,
+// registering the agent if it is new
+func (m *Manager) SetAgentLabels(agentID string, agentLabels map[string]string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	agent, exists := m.agents[agentID]
+	if !exists {
+		now := time.Now()
+		agent = &common.AgentInfo{
+			AgentID:   agentID,
+			Status:    common.AgentStatusOffline,
+			LastSeen:  now,
+			CreatedAt: now,
+			UpdatedAt: now,
+		}
+		m.agents[agentID] = agent
+	}
+
+	agent.AgentLabels = agentLabels
+	m.applyLabels(agent)
+}
+
+// SetOperatorLabels replaces the labels set through the API
+func (m *Manager) SetOperatorLabels(agentID string, operatorLabels map[string]string) (*common.AgentInfo, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	agent, exists := m.agents[agentID]
+	if !exists {
+		return nil, common.ErrAgentNotFound
+	}
+
+	agent.OperatorLabels = operatorLabels
+	m.applyLabels(agent)
+
+	agentCopy := *agent
+	return &agentCopy, nil
+}
+
+// PatchOperatorLabels sets the given operator labels, removing those with a nil value
+func (m *Manager) PatchOperatorLabels(agentID string, changes map[string]*string) (*common.AgentInfo, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	agent, exists := m.agents[agentID]
+	if !exists {
+		return nil, common.ErrAgentNotFound
+	}
+
+	operatorLabels := make(map[string]string, len(agent.OperatorLabels)+len(changes))
+	for key, value := range agent.OperatorLabels {
+		operatorLabels[key] = value
+	}
+	for key, value := range changes {
+		if value == nil {
+			delete(operatorLabels, key)
+		} else {
+			operatorLabels[key] = *value
+		}
+	}
+
+	agent.OperatorLabels = operatorLabels
+	m.applyLabels(agent)
+
+	agentCopy := *agent
+	return &agentCopy, nil
+}
+
+// applyLabels recomputes the effective labels and persists the agent. Must be called with the lock held.
+func (m *Manager) applyLabels(agent *common.AgentInfo) {
+	merged := make(map[string]string, len(agent.AgentLabels)+len(agent.OperatorLabels))
+	for key, value := range agent.AgentLabels {
+		merged[key] = value
+	}
+	for key, value := range agent.OperatorLabels {
+		merged[key] = value
+	}
+
+	// Label maps are replaced, never modified, so copies handed out stay consistent
+	agent.Labels = merged
+	agent.UpdatedAt = time.Now()
+	m.persist(agent)
+}
+
+// SetPingConfig replaces the heartbeat settings overriding the server defaults for an agent
+func (m *Manager) SetPingConfig(agentID string, config *common.PingConfig) (*common.AgentInfo, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	agent, exists := m.agents[agentID]
+	if !exists {
+		return nil, common.ErrAgentNotFound
+	}
+
+	agent.PingConfig = config
+	agent.UpdatedAt = time.Now()
+	m.persist(agent)
+
+	agentCopy := *agent
+	return &agentCopy, nil
+}
+
+// SetForceRecording sets whether all terminal sessions on an agent must be recorded
+func (m *Manager) SetForceRecording(agentID string, force bool) (*common.AgentInfo, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	agent, exists := m.agents[agentID]
+	if !exists {
+		return nil, common.ErrAgentNotFound
+	}
+
+	agent.ForceRecording = force
+	agent.UpdatedAt = time.Now()
+	m.persist(agent)
+
+	agentCopy := *agent
+	return &agentCopy, nil
+}
+
+// SelectAgents returns the agents whose labels match the selector, ordered by ID
+func (m *Manager) SelectAgents(selector labels.Selector) []*common.AgentInfo {
+	m.mu.RLock()
+	var agents []*common.AgentInfo
+	for _, agent := range m.agents {
+		if selector.Matches(agent.Labels) {
+			agentCopy := *agent
+			agents = append(agents, &agentCopy)
+		}
+	}
+	m.mu.RUnlock()
+
+	sort.Slice(agents, func(i, j int) bool {
+		return agents[i].AgentID < agents[j].AgentID
+	})
+
+	return agents
+}
+
+// IsAgentOnline checks if an agent is currently connected, including when it is degraded
 func (m *Manager) IsAgentOnline(agentID string) bool {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
 
 	agent, exists := m.agents[agentID]
-	return exists && agent.Status == common.AgentStatusOnline
+	return exists && agent.Status.IsAvailable()
 }
 
 // GetAgent returns information about a specific agent
@@ -163,14 +396,14 @@ func (m *Manager) GetAllAgents() []*common.AgentInfo {
 	return agents
 }
 
-// GetOnlineAgents returns all currently online agents
+// GetOnlineAgents returns all currently connected agents, including degraded ones
 func (m *Manager) GetOnlineAgents() []*common.AgentInfo {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
 
 	var onlineAgents []*common.AgentInfo
 	for _, agent := range m.agents {
-		if agent.Status == common.AgentStatusOnline {
+		if agent.Status.IsAvailable() {
 			agentCopy := *agent
 			onlineAgents = append(onlineAgents, &agentCopy)
 		}
@@ -199,6 +432,13 @@ func (m *Manager) CleanupStaleAgents(cutoff time.Time) int {
 
 	for _, agentID := range toDelete {
 		delete(m.agents, agentID)
+		delete(m.persistedAt, agentID)
+
+		if m.store != nil {
+			if err := m.store.DeleteAgent(agentID); err != nil {
+				log.Printf("Failed to delete persisted agent %s: %v", agentID, err)
+			}
+		}
 	}
 
 	return len(toDelete)
@@ -0,0 +1,695 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+	"google.golang.org/protobuf/encoding/protojson"
+
+	"github.com/mooncorn/nodelink/server/internal/common"
+	pb "github.com/mooncorn/nodelink/server/internal/proto"
+)
+
+var (
+	agentsBucket      = []byte("agents")
+	credentialsBucket = []byte("credentials")
+	enrollmentBucket  = []byte("enrollment_tokens")
+	historyBucket     = []byte("status_history") // one nested bucket per agent
+	metricsBucket     = []byte("metrics")        // one nested bucket per agent, holding one per resolution
+	auditLogsBucket   = []byte("terminal_audit_logs")
+	auditBucket       = []byte("terminal_audit") // one nested bucket per session
+)
+
+// BoltStore persists server state in an embedded bbolt database
+type BoltStore struct {
+	db *bolt.DB
+}
+
+// Open opens (or creates) the database at the given path
+func Open(path string) (*BoltStore, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: 1 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database %s: %w", path, err)
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, bucket := range [][]byte{agentsBucket, credentialsBucket, enrollmentBucket, historyBucket, metricsBucket, auditLogsBucket, auditBucket} {
+			if _, err := tx.CreateBucketIfNotExists(bucket); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to initialize database: %w", err)
+	}
+
+	return &BoltStore{db: db}, nil
+}
+
+// Close closes the database
+func (s *BoltStore) Close() error {
+	return s.db.Close()
+}
+
+// agentRecord is how an agent is stored. Its system info is a proto message
+// and is encoded with protojson, which keeps renamed fields and oneofs intact.
+type agentRecord struct {
+	*common.AgentInfo
+	SystemInfo json.RawMessage `json:"system_info,omitempty"`
+}
+
+// SaveAgent inserts or replaces an agent record
+func (s *BoltStore) SaveAgent(agent *common.AgentInfo) error {
+	record := agentRecord{AgentInfo: agent}
+	if agent.SystemInfo != nil {
+		systemInfo, err := protojson.MarshalOptions{UseProtoNames: true}.Marshal(agent.SystemInfo)
+		if err != nil {
+			return fmt.Errorf("failed to encode system info of agent %s: %w", agent.AgentID, err)
+		}
+		record.SystemInfo = systemInfo
+	}
+
+	data, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to encode agent %s: %w", agent.AgentID, err)
+	}
+
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(agentsBucket).Put([]byte(agent.AgentID), data)
+	})
+}
+
+// DeleteAgent removes an agent record and the history kept for it
+func (s *BoltStore) DeleteAgent(agentID string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		if err := tx.Bucket(agentsBucket).Delete([]byte(agentID)); err != nil {
+			return err
+		}
+
+		// Drop the agent's status history and metrics along with it
+		for _, name := range [][]byte{historyBucket, metricsBucket} {
+			err := tx.Bucket(name).DeleteBucket([]byte(agentID))
+			if err != nil && !errors.Is(err, bolt.ErrBucketNotFound) {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// LoadAgents returns all persisted agent records
+func (s *BoltStore) LoadAgents() ([]*common.AgentInfo, error) {
+	var agents []*common.AgentInfo
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(agentsBucket).ForEach(func(key, value []byte) error {
+			record := agentRecord{AgentInfo: &common.AgentInfo{}}
+			if err := json.Unmarshal(value, &record); err != nil {
+				return fmt.Errorf("failed to decode agent %s: %w", key, err)
+			}
+
+			// Fields the server no longer knows are dropped
+			if len(record.SystemInfo) > 0 {
+				record.AgentInfo.SystemInfo = &pb.SystemInfo{}
+				if err := (protojson.UnmarshalOptions{DiscardUnknown: true}).Unmarshal(record.SystemInfo, record.AgentInfo.SystemInfo); err != nil {
+					return fmt.Errorf("failed to decode system info of agent %s: %w", key, err)
+				}
+			}
+
+			agents = append(agents, record.AgentInfo)
+			return nil
+		})
+	})
+
+	return agents, err
+}
+
+// GetCredential returns the credential for an agent
+func (s *BoltStore) GetCredential(agentID string) (*common.AgentCredential, error) {
+	var credential *common.AgentCredential
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+		value := tx.Bucket(credentialsBucket).Get([]byte(agentID))
+		if value == nil {
+			return common.ErrCredentialNotFound
+		}
+
+		credential = &common.AgentCredential{}
+		return json.Unmarshal(value, credential)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return credential, nil
+}
+
+// ListCredentials returns all credentials ordered by agent ID
+func (s *BoltStore) ListCredentials() ([]*common.AgentCredential, error) {
+	var credentials []*common.AgentCredential
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(credentialsBucket).ForEach(func(key, value []byte) error {
+			var credential common.AgentCredential
+			if err := json.Unmarshal(value, &credential); err != nil {
+				return fmt.Errorf("failed to decode credential %s: %w", key, err)
+			}
+			credentials = append(credentials, &credential)
+			return nil
+		})
+	})
+
+	return credentials, err
+}
+
+// SaveCredential inserts or replaces a credential
+func (s *BoltStore) SaveCredential(credential *common.AgentCredential) error {
+	data, err := json.Marshal(credential)
+	if err != nil {
+		return fmt.Errorf("failed to encode credential %s: %w", credential.AgentID, err)
+	}
+
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(credentialsBucket).Put([]byte(credential.AgentID), data)
+	})
+}
+
+// MarkCredentialAuthenticated records the first authentication with a
+// credential, unless its token has been replaced since
+func (s *BoltStore) MarkCredentialAuthenticated(agentID, tokenHash string, at time.Time) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(credentialsBucket)
+		value := bucket.Get([]byte(agentID))
+		if value == nil {
+			return common.ErrCredentialNotFound
+		}
+
+		var credential common.AgentCredential
+		if err := json.Unmarshal(value, &credential); err != nil {
+			return err
+		}
+		if credential.AuthenticatedAt != nil || credential.TokenHash != tokenHash {
+			return nil
+		}
+
+		credential.AuthenticatedAt = &at
+		data, err := json.Marshal(&credential)
+		if err != nil {
+			return fmt.Errorf("failed to encode credential %s: %w", agentID, err)
+		}
+		return bucket.Put([]byte(agentID), data)
+	})
+}
+
+// SaveEnrollmentToken stores an enrollment token keyed by its hash
+func (s *BoltStore) SaveEnrollmentToken(token *common.EnrollmentToken) error {
+	data, err := json.Marshal(token)
+	if err != nil {
+		return fmt.Errorf("failed to encode enrollment token %s: %w", token.ID, err)
+	}
+
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(enrollmentBucket).Put([]byte(token.TokenHash), data)
+	})
+}
+
+// GetEnrollmentToken returns the token with the given hash
+func (s *BoltStore) GetEnrollmentToken(tokenHash string) (*common.EnrollmentToken, error) {
+	var token *common.EnrollmentToken
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+		value := tx.Bucket(enrollmentBucket).Get([]byte(tokenHash))
+		if value == nil {
+			return common.ErrEnrollmentTokenNotFound
+		}
+
+		token = &common.EnrollmentToken{}
+		return json.Unmarshal(value, token)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return token, nil
+}
+
+// ListEnrollmentTokens returns all outstanding enrollment tokens
+func (s *BoltStore) ListEnrollmentTokens() ([]*common.EnrollmentToken, error) {
+	var tokens []*common.EnrollmentToken
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(enrollmentBucket).ForEach(func(key, value []byte) error {
+			var token common.EnrollmentToken
+			if err := json.Unmarshal(value, &token); err != nil {
+				return fmt.Errorf("failed to decode enrollment token: %w", err)
+			}
+			tokens = append(tokens, &token)
+			return nil
+		})
+	})
+
+	return tokens, err
+}
+
+// DeleteEnrollmentToken removes an enrollment token by its ID
+func (s *BoltStore) DeleteEnrollmentToken(id string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(enrollmentBucket)
+		cursor := bucket.Cursor()
+
+		for key, value := cursor.First(); key != nil; key, value = cursor.Next() {
+			var token common.EnrollmentToken
+			if err := json.Unmarshal(value, &token); err != nil {
+				continue
+			}
+			if token.ID == id {
+				return bucket.Delete(key)
+			}
+		}
+
+		return common.ErrEnrollmentTokenNotFound
+	})
+}
+
+// AppendTransition records a status transition keyed by its timestamp, keeping
+// at most limit per agent and dropping those older than before except the
+// latest of them, which tells the status at that point
+func (s *BoltStore) AppendTransition(transition *common.StatusTransition, limit int, before time.Time) error {
+	data, err := json.Marshal(transition)
+	if err != nil {
+		return fmt.Errorf("failed to encode status transition for %s: %w", transition.AgentID, err)
+	}
+
+	return s.db.Update(func(tx *bolt.Tx) error {
+		bucket, err := tx.Bucket(historyBucket).CreateBucketIfNotExists([]byte(transition.AgentID))
+		if err != nil {
+			return err
+		}
+
+		// Transitions in the same nanosecond keep their order
+		key := timeKey(transition.Timestamp)
+		for bucket.Get(key) != nil {
+			binary.BigEndian.PutUint64(key, binary.BigEndian.Uint64(key)+1)
+		}
+		if err := bucket.Put(key, data); err != nil {
+			return err
+		}
+
+		// Walk back from the newest transition to the oldest one within the limit
+		cursor := bucket.Cursor()
+		var oldest []byte
+		if limit > 0 {
+			oldest, _ = cursor.Last()
+			for i := 1; i < limit && oldest != nil; i++ {
+				oldest, _ = cursor.Prev()
+			}
+			oldest = append([]byte(nil), oldest...)
+		}
+
+		cutoff := timeKey(before)
+		for key, _ := cursor.First(); key != nil; key, _ = cursor.First() {
+			next, _ := cursor.Next()
+			excess := bytes.Compare(key, oldest) < 0
+			expired := next != nil && bytes.Compare(next, cutoff) <= 0
+			if !excess && !expired {
+				break
+			}
+			if err := bucket.Delete(key); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// LoadTransitions returns an agent's transitions since the given time in
+// chronological order, preceded by the latest earlier one if there is any
+func (s *BoltStore) LoadTransitions(agentID string, since time.Time) ([]*common.StatusTransition, error) {
+	var transitions []*common.StatusTransition
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(historyBucket).Bucket([]byte(agentID))
+		if bucket == nil {
+			return nil
+		}
+
+		cursor := bucket.Cursor()
+		key, value := cursor.Seek(timeKey(since))
+		if key == nil {
+			key, value = cursor.Last()
+		} else if !bytes.Equal(key, timeKey(since)) {
+			// Step back to the status the agent had at the start
+			if previous, previousValue := cursor.Prev(); previous != nil {
+				key, value = previous, previousValue
+			} else {
+				key, value = cursor.First()
+			}
+		}
+
+		for ; key != nil; key, value = cursor.Next() {
+			var transition common.StatusTransition
+			if err := json.Unmarshal(value, &transition); err != nil {
+				return fmt.Errorf("failed to decode status transition for %s: %w", agentID, err)
+			}
+			transitions = append(transitions, &transition)
+		}
+		return nil
+	})
+
+	return transitions, err
+}
+
+// SaveMetricPoints stores points of an agent at a resolution keyed by their
+// timestamps. Concurrent saves are written in one transaction.
+func (s *BoltStore) SaveMetricPoints(agentID, resolution string, points []*common.MetricPoint) error {
+	values := make([][]byte, len(points))
+	for i, point := range points {
+		data, err := json.Marshal(point)
+		if err != nil {
+			return fmt.Errorf("failed to encode metrics for %s: %w", agentID, err)
+		}
+		values[i] = data
+	}
+
+	return s.db.Batch(func(tx *bolt.Tx) error {
+		agent, err := tx.Bucket(metricsBucket).CreateBucketIfNotExists([]byte(agentID))
+		if err != nil {
+			return err
+		}
+		bucket, err := agent.CreateBucketIfNotExists([]byte(resolution))
+		if err != nil {
+			return err
+		}
+
+		for i, point := range points {
+			if err := bucket.Put(timeKey(point.Timestamp), values[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// LoadMetricPoints returns an agent's points at a resolution from from up to
+// but excluding to, in chronological order
+func (s *BoltStore) LoadMetricPoints(agentID, resolution string, from, to time.Time) ([]*common.MetricPoint, error) {
+	var points []*common.MetricPoint
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+		bucket := metricPoints(tx, agentID, resolution)
+		if bucket == nil {
+			return nil
+		}
+
+		end := timeKey(to)
+		cursor := bucket.Cursor()
+		for key, value := cursor.Seek(timeKey(from)); key != nil && bytes.Compare(key, end) < 0; key, value = cursor.Next() {
+			var point common.MetricPoint
+			if err := json.Unmarshal(value, &point); err != nil {
+				return fmt.Errorf("failed to decode metrics for %s: %w", agentID, err)
+			}
+			points = append(points, &point)
+		}
+		return nil
+	})
+
+	return points, err
+}
+
+// LastMetricPoint returns an agent's latest point at a resolution, or nil if there is none
+func (s *BoltStore) LastMetricPoint(agentID, resolution string) (*common.MetricPoint, error) {
+	var point *common.MetricPoint
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+		bucket := metricPoints(tx, agentID, resolution)
+		if bucket == nil {
+			return nil
+		}
+
+		_, value := bucket.Cursor().Last()
+		if value == nil {
+			return nil
+		}
+		point = &common.MetricPoint{}
+		if err := json.Unmarshal(value, point); err != nil {
+			return fmt.Errorf("failed to decode metrics for %s: %w", agentID, err)
+		}
+		return nil
+	})
+
+	return point, err
+}
+
+// DeleteMetricPoints drops the points of every agent at a resolution older
+// than before. Points are deleted in batches, each in its own transaction, so
+// a large backlog doesn't hold the database's write lock for long.
+func (s *BoltStore) DeleteMetricPoints(resolution string, before time.Time) error {
+	cutoff := timeKey(before)
+	for {
+		var deleted int
+		err := s.db.Update(func(tx *bolt.Tx) error {
+			var err error
+			deleted, err = deleteMetricBatch(tx, []byte(resolution), cutoff, common.MetricsDeleteBatchSize)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		if deleted < common.MetricsDeleteBatchSize {
+			return nil
+		}
+	}
+}
+
+// deleteMetricBatch deletes up to limit points at a resolution with keys
+// before cutoff, along with buckets left empty, and returns how many it deleted
+func deleteMetricBatch(tx *bolt.Tx, resolution, cutoff []byte, limit int) (int, error) {
+	metrics := tx.Bucket(metricsBucket)
+
+	var agentIDs [][]byte
+	if err := metrics.ForEachBucket(func(key []byte) error {
+		// Keys are only valid until the bucket changes
+		agentIDs = append(agentIDs, bytes.Clone(key))
+		return nil
+	}); err != nil {
+		return 0, err
+	}
+
+	deleted := 0
+	for _, agentID := range agentIDs {
+		if deleted == limit {
+			break
+		}
+
+		agent := metrics.Bucket(agentID)
+		bucket := agent.Bucket(resolution)
+		if bucket == nil {
+			continue
+		}
+
+		cursor := bucket.Cursor()
+		for key, _ := cursor.First(); key != nil && bytes.Compare(key, cutoff) < 0 && deleted < limit; key, _ = cursor.First() {
+			if err := bucket.Delete(key); err != nil {
+				return deleted, err
+			}
+			deleted++
+		}
+
+		if key, _ := cursor.First(); key != nil {
+			continue
+		}
+		if err := agent.DeleteBucket(resolution); err != nil {
+			return deleted, err
+		}
+		if key, _ := agent.Cursor().First(); key == nil {
+			if err := metrics.DeleteBucket(agentID); err != nil {
+				return deleted, err
+			}
+		}
+	}
+	return deleted, nil
+}
+
+// MetricAgents returns the agents that have stored metrics
+func (s *BoltStore) MetricAgents() ([]string, error) {
+	var agentIDs []string
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(metricsBucket).ForEachBucket(func(key []byte) error {
+			agentIDs = append(agentIDs, string(key))
+			return nil
+		})
+	})
+
+	return agentIDs, err
+}
+
+// SaveAuditLog inserts or replaces the audit log metadata of a terminal session
+func (s *BoltStore) SaveAuditLog(log *common.TerminalAuditLog) error {
+	data, err := json.Marshal(log)
+	if err != nil {
+		return fmt.Errorf("failed to encode audit log of terminal session %s: %w", log.SessionID, err)
+	}
+
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(auditLogsBucket).Put([]byte(log.SessionID), data)
+	})
+}
+
+// GetAuditLog returns the audit log metadata of a terminal session
+func (s *BoltStore) GetAuditLog(sessionID string) (*common.TerminalAuditLog, error) {
+	var log common.TerminalAuditLog
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(auditLogsBucket).Get([]byte(sessionID))
+		if data == nil {
+			return common.ErrAuditLogNotFound
+		}
+		return json.Unmarshal(data, &log)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &log, nil
+}
+
+// SaveAuditEntries stores entries of a session's audit log under their
+// sequence numbers. Concurrent writes are batched into one transaction.
+func (s *BoltStore) SaveAuditEntries(sessionID string, entries map[uint64]common.TerminalAuditEntry) error {
+	values := make(map[uint64][]byte, len(entries))
+	for sequence, entry := range entries {
+		data, err := json.Marshal(entry)
+		if err != nil {
+			return fmt.Errorf("failed to encode audit entry of terminal session %s: %w", sessionID, err)
+		}
+		values[sequence] = data
+	}
+
+	return s.db.Batch(func(tx *bolt.Tx) error {
+		bucket, err := tx.Bucket(auditBucket).CreateBucketIfNotExists([]byte(sessionID))
+		if err != nil {
+			return err
+		}
+
+		for sequence, data := range values {
+			key := make([]byte, 8)
+			binary.BigEndian.PutUint64(key, sequence)
+			if err := bucket.Put(key, data); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// LoadAuditEntries returns the entries of a session's audit log, oldest first
+func (s *BoltStore) LoadAuditEntries(sessionID string) ([]common.TerminalAuditEntry, error) {
+	entries := make([]common.TerminalAuditEntry, 0)
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(auditBucket).Bucket([]byte(sessionID))
+		if bucket == nil {
+			return nil
+		}
+
+		return bucket.ForEach(func(key, value []byte) error {
+			var entry common.TerminalAuditEntry
+			if err := json.Unmarshal(value, &entry); err != nil {
+				return fmt.Errorf("failed to decode audit entry of terminal session %s: %w", sessionID, err)
+			}
+			entries = append(entries, entry)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+// DeleteAuditLogs deletes up to limit audit logs of sessions closed before
+// the given time. Logs left open by a server shutdown are deleted once they
+// are as old. Expired logs are looked up in a read-only transaction, so the
+// write lock is only held while they are deleted.
+func (s *BoltStore) DeleteAuditLogs(closedBefore time.Time, limit int) (int, error) {
+	var expired [][]byte
+	err := s.db.View(func(tx *bolt.Tx) error {
+		cursor := tx.Bucket(auditLogsBucket).Cursor()
+		for key, value := cursor.First(); key != nil && len(expired) < limit; key, value = cursor.Next() {
+			if auditLogExpired(value, closedBefore) {
+				expired = append(expired, bytes.Clone(key))
+			}
+		}
+		return nil
+	})
+	if err != nil || len(expired) == 0 {
+		return 0, err
+	}
+
+	deleted := 0
+	err = s.db.Update(func(tx *bolt.Tx) error {
+		logs := tx.Bucket(auditLogsBucket)
+		for _, key := range expired {
+			// Skip logs that changed since they were looked up
+			if value := logs.Get(key); value == nil || !auditLogExpired(value, closedBefore) {
+				continue
+			}
+
+			if err := logs.Delete(key); err != nil {
+				return err
+			}
+			err := tx.Bucket(auditBucket).DeleteBucket(key)
+			if err != nil && !errors.Is(err, bolt.ErrBucketNotFound) {
+				return err
+			}
+			deleted++
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return deleted, nil
+}
+
+// auditLogExpired reports whether an encoded audit log was closed, or created
+// if it never was, before the given time. Logs that can't be decoded are kept.
+func auditLogExpired(value []byte, closedBefore time.Time) bool {
+	var log common.TerminalAuditLog
+	if err := json.Unmarshal(value, &log); err != nil {
+		return false
+	}
+
+	closedAt := log.CreatedAt
+	if log.ClosedAt != nil {
+		closedAt = *log.ClosedAt
+	}
+	return closedAt.Before(closedBefore)
+}
+
+// metricPoints returns the bucket of an agent's points at a resolution, or nil if there is none
+func metricPoints(tx *bolt.Tx, agentID, resolution string) *bolt.Bucket {
+	agent := tx.Bucket(metricsBucket).Bucket([]byte(agentID))
+	if agent == nil {
+		return nil
+	}
+	return agent.Bucket([]byte(resolution))
+}
+
+// timeKey encodes a time as a sortable bucket key
+func timeKey(t time.Time) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, uint64(t.UnixNano()))
+	return key
+}
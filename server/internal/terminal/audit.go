@@ -0,0 +1,189 @@
+package terminal
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/mooncorn/nodelink/server/internal/common"
+)
+
+const (
+	// Keystrokes a user types in quick succession are kept as one input entry
+	auditCoalesceWindow = 2 * time.Second
+	auditMaxInputSize   = 1024
+)
+
+// auditLogs keeps a persistent log per session of who did what in it. Entries
+// are buffered and written to the store periodically and when the session
+// closes, so they outlive the session and the server without slowing down input.
+type auditLogs struct {
+	store    common.TerminalAuditStore
+	sessions map[string]*auditLog // logs of open sessions
+	mu       sync.Mutex
+}
+
+// auditLog is the log of an open session
+type auditLog struct {
+	info     *common.TerminalAuditLog
+	sequence uint64                                // of the latest entry
+	last     *common.TerminalAuditEntry            // latest entry, which typed input is added to
+	pending  map[uint64]*common.TerminalAuditEntry // entries changed since the last flush
+	mu       sync.Mutex
+
+	// Keeps flushes in order so an entry isn't overwritten by an older copy
+	flushMu sync.Mutex
+}
+
+// newAuditLogs creates a set of audit logs kept in the given store
+func newAuditLogs(store common.TerminalAuditStore) *auditLogs {
+	return &auditLogs{
+		store:    store,
+		sessions: make(map[string]*auditLog),
+	}
+}
+
+// open starts an audit log for a session
+func (a *auditLogs) open(session *common.TerminalSession) {
+	info := &common.TerminalAuditLog{
+		SessionID: session.SessionID,
+		UserID:    session.UserID,
+		AgentID:   session.AgentID,
+		CreatedAt: session.CreatedAt,
+	}
+	if err := a.store.SaveAuditLog(info); err != nil {
+		log.Printf("Failed to save audit log of terminal session %s: %v", session.SessionID, err)
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.sessions[session.SessionID] = &auditLog{
+		info:    info,
+		pending: make(map[uint64]*common.TerminalAuditEntry),
+	}
+}
+
+// add appends an entry to a session's log. Sessions without an open log are ignored.
+func (a *auditLogs) add(sessionID, userID string, action common.TerminalAuditAction, data string) {
+	a.mu.Lock()
+	audit, exists := a.sessions[sessionID]
+	a.mu.Unlock()
+
+	if !exists {
+		return
+	}
+
+	audit.mu.Lock()
+	defer audit.mu.Unlock()
+
+	now := time.Now()
+	last := audit.last
+	if action == common.TerminalAuditInput && last != nil && last.Action == action && last.UserID == userID &&
+		now.Sub(last.Timestamp) < auditCoalesceWindow && len(last.Data) < auditMaxInputSize {
+		last.Data += data
+	} else {
+		audit.sequence++
+		audit.last = &common.TerminalAuditEntry{
+			Timestamp: now,
+			UserID:    userID,
+			Action:    action,
+			Data:      data,
+		}
+	}
+
+	audit.pending[audit.sequence] = audit.last
+}
+
+// info returns the metadata of a session's log, also after the session closed
+func (a *auditLogs) info(sessionID string) (*common.TerminalAuditLog, error) {
+	return a.store.GetAuditLog(sessionID)
+}
+
+// entries returns a session's log, oldest first
+func (a *auditLogs) entries(sessionID string) ([]common.TerminalAuditEntry, error) {
+	a.mu.Lock()
+	audit, exists := a.sessions[sessionID]
+	a.mu.Unlock()
+
+	if exists {
+		a.flush(sessionID, audit)
+	}
+	return a.store.LoadAuditEntries(sessionID)
+}
+
+// close writes out the log of a closed session and marks it as complete
+func (a *auditLogs) close(sessionID string) {
+	a.mu.Lock()
+	audit, exists := a.sessions[sessionID]
+	delete(a.sessions, sessionID)
+	a.mu.Unlock()
+
+	if !exists {
+		return
+	}
+
+	a.flush(sessionID, audit)
+
+	audit.mu.Lock()
+	closedAt := time.Now()
+	audit.info.ClosedAt = &closedAt
+	err := a.store.SaveAuditLog(audit.info)
+	audit.mu.Unlock()
+	if err != nil {
+		log.Printf("Failed to save audit log of terminal session %s: %v", sessionID, err)
+	}
+}
+
+// flushAll writes the buffered entries of all open logs to the store
+func (a *auditLogs) flushAll() {
+	a.mu.Lock()
+	sessions := make(map[string]*auditLog, len(a.sessions))
+	for sessionID, audit := range a.sessions {
+		sessions[sessionID] = audit
+	}
+	a.mu.Unlock()
+
+	for sessionID, audit := range sessions {
+		a.flush(sessionID, audit)
+	}
+}
+
+// flush writes the buffered entries of a log to the store. The entries are
+// copied first, so input keeps being added while they are written.
+func (a *auditLogs) flush(sessionID string, audit *auditLog) {
+	audit.flushMu.Lock()
+	defer audit.flushMu.Unlock()
+
+	audit.mu.Lock()
+	if len(audit.pending) == 0 {
+		audit.mu.Unlock()
+		return
+	}
+	entries := make(map[uint64]common.TerminalAuditEntry, len(audit.pending))
+	for sequence, entry := range audit.pending {
+		entries[sequence] = *entry
+	}
+	audit.pending = make(map[uint64]*common.TerminalAuditEntry)
+	audit.mu.Unlock()
+
+	if err := a.store.SaveAuditEntries(sessionID, entries); err != nil {
+		log.Printf("Failed to save audit entries of terminal session %s: %v", sessionID, err)
+	}
+}
+
+// cleanup deletes the logs of sessions closed longer than the retention ago,
+// a batch at a time so the database isn't locked for long
+func (a *auditLogs) cleanup(now time.Time) {
+	closedBefore := now.Add(-common.TerminalAuditRetention)
+	for {
+		deleted, err := a.store.DeleteAuditLogs(closedBefore, common.TerminalAuditDeleteBatchSize)
+		if err != nil {
+			log.Printf("Failed to delete expired terminal audit logs: %v", err)
+			return
+		}
+		if deleted < common.TerminalAuditDeleteBatchSize {
+			return
+		}
+	}
+}
@@ -10,6 +10,8 @@ import (
 	"github.com/google/uuid"
 	pb "github.com/mooncorn/nodelink/server/internal/proto"
 	"github.com/mooncorn/nodelink/server/internal/common"
+	"github.com/mooncorn/nodelink/server/internal/labels"
+	"github.com/mooncorn/nodelink/server/internal/sse"
 )
 
 // Handler manages terminal operations and command execution
@@ -18,6 +20,14 @@ type Handler struct {
 	statusManager  common.StatusManager
 	streamSender   common.StreamSender
 	sseManager     common.SSEManager
+	broadcaster    *sse.Broadcaster
+	subscribers    *subscribers
+	presence       *presence
+	audit          *auditLogs
+	recorder       common.TerminalRecorder
+
+	// Agents whose stream dropped; their sessions wait for the reconnect announcement
+	disconnected map[string]bool
 
 	// Track pending commands and responses
 	pendingCommands map[string]*TerminalCommand
@@ -40,6 +50,12 @@ func NewHandler(sessionManager common.TerminalSessionManager, statusManager comm
 		sessionManager:  sessionManager,
 		statusManager:   statusManager,
 		sseManager:      sseManager,
+		broadcaster:     sse.NewBroadcaster(sseManager),
+		subscribers:     newSubscribers(),
+		presence:        newPresence(),
+		audit:           newAuditLogs(noAuditStore{}),
+		recorder:        noRecorder{},
+		disconnected:    make(map[string]bool),
 		pendingCommands: make(map[string]*TerminalCommand),
 	}
 }
@@ -49,8 +65,83 @@ func (h *Handler) SetStreamSender(sender common.StreamSender) {
 	h.streamSender = sender
 }
 
-// CreateTerminalSession creates a new terminal session on an agent
-func (h *Handler) CreateTerminalSession(ctx context.Context, userID, agentID, shell, workingDir string, env map[string]string) (*common.TerminalSession, error) {
+// SetRecorder sets the recorder for terminal sessions
+func (h *Handler) SetRecorder(recorder common.TerminalRecorder) {
+	h.recorder = recorder
+}
+
+// SetAuditStore sets the store that keeps the audit logs of terminal sessions
+func (h *Handler) SetAuditStore(store common.TerminalAuditStore) {
+	h.audit = newAuditLogs(store)
+}
+
+// Start writes buffered audit entries to the store and deletes expired audit
+// logs until the context is cancelled
+func (h *Handler) Start(ctx context.Context) {
+	flushTicker := time.NewTicker(common.TerminalAuditFlushInterval)
+	defer flushTicker.Stop()
+	cleanupTicker := time.NewTicker(common.TerminalAuditCleanupInterval)
+	defer cleanupTicker.Stop()
+
+	h.audit.cleanup(time.Now())
+	for {
+		select {
+		case <-flushTicker.C:
+			h.audit.flushAll()
+		case now := <-cleanupTicker.C:
+			h.audit.cleanup(now)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Stop writes the audit entries still buffered to the store
+func (h *Handler) Stop() {
+	h.audit.flushAll()
+}
+
+// SelectAgent picks the online agent matching the selector that has the fewest
+// open terminal sessions. Degraded agents are only picked if none is healthy.
+func (h *Handler) SelectAgent(selector labels.Selector) (string, error) {
+	selected, fewest, selectedHealthy := "", -1, false
+	for _, agent := range h.statusManager.SelectAgents(selector) {
+		if !agent.Status.IsAvailable() {
+			continue
+		}
+
+		open := 0
+		for _, session := range h.sessionManager.GetAgentSessions(agent.AgentID) {
+			if session.Status != common.TerminalStatusClosed {
+				open++
+			}
+		}
+
+		healthy := agent.Status == common.AgentStatusOnline
+		if selected == "" || (healthy && !selectedHealthy) || (healthy == selectedHealthy && open < fewest) {
+			selected, fewest, selectedHealthy = agent.AgentID, open, healthy
+		}
+	}
+
+	if selected == "" {
+		return "", common.ErrNoMatchingAgents
+	}
+	return selected, nil
+}
+
+// CreateTerminalSession creates a new terminal session on an agent. Zero rows
+// or cols use the default terminal size, a nil record the default recording setting.
+func (h *Handler) CreateTerminalSession(ctx context.Context, userID, agentID, shell, workingDir string, env map[string]string, rows, cols int, record *bool) (*common.TerminalSession, error) {
+	if rows == 0 {
+		rows = common.DefaultTerminalRows
+	}
+	if cols == 0 {
+		cols = common.DefaultTerminalCols
+	}
+	if err := validateSize(rows, cols); err != nil {
+		return nil, err
+	}
+
 	// Validate agent is connected
 	if !h.statusManager.IsAgentOnline(agentID) {
 		return nil, common.ErrAgentNotConnected
@@ -61,6 +152,19 @@ func (h *Handler) CreateTerminalSession(ctx context.Context, userID, agentID, sh
 	if err != nil {
 		return nil, err
 	}
+	h.sessionManager.SetSessionSize(session.SessionID, rows, cols)
+	session.Rows, session.Cols = rows, cols
+	h.subscribers.open(session.SessionID)
+	h.audit.open(session)
+
+	// Start recording before the agent can produce any output
+	if h.recorder.ShouldRecord(agentID, record) {
+		if err := h.recorder.Start(session); err != nil {
+			h.closeSession(session.SessionID, "Failed to start recording")
+			return nil, fmt.Errorf("failed to start recording: %w", err)
+		}
+		h.sessionManager.SetSessionRecorded(session.SessionID, true)
+	}
 
 	// Send create request to agent
 	request := &pb.TerminalCreateRequest{
@@ -68,6 +172,8 @@ func (h *Handler) CreateTerminalSession(ctx context.Context, userID, agentID, sh
 		Shell:      session.Shell,
 		WorkingDir: session.WorkingDir,
 		Env:        session.Env,
+		Rows:       uint32(rows),
+		Cols:       uint32(cols),
 	}
 
 	message := &pb.ServerMessage{
@@ -78,17 +184,18 @@ func (h *Handler) CreateTerminalSession(ctx context.Context, userID, agentID, sh
 
 	if err := h.streamSender.SendToAgent(agentID, message); err != nil {
 		// Cleanup session if agent communication fails
-		h.sessionManager.CloseSession(session.SessionID)
+		h.closeSession(session.SessionID, "Failed to reach agent")
 		return nil, fmt.Errorf("failed to send terminal create request to agent: %w", err)
 	}
 
-	return session, nil
+	// Include the size and recording set after creation
+	return h.sessionManager.GetSession(session.SessionID)
 }
 
 // ExecuteCommand sends a command to a terminal session
 func (h *Handler) ExecuteCommand(ctx context.Context, sessionID, userID, command string) (string, error) {
 	// Validate session access
-	if err := h.sessionManager.ValidateSessionAccess(sessionID, userID); err != nil {
+	if err := h.sessionManager.ValidateSessionAccess(sessionID, userID, common.TerminalRoleCollaborator); err != nil {
 		return "", err
 	}
 
@@ -116,18 +223,11 @@ func (h *Handler) ExecuteCommand(ctx context.Context, sessionID, userID, command
 		Response:  make(chan *pb.TerminalCommandResponse, 100), // Buffer for streaming responses
 	}
 
-	// Store pending command
+	// Store pending command until the agent reports it finished
 	h.mu.Lock()
 	h.pendingCommands[commandID] = termCmd
 	h.mu.Unlock()
 
-	// Cleanup on completion
-	defer func() {
-		h.mu.Lock()
-		delete(h.pendingCommands, commandID)
-		h.mu.Unlock()
-	}()
-
 	// Send command request to agent
 	request := &pb.TerminalCommandRequest{
 		SessionId: sessionID,
@@ -142,8 +242,13 @@ func (h *Handler) ExecuteCommand(ctx context.Context, sessionID, userID, command
 	}
 
 	if err := h.streamSender.SendToAgent(session.AgentID, message); err != nil {
+		h.mu.Lock()
+		delete(h.pendingCommands, commandID)
+		h.mu.Unlock()
 		return "", fmt.Errorf("failed to send terminal command to agent: %w", err)
 	}
+	h.recorder.RecordInput(sessionID, userID, []byte(command+"\n"))
+	h.audit.add(sessionID, userID, common.TerminalAuditCommand, command)
 
 	// Update last activity
 	h.sessionManager.UpdateLastActivity(sessionID)
@@ -151,10 +256,173 @@ func (h *Handler) ExecuteCommand(ctx context.Context, sessionID, userID, command
 	return commandID, nil
 }
 
-// CloseTerminalSession closes a terminal session
+// WriteInput types raw input, such as keystrokes, into a session's terminal
+func (h *Handler) WriteInput(ctx context.Context, sessionID, userID string, data []byte) error {
+	session, err := h.connectedSession(sessionID, userID, common.TerminalRoleCollaborator)
+	if err != nil {
+		return err
+	}
+
+	message := &pb.ServerMessage{
+		Message: &pb.ServerMessage_TerminalInput{
+			TerminalInput: &pb.TerminalInput{
+				SessionId: sessionID,
+				Data:      data,
+			},
+		},
+	}
+
+	if err := h.streamSender.SendToAgent(session.AgentID, message); err != nil {
+		return fmt.Errorf("failed to send terminal input to agent: %w", err)
+	}
+	h.recorder.RecordInput(sessionID, userID, data)
+	h.audit.add(sessionID, userID, common.TerminalAuditInput, string(data))
+
+	// Update last activity
+	h.sessionManager.UpdateLastActivity(sessionID)
+
+	return nil
+}
+
+// SignalTerminal signals the foreground process group of a session's terminal
+func (h *Handler) SignalTerminal(ctx context.Context, sessionID, userID, signal string) error {
+	switch signal {
+	case "SIGINT", "SIGQUIT", "SIGTSTP", "SIGTERM", "SIGKILL", "SIGHUP":
+	default:
+		return common.ErrInvalidSignal
+	}
+
+	session, err := h.connectedSession(sessionID, userID, common.TerminalRoleCollaborator)
+	if err != nil {
+		return err
+	}
+
+	message := &pb.ServerMessage{
+		Message: &pb.ServerMessage_TerminalSignalRequest{
+			TerminalSignalRequest: &pb.TerminalSignalRequest{
+				SessionId: sessionID,
+				Signal:    signal,
+			},
+		},
+	}
+
+	if err := h.streamSender.SendToAgent(session.AgentID, message); err != nil {
+		return fmt.Errorf("failed to send terminal signal to agent: %w", err)
+	}
+	h.audit.add(sessionID, userID, common.TerminalAuditSignal, signal)
+
+	return nil
+}
+
+// Subscribe delivers a session's output and status changes to the returned
+// channel until the cancel function is called. The output buffered before is
+// returned along with it.
+func (h *Handler) Subscribe(sessionID string) ([]byte, <-chan Event, func()) {
+	return h.subscribers.subscribe(sessionID)
+}
+
+// GetScrollback returns the buffered output of a session and the total number of bytes it has written
+func (h *Handler) GetScrollback(sessionID string) ([]byte, int64, error) {
+	if _, err := h.sessionManager.GetSession(sessionID); err != nil {
+		return nil, 0, err
+	}
+
+	history, total := h.subscribers.history(sessionID)
+	return history, total, nil
+}
+
+// DetachSession leaves a session running without a client, tmux-style. Idle
+// detached sessions are kept for much longer, and clients connected over
+// WebSocket are disconnected. Only the owner may detach a session.
+func (h *Handler) DetachSession(ctx context.Context, sessionID, userID string) error {
+	if err := h.sessionManager.ValidateSessionAccess(sessionID, userID, common.TerminalRoleOwner); err != nil {
+		return err
+	}
+
+	if err := h.sessionManager.SetSessionDetached(sessionID, true); err != nil {
+		return err
+	}
+
+	session, err := h.sessionManager.GetSession(sessionID)
+	if err != nil {
+		return err
+	}
+
+	h.audit.add(sessionID, userID, common.TerminalAuditDetach, "")
+	h.broadcaster.TerminalStatus(sessionID, string(session.Status), "Terminal session detached")
+	h.subscribers.publish(sessionID, Event{Type: EventStatus, Status: string(session.Status), Message: "Terminal session detached", Detached: true})
+	return nil
+}
+
+// AttachSession reattaches a detached session. Attaching a session that
+// isn't detached does nothing.
+func (h *Handler) AttachSession(ctx context.Context, sessionID, userID string) (*common.TerminalSession, error) {
+	if err := h.sessionManager.ValidateSessionAccess(sessionID, userID, common.TerminalRoleObserver); err != nil {
+		return nil, err
+	}
+
+	session, err := h.sessionManager.GetSession(sessionID)
+	if err != nil {
+		return nil, err
+	}
+	if !session.Detached {
+		return session, nil
+	}
+
+	if err := h.sessionManager.SetSessionDetached(sessionID, false); err != nil {
+		return nil, err
+	}
+	h.sessionManager.UpdateLastActivity(sessionID)
+
+	h.publishStatus(sessionID, session.Status, "Terminal session attached")
+	return session, nil
+}
+
+// ResizeTerminal changes the size of a session's terminal
+func (h *Handler) ResizeTerminal(ctx context.Context, sessionID, userID string, rows, cols int) error {
+	if err := validateSize(rows, cols); err != nil {
+		return err
+	}
+
+	// Validate session access
+	if err := h.sessionManager.ValidateSessionAccess(sessionID, userID, common.TerminalRoleCollaborator); err != nil {
+		return err
+	}
+
+	// Get session details
+	session, err := h.sessionManager.GetSession(sessionID)
+	if err != nil {
+		return err
+	}
+
+	// Validate agent is still connected
+	if !h.statusManager.IsAgentOnline(session.AgentID) {
+		return common.ErrAgentNotConnected
+	}
+
+	message := &pb.ServerMessage{
+		Message: &pb.ServerMessage_TerminalResizeRequest{
+			TerminalResizeRequest: &pb.TerminalResizeRequest{
+				SessionId: sessionID,
+				Rows:      uint32(rows),
+				Cols:      uint32(cols),
+			},
+		},
+	}
+
+	if err := h.streamSender.SendToAgent(session.AgentID, message); err != nil {
+		return fmt.Errorf("failed to send terminal resize request to agent: %w", err)
+	}
+	h.recorder.RecordResize(sessionID, rows, cols)
+	h.audit.add(sessionID, userID, common.TerminalAuditResize, fmt.Sprintf("%dx%d", cols, rows))
+
+	return h.sessionManager.SetSessionSize(sessionID, rows, cols)
+}
+
+// CloseTerminalSession closes a terminal session. Only the owner may close it.
 func (h *Handler) CloseTerminalSession(ctx context.Context, sessionID, userID string) error {
 	// Validate session access
-	if err := h.sessionManager.ValidateSessionAccess(sessionID, userID); err != nil {
+	if err := h.sessionManager.ValidateSessionAccess(sessionID, userID, common.TerminalRoleOwner); err != nil {
 		return err
 	}
 
@@ -181,20 +449,136 @@ func (h *Handler) CloseTerminalSession(ctx context.Context, sessionID, userID st
 	}
 
 	// Close session locally
-	return h.sessionManager.CloseSession(sessionID)
+	return h.closeSession(sessionID, "Terminal session closed")
+}
+
+// CloseInactiveSession closes a session the inactivity cleanup found idle for too
+// long, telling the agent to end its shell if it is connected
+func (h *Handler) CloseInactiveSession(sessionID string) {
+	session, err := h.sessionManager.GetSession(sessionID)
+	if err != nil {
+		return
+	}
+
+	if h.statusManager.IsAgentOnline(session.AgentID) {
+		h.sendCloseRequest(session.AgentID, sessionID)
+	}
+
+	h.closeSession(sessionID, "Terminal session closed after inactivity")
 }
 
-// GetUserSessions returns all terminal sessions for a user
+// GetUserSessions returns all terminal sessions a user owns or was invited into
 func (h *Handler) GetUserSessions(userID string) []*common.TerminalSession {
 	return h.sessionManager.GetUserSessions(userID)
 }
 
+// PendingCommands returns the number of commands waiting for the agent to report them finished
+func (h *Handler) PendingCommands() int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	return len(h.pendingCommands)
+}
+
+// ShareSession invites a user into a session as collaborator or observer, or
+// changes the role of a user already invited. Only the owner may share a session.
+func (h *Handler) ShareSession(ctx context.Context, sessionID, ownerID, userID string, role common.TerminalRole) (*common.TerminalParticipant, error) {
+	if err := h.sessionManager.ValidateSessionAccess(sessionID, ownerID, common.TerminalRoleOwner); err != nil {
+		return nil, err
+	}
+
+	if userID == "" || userID == ownerID || (role != common.TerminalRoleCollaborator && role != common.TerminalRoleObserver) {
+		return nil, common.ErrInvalidTerminalInvite
+	}
+
+	participant := common.TerminalParticipant{UserID: userID, Role: role, InvitedAt: time.Now()}
+	if err := h.sessionManager.SetParticipant(sessionID, participant); err != nil {
+		return nil, err
+	}
+	h.audit.add(sessionID, ownerID, common.TerminalAuditInvite, fmt.Sprintf("%s as %s", userID, role))
+
+	return &participant, nil
+}
+
+// RevokeParticipant revokes a user's invite to a session and disconnects the
+// user's open streams. Only the owner may revoke an invite.
+func (h *Handler) RevokeParticipant(ctx context.Context, sessionID, ownerID, userID string) error {
+	if err := h.sessionManager.ValidateSessionAccess(sessionID, ownerID, common.TerminalRoleOwner); err != nil {
+		return err
+	}
+
+	if err := h.sessionManager.RemoveParticipant(sessionID, userID); err != nil {
+		return err
+	}
+	h.audit.add(sessionID, ownerID, common.TerminalAuditRevoke, userID)
+
+	if h.presence.revoke(sessionID, userID) > 0 {
+		h.publishPresence(sessionID, userID, "revoked")
+	}
+	return nil
+}
+
+// GetParticipants returns a session and the users currently attached to it
+func (h *Handler) GetParticipants(sessionID, userID string) (*common.TerminalSession, []common.TerminalPresence, error) {
+	if err := h.sessionManager.ValidateSessionAccess(sessionID, userID, common.TerminalRoleObserver); err != nil {
+		return nil, nil, err
+	}
+
+	session, err := h.sessionManager.GetSession(sessionID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return session, h.attached(sessionID), nil
+}
+
+// GetAuditLog returns who did what in a session, oldest first. Only the owner
+// may read it, also after the session closed.
+func (h *Handler) GetAuditLog(sessionID, userID string) ([]common.TerminalAuditEntry, error) {
+	err := h.sessionManager.ValidateSessionAccess(sessionID, userID, common.TerminalRoleOwner)
+	if err == common.ErrTerminalSessionNotFound {
+		// Closed sessions are only known from their log
+		info, err := h.audit.info(sessionID)
+		if err == common.ErrAuditLogNotFound {
+			return nil, common.ErrTerminalSessionNotFound
+		}
+		if err != nil {
+			return nil, err
+		}
+		if info.UserID != userID {
+			return nil, common.ErrUnauthorizedTerminalAccess
+		}
+	} else if err != nil && err != common.ErrTerminalSessionClosed {
+		return nil, err
+	}
+
+	return h.audit.entries(sessionID)
+}
+
+// Join records a user attaching to a session over SSE or WebSocket and
+// announces it to the session's SSE clients
+func (h *Handler) Join(sessionID, userID, via string) (<-chan struct{}, func()) {
+	a := h.presence.join(sessionID, userID, via)
+	h.audit.add(sessionID, userID, common.TerminalAuditJoin, via)
+	h.publishPresence(sessionID, userID, "joined")
+
+	var once sync.Once
+	return a.revoked, func() {
+		once.Do(func() {
+			if h.presence.leave(sessionID, a) {
+				h.audit.add(sessionID, userID, common.TerminalAuditLeave, via)
+				h.publishPresence(sessionID, userID, "left")
+			}
+		})
+	}
+}
+
 // HandleTerminalCreateResponse handles responses from agent for terminal creation
 func (h *Handler) HandleTerminalCreateResponse(response *pb.TerminalCreateResponse) error {
 	// If terminal creation failed on agent, cleanup local session
 	if !response.Success {
 		log.Printf("Terminal creation failed on agent for session %s: %s", response.SessionId, response.Error)
-		h.sessionManager.CloseSession(response.SessionId)
+		h.closeSession(response.SessionId, "Terminal creation failed: "+response.Error)
 		return fmt.Errorf("terminal creation failed: %s", response.Error)
 	}
 
@@ -207,9 +591,12 @@ func (h *Handler) HandleTerminalCommandResponse(response *pb.TerminalCommandResp
 	// Handle both command-specific responses and session output
 	if response.CommandId != "" {
 		// This is a response to a specific command
-		h.mu.RLock()
+		h.mu.Lock()
 		_, exists := h.pendingCommands[response.CommandId]
-		h.mu.RUnlock()
+		if response.IsFinal {
+			delete(h.pendingCommands, response.CommandId)
+		}
+		h.mu.Unlock()
 
 		if !exists {
 			log.Printf("Received response for unknown command: %s", response.CommandId)
@@ -217,6 +604,12 @@ func (h *Handler) HandleTerminalCommandResponse(response *pb.TerminalCommandResp
 		}
 	}
 
+	// A final response without a command ID means the shell itself exited
+	if response.CommandId == "" && response.IsFinal {
+		h.subscribers.publish(response.SessionId, Event{Type: EventExit, ExitCode: response.ExitCode})
+		h.closeSession(response.SessionId, response.Error)
+	}
+
 	// Send output via SSE to client (regardless of command ID)
 	roomID := fmt.Sprintf("terminal_%s", response.SessionId)
 
@@ -230,6 +623,9 @@ func (h *Handler) HandleTerminalCommandResponse(response *pb.TerminalCommandResp
 
 	if response.IsFinal {
 		outputData["exit_code"] = response.ExitCode
+		if response.CommandId != "" {
+			outputData["duration_ms"] = response.DurationMs
+		}
 	}
 
 	// Send to SSE room
@@ -243,6 +639,19 @@ func (h *Handler) HandleTerminalCommandResponse(response *pb.TerminalCommandResp
 	return nil
 }
 
+// HandleTerminalOutput broadcasts raw output from a session's terminal
+func (h *Handler) HandleTerminalOutput(output *pb.TerminalOutput) error {
+	// The offset lets stream clients skip output already replayed from the scrollback
+	offset := h.subscribers.publishOutput(output.SessionId, output.Data)
+	h.broadcaster.TerminalOutput(output.SessionId, output.Data, offset, output.CommandId)
+	h.recorder.RecordOutput(output.SessionId, output.Data)
+
+	// Update last activity
+	h.sessionManager.UpdateLastActivity(output.SessionId)
+
+	return nil
+}
+
 // HandleTerminalCloseResponse handles responses from agent for terminal closure
 func (h *Handler) HandleTerminalCloseResponse(response *pb.TerminalCloseResponse) error {
 	if !response.Success {
@@ -252,10 +661,211 @@ func (h *Handler) HandleTerminalCloseResponse(response *pb.TerminalCloseResponse
 	}
 
 	// Always cleanup local session
-	return h.sessionManager.CloseSession(response.SessionId)
+	return h.closeSession(response.SessionId, "Terminal session closed")
+}
+
+// HandleTerminalSessionsAnnouncement re-attaches the sessions an agent still has running after a reconnect
+func (h *Handler) HandleTerminalSessionsAnnouncement(agentID string, announcement *pb.TerminalSessionsAnnouncement) error {
+	h.mu.Lock()
+	delete(h.disconnected, agentID)
+	h.mu.Unlock()
+
+	announced := make(map[string]bool, len(announcement.Sessions))
+
+	for _, info := range announcement.Sessions {
+		announced[info.SessionId] = true
+
+		session, err := h.sessionManager.GetSession(info.SessionId)
+		if err != nil || session.AgentID != agentID {
+			// Nobody can reach a session the server doesn't know about (e.g. after a server restart)
+			log.Printf("Closing unknown terminal session %s on agent %s", info.SessionId, agentID)
+			h.sendCloseRequest(agentID, info.SessionId)
+			continue
+		}
+
+		h.sessionManager.SetSessionStatus(info.SessionId, common.TerminalStatusActive)
+		h.publishStatus(info.SessionId, common.TerminalStatusActive, "Terminal session re-attached")
+		log.Printf("Terminal session %s re-attached on agent %s", info.SessionId, agentID)
+	}
+
+	// Sessions that were detached on disconnect but not announced are gone on the agent
+	for _, session := range h.sessionManager.GetAgentSessions(agentID) {
+		if announced[session.SessionID] || session.Status != common.TerminalStatusInactive {
+			continue
+		}
+
+		h.closeSession(session.SessionID, "Terminal session lost while agent was disconnected")
+		log.Printf("Terminal session %s no longer exists on agent %s", session.SessionID, agentID)
+	}
+
+	return nil
+}
+
+// HandleAgentDisconnected marks an agent's sessions inactive once its stream
+// is gone. They stay inactive until the agent reconnects and announces them.
+func (h *Handler) HandleAgentDisconnected(agentID string) {
+	h.mu.Lock()
+	h.disconnected[agentID] = true
+	h.mu.Unlock()
+
+	h.setAgentSessionsStatus(agentID, common.TerminalStatusActive, common.TerminalStatusInactive, "Agent disconnected, waiting for it to reconnect")
+}
+
+// OnStatusChange implements StatusChangeListener to mark sessions inactive
+// while their agent is offline. An agent that went offline by missing pongs
+// but kept its stream sends no announcement when it recovers, so its sessions
+// are made active again here.
+func (h *Handler) OnStatusChange(event common.StatusChangeEvent) {
+	// Listeners run asynchronously; act on the current status rather than a stale event
+	online := h.statusManager.IsAgentOnline(event.AgentID)
+
+	switch {
+	case event.NewStatus == common.AgentStatusOffline && !online:
+		h.setAgentSessionsStatus(event.AgentID, common.TerminalStatusActive, common.TerminalStatusInactive, "Agent unreachable, waiting for it to recover")
+
+	case event.OldStatus == common.AgentStatusOffline && event.NewStatus.IsAvailable() && online:
+		h.mu.RLock()
+		disconnected := h.disconnected[event.AgentID]
+		h.mu.RUnlock()
+
+		if !disconnected {
+			h.setAgentSessionsStatus(event.AgentID, common.TerminalStatusInactive, common.TerminalStatusActive, "Agent reachable again")
+		}
+	}
+}
+
+// setAgentSessionsStatus moves an agent's sessions from one status to another
+func (h *Handler) setAgentSessionsStatus(agentID string, from, to common.TerminalStatus, message string) {
+	for _, session := range h.sessionManager.GetAgentSessions(agentID) {
+		if session.Status != from {
+			continue
+		}
+
+		h.sessionManager.SetSessionStatus(session.SessionID, to)
+		h.publishStatus(session.SessionID, to, message)
+	}
+}
+
+// connectedSession returns a session the user may access with the required
+// role whose agent is connected
+func (h *Handler) connectedSession(sessionID, userID string, required common.TerminalRole) (*common.TerminalSession, error) {
+	if err := h.sessionManager.ValidateSessionAccess(sessionID, userID, required); err != nil {
+		return nil, err
+	}
+
+	session, err := h.sessionManager.GetSession(sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	if !h.statusManager.IsAgentOnline(session.AgentID) {
+		return nil, common.ErrAgentNotConnected
+	}
+
+	return session, nil
+}
+
+// closeSession closes a session locally, finishing its recording and telling its clients
+func (h *Handler) closeSession(sessionID, message string) error {
+	if err := h.sessionManager.CloseSession(sessionID); err != nil {
+		return err
+	}
+
+	h.recorder.Stop(sessionID)
+	h.publishStatus(sessionID, common.TerminalStatusClosed, message)
+	h.subscribers.forget(sessionID)
+	h.presence.forget(sessionID)
+	h.audit.close(sessionID)
+
+	// Commands still running won't report anymore
+	h.mu.Lock()
+	for commandID, command := range h.pendingCommands {
+		if command.SessionID == sessionID {
+			delete(h.pendingCommands, commandID)
+		}
+	}
+	h.mu.Unlock()
+	return nil
+}
+
+// publishStatus announces a session status change to SSE clients and subscribers
+func (h *Handler) publishStatus(sessionID string, status common.TerminalStatus, message string) {
+	h.broadcaster.TerminalStatus(sessionID, string(status), message)
+	h.subscribers.publish(sessionID, Event{Type: EventStatus, Status: string(status), Message: message})
+}
+
+// publishPresence announces a change of who is attached to a session to its SSE clients
+func (h *Handler) publishPresence(sessionID, userID, action string) {
+	h.broadcaster.TerminalPresence(sessionID, userID, action, h.attached(sessionID))
+}
+
+// attached returns the users attached to a session along with their roles
+func (h *Handler) attached(sessionID string) []common.TerminalPresence {
+	users := h.presence.users(sessionID)
+	attached := make([]common.TerminalPresence, 0, len(users))
+	for _, user := range users {
+		role, _ := h.sessionManager.GetSessionRole(sessionID, user.userID)
+		attached = append(attached, common.TerminalPresence{
+			UserID:      user.userID,
+			Role:        role,
+			Connections: user.connections,
+			Since:       user.since,
+		})
+	}
+	return attached
+}
+
+// sendCloseRequest asks an agent to close a terminal session
+func (h *Handler) sendCloseRequest(agentID, sessionID string) {
+	message := &pb.ServerMessage{
+		Message: &pb.ServerMessage_TerminalCloseRequest{
+			TerminalCloseRequest: &pb.TerminalCloseRequest{
+				SessionId: sessionID,
+			},
+		},
+	}
+
+	if err := h.streamSender.SendToAgent(agentID, message); err != nil {
+		log.Printf("Failed to send terminal close request for session %s: %v", sessionID, err)
+	}
+}
+
+// validateSize checks that a terminal size is within bounds
+func validateSize(rows, cols int) error {
+	if rows < 1 || rows > common.MaxTerminalSize || cols < 1 || cols > common.MaxTerminalSize {
+		return common.ErrInvalidTerminalSize
+	}
+	return nil
 }
 
 // GetTerminalSessionRoom returns the SSE room name for a terminal session
 func GetTerminalSessionRoom(sessionID string) string {
 	return fmt.Sprintf("terminal_%s", sessionID)
 }
+
+// noRecorder records nothing, used until a recorder is set
+type noRecorder struct{}
+
+func (noRecorder) ShouldRecord(agentID string, requested *bool) bool { return false }
+func (noRecorder) Start(session *common.TerminalSession) error       { return nil }
+func (noRecorder) RecordOutput(sessionID string, data []byte)        {}
+func (noRecorder) RecordInput(sessionID, userID string, data []byte) {}
+func (noRecorder) RecordResize(sessionID string, rows, cols int)     {}
+func (noRecorder) Stop(sessionID string)                             {}
+
+// noAuditStore keeps nothing, used until an audit store is set
+type noAuditStore struct{}
+
+func (noAuditStore) SaveAuditLog(log *common.TerminalAuditLog) error { return nil }
+func (noAuditStore) GetAuditLog(sessionID string) (*common.TerminalAuditLog, error) {
+	return nil, common.ErrAuditLogNotFound
+}
+func (noAuditStore) SaveAuditEntries(sessionID string, entries map[uint64]common.TerminalAuditEntry) error {
+	return nil
+}
+func (noAuditStore) LoadAuditEntries(sessionID string) ([]common.TerminalAuditEntry, error) {
+	return []common.TerminalAuditEntry{}, nil
+}
+func (noAuditStore) DeleteAuditLogs(closedBefore time.Time, limit int) (int, error) {
+	return 0, nil
+}
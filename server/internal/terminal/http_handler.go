@@ -2,10 +2,13 @@ package terminal
 
 import (
 	"net/http"
+	"sort"
 	"strings"
 
 	"github.com/gin-gonic/gin"
+	"github.com/mooncorn/nodelink/server/internal/auth"
 	"github.com/mooncorn/nodelink/server/internal/common"
+	"github.com/mooncorn/nodelink/server/internal/labels"
 )
 
 // HTTPHandler handles HTTP endpoints for terminal operations
@@ -27,33 +30,71 @@ func (h *HTTPHandler) RegisterRoutes(router gin.IRouter) {
 		terminals.POST("", h.createTerminalSession)
 		terminals.GET("", h.getUserTerminalSessions)
 		terminals.POST("/:sessionId/command", h.executeCommand)
+		terminals.POST("/:sessionId/resize", h.resizeTerminal)
+		terminals.POST("/:sessionId/detach", h.detachTerminalSession)
+		terminals.POST("/:sessionId/attach", h.attachTerminalSession)
 		terminals.DELETE("/:sessionId", h.closeTerminalSession)
+		terminals.GET("/:sessionId/participants", h.getParticipants)
+		terminals.PUT("/:sessionId/participants/:userId", h.shareTerminalSession)
+		terminals.DELETE("/:sessionId/participants/:userId", h.revokeParticipant)
+		terminals.GET("/:sessionId/audit", h.getAuditLog)
 	}
 }
 
-// CreateSessionRequest represents the request to create a terminal session
+// CreateSessionRequest represents the request to create a terminal session.
+// Exactly one of AgentID and Selector must be set; with a selector the session
+// opens on the matching online agent with the fewest open sessions.
 type CreateSessionRequest struct {
-	AgentID    string            `json:"agent_id" binding:"required"`
+	AgentID    string            `json:"agent_id,omitempty"`
+	Selector   string            `json:"selector,omitempty"`
 	Shell      string            `json:"shell,omitempty"`
 	WorkingDir string            `json:"working_dir,omitempty"`
 	Env        map[string]string `json:"env,omitempty"`
+	Rows       int               `json:"rows,omitempty"` // initial terminal size, 24x80 by default
+	Cols       int               `json:"cols,omitempty"`
+	Record     *bool             `json:"record,omitempty"` // record the session, the server default if unset
 }
 
 // CreateSessionResponse represents the response for terminal session creation
 type CreateSessionResponse struct {
 	SessionID  string `json:"session_id"`
+	Owner      string `json:"owner"`
+	Role       string `json:"role"` // the requesting user's role
 	AgentID    string `json:"agent_id"`
 	Shell      string `json:"shell"`
 	WorkingDir string `json:"working_dir"`
 	Status     string `json:"status"`
+	Rows       int    `json:"rows"`
+	Cols       int    `json:"cols"`
+	Recorded   bool   `json:"recorded"`
+	Detached   bool   `json:"detached"`
 	CreatedAt  string `json:"created_at"`
 }
 
+// ShareSessionRequest represents the request to invite a user into a terminal session
+type ShareSessionRequest struct {
+	Role string `json:"role" binding:"required"` // collaborator or observer
+}
+
+// ParticipantsResponse lists who a terminal session is shared with and who is attached
+type ParticipantsResponse struct {
+	SessionID    string                       `json:"session_id"`
+	Owner        string                       `json:"owner"`
+	Participants []common.TerminalParticipant `json:"participants"`
+	Attached     []common.TerminalPresence    `json:"attached"`
+}
+
 // ExecuteCommandRequest represents the request to execute a command
 type ExecuteCommandRequest struct {
 	Command string `json:"command" binding:"required"`
 }
 
+// ResizeTerminalRequest represents the request to resize a terminal
+type ResizeTerminalRequest struct {
+	Rows int `json:"rows" binding:"required"`
+	Cols int `json:"cols" binding:"required"`
+}
+
 // ExecuteCommandResponse represents the response for command execution
 type ExecuteCommandResponse struct {
 	CommandID string `json:"command_id"`
@@ -70,12 +111,31 @@ func (h *HTTPHandler) createTerminalSession(c *gin.Context) {
 	}
 
 	// Get user ID from context (should be set by auth middleware)
-	userID := h.getUserIDFromContext(c)
+	userID := auth.UserIDFromContext(c)
 	if userID == "" {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "User authentication required"})
 		return
 	}
 
+	if (req.AgentID == "") == (req.Selector == "") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Exactly one of agent_id and selector is required"})
+		return
+	}
+
+	if req.Selector != "" {
+		selector, err := labels.Parse(req.Selector)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		req.AgentID, err = h.terminalHandler.SelectAgent(selector)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "No online agents match the selector"})
+			return
+		}
+	}
+
 	// Create terminal session
 	session, err := h.terminalHandler.CreateTerminalSession(
 		c.Request.Context(),
@@ -84,6 +144,9 @@ func (h *HTTPHandler) createTerminalSession(c *gin.Context) {
 		req.Shell,
 		req.WorkingDir,
 		req.Env,
+		req.Rows,
+		req.Cols,
+		req.Record,
 	)
 
 	if err != nil {
@@ -92,29 +155,21 @@ func (h *HTTPHandler) createTerminalSession(c *gin.Context) {
 			c.JSON(http.StatusNotFound, gin.H{"error": "Agent is not connected"})
 		case common.ErrMaxTerminalSessionsReached:
 			c.JSON(http.StatusTooManyRequests, gin.H{"error": "Maximum terminal sessions reached"})
+		case common.ErrInvalidTerminalSize:
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		default:
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		}
 		return
 	}
 
-	// Convert to response
-	response := CreateSessionResponse{
-		SessionID:  session.SessionID,
-		AgentID:    session.AgentID,
-		Shell:      session.Shell,
-		WorkingDir: session.WorkingDir,
-		Status:     string(session.Status),
-		CreatedAt:  session.CreatedAt.Format("2006-01-02T15:04:05Z07:00"),
-	}
-
-	c.JSON(http.StatusCreated, response)
+	c.JSON(http.StatusCreated, newSessionResponse(session, userID))
 }
 
 // getUserTerminalSessions handles GET /terminals
 func (h *HTTPHandler) getUserTerminalSessions(c *gin.Context) {
 	// Get user ID from context
-	userID := h.getUserIDFromContext(c)
+	userID := auth.UserIDFromContext(c)
 	if userID == "" {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "User authentication required"})
 		return
@@ -126,14 +181,7 @@ func (h *HTTPHandler) getUserTerminalSessions(c *gin.Context) {
 	// Convert to response format
 	response := make([]CreateSessionResponse, len(sessions))
 	for i, session := range sessions {
-		response[i] = CreateSessionResponse{
-			SessionID:  session.SessionID,
-			AgentID:    session.AgentID,
-			Shell:      session.Shell,
-			WorkingDir: session.WorkingDir,
-			Status:     string(session.Status),
-			CreatedAt:  session.CreatedAt.Format("2006-01-02T15:04:05Z07:00"),
-		}
+		response[i] = newSessionResponse(session, userID)
 	}
 
 	c.JSON(http.StatusOK, gin.H{"sessions": response})
@@ -154,7 +202,7 @@ func (h *HTTPHandler) executeCommand(c *gin.Context) {
 	}
 
 	// Get user ID from context
-	userID := h.getUserIDFromContext(c)
+	userID := auth.UserIDFromContext(c)
 	if userID == "" {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "User authentication required"})
 		return
@@ -174,6 +222,8 @@ func (h *HTTPHandler) executeCommand(c *gin.Context) {
 			c.JSON(http.StatusNotFound, gin.H{"error": "Terminal session not found"})
 		case common.ErrUnauthorizedTerminalAccess:
 			c.JSON(http.StatusForbidden, gin.H{"error": "Unauthorized access to terminal session"})
+		case common.ErrInsufficientTerminalRole:
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
 		case common.ErrTerminalSessionClosed:
 			c.JSON(http.StatusGone, gin.H{"error": "Terminal session is closed"})
 		case common.ErrAgentNotConnected:
@@ -194,6 +244,224 @@ func (h *HTTPHandler) executeCommand(c *gin.Context) {
 	c.JSON(http.StatusOK, response)
 }
 
+// resizeTerminal handles POST /terminals/:sessionId/resize
+func (h *HTTPHandler) resizeTerminal(c *gin.Context) {
+	sessionID := c.Param("sessionId")
+	if sessionID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Session ID is required"})
+		return
+	}
+
+	var req ResizeTerminalRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON body, rows and cols are required"})
+		return
+	}
+
+	// Get user ID from context
+	userID := auth.UserIDFromContext(c)
+	if userID == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User authentication required"})
+		return
+	}
+
+	err := h.terminalHandler.ResizeTerminal(c.Request.Context(), sessionID, userID, req.Rows, req.Cols)
+	if err != nil {
+		switch err {
+		case common.ErrInvalidTerminalSize:
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case common.ErrTerminalSessionNotFound:
+			c.JSON(http.StatusNotFound, gin.H{"error": "Terminal session not found"})
+		case common.ErrUnauthorizedTerminalAccess:
+			c.JSON(http.StatusForbidden, gin.H{"error": "Unauthorized access to terminal session"})
+		case common.ErrInsufficientTerminalRole:
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		case common.ErrTerminalSessionClosed:
+			c.JSON(http.StatusGone, gin.H{"error": "Terminal session is closed"})
+		case common.ErrAgentNotConnected:
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Agent is not connected"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"session_id": sessionID, "rows": req.Rows, "cols": req.Cols})
+}
+
+// detachTerminalSession handles POST /terminals/:sessionId/detach
+func (h *HTTPHandler) detachTerminalSession(c *gin.Context) {
+	sessionID := c.Param("sessionId")
+
+	// Get user ID from context
+	userID := auth.UserIDFromContext(c)
+	if userID == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User authentication required"})
+		return
+	}
+
+	if err := h.terminalHandler.DetachSession(c.Request.Context(), sessionID, userID); err != nil {
+		respondSessionError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"session_id": sessionID, "detached": true})
+}
+
+// attachTerminalSession handles POST /terminals/:sessionId/attach
+func (h *HTTPHandler) attachTerminalSession(c *gin.Context) {
+	sessionID := c.Param("sessionId")
+
+	// Get user ID from context
+	userID := auth.UserIDFromContext(c)
+	if userID == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User authentication required"})
+		return
+	}
+
+	session, err := h.terminalHandler.AttachSession(c.Request.Context(), sessionID, userID)
+	if err != nil {
+		respondSessionError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, newSessionResponse(session, userID))
+}
+
+// getParticipants handles GET /terminals/:sessionId/participants
+func (h *HTTPHandler) getParticipants(c *gin.Context) {
+	sessionID := c.Param("sessionId")
+
+	// Get user ID from context
+	userID := auth.UserIDFromContext(c)
+	if userID == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User authentication required"})
+		return
+	}
+
+	session, attached, err := h.terminalHandler.GetParticipants(sessionID, userID)
+	if err != nil {
+		respondSessionError(c, err)
+		return
+	}
+
+	participants := make([]common.TerminalParticipant, 0, len(session.Participants))
+	for _, participant := range session.Participants {
+		participants = append(participants, participant)
+	}
+	sort.Slice(participants, func(i, j int) bool { return participants[i].InvitedAt.Before(participants[j].InvitedAt) })
+
+	c.JSON(http.StatusOK, ParticipantsResponse{
+		SessionID:    session.SessionID,
+		Owner:        session.UserID,
+		Participants: participants,
+		Attached:     attached,
+	})
+}
+
+// shareTerminalSession handles PUT /terminals/:sessionId/participants/:userId
+func (h *HTTPHandler) shareTerminalSession(c *gin.Context) {
+	sessionID := c.Param("sessionId")
+
+	var req ShareSessionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON body, role is required"})
+		return
+	}
+
+	// Get user ID from context
+	userID := auth.UserIDFromContext(c)
+	if userID == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User authentication required"})
+		return
+	}
+
+	participant, err := h.terminalHandler.ShareSession(c.Request.Context(), sessionID, userID, strings.TrimSpace(c.Param("userId")), common.TerminalRole(req.Role))
+	if err != nil {
+		respondSessionError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, participant)
+}
+
+// revokeParticipant handles DELETE /terminals/:sessionId/participants/:userId
+func (h *HTTPHandler) revokeParticipant(c *gin.Context) {
+	sessionID := c.Param("sessionId")
+
+	// Get user ID from context
+	userID := auth.UserIDFromContext(c)
+	if userID == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User authentication required"})
+		return
+	}
+
+	if err := h.terminalHandler.RevokeParticipant(c.Request.Context(), sessionID, userID, c.Param("userId")); err != nil {
+		respondSessionError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Participant removed successfully"})
+}
+
+// getAuditLog handles GET /terminals/:sessionId/audit
+func (h *HTTPHandler) getAuditLog(c *gin.Context) {
+	sessionID := c.Param("sessionId")
+
+	// Get user ID from context
+	userID := auth.UserIDFromContext(c)
+	if userID == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User authentication required"})
+		return
+	}
+
+	entries, err := h.terminalHandler.GetAuditLog(sessionID, userID)
+	if err != nil {
+		respondSessionError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"session_id": sessionID, "entries": entries})
+}
+
+// newSessionResponse describes a session as seen by the given user
+func newSessionResponse(session *common.TerminalSession, userID string) CreateSessionResponse {
+	return CreateSessionResponse{
+		SessionID:  session.SessionID,
+		Owner:      session.UserID,
+		Role:       string(session.RoleOf(userID)),
+		AgentID:    session.AgentID,
+		Shell:      session.Shell,
+		WorkingDir: session.WorkingDir,
+		Status:     string(session.Status),
+		Rows:       session.Rows,
+		Cols:       session.Cols,
+		Recorded:   session.Recorded,
+		Detached:   session.Detached,
+		CreatedAt:  session.CreatedAt.Format("2006-01-02T15:04:05Z07:00"),
+	}
+}
+
+// respondSessionError responds with the status matching a session access error
+func respondSessionError(c *gin.Context, err error) {
+	switch err {
+	case common.ErrTerminalSessionNotFound:
+		c.JSON(http.StatusNotFound, gin.H{"error": "Terminal session not found"})
+	case common.ErrUnauthorizedTerminalAccess:
+		c.JSON(http.StatusForbidden, gin.H{"error": "Unauthorized access to terminal session"})
+	case common.ErrInsufficientTerminalRole:
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	case common.ErrTerminalSessionClosed:
+		c.JSON(http.StatusGone, gin.H{"error": "Terminal session is closed"})
+	case common.ErrInvalidTerminalInvite:
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case common.ErrParticipantNotFound:
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
+
 // closeTerminalSession handles DELETE /terminals/:sessionId
 func (h *HTTPHandler) closeTerminalSession(c *gin.Context) {
 	sessionID := c.Param("sessionId")
@@ -203,7 +471,7 @@ func (h *HTTPHandler) closeTerminalSession(c *gin.Context) {
 	}
 
 	// Get user ID from context
-	userID := h.getUserIDFromContext(c)
+	userID := auth.UserIDFromContext(c)
 	if userID == "" {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "User authentication required"})
 		return
@@ -222,6 +490,8 @@ func (h *HTTPHandler) closeTerminalSession(c *gin.Context) {
 			c.JSON(http.StatusNotFound, gin.H{"error": "Terminal session not found"})
 		case common.ErrUnauthorizedTerminalAccess:
 			c.JSON(http.StatusForbidden, gin.H{"error": "Unauthorized access to terminal session"})
+		case common.ErrInsufficientTerminalRole:
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
 		default:
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		}
@@ -230,23 +500,3 @@ func (h *HTTPHandler) closeTerminalSession(c *gin.Context) {
 
 	c.JSON(http.StatusOK, gin.H{"message": "Terminal session closed successfully"})
 }
-
-// getUserIDFromContext extracts user ID from the request context
-// This should be set by authentication middleware
-func (h *HTTPHandler) getUserIDFromContext(c *gin.Context) string {
-	// For now, we'll use a simple approach with a header
-	// In a real implementation, this would come from JWT token or session
-	userID := c.GetHeader("X-User-ID")
-	if userID == "" {
-		// Fallback to query parameter for testing
-		userID = c.Query("user_id")
-	}
-
-	// Clean and validate user ID
-	userID = strings.TrimSpace(userID)
-	if userID == "" {
-		return ""
-	}
-
-	return userID
-}
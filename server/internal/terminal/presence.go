@@ -0,0 +1,122 @@
+package terminal
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// attachment is one connection of a user to a session
+type attachment struct {
+	userID  string
+	via     string // sse or websocket
+	since   time.Time
+	revoked chan struct{}
+}
+
+// presence tracks which users are attached to each session
+type presence struct {
+	sessions map[string]map[*attachment]struct{}
+	mu       sync.Mutex
+}
+
+// newPresence creates an empty presence tracker
+func newPresence() *presence {
+	return &presence{
+		sessions: make(map[string]map[*attachment]struct{}),
+	}
+}
+
+// join records a new connection of a user to a session
+func (p *presence) join(sessionID, userID, via string) *attachment {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	a := &attachment{userID: userID, via: via, since: time.Now(), revoked: make(chan struct{})}
+	if p.sessions[sessionID] == nil {
+		p.sessions[sessionID] = make(map[*attachment]struct{})
+	}
+	p.sessions[sessionID][a] = struct{}{}
+	return a
+}
+
+// leave removes a connection, reporting false if it was already revoked or forgotten
+func (p *presence) leave(sessionID string, a *attachment) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	attachments := p.sessions[sessionID]
+	if _, exists := attachments[a]; !exists {
+		return false
+	}
+
+	delete(attachments, a)
+	if len(attachments) == 0 {
+		delete(p.sessions, sessionID)
+	}
+	return true
+}
+
+// revoke removes every connection of a user to a session and tells each one
+// to disconnect, returning how many there were
+func (p *presence) revoke(sessionID, userID string) int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	attachments := p.sessions[sessionID]
+	revoked := 0
+	for a := range attachments {
+		if a.userID != userID {
+			continue
+		}
+		delete(attachments, a)
+		close(a.revoked)
+		revoked++
+	}
+	if len(attachments) == 0 {
+		delete(p.sessions, sessionID)
+	}
+	return revoked
+}
+
+// users returns each attached user with their number of connections and when
+// the earliest was opened, ordered by that time
+func (p *presence) users(sessionID string) []attachedUser {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	byUser := make(map[string]*attachedUser)
+	for a := range p.sessions[sessionID] {
+		user, exists := byUser[a.userID]
+		if !exists {
+			user = &attachedUser{userID: a.userID, since: a.since}
+			byUser[a.userID] = user
+		}
+		user.connections++
+		if a.since.Before(user.since) {
+			user.since = a.since
+		}
+	}
+
+	users := make([]attachedUser, 0, len(byUser))
+	for _, user := range byUser {
+		users = append(users, *user)
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].since.Before(users[j].since) })
+	return users
+}
+
+// forget drops the connections of a closed session
+func (p *presence) forget(sessionID string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	delete(p.sessions, sessionID)
+}
+
+// attachedUser summarizes the connections of one user to a session
+type attachedUser struct {
+	userID      string
+	connections int
+	since       time.Time
+}
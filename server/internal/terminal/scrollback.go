@@ -0,0 +1,60 @@
+package terminal
+
+import "unicode/utf8"
+
+// scrollback is a ring buffer holding the most recent output of a session
+type scrollback struct {
+	data  []byte
+	start int   // index of the oldest byte
+	size  int   // number of bytes held
+	total int64 // bytes written since the session started
+}
+
+// newScrollback creates a buffer holding up to capacity bytes
+func newScrollback(capacity int) *scrollback {
+	return &scrollback{data: make([]byte, capacity)}
+}
+
+// write appends output, overwriting the oldest once the buffer is full
+func (s *scrollback) write(p []byte) {
+	s.total += int64(len(p))
+
+	capacity := len(s.data)
+	if len(p) >= capacity {
+		copy(s.data, p[len(p)-capacity:])
+		s.start, s.size = 0, capacity
+		return
+	}
+
+	end := (s.start + s.size) % capacity
+	n := copy(s.data[end:], p)
+	copy(s.data, p[n:])
+
+	s.size += len(p)
+	if s.size > capacity {
+		s.start = (s.start + s.size - capacity) % capacity
+		s.size = capacity
+	}
+}
+
+// snapshot returns a copy of the buffered output and the total written so far.
+// Once older output has been overwritten, the copy starts at the next complete
+// UTF-8 character.
+func (s *scrollback) snapshot() ([]byte, int64) {
+	out := make([]byte, 0, s.size)
+	if s.start+s.size <= len(s.data) {
+		out = append(out, s.data[s.start:s.start+s.size]...)
+	} else {
+		out = append(out, s.data[s.start:]...)
+		out = append(out, s.data[:s.start+s.size-len(s.data)]...)
+	}
+
+	if s.total > int64(s.size) {
+		for i := 0; i < len(out) && i < utf8.UTFMax; i++ {
+			if utf8.RuneStart(out[i]) {
+				return out[i:], s.total
+			}
+		}
+	}
+	return out, s.total
+}
@@ -15,6 +15,7 @@ type SessionManager struct {
 	mu            sync.RWMutex
 	cleanupTicker *time.Ticker
 	stopCleanup   chan struct{}
+	onInactive    func(sessionID string) // closes inactive sessions, if set
 }
 
 // NewSessionManager creates a new terminal session manager
@@ -57,6 +58,8 @@ func (sm *SessionManager) CreateSession(userID, agentID, shell, workingDir strin
 		Shell:        shell,
 		WorkingDir:   workingDir,
 		Status:       common.TerminalStatusActive,
+		Rows:         common.DefaultTerminalRows,
+		Cols:         common.DefaultTerminalCols,
 		CreatedAt:    time.Now(),
 		LastActivity: time.Now(),
 		Env:          env,
@@ -66,10 +69,10 @@ func (sm *SessionManager) CreateSession(userID, agentID, shell, workingDir strin
 	sm.sessions[sessionID] = session
 	sm.userSessions[userID] = append(sm.userSessions[userID], sessionID)
 
-	return session, nil
+	return snapshot(session), nil
 }
 
-// GetSession retrieves a session by ID
+// GetSession retrieves a snapshot of a session by ID
 func (sm *SessionManager) GetSession(sessionID string) (*common.TerminalSession, error) {
 	sm.mu.RLock()
 	defer sm.mu.RUnlock()
@@ -79,10 +82,10 @@ func (sm *SessionManager) GetSession(sessionID string) (*common.TerminalSession,
 		return nil, common.ErrTerminalSessionNotFound
 	}
 
-	return session, nil
+	return snapshot(session), nil
 }
 
-// GetUserSessions returns all sessions for a user
+// GetUserSessions returns all sessions a user owns, followed by those shared with the user
 func (sm *SessionManager) GetUserSessions(userID string) []*common.TerminalSession {
 	sm.mu.RLock()
 	defer sm.mu.RUnlock()
@@ -92,13 +95,155 @@ func (sm *SessionManager) GetUserSessions(userID string) []*common.TerminalSessi
 
 	for _, sessionID := range sessionIDs {
 		if session, exists := sm.sessions[sessionID]; exists {
-			sessions = append(sessions, session)
+			sessions = append(sessions, snapshot(session))
+		}
+	}
+
+	for _, session := range sm.sessions {
+		if _, shared := session.Participants[userID]; shared {
+			sessions = append(sessions, snapshot(session))
 		}
 	}
 
 	return sessions
 }
 
+// GetAgentSessions returns all sessions running on an agent
+func (sm *SessionManager) GetAgentSessions(agentID string) []*common.TerminalSession {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+
+	sessions := make([]*common.TerminalSession, 0)
+	for _, session := range sm.sessions {
+		if session.AgentID == agentID {
+			sessions = append(sessions, snapshot(session))
+		}
+	}
+
+	return sessions
+}
+
+// snapshot copies a session so it can be read after the lock is released
+// while the original keeps changing
+func snapshot(session *common.TerminalSession) *common.TerminalSession {
+	copied := *session
+	if session.Participants != nil {
+		copied.Participants = make(map[string]common.TerminalParticipant, len(session.Participants))
+		for userID, participant := range session.Participants {
+			copied.Participants[userID] = participant
+		}
+	}
+	return &copied
+}
+
+// SetSessionStatus updates the status of a session
+func (sm *SessionManager) SetSessionStatus(sessionID string, status common.TerminalStatus) error {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	session, exists := sm.sessions[sessionID]
+	if !exists {
+		return common.ErrTerminalSessionNotFound
+	}
+
+	session.Status = status
+	return nil
+}
+
+// SetSessionSize records the size of a session's terminal
+func (sm *SessionManager) SetSessionSize(sessionID string, rows, cols int) error {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	session, exists := sm.sessions[sessionID]
+	if !exists {
+		return common.ErrTerminalSessionNotFound
+	}
+
+	session.Rows = rows
+	session.Cols = cols
+	return nil
+}
+
+// SetSessionRecorded marks whether a session is being recorded
+func (sm *SessionManager) SetSessionRecorded(sessionID string, recorded bool) error {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	session, exists := sm.sessions[sessionID]
+	if !exists {
+		return common.ErrTerminalSessionNotFound
+	}
+
+	session.Recorded = recorded
+	return nil
+}
+
+// SetSessionDetached marks whether a session is detached from its clients
+func (sm *SessionManager) SetSessionDetached(sessionID string, detached bool) error {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	session, exists := sm.sessions[sessionID]
+	if !exists {
+		return common.ErrTerminalSessionNotFound
+	}
+
+	session.Detached = detached
+	return nil
+}
+
+// SetParticipant invites a user into a session, or changes the role of one already invited
+func (sm *SessionManager) SetParticipant(sessionID string, participant common.TerminalParticipant) error {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	session, exists := sm.sessions[sessionID]
+	if !exists {
+		return common.ErrTerminalSessionNotFound
+	}
+
+	if session.Participants == nil {
+		session.Participants = make(map[string]common.TerminalParticipant)
+	}
+	session.Participants[participant.UserID] = participant
+	return nil
+}
+
+// RemoveParticipant revokes a user's access to a session
+func (sm *SessionManager) RemoveParticipant(sessionID, userID string) error {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	session, exists := sm.sessions[sessionID]
+	if !exists {
+		return common.ErrTerminalSessionNotFound
+	}
+	if _, exists := session.Participants[userID]; !exists {
+		return common.ErrParticipantNotFound
+	}
+
+	delete(session.Participants, userID)
+	return nil
+}
+
+// GetSessionRole returns the user's role in a session
+func (sm *SessionManager) GetSessionRole(sessionID, userID string) (common.TerminalRole, error) {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+
+	session, exists := sm.sessions[sessionID]
+	if !exists {
+		return "", common.ErrTerminalSessionNotFound
+	}
+
+	role := session.RoleOf(userID)
+	if role == "" {
+		return "", common.ErrUnauthorizedTerminalAccess
+	}
+	return role, nil
+}
+
 // CloseSession closes and removes a terminal session
 func (sm *SessionManager) CloseSession(sessionID string) error {
 	sm.mu.Lock()
@@ -146,47 +291,47 @@ func (sm *SessionManager) UpdateLastActivity(sessionID string) error {
 	return nil
 }
 
-// CleanupInactiveSessions removes sessions that have been inactive for too long
-func (sm *SessionManager) CleanupInactiveSessions(maxInactivity time.Duration) int {
+// SetInactiveHandler sets the function that closes sessions found inactive
+// by the cleanup, so they are closed like any other session
+func (sm *SessionManager) SetInactiveHandler(handler func(sessionID string)) {
 	sm.mu.Lock()
 	defer sm.mu.Unlock()
 
+	sm.onInactive = handler
+}
+
+// CleanupInactiveSessions closes sessions that have been inactive for too
+// long. Detached sessions are kept for at least DetachedTerminalTimeout.
+func (sm *SessionManager) CleanupInactiveSessions(maxInactivity time.Duration) int {
+	sm.mu.Lock()
+
 	now := time.Now()
-	cleanedCount := 0
 	sessionsToDelete := make([]string, 0)
 
 	// Find sessions to cleanup
 	for sessionID, session := range sm.sessions {
-		if now.Sub(session.LastActivity) > maxInactivity {
+		timeout := maxInactivity
+		if session.Detached && timeout < common.DetachedTerminalTimeout {
+			timeout = common.DetachedTerminalTimeout
+		}
+		if now.Sub(session.LastActivity) > timeout {
 			sessionsToDelete = append(sessionsToDelete, sessionID)
 		}
 	}
 
-	// Remove sessions
-	for _, sessionID := range sessionsToDelete {
-		session := sm.sessions[sessionID]
-		session.Status = common.TerminalStatusClosed
+	onInactive := sm.onInactive
+	sm.mu.Unlock()
 
-		delete(sm.sessions, sessionID)
-
-		// Remove from user sessions
-		userSessions := sm.userSessions[session.UserID]
-		for i, id := range userSessions {
-			if id == sessionID {
-				sm.userSessions[session.UserID] = append(userSessions[:i], userSessions[i+1:]...)
-				break
-			}
-		}
-
-		// Clean up empty user entry
-		if len(sm.userSessions[session.UserID]) == 0 {
-			delete(sm.userSessions, session.UserID)
+	// Close sessions without the lock, the handler updates them through the manager
+	for _, sessionID := range sessionsToDelete {
+		if onInactive != nil {
+			onInactive(sessionID)
+		} else {
+			sm.CloseSession(sessionID)
 		}
-
-		cleanedCount++
 	}
 
-	return cleanedCount
+	return len(sessionsToDelete)
 }
 
 // GetSessionStats returns statistics about current sessions
@@ -200,8 +345,21 @@ func (sm *SessionManager) GetSessionStats() map[string]interface{} {
 	}
 }
 
-// ValidateSessionAccess checks if a user has access to a session
-func (sm *SessionManager) ValidateSessionAccess(sessionID, userID string) error {
+// SessionCounts returns the number of sessions in each status
+func (sm *SessionManager) SessionCounts() map[common.TerminalStatus]int {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+
+	counts := make(map[common.TerminalStatus]int)
+	for _, session := range sm.sessions {
+		counts[session.Status]++
+	}
+	return counts
+}
+
+// ValidateSessionAccess checks if a user has access to a session with at
+// least the required role
+func (sm *SessionManager) ValidateSessionAccess(sessionID, userID string, required common.TerminalRole) error {
 	sm.mu.RLock()
 	defer sm.mu.RUnlock()
 
@@ -210,7 +368,8 @@ func (sm *SessionManager) ValidateSessionAccess(sessionID, userID string) error
 		return common.ErrTerminalSessionNotFound
 	}
 
-	if session.UserID != userID {
+	role := session.RoleOf(userID)
+	if role == "" {
 		return common.ErrUnauthorizedTerminalAccess
 	}
 
@@ -218,6 +377,10 @@ func (sm *SessionManager) ValidateSessionAccess(sessionID, userID string) error
 		return common.ErrTerminalSessionClosed
 	}
 
+	if !role.Allows(required) {
+		return common.ErrInsufficientTerminalRole
+	}
+
 	return nil
 }
 
@@ -2,6 +2,7 @@ package terminal
 
 import (
 	"github.com/gin-gonic/gin"
+	"github.com/mooncorn/nodelink/server/internal/auth"
 	"github.com/mooncorn/nodelink/server/internal/common"
 	"github.com/mooncorn/nodelink/server/internal/sse"
 )
@@ -29,14 +30,21 @@ func (h *SSEHandler) RegisterRoutes(router gin.IRouter) {
 	router.GET("/terminals/:sessionId/stream", h.handleTerminalStream)
 }
 
-// handleTerminalStream handles SSE connections for terminal output
+// handleTerminalStream handles SSE connections for terminal output, replaying
+// the scrollback first. Connecting reattaches a detached session, and the
+// session's other clients see the user join and leave.
 func (h *SSEHandler) handleTerminalStream(c *gin.Context) {
-	h.streamBuilder.ForTerminal("").RequireAuth(h.sessionManager).Handle(c)
+	if userID := auth.UserIDFromContext(c); userID != "" {
+		// Access errors are reported by the stream builder
+		h.terminalHandler.AttachSession(c.Request.Context(), c.Param("sessionId"), userID)
+	}
+
+	h.streamBuilder.ForTerminal("").RequireAuth(h.sessionManager).WithHistory(h.terminalHandler).WithPresence(h.terminalHandler).Handle(c)
 }
 
 // BroadcastOutput broadcasts terminal output to the session room
-func (h *SSEHandler) BroadcastOutput(sessionID string, output []byte) {
-	h.broadcaster.TerminalOutput(sessionID, output)
+func (h *SSEHandler) BroadcastOutput(sessionID string, output []byte, offset int64, commandID string) {
+	h.broadcaster.TerminalOutput(sessionID, output, offset, commandID)
 }
 
 // BroadcastStatus broadcasts terminal session status changes
@@ -0,0 +1,151 @@
+package terminal
+
+import (
+	"sync"
+
+	"github.com/mooncorn/nodelink/server/internal/common"
+)
+
+// subscriberBuffer is how many events a subscriber may fall behind before it is dropped
+const subscriberBuffer = 256
+
+// EventType identifies what a terminal event carries
+type EventType string
+
+const (
+	EventOutput EventType = "output" // raw terminal output in Data
+	EventStatus EventType = "status" // session status change, or detached
+	EventExit   EventType = "exit"   // the shell exited with ExitCode
+)
+
+// Event is delivered to direct subscribers of a terminal session
+type Event struct {
+	Type     EventType
+	Data     []byte
+	Status   string
+	Message  string
+	Detached bool
+	ExitCode int32
+}
+
+// subscribers fans terminal events out to per-session channels and keeps each
+// session's scrollback, so that a new subscriber sees every byte exactly once
+type subscribers struct {
+	sessions map[string]map[chan Event]struct{}
+	buffers  map[string]*scrollback
+	mu       sync.Mutex
+}
+
+// newSubscribers creates an empty subscriber registry
+func newSubscribers() *subscribers {
+	return &subscribers{
+		sessions: make(map[string]map[chan Event]struct{}),
+		buffers:  make(map[string]*scrollback),
+	}
+}
+
+// subscribe registers a channel for a session's events and returns the output
+// buffered before it. The channel is closed by the returned cancel function,
+// or early if the subscriber falls behind.
+func (s *subscribers) subscribe(sessionID string) ([]byte, <-chan Event, func()) {
+	ch := make(chan Event, subscriberBuffer)
+
+	s.mu.Lock()
+	var history []byte
+	if buffer, exists := s.buffers[sessionID]; exists {
+		history, _ = buffer.snapshot()
+	}
+	if s.sessions[sessionID] == nil {
+		s.sessions[sessionID] = make(map[chan Event]struct{})
+	}
+	s.sessions[sessionID][ch] = struct{}{}
+	s.mu.Unlock()
+
+	return history, ch, func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.remove(sessionID, ch)
+	}
+}
+
+// open starts keeping scrollback for a session
+func (s *subscribers) open(sessionID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.buffers[sessionID] = newScrollback(common.TerminalScrollbackSize)
+}
+
+// publishOutput adds output to the session's scrollback and delivers it to
+// every subscriber. It returns the total number of bytes written so far, zero
+// for sessions without scrollback.
+func (s *subscribers) publishOutput(sessionID string, data []byte) int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var total int64
+	if buffer, exists := s.buffers[sessionID]; exists {
+		buffer.write(data)
+		total = buffer.total
+	}
+
+	s.deliver(sessionID, Event{Type: EventOutput, Data: data})
+	return total
+}
+
+// publish delivers an event to every subscriber of a session
+func (s *subscribers) publish(sessionID string, event Event) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.deliver(sessionID, event)
+}
+
+// history returns a session's buffered output and the total written so far
+func (s *subscribers) history(sessionID string) ([]byte, int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	buffer, exists := s.buffers[sessionID]
+	if !exists {
+		return nil, 0
+	}
+	return buffer.snapshot()
+}
+
+// forget drops the scrollback of a closed session
+func (s *subscribers) forget(sessionID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.buffers, sessionID)
+}
+
+// deliver sends an event to each subscriber; the caller must hold the lock
+func (s *subscribers) deliver(sessionID string, event Event) {
+	for ch := range s.sessions[sessionID] {
+		select {
+		case ch <- event:
+		default:
+			// Dropping an event would corrupt the terminal, so drop the subscriber instead
+			s.remove(sessionID, ch)
+		}
+	}
+}
+
+// remove closes and unregisters a channel; the caller must hold the lock
+func (s *subscribers) remove(sessionID string, ch chan Event) {
+	channels, exists := s.sessions[sessionID]
+	if !exists {
+		return
+	}
+	if _, exists := channels[ch]; !exists {
+		return
+	}
+
+	delete(channels, ch)
+	close(ch)
+	if len(channels) == 0 {
+		delete(s.sessions, sessionID)
+	}
+}
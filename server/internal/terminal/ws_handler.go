@@ -0,0 +1,258 @@
+package terminal
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"github.com/mooncorn/nodelink/server/internal/auth"
+	"github.com/mooncorn/nodelink/server/internal/common"
+)
+
+const (
+	// wsWriteWait bounds how long a single frame may take to write
+	wsWriteWait = 10 * time.Second
+
+	// wsPongWait is how long the connection may stay silent; pings go out more often than that
+	wsPongWait   = 60 * time.Second
+	wsPingPeriod = wsPongWait * 9 / 10
+
+	// wsMaxMessageSize limits a single frame from the client, e.g. a paste
+	wsMaxMessageSize = 64 * 1024
+)
+
+// WSHandler serves interactive terminal sessions over WebSocket.
+//
+// Binary frames carry raw terminal bytes in both directions: keystrokes from
+// the client, output from the terminal. Text frames carry JSON control
+// messages. Clients send resize ({"type":"resize","rows":40,"cols":120}),
+// signal ({"type":"signal","signal":"SIGINT"}), detach ({"type":"detach"})
+// and close ({"type":"close"}), where close ends the session itself while
+// disconnecting or detaching leaves it running. Connecting reattaches a
+// detached session and replays its scrollback. The server sends status, exit
+// and error messages and closes the socket once the session is closed or
+// detached, or the user's access is revoked. The first status message carries
+// the user's role; observers can't send input, signals or resizes.
+type WSHandler struct {
+	terminalHandler *Handler
+	upgrader        websocket.Upgrader
+}
+
+// ControlMessage is a JSON control frame on a terminal WebSocket
+type ControlMessage struct {
+	Type     string `json:"type"` // resize, signal, detach, close, status, exit or error
+	Rows     int    `json:"rows,omitempty"`
+	Cols     int    `json:"cols,omitempty"`
+	Signal   string `json:"signal,omitempty"`
+	Status   string `json:"status,omitempty"`
+	Message  string `json:"message,omitempty"`
+	Detached bool   `json:"detached,omitempty"`
+	Role     string `json:"role,omitempty"`
+	ExitCode *int32 `json:"exit_code,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// NewWSHandler creates a new WebSocket handler for interactive terminals
+func NewWSHandler(terminalHandler *Handler) *WSHandler {
+	return &WSHandler{
+		terminalHandler: terminalHandler,
+		upgrader: websocket.Upgrader{
+			ReadBufferSize:  4096,
+			WriteBufferSize: 32 * 1024,
+			// The CORS middleware already rejects requests from unknown origins
+			CheckOrigin: func(r *http.Request) bool { return true },
+		},
+	}
+}
+
+// RegisterRoutes registers WebSocket routes for interactive terminals
+func (h *WSHandler) RegisterRoutes(router gin.IRouter) {
+	router.GET("/terminals/:sessionId/ws", h.handleWebSocket)
+}
+
+// handleWebSocket handles GET /terminals/:sessionId/ws
+func (h *WSHandler) handleWebSocket(c *gin.Context) {
+	sessionID := c.Param("sessionId")
+
+	// Browsers can't set headers on WebSocket requests, so user_id usually comes from the query
+	userID := auth.UserIDFromContext(c)
+	if userID == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User authentication required"})
+		return
+	}
+
+	// Subscribe first so a session closing meanwhile isn't missed
+	history, events, unsubscribe := h.terminalHandler.Subscribe(sessionID)
+	defer unsubscribe()
+
+	// Reject before upgrading so clients get a regular HTTP error
+	session, err := h.terminalHandler.AttachSession(c.Request.Context(), sessionID, userID)
+	if err != nil {
+		switch err {
+		case common.ErrTerminalSessionNotFound:
+			c.JSON(http.StatusNotFound, gin.H{"error": "Terminal session not found"})
+		case common.ErrUnauthorizedTerminalAccess:
+			c.JSON(http.StatusForbidden, gin.H{"error": "Unauthorized access to terminal session"})
+		case common.ErrTerminalSessionClosed:
+			c.JSON(http.StatusGone, gin.H{"error": "Terminal session is closed"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+	role := session.RoleOf(userID)
+
+	conn, err := h.upgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		// The upgrader has already responded
+		log.Printf("Failed to upgrade terminal WebSocket for session %s: %v", sessionID, err)
+		return
+	}
+	defer conn.Close()
+
+	// Start with the current state so clients can size their terminal before any output
+	conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+	if err := conn.WriteJSON(ControlMessage{Type: "status", Status: string(session.Status), Rows: session.Rows, Cols: session.Cols, Role: string(role)}); err != nil {
+		return
+	}
+	if len(history) > 0 {
+		if err := conn.WriteMessage(websocket.BinaryMessage, history); err != nil {
+			return
+		}
+	}
+
+	revoked, leave := h.terminalHandler.Join(sessionID, userID, "websocket")
+	defer leave()
+
+	replies := make(chan ControlMessage, 16)
+
+	done := make(chan struct{})
+	go h.readLoop(c, conn, sessionID, userID, replies, done)
+	h.writeLoop(conn, events, replies, revoked, done)
+}
+
+// readLoop forwards input and control messages from the client until the connection fails
+func (h *WSHandler) readLoop(c *gin.Context, conn *websocket.Conn, sessionID, userID string, replies chan<- ControlMessage, done chan<- struct{}) {
+	defer close(done)
+
+	conn.SetReadLimit(wsMaxMessageSize)
+	conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	})
+
+	ctx := c.Request.Context()
+	for {
+		messageType, data, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		conn.SetReadDeadline(time.Now().Add(wsPongWait))
+
+		if messageType == websocket.BinaryMessage {
+			err = h.terminalHandler.WriteInput(ctx, sessionID, userID, data)
+		} else {
+			err = h.handleControl(c, sessionID, userID, data)
+		}
+
+		if err != nil {
+			select {
+			case replies <- ControlMessage{Type: "error", Error: err.Error()}:
+			default:
+			}
+		}
+	}
+}
+
+// handleControl applies a control message sent by the client
+func (h *WSHandler) handleControl(c *gin.Context, sessionID, userID string, data []byte) error {
+	var control ControlMessage
+	if err := json.Unmarshal(data, &control); err != nil {
+		return common.ErrInvalidControlMessage
+	}
+
+	ctx := c.Request.Context()
+	switch control.Type {
+	case "resize":
+		return h.terminalHandler.ResizeTerminal(ctx, sessionID, userID, control.Rows, control.Cols)
+	case "signal":
+		return h.terminalHandler.SignalTerminal(ctx, sessionID, userID, control.Signal)
+	case "detach":
+		return h.terminalHandler.DetachSession(ctx, sessionID, userID)
+	case "close":
+		return h.terminalHandler.CloseTerminalSession(ctx, sessionID, userID)
+	default:
+		return common.ErrInvalidControlMessage
+	}
+}
+
+// writeLoop sends terminal events and replies to the client until the session
+// closes, the client disconnects or its access is revoked, or it falls too far behind
+func (h *WSHandler) writeLoop(conn *websocket.Conn, events <-chan Event, replies <-chan ControlMessage, revoked <-chan struct{}, done <-chan struct{}) {
+	ticker := time.NewTicker(wsPingPeriod)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case event, ok := <-events:
+			if !ok {
+				closeWebSocket(conn, websocket.CloseTryAgainLater, "Client fell behind terminal output")
+				return
+			}
+
+			if err := writeEvent(conn, event); err != nil {
+				return
+			}
+
+			if event.Type == EventStatus && event.Status == string(common.TerminalStatusClosed) {
+				closeWebSocket(conn, websocket.CloseNormalClosure, "Terminal session closed")
+				return
+			}
+			if event.Detached {
+				closeWebSocket(conn, websocket.CloseNormalClosure, "Terminal session detached")
+				return
+			}
+
+		case reply := <-replies:
+			conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+			if err := conn.WriteJSON(reply); err != nil {
+				return
+			}
+
+		case <-revoked:
+			closeWebSocket(conn, websocket.ClosePolicyViolation, "Access to terminal session revoked")
+			return
+
+		case <-ticker.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(wsWriteWait)); err != nil {
+				return
+			}
+
+		case <-done:
+			return
+		}
+	}
+}
+
+// writeEvent sends a terminal event as a binary or control frame
+func writeEvent(conn *websocket.Conn, event Event) error {
+	conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+
+	switch event.Type {
+	case EventOutput:
+		return conn.WriteMessage(websocket.BinaryMessage, event.Data)
+	case EventExit:
+		exitCode := event.ExitCode
+		return conn.WriteJSON(ControlMessage{Type: "exit", ExitCode: &exitCode})
+	default:
+		return conn.WriteJSON(ControlMessage{Type: "status", Status: event.Status, Message: event.Message, Detached: event.Detached})
+	}
+}
+
+// closeWebSocket sends a close frame with the given code and reason
+func closeWebSocket(conn *websocket.Conn, code int, reason string) {
+	conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, reason), time.Now().Add(wsWriteWait))
+}